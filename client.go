@@ -9,22 +9,71 @@ import (
 	"go-moq/pkg/session/control"
 	"go-moq/pkg/transport"
 	moqtquic "go-moq/pkg/transport/quic" // this alias is important to prevent confusion with "quic-go"
+	moqtwebtransport "go-moq/pkg/transport/webtransport"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 )
 
 const transportDialTimeout = 30       // time (seconds) limit to get a response to quic or WT dial.
 const transportOpenStreamTimeout = 10 // time limit to a request of opening a stream being accpeted.
 const maxUniStreams = 100             // Maximum number of concurrent unidirectional streams (incoming, because it's usually the server opening uni streams)
+const maxBidiStreams = 100            // Maximum number of concurrent bidirectional streams, one for every SUBSCRIBE_NAMESPACE of the server
 const defaultMaxIncomingRequestId = 1000
 const defaultMaxLocalTokenCacheSize = 0
 
 // MOQT Client functionality
 
 type Client struct {
-	// Right now this is empty, but it might be needed in the future to hold things like auth tokens etc.
+	mu     sync.Mutex
+	dialer *webtransport.Dialer // Shared by the WebTransport sessions of the client, nil until the first one is dialed
+}
+
+// The QUIC connection the Dialer establishes for a Dial, found in the context of the Dial.
+// Dial doesn't close it when it fails after the connection was established, so we do.
+type dialedConnKey struct{}
+
+// Returns the Dialer of the WebTransport sessions, it is created on first use.
+func (c *Client) webTransportDialer() *webtransport.Dialer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dialer == nil {
+		c.dialer = &webtransport.Dialer{
+			TLSClientConfig: &tls.Config{
+				NextProtos: []string{http3.NextProtoH3}, // ALPN is HTTP/3, MOQT is negotiated with the WT-Available-Protocols header
+			},
+			QUICConfig: &quic.Config{
+				EnableDatagrams:       true,          // Required by WebTransport, and by MOQT itself.
+				MaxIncomingUniStreams: maxUniStreams, // Temporary hard limit.
+			},
+			DialAddr: func(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (*quic.Conn, error) {
+				qConn, err := quic.DialAddrEarly(ctx, addr, tlsConf, quicConf)
+				if dialed, ok := ctx.Value(dialedConnKey{}).(**quic.Conn); ok {
+					*dialed = qConn
+				}
+				return qConn, err
+			},
+		}
+	}
+	return c.dialer
+}
+
+// Close releases the Dialer of the WebTransport sessions. The sessions that were established are closed on their own,
+// a WebTransport session can't be dialed after Close.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dialer == nil {
+		return nil
+	}
+	return c.dialer.Close()
 }
 
 // Establish a transport with the fiven URI
@@ -45,9 +94,9 @@ func (c *Client) Connect(uri string) (transport.MOQTConnection, error) {
 		}
 
 		quicConf := &quic.Config{
-			EnableDatagrams:       true,          // The QUIC Datagram extension MUST be supported. [Cite: Section 3.1]
-			MaxIncomingStreams:    1,             // Only 1 bidirectional stream allowed that is the control stream.
-			MaxIncomingUniStreams: maxUniStreams, // Temporary hard limit.
+			EnableDatagrams:       true,           // The QUIC Datagram extension MUST be supported. [Cite: Section 3.1]
+			MaxIncomingStreams:    maxBidiStreams, // The client opens the control stream, the server only opens SUBSCRIBE_NAMESPACE streams.
+			MaxIncomingUniStreams: maxUniStreams,  // Temporary hard limit.
 		}
 
 		// 2. Dial the QUIC Connection
@@ -64,9 +113,26 @@ func (c *Client) Connect(uri string) (transport.MOQTConnection, error) {
 		return &moqtquic.Connection{Conn: qConn}, nil
 
 	case "https": // WebTransport Connection
-		// TODO: Implement webtransport connection
 		// The client performs an HTTP/3 CONNECT request. It MUST include the header WT-Available-Protocols: moqt-15
-		return nil, nil
+		header := http.Header{}
+		header.Set(moqtwebtransport.HeaderAvailableProtocols, moqtwebtransport.ProtocolHeaderValue())
+
+		var qConn *quic.Conn
+		rsp, wtSess, err := c.webTransportDialer().Dial(context.WithValue(ctx, dialedConnKey{}, &qConn), uri, header)
+		if err != nil {
+			if qConn != nil {
+				qConn.CloseWithError(0, "WebTransport session was not established")
+			}
+			return nil, fmt.Errorf("Client.Connect(): Failed to establish WebTransport session: %w", err)
+		}
+
+		// The server confirms the protocol it selected, anything but MOQT means we can't talk to it.
+		if !moqtwebtransport.OffersProtocol(rsp.Header.Values(moqtwebtransport.HeaderProtocol)) {
+			wtSess.CloseWithError(0, "moqt-15 was not selected")
+			qConn.CloseWithError(0, "moqt-15 was not selected")
+			return nil, fmt.Errorf("Client.Connect(): Server did not select %s as the WebTransport protocol", moqtwebtransport.Protocol)
+		}
+		return &moqtwebtransport.Connection{Session: wtSess}, nil
 
 	default:
 		return nil, fmt.Errorf("Client.Connect(): Unsupported URI scheme: %s", u.Scheme)
@@ -151,7 +217,9 @@ func (c *Client) performHandshake(sess *session.Session, setupParams []model.Moq
 	}
 
 	// Populate session state's peer values from obtained parameters in SERVER_SETUP
-	sess.State.FromParams(serverSetupMsg.Parameters)
+	if err := sess.State.FromParams(serverSetupMsg.Parameters); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -171,12 +239,7 @@ func (c *Client) InitiateSession(conn transport.MOQTConnection, setupParams []mo
 		// ex: if MOQT_SESSION_TERMINATION_ERROR_CODE == MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION // caller can distinguish between general error and a protocol violation error
 	}
 
-	sess := &session.Session{
-		State:         session.NewSessionState(session.RoleClient, defaultMaxIncomingRequestId, defaultMaxLocalTokenCacheSize),
-		Conn:          conn,
-		ControlStream: s,
-		Cmf:           control.NewControlMessageFactory(s),
-	}
+	sess := session.NewSession(conn, s, session.NewSessionState(session.RoleClient, defaultMaxIncomingRequestId, defaultMaxLocalTokenCacheSize))
 
 	err = c.performHandshake(sess, setupParams)
 	if err != nil {
@@ -184,3 +247,30 @@ func (c *Client) InitiateSession(conn transport.MOQTConnection, setupParams []mo
 	}
 	return sess, nil
 }
+
+// Reconnect establishes the session that replaces one the server sent GOAWAY on, at the New Session URI of the GOAWAY.
+// When the server didn't give one, uri (usually the URI of the current session) is used, as the client reconnects to the current URI in that case.
+// The old session is left open so in-flight subscriptions can finish, the caller closes it once it's done with it.
+func (c *Client) Reconnect(old *session.Session, uri string, setupParams []model.MoqtKeyValuePair) (*session.Session, error) {
+	select {
+	case <-old.GoingAway():
+	default:
+		return nil, fmt.Errorf("Client.Reconnect(): The server didn't send GOAWAY")
+	}
+
+	if newURI := old.NewSessionURI(); newURI != "" {
+		uri = newURI
+	}
+
+	conn, err := c.Connect(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Client.Reconnect(): Failed to connect to %s: %w", uri, err)
+	}
+
+	sess, err := c.InitiateSession(conn, setupParams)
+	if err != nil {
+		conn.CloseWithError(uint64(model.MOQT_SESSION_TERMINATION_ERROR_CODE_INTERNAL_ERROR), "Handshake failed")
+		return nil, fmt.Errorf("Client.Reconnect(): Failed to initiate session with %s: %w", uri, err)
+	}
+	return sess, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go-moq"
 	"go-moq/internal"
 	"go-moq/pkg/model"
@@ -8,6 +9,7 @@ import (
 )
 func main() {
     client := moqt.Client{}
+    defer client.Close()
 
     // Ensure the Connect function uses the updated quicConf with MaxIncomingStreams!
     conn, err := client.Connect("moqt://localhost:4443")
@@ -21,8 +23,8 @@ func main() {
     if err != nil {
         panic(err)
     }
-    _ = sess
-    // Keep the client alive long enough to receive a response or for the server to process it
-    // In a real app, you'd be reading from the stream or using a context.
-    select {} 
+    // Run the control message loop, this keeps the client alive until the session terminates
+    if err := sess.Run(context.Background()); err != nil {
+        panic(err)
+    }
 }
\ No newline at end of file
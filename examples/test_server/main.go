@@ -15,6 +15,7 @@ import (
 func main() {
     srv := moqt.Server{
         MaxUniStreamsPerConn:        100,
+        MaxBidiStreamsPerConn:       100,
         WaitForControlStreamTimeout: 10 * time.Second, // 10 seconds until receiving a control stream open request
     }
 
@@ -46,6 +47,10 @@ func main() {
                 return
             }
             fmt.Printf("Session initiated with %s\n", sess.Conn.RemoteHost())
+
+            // Run the control message loop until the session terminates
+            err = sess.Run(ctx)
+            fmt.Printf("Session with %s terminated: %v\n", sess.Conn.RemoteHost(), err)
         }(conn)
     }
 }
\ No newline at end of file
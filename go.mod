@@ -5,10 +5,13 @@ go 1.24.9
 require (
 	github.com/LukaGiorgadze/gonull/v2 v2.1.0
 	github.com/quic-go/quic-go v0.56.0
+	github.com/quic-go/webtransport-go v0.9.0
 )
 
 require (
+	github.com/quic-go/qpack v0.5.1 // indirect
 	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 )
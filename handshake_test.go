@@ -0,0 +1,222 @@
+package moqt
+
+import (
+	"context"
+	"errors"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"go-moq/pkg/session/control"
+	moqtmemory "go-moq/pkg/transport/memory"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func param(t *testing.T, typ uint64, value any) model.MoqtKeyValuePair {
+	t.Helper()
+	p, err := model.NewMoqtKeyValuePair(typ, value)
+	if err != nil {
+		t.Fatalf("NewMoqtKeyValuePair(%#x) unexpected error: %v", typ, err)
+	}
+	return p
+}
+
+type handshakeResult struct {
+	clientSess *session.Session
+	clientErr  error
+	serverSess *session.Session
+	serverErr  error
+}
+
+// Runs Client.InitiateSession against Server.InitateSession over an in-memory connection.
+// clientWT and serverWT make the respective end report that it is a WebTransport session.
+func handshake(t *testing.T, server *Server, clientParams []model.MoqtKeyValuePair, serverParams []model.MoqtKeyValuePair, clientWT bool, serverWT bool) handshakeResult {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+
+	clientConn, serverConn := moqtmemory.NewPair()
+	clientConn.WebTransport = clientWT
+	serverConn.WebTransport = serverWT
+	t.Cleanup(func() { clientConn.CloseWithError(0, "") })
+	if server.WaitForControlStreamTimeout == 0 {
+		server.WaitForControlStreamTimeout = time.Second
+	}
+
+	var res handshakeResult
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res.serverSess, res.serverErr = server.InitateSession(ctx, serverConn, serverParams)
+	}()
+	res.clientSess, res.clientErr = (&Client{}).InitiateSession(clientConn, clientParams)
+	if res.clientErr != nil {
+		// The server may still wait for a CLIENT_SETUP that never comes
+		clientConn.CloseWithError(0, "Handshake failed")
+	}
+	<-done
+	return res
+}
+
+// Reports whether err is the connection being closed by the peer with code.
+func closedWith(err error, code model.MOQT_SESSION_TERMINATION_ERROR_CODE) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == quic.ApplicationErrorCode(code)
+}
+
+func TestHandshake(t *testing.T) {
+	clientParams := []model.MoqtKeyValuePair{
+		param(t, control.SetupParamPath, []byte("/moq")),
+		param(t, control.SetupParamAuthority, []byte("relay.example.com")),
+		param(t, control.SetupParamMaxRequestID, uint64(50)),
+		param(t, control.SetupParamMoqtImplementation, []byte("go-moq-client")),
+	}
+	serverParams := []model.MoqtKeyValuePair{
+		param(t, control.SetupParamMaxRequestID, uint64(20)),
+		param(t, control.SetupParamMaxAuthTokenCacheSize, uint64(4096)),
+	}
+
+	res := handshake(t, &Server{}, clientParams, serverParams, false, false)
+	if res.clientErr != nil || res.serverErr != nil {
+		t.Fatalf("Handshake unexpected errors: client %v, server %v", res.clientErr, res.serverErr)
+	}
+
+	server := res.serverSess.State
+	if server.Path != "/moq" || server.Authority != "relay.example.com" {
+		t.Errorf("Server got Path = %q, Authority = %q, want %q, %q", server.Path, server.Authority, "/moq", "relay.example.com")
+	}
+	if server.MaxOutgoingRequestID != 50 || server.PeerImplementation != "go-moq-client" {
+		t.Errorf("Server got MaxOutgoingRequestID = %d, PeerImplementation = %q, want 50, %q", server.MaxOutgoingRequestID, server.PeerImplementation, "go-moq-client")
+	}
+	if server.MaxIncomingRequestID != 20 {
+		t.Errorf("Server MaxIncomingRequestID = %d, want 20", server.MaxIncomingRequestID)
+	}
+
+	client := res.clientSess.State
+	if client.MaxOutgoingRequestID != 20 || client.PeerMaxTokenCacheSize != 4096 {
+		t.Errorf("Client got MaxOutgoingRequestID = %d, PeerMaxTokenCacheSize = %d, want 20, 4096", client.MaxOutgoingRequestID, client.PeerMaxTokenCacheSize)
+	}
+	if client.MaxIncomingRequestID != 50 {
+		t.Errorf("Client MaxIncomingRequestID = %d, want 50", client.MaxIncomingRequestID)
+	}
+}
+
+func TestHandshakePathAndAuthority(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientParam  uint64 // Sent by the client, 0 for none
+		serverParam  uint64 // Sent by the server, 0 for none
+		clientWT     bool
+		serverWT     bool
+		wantLocalErr bool                                      // The client refuses to send the parameter
+		wantCode     model.MOQT_SESSION_TERMINATION_ERROR_CODE // The session is closed with, 0 if the handshake succeeds
+	}{
+		{name: "path over QUIC", clientParam: control.SetupParamPath},
+		{name: "authority over QUIC", clientParam: control.SetupParamAuthority},
+		{name: "path over WebTransport", clientParam: control.SetupParamPath, clientWT: true, serverWT: true, wantLocalErr: true},
+		{name: "authority over WebTransport", clientParam: control.SetupParamAuthority, clientWT: true, serverWT: true, wantLocalErr: true},
+		{name: "path received over WebTransport", clientParam: control.SetupParamPath, serverWT: true, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH},
+		{name: "authority received over WebTransport", clientParam: control.SetupParamAuthority, serverWT: true, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_AUTHORITY},
+		{name: "path from the server", serverParam: control.SetupParamPath, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH},
+		{name: "authority from the server", serverParam: control.SetupParamAuthority, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_AUTHORITY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var clientParams, serverParams []model.MoqtKeyValuePair
+			if tt.clientParam != 0 {
+				clientParams = append(clientParams, param(t, tt.clientParam, []byte("value")))
+			}
+			if tt.serverParam != 0 {
+				serverParams = append(serverParams, param(t, tt.serverParam, []byte("value")))
+			}
+
+			res := handshake(t, &Server{}, clientParams, serverParams, tt.clientWT, tt.serverWT)
+			switch {
+			case tt.wantLocalErr:
+				var termErr model.MOQT_SESSION_TERMINATION_ERROR
+				if res.clientErr == nil || errors.As(res.clientErr, &termErr) {
+					t.Errorf("Client error = %v, want it to refuse the parameter before sending CLIENT_SETUP", res.clientErr)
+				}
+				if res.serverErr == nil {
+					t.Errorf("Server unexpectedly completed the handshake without CLIENT_SETUP")
+				}
+
+			case tt.wantCode != 0 && tt.serverParam != 0:
+				// The client detects the violation in SERVER_SETUP
+				var termErr model.MOQT_SESSION_TERMINATION_ERROR
+				if !errors.As(res.clientErr, &termErr) || termErr.ErrorCode != tt.wantCode {
+					t.Errorf("Client error = %v, want termination code %#x", res.clientErr, uint64(tt.wantCode))
+				}
+
+			case tt.wantCode != 0:
+				// The server detects the violation in CLIENT_SETUP and closes the connection with it
+				var termErr model.MOQT_SESSION_TERMINATION_ERROR
+				if !errors.As(res.serverErr, &termErr) || termErr.ErrorCode != tt.wantCode {
+					t.Errorf("Server error = %v, want termination code %#x", res.serverErr, uint64(tt.wantCode))
+				}
+				if !closedWith(res.clientErr, tt.wantCode) {
+					t.Errorf("Client error = %v, want the connection closed with %#x", res.clientErr, uint64(tt.wantCode))
+				}
+
+			default:
+				if res.clientErr != nil || res.serverErr != nil {
+					t.Errorf("Handshake unexpected errors: client %v, server %v", res.clientErr, res.serverErr)
+				}
+			}
+		})
+	}
+}
+
+// Admits clients with the "setup" token on the path "/allowed".
+type setupAuthorizer struct{}
+
+func (setupAuthorizer) AuthorizeSetup(req *session.AuthRequest) error {
+	if req.State.Path != "/allowed" {
+		return model.MOQT_SESSION_TERMINATION_ERROR{ErrorCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH, ReasonPhrase: model.NewReasonPhrase("Unknown path")}
+	}
+	if len(req.Tokens) != 1 || string(req.Tokens[0].Value) != "setup" {
+		return errors.New("no setup token")
+	}
+	return nil
+}
+
+func (setupAuthorizer) AuthorizeRequest(req *session.AuthRequest) error {
+	return nil
+}
+
+func TestHandshakeAuthorizer(t *testing.T) {
+	token := control.AuthToken{AliasType: control.AuthTokenUseValue, Value: []byte("setup")}.ToParam()
+	path := param(t, control.SetupParamPath, []byte("/allowed"))
+
+	tests := []struct {
+		name         string
+		clientParams []model.MoqtKeyValuePair
+		wantCode     model.MOQT_SESSION_TERMINATION_ERROR_CODE // 0 if the client is admitted
+	}{
+		{name: "admitted", clientParams: []model.MoqtKeyValuePair{path, token}},
+		{name: "no token", clientParams: []model.MoqtKeyValuePair{path}, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNAUTHORIZED},
+		{name: "own code", clientParams: []model.MoqtKeyValuePair{param(t, control.SetupParamPath, []byte("/other")), token}, wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := handshake(t, &Server{Authorizer: setupAuthorizer{}}, tt.clientParams, nil, false, false)
+			if tt.wantCode == 0 {
+				if res.clientErr != nil || res.serverErr != nil {
+					t.Fatalf("Handshake unexpected errors: client %v, server %v", res.clientErr, res.serverErr)
+				}
+				return
+			}
+
+			var termErr model.MOQT_SESSION_TERMINATION_ERROR
+			if !errors.As(res.serverErr, &termErr) || termErr.ErrorCode != tt.wantCode {
+				t.Errorf("Server error = %v, want termination code %#x", res.serverErr, uint64(tt.wantCode))
+			}
+			if !closedWith(res.clientErr, tt.wantCode) {
+				t.Errorf("Client error = %v, want the connection closed with %#x", res.clientErr, uint64(tt.wantCode))
+			}
+		})
+	}
+}
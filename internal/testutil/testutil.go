@@ -0,0 +1,55 @@
+package testutil
+
+import (
+	"context"
+	"go-moq/pkg/model"
+	"go-moq/pkg/transport"
+	moqtmemory "go-moq/pkg/transport/memory"
+	"testing"
+	"time"
+)
+
+// Fixtures shared by the tests of the session and the relay, over the in-memory transport.
+// It doesn't import the session package, so the tests inside of it can use it as well.
+
+// Pair is both ends of an in-memory connection whose control stream is already open.
+type Pair struct {
+	ClientConn   *moqtmemory.Connection
+	ServerConn   *moqtmemory.Connection
+	ClientStream transport.Stream // The control stream, opened by the client
+	ServerStream transport.Stream
+}
+
+// NewPair connects a client and a server in memory and opens the control stream, the handshake is left to the caller.
+func NewPair(t *testing.T) Pair {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientConn, serverConn := moqtmemory.NewPair()
+	clientStream, err := clientConn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync() unexpected error: %v", err)
+	}
+	serverStream, err := serverConn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() unexpected error: %v", err)
+	}
+	return Pair{ClientConn: clientConn, ServerConn: serverConn, ClientStream: clientStream, ServerStream: serverStream}
+}
+
+// Context returns a context that is cancelled after 2 seconds or when the test ends.
+func Context(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// FullTrackName returns the track with the given name in the namespace made of the ns fields.
+func FullTrackName(name string, ns ...string) model.MoqtFullTrackName {
+	namespace := model.MoqtTrackNamespace{}
+	for _, field := range ns {
+		namespace = append(namespace, []byte(field))
+	}
+	return model.MoqtFullTrackName{Namespace: namespace, Name: []byte(name)}
+}
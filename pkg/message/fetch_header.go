@@ -0,0 +1,105 @@
+package message
+
+import "fmt"
+
+// Used to deliver the objects of a FETCH. All objects of the fetch are sent on a single unidirectional stream,
+// which starts with a FETCH_HEADER and continues with the objects in the order requested by the subscriber.
+
+// FETCH_HEADER {
+//   Type (i) = 0x5,
+//   Request ID (i),
+// }
+
+// Objects on a fetch stream:
+// {
+//   Serialization Flags (i),
+//   [Group ID (i),]
+//   [Subgroup ID (i),]
+//   [Object ID (i),]
+//   [Publisher Priority (8),]
+//   [Extensions (..),]
+//   Object Payload Length (i),
+//   [Object Status (i),]
+//   Object Payload (..),
+// }
+
+// Unlike subgroup streams, every object tells which of its fields are present with its Serialization Flags.
+// Omitted fields are derived from the prior object on the stream, so the first object MUST NOT omit any of them.
+
+// Bit Mask		Hex		Logic Type		Meaning
+// Bit 0-1		0x03	Enum			0b00: Subgroup ID is 0, 0b01: prior Subgroup ID, 0b10: prior Subgroup ID + 1, 0b11: Subgroup ID present
+// Bit 2		0x04	Normal			Object ID present, otherwise prior Object ID + 1
+// Bit 3		0x08	Normal			Group ID present, otherwise prior Group ID
+// Bit 4		0x10	Normal			Publisher Priority present, otherwise prior Publisher Priority
+// Bit 5		0x20	Normal			Extensions present
+// Bit 6+				Reserved		Any other value is a PROTOCOL_VIOLATION, except the End of Range markers below
+
+const FetchHeaderType uint64 = 0x05
+
+const (
+	fetchMaskSubgroupMode      = 0x03  // Bit 0-1: 0000 0011
+	fetchFlagObjectIdPresent   = 0x04  // Bit 2: 0000 0100
+	fetchFlagGroupIdPresent    = 0x08  // Bit 3: 0000 1000
+	fetchFlagPriorityPresent   = 0x10  // Bit 4: 0001 0000
+	fetchFlagExtensionsPresent = 0x20  // Bit 5: 0010 0000
+	fetchMaxSerializationFlags = 0x3F  // Largest value made of the bits above
+	fetchEndOfNonExistentRange = 0x8C  // Marker: no objects exist up to the given Group ID and Object ID
+	fetchEndOfUnknownRange     = 0x10C // Marker: the publisher doesn't know about objects up to the given Group ID and Object ID
+)
+
+// FetchSubgroupMode tells how the Subgroup ID of an object on a fetch stream is determined, it is encoded in bits 0-1 of the flags.
+type FetchSubgroupMode uint64
+
+const (
+	FetchSubgroupZero         FetchSubgroupMode = 0x0
+	FetchSubgroupPrior        FetchSubgroupMode = 0x1
+	FetchSubgroupPriorPlusOne FetchSubgroupMode = 0x2
+	FetchSubgroupPresent      FetchSubgroupMode = 0x3
+)
+
+// FetchObjectFlags are the Serialization Flags of a single object on a fetch stream.
+type FetchObjectFlags struct {
+	SubgroupMode      FetchSubgroupMode
+	ObjectIdPresent   bool
+	GroupIdPresent    bool
+	PriorityPresent   bool
+	ExtensionsPresent bool
+}
+
+// Here we apply the bitmask, End of Range markers are not objects and must be checked for before.
+func NewFetchObjectFlags(flags uint64) (*FetchObjectFlags, error) {
+	if flags > fetchMaxSerializationFlags {
+		return &FetchObjectFlags{}, fmt.Errorf("invalid fetch object serialization flags: 0x%x", flags)
+	}
+
+	return &FetchObjectFlags{
+		SubgroupMode:      FetchSubgroupMode(flags & fetchMaskSubgroupMode),
+		ObjectIdPresent:   (flags & fetchFlagObjectIdPresent) != 0,
+		GroupIdPresent:    (flags & fetchFlagGroupIdPresent) != 0,
+		PriorityPresent:   (flags & fetchFlagPriorityPresent) != 0,
+		ExtensionsPresent: (flags & fetchFlagExtensionsPresent) != 0,
+	}, nil
+}
+
+func (ff *FetchObjectFlags) ToUInt64() uint64 {
+	flags := uint64(ff.SubgroupMode)
+
+	if ff.ObjectIdPresent {
+		flags |= fetchFlagObjectIdPresent
+	}
+	if ff.GroupIdPresent {
+		flags |= fetchFlagGroupIdPresent
+	}
+	if ff.PriorityPresent {
+		flags |= fetchFlagPriorityPresent
+	}
+	if ff.ExtensionsPresent {
+		flags |= fetchFlagExtensionsPresent
+	}
+	return flags
+}
+
+// Reports whether the flags value is an End of Range marker instead of an object.
+func isFetchEndOfRange(flags uint64) bool {
+	return flags == fetchEndOfNonExistentRange || flags == fetchEndOfUnknownRange
+}
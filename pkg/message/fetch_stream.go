@@ -0,0 +1,264 @@
+package message
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/transport"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// FetchWriter writes the objects of a fetch to a unidirectional stream.
+// Fields that can be derived from the prior object are omitted. It is not safe for concurrent use.
+type FetchWriter struct {
+	stream    transport.SendStream
+	requestId uint64
+
+	written bool             // Whether at least one object was written
+	prior   model.MoqtObject // The last written object, valid if written is true
+
+	buf []byte // Reused between objects
+}
+
+// Opens the fetch stream by writing the FETCH_HEADER.
+func NewFetchWriter(stream transport.SendStream, requestId uint64) (*FetchWriter, error) {
+	fw := &FetchWriter{
+		stream:    stream,
+		requestId: requestId,
+		buf:       make([]byte, 0, 64),
+	}
+
+	EncodeFetchHeader(&fw.buf, requestId)
+	if _, err := stream.Write(fw.buf); err != nil {
+		return nil, fmt.Errorf("FetchWriter: failed to write FETCH_HEADER: %w", err)
+	}
+	return fw, nil
+}
+
+func (fw *FetchWriter) RequestID() uint64 {
+	return fw.requestId
+}
+
+// Picks the smallest serialization of the object relative to the prior one.
+func (fw *FetchWriter) flagsFor(obj *model.MoqtObject) *FetchObjectFlags {
+	flags := &FetchObjectFlags{
+		GroupIdPresent:    true,
+		ObjectIdPresent:   true,
+		PriorityPresent:   true,
+		ExtensionsPresent: len(obj.ExtensionHeaders) > 0,
+		SubgroupMode:      FetchSubgroupPresent,
+	}
+	if obj.SubgroupID == 0 {
+		flags.SubgroupMode = FetchSubgroupZero
+	}
+	if !fw.written {
+		return flags // Nothing to derive from
+	}
+
+	flags.GroupIdPresent = obj.Location.GroupId != fw.prior.Location.GroupId
+	flags.ObjectIdPresent = obj.Location.ObjectId != fw.prior.Location.ObjectId+1
+	flags.PriorityPresent = obj.PublisherPriority != fw.prior.PublisherPriority
+
+	switch {
+	case obj.SubgroupID == 0:
+	case obj.SubgroupID == fw.prior.SubgroupID:
+		flags.SubgroupMode = FetchSubgroupPrior
+	case obj.SubgroupID == fw.prior.SubgroupID+1:
+		flags.SubgroupMode = FetchSubgroupPriorPlusOne
+	}
+	return flags
+}
+
+// WriteObject writes the next object of the fetch.
+func (fw *FetchWriter) WriteObject(obj *model.MoqtObject) error {
+	fw.buf = fw.buf[:0]
+	EncodeFetchObjectHeader(&fw.buf, fw.flagsFor(obj), obj)
+	if _, err := fw.stream.Write(fw.buf); err != nil {
+		return fmt.Errorf("FetchWriter: failed to write object header: %w", err)
+	}
+	if len(obj.Payload) > 0 {
+		if _, err := fw.stream.Write(obj.Payload); err != nil {
+			return fmt.Errorf("FetchWriter: failed to write object payload: %w", err)
+		}
+	}
+
+	fw.written = true
+	fw.prior = *obj
+	return nil
+}
+
+// Close gracefully finishes the fetch (FIN), telling the subscriber every object was delivered.
+func (fw *FetchWriter) Close() error {
+	return fw.stream.Close()
+}
+
+// Cancel abruptly terminates the fetch with the given stream reset code.
+func (fw *FetchWriter) Cancel(code quic.StreamErrorCode) {
+	fw.stream.CancelWrite(code)
+}
+
+// FetchReader reads the objects of a fetch from a unidirectional stream.
+// It is not safe for concurrent use.
+type FetchReader struct {
+	stream    *BufferedReceiveStream
+	requestId uint64
+
+	read  bool             // Whether at least one object was read
+	prior model.MoqtObject // The last read object, valid if read is true
+}
+
+// Reads the FETCH_HEADER from the stream, including the stream type.
+func NewFetchReader(stream transport.ReceiveStream) (*FetchReader, error) {
+	bs := NewBufferedReceiveStream(stream)
+
+	typeId, err := quicvarint.Read(bs)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReader: failed to read stream type: %w", err)
+	}
+	return NewFetchReaderWithType(bs, typeId)
+}
+
+// Reads the rest of the FETCH_HEADER, for callers that already consumed the stream type to tell the kind of the data stream.
+func NewFetchReaderWithType(stream *BufferedReceiveStream, typeId uint64) (*FetchReader, error) {
+	if typeId != FetchHeaderType {
+		return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Invalid FETCH_HEADER type: %#X", typeId)),
+		}
+	}
+
+	requestId, err := quicvarint.Read(stream)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReader: failed to read Request ID: %w", unexpectedEOF(err))
+	}
+	return &FetchReader{stream: stream, requestId: requestId}, nil
+}
+
+// RequestID returns the Request ID of the FETCH the stream answers.
+func (fr *FetchReader) RequestID() uint64 {
+	return fr.requestId
+}
+
+// ReadObject returns the next object of the fetch, io.EOF is returned when the publisher finished the fetch.
+// End of Range markers are consumed silently, they only tell the subscriber which objects it won't receive.
+// Like SubgroupReader.ReadObject, the returned object has no FullTrackName.
+func (fr *FetchReader) ReadObject() (*model.MoqtObject, error) {
+	for {
+		rawFlags, err := quicvarint.Read(fr.stream)
+		if err != nil {
+			return nil, err // io.EOF at an object boundary is the clean end of the fetch
+		}
+
+		if isFetchEndOfRange(rawFlags) {
+			if err := fr.readEndOfRange(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		flags, err := NewFetchObjectFlags(rawFlags)
+		if err != nil {
+			return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+				ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Invalid fetch object Serialization Flags: %#X", rawFlags)),
+			}
+		}
+		return fr.readObject(flags)
+	}
+}
+
+func (fr *FetchReader) readObject(flags *FetchObjectFlags) (*model.MoqtObject, error) {
+	// Referencing a prior object that doesn't exist is a PROTOCOL_VIOLATION
+	if !fr.read && (!flags.GroupIdPresent || !flags.ObjectIdPresent || !flags.PriorityPresent ||
+		flags.SubgroupMode == FetchSubgroupPrior || flags.SubgroupMode == FetchSubgroupPriorPlusOne) {
+		return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("First object of a fetch stream refers to a prior object"),
+		}
+	}
+
+	var err error
+	groupId := fr.prior.Location.GroupId
+	if flags.GroupIdPresent {
+		if groupId, err = quicvarint.Read(fr.stream); err != nil {
+			return nil, fmt.Errorf("FetchReader: failed to read Group ID: %w", unexpectedEOF(err))
+		}
+	}
+
+	var subgroupId uint64
+	switch flags.SubgroupMode {
+	case FetchSubgroupPrior:
+		subgroupId = fr.prior.SubgroupID
+	case FetchSubgroupPriorPlusOne:
+		subgroupId = fr.prior.SubgroupID + 1
+	case FetchSubgroupPresent:
+		if subgroupId, err = quicvarint.Read(fr.stream); err != nil {
+			return nil, fmt.Errorf("FetchReader: failed to read Subgroup ID: %w", unexpectedEOF(err))
+		}
+	}
+
+	objectId := fr.prior.Location.ObjectId + 1
+	if flags.ObjectIdPresent {
+		if objectId, err = quicvarint.Read(fr.stream); err != nil {
+			return nil, fmt.Errorf("FetchReader: failed to read Object ID: %w", unexpectedEOF(err))
+		}
+	}
+
+	priority := fr.prior.PublisherPriority
+	if flags.PriorityPresent {
+		if priority, err = fr.stream.ReadByte(); err != nil {
+			return nil, fmt.Errorf("FetchReader: failed to read Publisher Priority: %w", unexpectedEOF(err))
+		}
+	}
+
+	var extensions []model.MoqtKeyValuePair
+	if flags.ExtensionsPresent {
+		if extensions, err = readExtensions(fr.stream); err != nil {
+			return nil, fmt.Errorf("FetchReader: failed to read Extensions: %w", err)
+		}
+	}
+
+	status, payload, err := readObjectPayload(fr.stream)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReader: %w", err)
+	}
+
+	obj, err := model.NewMoqtObject(
+		model.MoqtLocation{GroupId: groupId, ObjectId: objectId},
+		subgroupId,
+		model.MoqtFullTrackName{},
+		priority,
+		model.Subgroup,
+		status,
+		extensions,
+		payload,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fr.read = true
+	fr.prior = *obj
+	return obj, nil
+}
+
+// End of Range markers carry a Group ID and an Object ID, which become the prior location of the next object.
+func (fr *FetchReader) readEndOfRange() error {
+	groupId, err := quicvarint.Read(fr.stream)
+	if err != nil {
+		return fmt.Errorf("FetchReader: failed to read End of Range Group ID: %w", unexpectedEOF(err))
+	}
+	objectId, err := quicvarint.Read(fr.stream)
+	if err != nil {
+		return fmt.Errorf("FetchReader: failed to read End of Range Object ID: %w", unexpectedEOF(err))
+	}
+
+	fr.prior.Location = model.MoqtLocation{GroupId: groupId, ObjectId: objectId}
+	return nil
+}
+
+// Cancel tells the publisher to stop sending the fetch (STOP_SENDING).
+func (fr *FetchReader) Cancel(code quic.StreamErrorCode) {
+	fr.stream.CancelRead(code)
+}
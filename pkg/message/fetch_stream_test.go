@@ -0,0 +1,121 @@
+package message
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"go-moq/internal"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestFetchStreamRoundTrip(t *testing.T) {
+	ext := []model.MoqtKeyValuePair{
+		internal.Must(model.NewMoqtKeyValuePair(0x02, uint64(9))),
+	}
+	newObject := func(group, subgroup, object uint64, priority uint8, status model.MoqtObjectStatus, ext []model.MoqtKeyValuePair, payload []byte) *model.MoqtObject {
+		return internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: group, ObjectId: object}, subgroup, model.MoqtFullTrackName{}, priority, model.Subgroup, status, ext, payload))
+	}
+
+	// Exercises every way a field can be derived from the prior object
+	objects := []*model.MoqtObject{
+		newObject(1, 0, 0, 5, model.Normal, ext, []byte("a")),
+		newObject(1, 0, 1, 5, model.Normal, nil, []byte("b")),   // Object ID + 1, same group, same priority
+		newObject(1, 3, 4, 5, model.Normal, nil, []byte("c")),   // Subgroup and Object ID present
+		newObject(1, 3, 5, 7, model.Normal, nil, []byte("d")),   // Prior subgroup, new priority
+		newObject(1, 4, 6, 7, model.Normal, nil, []byte("e")),   // Prior subgroup + 1
+		newObject(2, 0, 0, 7, model.EndOfGroup, nil, nil),       // New group, status
+		newObject(5, 1, 0, 1, model.Normal, nil, []byte("fin")), // Gap in groups
+	}
+
+	stream := &bufferStream{}
+	fw, err := NewFetchWriter(stream, 12)
+	if err != nil {
+		t.Fatalf("NewFetchWriter() unexpected error: %v", err)
+	}
+	for _, obj := range objects {
+		if err := fw.WriteObject(obj); err != nil {
+			t.Fatalf("WriteObject() unexpected error: %v", err)
+		}
+	}
+
+	fr, err := NewFetchReader(stream)
+	if err != nil {
+		t.Fatalf("NewFetchReader() unexpected error: %v", err)
+	}
+	if fr.RequestID() != 12 {
+		t.Errorf("RequestID() got = %d, want 12", fr.RequestID())
+	}
+
+	for i, expected := range objects {
+		got, err := fr.ReadObject()
+		if err != nil {
+			t.Fatalf("ReadObject() #%d unexpected error: %v", i, err)
+		}
+		if got.Location != expected.Location || got.SubgroupID != expected.SubgroupID || got.PublisherPriority != expected.PublisherPriority ||
+			got.ObjectStatus != expected.ObjectStatus || string(got.Payload) != string(expected.Payload) {
+			t.Errorf("ReadObject() #%d got = %+v, want %+v", i, got, expected)
+		}
+		if len(expected.ExtensionHeaders) > 0 && !reflect.DeepEqual(got.ExtensionHeaders, expected.ExtensionHeaders) {
+			t.Errorf("ReadObject() #%d extensions got = %+v, want %+v", i, got.ExtensionHeaders, expected.ExtensionHeaders)
+		}
+	}
+
+	if _, err := fr.ReadObject(); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadObject() at the end of the stream error = %v, want io.EOF", err)
+	}
+}
+
+func TestFetchStreamEndOfRange(t *testing.T) {
+	stream := &bufferStream{}
+	b := make([]byte, 0)
+	EncodeFetchHeader(&b, 2)
+	b = quicvarint.Append(b, fetchEndOfNonExistentRange)
+	b = quicvarint.Append(b, 3) // Group ID
+	b = quicvarint.Append(b, 9) // Object ID
+	obj := internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 4, ObjectId: 0}, 0, model.MoqtFullTrackName{}, 1, model.Subgroup, model.Normal, nil, []byte("x")))
+	EncodeFetchObjectHeader(&b, &FetchObjectFlags{GroupIdPresent: true, ObjectIdPresent: true, PriorityPresent: true}, obj)
+	b = append(b, obj.Payload...)
+	stream.Write(b)
+
+	fr := internal.Must(NewFetchReader(stream))
+	got, err := fr.ReadObject()
+	if err != nil {
+		t.Fatalf("ReadObject() unexpected error: %v", err)
+	}
+	if got.Location != obj.Location {
+		t.Errorf("ReadObject() got location = %+v, want %+v", got.Location, obj.Location)
+	}
+}
+
+func TestFetchStreamInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags uint64
+	}{
+		{"First object without Group ID", fetchFlagObjectIdPresent | fetchFlagPriorityPresent},
+		{"First object with prior Subgroup ID", uint64(FetchSubgroupPrior) | fetchFlagGroupIdPresent | fetchFlagObjectIdPresent | fetchFlagPriorityPresent},
+		{"Reserved flag", 0x40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &bufferStream{}
+			b := make([]byte, 0)
+			EncodeFetchHeader(&b, 0)
+			b = quicvarint.Append(b, tt.flags)
+			b = append(b, 0, 0, 0, 0, 0, 0) // Enough for any field, must not be reached
+			stream.Write(b)
+
+			fr := internal.Must(NewFetchReader(stream))
+			_, err := fr.ReadObject()
+			var termErr model.MOQT_SESSION_TERMINATION_ERROR
+			if !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+				t.Errorf("ReadObject() error = %v, want PROTOCOL_VIOLATION", err)
+			}
+		})
+	}
+}
@@ -261,3 +261,14 @@ func NewObjectDatagram(trackAlias uint64, groupId uint64, opts ...ObjectDatagram
 
 	return dg, nil
 }
+
+// Converts the datagram into an object of the given track, the track is known from the Track Alias by the receiver.
+func (dg *ObjectDatagram) ToMoqtObject(ftn model.MoqtFullTrackName) (*model.MoqtObject, error) {
+	status := model.Normal
+	if dg.Status.Valid {
+		status = dg.Status.Val
+	}
+
+	// Datagrams don't belong to a subgroup, the Subgroup ID is left as 0
+	return model.NewMoqtObject(dg.Location, 0, ftn, dg.PublisherPriority.Val, model.Datagram, status, dg.Extensions.Val, dg.Payload.Val)
+}
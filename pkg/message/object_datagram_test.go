@@ -429,3 +429,26 @@ func TestNewObjectDatagram(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectDatagramToMoqtObject(t *testing.T) {
+	ftn := model.MoqtFullTrackName{Namespace: model.MoqtTrackNamespace{[]byte("test")}, Name: []byte("track")}
+
+	payloadDg := internal.Must(NewObjectDatagram(1, 2, WithObjectId(3), WithPublisherPriority(4), WithPayload([]byte("data"))))
+	obj, err := payloadDg.ToMoqtObject(ftn)
+	if err != nil {
+		t.Fatalf("ToMoqtObject() unexpected error: %v", err)
+	}
+	expected := internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 2, ObjectId: 3}, 0, ftn, 4, model.Datagram, model.Normal, nil, []byte("data")))
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("ToMoqtObject() got = %+v, want %+v", obj, expected)
+	}
+
+	statusDg := internal.Must(NewObjectDatagram(1, 2, WithStatus(model.EndOfTrack)))
+	obj, err = statusDg.ToMoqtObject(ftn)
+	if err != nil {
+		t.Fatalf("ToMoqtObject() unexpected error: %v", err)
+	}
+	if obj.ObjectStatus != model.EndOfTrack || obj.Payload != nil {
+		t.Errorf("ToMoqtObject() got = %+v, want an empty EndOfTrack object", obj)
+	}
+}
@@ -0,0 +1,176 @@
+package message
+
+import (
+	"fmt"
+
+	"github.com/LukaGiorgadze/gonull/v2"
+)
+
+// Used when Forwarding Preference = Subgroup. Every subgroup is sent on its own unidirectional stream, which starts with a SUBGROUP_HEADER
+// and continues with the objects of the subgroup in ascending Object ID order.
+
+// SUBGROUP_HEADER {
+//   Type (i) = 0x10-0x15,0x18-0x1D,0x30-0x35,0x38-0x3D
+//   Track Alias (i),
+//   Group ID (i),
+//   [Subgroup ID (i),]
+//   [Publisher Priority (8),]
+// }
+
+// Like OBJECT_DATAGRAM, the Type acts as a bitmask regarding which values are present in the header and in the objects that follow.
+
+// Bit Mask		Hex		Logic Type		Meaning
+// Bit 0		0x01	Normal			Every object on the stream carries an Extensions field
+// Bit 1-2		0x06	Enum			0b00: Subgroup ID is 0, 0b01: Subgroup ID is the first Object ID, 0b10: Subgroup ID present, 0b11: invalid
+// Bit 3		0x08	Normal			This subgroup contains the largest object of the group (End of Group)
+// Bit 4		0x10	Fixed			Always set, tells subgroup streams apart from other data streams
+// Bit 5		0x20	Inverted		Priority Present (0) / Priority Omitted (1)
+
+const (
+	subgroupFlagExtensionsPresent = 0x01 // Bit 0: 0000 0001
+	subgroupMaskSubgroupIdMode    = 0x06 // Bit 1-2: 0000 0110
+	subgroupFlagEndOfGroup        = 0x08 // Bit 3: 0000 1000
+	subgroupFlagStream            = 0x10 // Bit 4: 0001 0000
+	subgroupFlagPriorityOmitted   = 0x20 // Bit 5: 0010 0000
+)
+
+// SubgroupIdMode tells how the Subgroup ID of the stream is determined, it is encoded in bits 1-2 of the type.
+type SubgroupIdMode uint64
+
+const (
+	SubgroupIdZero        SubgroupIdMode = 0x0 // Subgroup ID is 0 and it's omitted in the header
+	SubgroupIdFirstObject SubgroupIdMode = 0x1 // Subgroup ID is the Object ID of the first object on the stream, omitted in the header
+	SubgroupIdPresent     SubgroupIdMode = 0x2 // Subgroup ID is present in the header
+)
+
+type SubgroupHeaderType struct {
+	TypeID            uint64
+	ExtensionsPresent bool           // Do objects on this stream carry extensions? 1 = yes, 0 = no
+	SubgroupIdMode    SubgroupIdMode // How the Subgroup ID is determined
+	EndOfGroup        bool           // Does this subgroup contain the largest object in the group? 1 = yes, 0 = no
+	PriorityPresent   bool           // Is Publisher Priority present? 1 = yes, 0 = no, if no, the priority of the subscription is used
+}
+
+// Here we apply the bitmask
+// This function comes in handy when deserializing subgroup headers from the wire
+func NewSubgroupHeaderType(typeId uint64) (*SubgroupHeaderType, error) {
+	// Bit 4 must be set, bits above 5 must be unset
+	if typeId > 0x3D || (typeId&subgroupFlagStream) == 0 {
+		return &SubgroupHeaderType{}, fmt.Errorf("invalid subgroup header type ID: 0x%x", typeId)
+	}
+
+	ht := SubgroupHeaderType{
+		TypeID:            typeId,
+		ExtensionsPresent: (typeId & subgroupFlagExtensionsPresent) != 0,
+		SubgroupIdMode:    SubgroupIdMode((typeId & subgroupMaskSubgroupIdMode) >> 1),
+		EndOfGroup:        (typeId & subgroupFlagEndOfGroup) != 0,
+		PriorityPresent:   (typeId & subgroupFlagPriorityOmitted) == 0, // Logic Inversion!
+	}
+
+	// 0b11 is not a defined Subgroup ID mode (0x16, 0x17, 0x1E, 0x1F ...)
+	if ht.SubgroupIdMode > SubgroupIdPresent {
+		return &SubgroupHeaderType{}, fmt.Errorf("invalid subgroup header type ID 0x%x: undefined Subgroup ID mode", typeId)
+	}
+
+	return &ht, nil
+}
+
+// This function assumes that the given ht is valid, created with it's respectible "New..." function
+func (ht *SubgroupHeaderType) ToUInt64() uint64 {
+	var typeId uint64 = subgroupFlagStream
+
+	if ht.ExtensionsPresent {
+		typeId |= subgroupFlagExtensionsPresent
+	}
+
+	typeId |= uint64(ht.SubgroupIdMode) << 1
+
+	if ht.EndOfGroup {
+		typeId |= subgroupFlagEndOfGroup
+	}
+
+	// If PriorityPresent is FALSE, we SET the "Omitted" bit (1).
+	if !ht.PriorityPresent {
+		typeId |= subgroupFlagPriorityOmitted
+	}
+
+	return typeId
+}
+
+func (ht *SubgroupHeaderType) IsValid() bool {
+	if ht.SubgroupIdMode > SubgroupIdPresent {
+		return false
+	}
+	if ht.TypeID > 0x3D || (ht.TypeID&subgroupFlagStream) == 0 {
+		return false
+	}
+	return true
+}
+
+type SubgroupHeader struct {
+	Htype      SubgroupHeaderType
+	TrackAlias uint64
+	GroupId    uint64
+	SubgroupId uint64 // Only on the wire when Htype.SubgroupIdMode == SubgroupIdPresent
+
+	PublisherPriority gonull.Nullable[uint8]
+}
+
+type SubgroupHeaderOption func(*SubgroupHeader)
+
+// Sets the Subgroup ID, 0 is encoded implicitly in the type.
+func WithSubgroupId(sid uint64) SubgroupHeaderOption {
+	return func(sh *SubgroupHeader) {
+		sh.SubgroupId = sid
+		if sid == 0 {
+			sh.Htype.SubgroupIdMode = SubgroupIdZero
+		} else {
+			sh.Htype.SubgroupIdMode = SubgroupIdPresent
+		}
+	}
+}
+
+// The Subgroup ID will be the Object ID of the first object written to the stream.
+func WithSubgroupIdFromFirstObject() SubgroupHeaderOption {
+	return func(sh *SubgroupHeader) {
+		sh.Htype.SubgroupIdMode = SubgroupIdFirstObject
+	}
+}
+
+func WithSubgroupPublisherPriority(priority uint8) SubgroupHeaderOption {
+	return func(sh *SubgroupHeader) {
+		sh.Htype.PriorityPresent = true
+		sh.PublisherPriority = gonull.NewNullable(priority)
+	}
+}
+
+// Every object on the stream will carry an Extensions field, possibly empty.
+func WithSubgroupExtensions() SubgroupHeaderOption {
+	return func(sh *SubgroupHeader) {
+		sh.Htype.ExtensionsPresent = true
+	}
+}
+
+func WithSubgroupEndOfGroup() SubgroupHeaderOption {
+	return func(sh *SubgroupHeader) {
+		sh.Htype.EndOfGroup = true
+	}
+}
+
+// By default the Subgroup ID is 0, Publisher Priority is omitted and objects carry no extensions.
+func NewSubgroupHeader(trackAlias uint64, groupId uint64, opts ...SubgroupHeaderOption) (*SubgroupHeader, error) {
+	sh := &SubgroupHeader{
+		TrackAlias: trackAlias,
+		GroupId:    groupId,
+	}
+	for _, opt := range opts {
+		opt(sh)
+	}
+
+	sh.Htype.TypeID = sh.Htype.ToUInt64()
+	if !sh.Htype.IsValid() {
+		return nil, fmt.Errorf("invalid subgroup header type constructed: 0x%x", sh.Htype.TypeID)
+	}
+
+	return sh, nil
+}
@@ -0,0 +1,125 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+
+	"go-moq/internal"
+
+	"github.com/LukaGiorgadze/gonull/v2"
+)
+
+func TestNewSubgroupHeaderType(t *testing.T) {
+	tests := []struct {
+		name      string
+		typeID    uint64
+		expected  *SubgroupHeaderType
+		expectErr bool
+	}{
+		{
+			name:      "Out of range - Stream bit 0x10 unset",
+			typeID:    0x05,
+			expectErr: true,
+		},
+		{
+			name:      "Out of range - Undefined Subgroup ID mode 0x16",
+			typeID:    0x16,
+			expectErr: true,
+		},
+		{
+			name:      "Out of range - Exceeds defined range by value 0x40",
+			typeID:    0x40,
+			expectErr: true,
+		},
+		{
+			name:   "0x10 - Subgroup ID zero, Priority present, no extensions",
+			typeID: 0x10,
+			expected: &SubgroupHeaderType{
+				TypeID:          0x10,
+				SubgroupIdMode:  SubgroupIdZero,
+				PriorityPresent: true,
+			},
+		},
+		{
+			name:   "0x13 - Subgroup ID from first object, extensions",
+			typeID: 0x13,
+			expected: &SubgroupHeaderType{
+				TypeID:            0x13,
+				ExtensionsPresent: true,
+				SubgroupIdMode:    SubgroupIdFirstObject,
+				PriorityPresent:   true,
+			},
+		},
+		{
+			name:   "0x3C - Subgroup ID present, End of Group, Priority omitted",
+			typeID: 0x3C,
+			expected: &SubgroupHeaderType{
+				TypeID:         0x3C,
+				SubgroupIdMode: SubgroupIdPresent,
+				EndOfGroup:     true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSubgroupHeaderType(tt.typeID)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("NewSubgroupHeaderType() expected an error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSubgroupHeaderType() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("NewSubgroupHeaderType() got = %+v, want %+v", got, tt.expected)
+			}
+			if got.ToUInt64() != tt.typeID {
+				t.Errorf("ToUInt64() got = 0x%x, want 0x%x", got.ToUInt64(), tt.typeID)
+			}
+		})
+	}
+}
+
+func TestEncodeSubgroupHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   *SubgroupHeader
+		expected []byte
+	}{
+		{
+			name:     "Defaults - Subgroup ID zero, Priority omitted",
+			header:   internal.Must(NewSubgroupHeader(1, 2)),
+			expected: []byte{0x30, 0x01, 0x02},
+		},
+		{
+			name:     "Explicit Subgroup ID and Priority",
+			header:   internal.Must(NewSubgroupHeader(1, 2, WithSubgroupId(7), WithSubgroupPublisherPriority(128))),
+			expected: []byte{0x14, 0x01, 0x02, 0x07, 0x80},
+		},
+		{
+			name:     "Subgroup ID from first object, End of Group, Extensions",
+			header:   internal.Must(NewSubgroupHeader(1, 2, WithSubgroupIdFromFirstObject(), WithSubgroupEndOfGroup(), WithSubgroupExtensions())),
+			expected: []byte{0x3B, 0x01, 0x02},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf []byte
+			EncodeSubgroupHeader(&buf, tt.header)
+			if !reflect.DeepEqual(buf, tt.expected) {
+				t.Errorf("EncodeSubgroupHeader() got = %v, want %v", buf, tt.expected)
+			}
+		})
+	}
+
+	// Explicit Subgroup ID 0 is folded into the type
+	sh := internal.Must(NewSubgroupHeader(1, 2, WithSubgroupId(0), WithSubgroupPublisherPriority(1)))
+	if sh.Htype.SubgroupIdMode != SubgroupIdZero || sh.PublisherPriority != gonull.NewNullable(uint8(1)) {
+		t.Errorf("NewSubgroupHeader() got = %+v", sh)
+	}
+}
@@ -0,0 +1,332 @@
+package message
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/transport"
+	"io"
+
+	"github.com/LukaGiorgadze/gonull/v2"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Upper bound for a single object payload read from a data stream, protects the receiver from allocating whatever length the peer claims.
+const maxStreamObjectPayloadLength = 64 << 20 // 64 MiB
+
+// See model.MoqtKeyValuePair
+const maxKeyValuePairValueLength = 65535
+
+// BufferedReceiveStream wraps a transport.ReceiveStream with a bufio.Reader.
+// Like the control stream (see control.ControlMessageFactory), data streams are parsed varint by varint, which requires an io.ByteReader.
+type BufferedReceiveStream struct {
+	r      *bufio.Reader
+	stream transport.ReceiveStream
+}
+
+func NewBufferedReceiveStream(stream transport.ReceiveStream) *BufferedReceiveStream {
+	if bs, ok := stream.(*BufferedReceiveStream); ok {
+		return bs // Already buffered, wrapping it again would lose what is buffered
+	}
+	return &BufferedReceiveStream{
+		r:      bufio.NewReader(stream),
+		stream: stream,
+	}
+}
+
+// io.Reader implementation
+func (bs *BufferedReceiveStream) Read(p []byte) (int, error) {
+	return bs.r.Read(p)
+}
+
+// io.ByteReader implementation
+func (bs *BufferedReceiveStream) ReadByte() (byte, error) {
+	return bs.r.ReadByte()
+}
+
+// CancelRead implementation
+func (bs *BufferedReceiveStream) CancelRead(code quic.StreamErrorCode) {
+	bs.stream.CancelRead(code)
+}
+
+// SubgroupWriter writes the objects of a single subgroup to a unidirectional stream.
+// It is not safe for concurrent use.
+type SubgroupWriter struct {
+	stream transport.SendStream
+	header SubgroupHeader
+
+	written      bool   // Whether at least one object was written
+	lastObjectId uint64 // Object ID of the last written object, valid if written is true
+
+	buf []byte // Reused between objects
+}
+
+// Opens the subgroup by writing the SUBGROUP_HEADER to the stream.
+func NewSubgroupWriter(stream transport.SendStream, header *SubgroupHeader) (*SubgroupWriter, error) {
+	sw := &SubgroupWriter{
+		stream: stream,
+		header: *header,
+		buf:    make([]byte, 0, 64),
+	}
+
+	EncodeSubgroupHeader(&sw.buf, header)
+	if _, err := stream.Write(sw.buf); err != nil {
+		return nil, fmt.Errorf("SubgroupWriter: failed to write SUBGROUP_HEADER: %w", err)
+	}
+	return sw, nil
+}
+
+func (sw *SubgroupWriter) Header() SubgroupHeader {
+	return sw.header
+}
+
+// WriteObject writes the next object of the subgroup, objects MUST be written in ascending Object ID order.
+func (sw *SubgroupWriter) WriteObject(obj *model.MoqtObject) error {
+	if obj.Location.GroupId != sw.header.GroupId {
+		return fmt.Errorf("SubgroupWriter: object belongs to group %d, the stream carries group %d", obj.Location.GroupId, sw.header.GroupId)
+	}
+	if sw.written && obj.Location.ObjectId <= sw.lastObjectId {
+		return fmt.Errorf("SubgroupWriter: Object IDs must increase within a subgroup, last: %d, got: %d", sw.lastObjectId, obj.Location.ObjectId)
+	}
+	if !sw.header.Htype.ExtensionsPresent && len(obj.ExtensionHeaders) > 0 {
+		return fmt.Errorf("SubgroupWriter: object has extension headers, but the subgroup header type 0x%x doesn't allow them", sw.header.Htype.TypeID)
+	}
+
+	// The first object determines the Subgroup ID in this mode
+	if !sw.written && sw.header.Htype.SubgroupIdMode == SubgroupIdFirstObject {
+		sw.header.SubgroupId = obj.Location.ObjectId
+	}
+
+	// Object ID Delta: The first object carries its Object ID, the rest carry the gap to the previous one minus one.
+	delta := obj.Location.ObjectId
+	if sw.written {
+		delta = obj.Location.ObjectId - sw.lastObjectId - 1
+	}
+
+	sw.buf = sw.buf[:0]
+	EncodeSubgroupObjectHeader(&sw.buf, delta, sw.header.Htype.ExtensionsPresent, obj)
+	if _, err := sw.stream.Write(sw.buf); err != nil {
+		return fmt.Errorf("SubgroupWriter: failed to write object header: %w", err)
+	}
+	if len(obj.Payload) > 0 {
+		if _, err := sw.stream.Write(obj.Payload); err != nil {
+			return fmt.Errorf("SubgroupWriter: failed to write object payload: %w", err)
+		}
+	}
+
+	sw.written = true
+	sw.lastObjectId = obj.Location.ObjectId
+	return nil
+}
+
+// Close gracefully finishes the subgroup (FIN).
+func (sw *SubgroupWriter) Close() error {
+	return sw.stream.Close()
+}
+
+// Cancel abruptly terminates the subgroup with the given stream reset code.
+func (sw *SubgroupWriter) Cancel(code quic.StreamErrorCode) {
+	sw.stream.CancelWrite(code)
+}
+
+// SubgroupReader reads the objects of a single subgroup from a unidirectional stream.
+// It is not safe for concurrent use.
+type SubgroupReader struct {
+	stream *BufferedReceiveStream
+	header SubgroupHeader
+
+	read         bool   // Whether at least one object was read
+	lastObjectId uint64 // Object ID of the last read object, valid if read is true
+}
+
+// Reads the SUBGROUP_HEADER from the stream, including the stream type.
+func NewSubgroupReader(stream transport.ReceiveStream) (*SubgroupReader, error) {
+	bs := NewBufferedReceiveStream(stream)
+
+	typeId, err := quicvarint.Read(bs)
+	if err != nil {
+		return nil, fmt.Errorf("SubgroupReader: failed to read stream type: %w", err)
+	}
+	return NewSubgroupReaderWithType(bs, typeId)
+}
+
+// Reads the rest of the SUBGROUP_HEADER, for callers that already consumed the stream type to tell the kind of the data stream.
+func NewSubgroupReaderWithType(stream *BufferedReceiveStream, typeId uint64) (*SubgroupReader, error) {
+	htype, err := NewSubgroupHeaderType(typeId)
+	if err != nil {
+		return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Invalid SUBGROUP_HEADER type: %#X", typeId)),
+		}
+	}
+
+	sr := &SubgroupReader{
+		stream: stream,
+		header: SubgroupHeader{Htype: *htype},
+	}
+
+	if sr.header.TrackAlias, err = quicvarint.Read(stream); err != nil {
+		return nil, fmt.Errorf("SubgroupReader: failed to read Track Alias: %w", unexpectedEOF(err))
+	}
+	if sr.header.GroupId, err = quicvarint.Read(stream); err != nil {
+		return nil, fmt.Errorf("SubgroupReader: failed to read Group ID: %w", unexpectedEOF(err))
+	}
+	if htype.SubgroupIdMode == SubgroupIdPresent {
+		if sr.header.SubgroupId, err = quicvarint.Read(stream); err != nil {
+			return nil, fmt.Errorf("SubgroupReader: failed to read Subgroup ID: %w", unexpectedEOF(err))
+		}
+	}
+	if htype.PriorityPresent {
+		priority, err := stream.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("SubgroupReader: failed to read Publisher Priority: %w", unexpectedEOF(err))
+		}
+		sr.header.PublisherPriority = gonull.NewNullable(priority)
+	}
+
+	return sr, nil
+}
+
+// Header returns the SUBGROUP_HEADER of the stream.
+// When the Subgroup ID is taken from the first object, it is only known after the first ReadObject call.
+func (sr *SubgroupReader) Header() SubgroupHeader {
+	return sr.header
+}
+
+// ReadObject returns the next object on the stream, io.EOF is returned when the publisher finished the subgroup.
+// The returned object has no FullTrackName, only the Track Alias is known on the stream (see Header), the session resolves it.
+// If the Publisher Priority is omitted on the stream, the object's priority is left as 0.
+func (sr *SubgroupReader) ReadObject() (*model.MoqtObject, error) {
+	delta, err := quicvarint.Read(sr.stream)
+	if err != nil {
+		return nil, err // io.EOF at an object boundary is the clean end of the subgroup
+	}
+
+	objectId := delta
+	if sr.read {
+		objectId = sr.lastObjectId + delta + 1
+	}
+
+	var extensions []model.MoqtKeyValuePair
+	if sr.header.Htype.ExtensionsPresent {
+		extensions, err = readExtensions(sr.stream)
+		if err != nil {
+			return nil, fmt.Errorf("SubgroupReader: failed to read Extensions: %w", err)
+		}
+	}
+
+	status, payload, err := readObjectPayload(sr.stream)
+	if err != nil {
+		return nil, fmt.Errorf("SubgroupReader: %w", err)
+	}
+
+	if !sr.read && sr.header.Htype.SubgroupIdMode == SubgroupIdFirstObject {
+		sr.header.SubgroupId = objectId
+	}
+
+	obj, err := model.NewMoqtObject(
+		model.MoqtLocation{GroupId: sr.header.GroupId, ObjectId: objectId},
+		sr.header.SubgroupId,
+		model.MoqtFullTrackName{},
+		sr.header.PublisherPriority.Val,
+		model.Subgroup,
+		status,
+		extensions,
+		payload,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.read = true
+	sr.lastObjectId = objectId
+	return obj, nil
+}
+
+// Cancel tells the publisher to stop sending this subgroup (STOP_SENDING).
+func (sr *SubgroupReader) Cancel(code quic.StreamErrorCode) {
+	sr.stream.CancelRead(code)
+}
+
+// Reads "Object Payload Length (i), [Object Status (i),] Object Payload (..)"
+func readObjectPayload(r *BufferedReceiveStream) (model.MoqtObjectStatus, []byte, error) {
+	length, err := quicvarint.Read(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read Object Payload Length: %w", unexpectedEOF(err))
+	}
+
+	if length == 0 {
+		status, err := quicvarint.Read(r)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read Object Status: %w", unexpectedEOF(err))
+		}
+		return model.MoqtObjectStatus(status), nil, nil
+	}
+
+	if length > maxStreamObjectPayloadLength {
+		return 0, nil, fmt.Errorf("object payload length %d exceeds the limit of %d bytes", length, maxStreamObjectPayloadLength)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read Object Payload: %w", unexpectedEOF(err))
+	}
+	return model.Normal, payload, nil
+}
+
+// Stream counterpart of DecodeExtensions
+func readExtensions(r *BufferedReceiveStream) ([]model.MoqtKeyValuePair, error) {
+	count, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Extension Headers Length: %w", unexpectedEOF(err))
+	}
+
+	kvPairs := make([]model.MoqtKeyValuePair, 0)
+	for i := uint64(0); i < count; i++ {
+		typ, err := quicvarint.Read(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Type of Key-Value-Pair %d: %w", i, unexpectedEOF(err))
+		}
+
+		var value any
+		if typ%2 == 0 {
+			v, err := quicvarint.Read(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Value of Key-Value-Pair %d: %w", i, unexpectedEOF(err))
+			}
+			value = v
+		} else {
+			length, err := quicvarint.Read(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Length of Key-Value-Pair %d: %w", i, unexpectedEOF(err))
+			}
+			if length > maxKeyValuePairValueLength {
+				return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+					ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+					ReasonPhrase: model.NewReasonPhrase("Value length must not exceed 65535 bytes when it is []byte"),
+				}
+			}
+			v := make([]byte, length)
+			if _, err := io.ReadFull(r, v); err != nil {
+				return nil, fmt.Errorf("failed to read Value of Key-Value-Pair %d: %w", i, unexpectedEOF(err))
+			}
+			value = v
+		}
+
+		kvp, err := model.NewMoqtKeyValuePair(typ, value)
+		if err != nil {
+			return nil, err
+		}
+		kvPairs = append(kvPairs, kvp)
+	}
+	return kvPairs, nil
+}
+
+// The stream ending in the middle of a structure is not a clean end.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"go-moq/internal"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Minimal in-memory stream, written by the writer under test and read back by the reader under test.
+type bufferStream struct {
+	bytes.Buffer
+}
+
+func (bs *bufferStream) Close() error                     { return nil }
+func (bs *bufferStream) CancelWrite(quic.StreamErrorCode) {}
+func (bs *bufferStream) CancelRead(quic.StreamErrorCode)  {}
+
+func TestSubgroupStreamRoundTrip(t *testing.T) {
+	ext := []model.MoqtKeyValuePair{
+		internal.Must(model.NewMoqtKeyValuePair(0x02, uint64(9))),
+		internal.Must(model.NewMoqtKeyValuePair(0x05, []byte("meta"))),
+	}
+
+	tests := []struct {
+		name    string
+		header  *SubgroupHeader
+		objects []*model.MoqtObject
+	}{
+		{
+			name:   "Explicit Subgroup ID, Priority, Extensions",
+			header: internal.Must(NewSubgroupHeader(3, 10, WithSubgroupId(2), WithSubgroupPublisherPriority(5), WithSubgroupExtensions())),
+			objects: []*model.MoqtObject{
+				internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 10, ObjectId: 0}, 2, model.MoqtFullTrackName{}, 5, model.Subgroup, model.Normal, ext, []byte("first"))),
+				internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 10, ObjectId: 1}, 2, model.MoqtFullTrackName{}, 5, model.Subgroup, model.Normal, []model.MoqtKeyValuePair{}, []byte("second"))),
+				internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 10, ObjectId: 7}, 2, model.MoqtFullTrackName{}, 5, model.Subgroup, model.EndOfGroup, []model.MoqtKeyValuePair{}, nil)),
+			},
+		},
+		{
+			name:   "Subgroup ID from first object, no extensions",
+			header: internal.Must(NewSubgroupHeader(3, 4, WithSubgroupIdFromFirstObject(), WithSubgroupEndOfGroup())),
+			objects: []*model.MoqtObject{
+				internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 4, ObjectId: 5}, 5, model.MoqtFullTrackName{}, 0, model.Subgroup, model.Normal, nil, []byte("a"))),
+				internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 4, ObjectId: 6}, 5, model.MoqtFullTrackName{}, 0, model.Subgroup, model.Normal, nil, []byte("b"))),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &bufferStream{}
+			sw, err := NewSubgroupWriter(stream, tt.header)
+			if err != nil {
+				t.Fatalf("NewSubgroupWriter() unexpected error: %v", err)
+			}
+			for _, obj := range tt.objects {
+				if err := sw.WriteObject(obj); err != nil {
+					t.Fatalf("WriteObject() unexpected error: %v", err)
+				}
+			}
+
+			sr, err := NewSubgroupReader(stream)
+			if err != nil {
+				t.Fatalf("NewSubgroupReader() unexpected error: %v", err)
+			}
+			if sr.Header().TrackAlias != tt.header.TrackAlias || sr.Header().GroupId != tt.header.GroupId {
+				t.Errorf("Header() got = %+v, want %+v", sr.Header(), tt.header)
+			}
+
+			for i, expected := range tt.objects {
+				got, err := sr.ReadObject()
+				if err != nil {
+					t.Fatalf("ReadObject() %d unexpected error: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("ReadObject() %d got = %+v, want %+v", i, got, expected)
+				}
+			}
+			if _, err := sr.ReadObject(); !errors.Is(err, io.EOF) {
+				t.Errorf("ReadObject() at the end of the stream got error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestSubgroupWriterRejectsInvalidObjects(t *testing.T) {
+	sw := internal.Must(NewSubgroupWriter(&bufferStream{}, internal.Must(NewSubgroupHeader(1, 1))))
+
+	withExt := internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 1, ObjectId: 0}, 0, model.MoqtFullTrackName{}, 0, model.Subgroup, model.Normal,
+		[]model.MoqtKeyValuePair{internal.Must(model.NewMoqtKeyValuePair(0x02, uint64(1)))}, []byte("x")))
+	if err := sw.WriteObject(withExt); err == nil {
+		t.Errorf("WriteObject() expected an error for extensions on a stream without them, but got none")
+	}
+
+	otherGroup := internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 2, ObjectId: 0}, 0, model.MoqtFullTrackName{}, 0, model.Subgroup, model.Normal, nil, []byte("x")))
+	if err := sw.WriteObject(otherGroup); err == nil {
+		t.Errorf("WriteObject() expected an error for an object of another group, but got none")
+	}
+
+	first := internal.Must(model.NewMoqtObject(model.MoqtLocation{GroupId: 1, ObjectId: 3}, 0, model.MoqtFullTrackName{}, 0, model.Subgroup, model.Normal, nil, []byte("x")))
+	if err := sw.WriteObject(first); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if err := sw.WriteObject(first); err == nil {
+		t.Errorf("WriteObject() expected an error for a non-increasing Object ID, but got none")
+	}
+}
+
+func TestSubgroupReaderTruncatedObject(t *testing.T) {
+	stream := &bufferStream{}
+	stream.Write([]byte{0x30, 0x01, 0x02, 0x00, 0x05, 0x61}) // Header, then an object claiming 5 payload bytes with only 1 present
+
+	sr := internal.Must(NewSubgroupReader(stream))
+	if _, err := sr.ReadObject(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadObject() got error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -5,6 +5,7 @@ package message
 import (
 	"fmt"
 	"go-moq/pkg/model"
+	"unicode/utf8"
 
 	"github.com/LukaGiorgadze/gonull/v2"
 	"github.com/quic-go/quic-go/quicvarint"
@@ -111,6 +112,11 @@ func DecodeExtensions(b []byte) ([]model.MoqtKeyValuePair, int, error) {
 	}
 	b = b[n:]
 
+	// Every Key-Value-Pair takes at least 2 bytes, a larger count can't be valid and must not size the allocation
+	if kvPairsLen > uint64(len(b)/2) {
+		return nil, parsed, fmt.Errorf("DecodeExtensions: %d Key-Value-Pairs don't fit in the remaining %d bytes", kvPairsLen, len(b))
+	}
+
 	kvPairs := make([]model.MoqtKeyValuePair, kvPairsLen)
 	for i := uint64(0); i < kvPairsLen; i++ {
 		kvp, n, err := DecodeMoqtKeyValuePair(b)
@@ -216,3 +222,125 @@ func DecodeObjectDatagram(b []byte) (*ObjectDatagram, int, error){
 
 	return dg, parsed, nil	
 }
+
+// Upper bounds enforced while decoding, see model.MoqtTrackNamespace and model.MoqtReasonPhrase
+const maxTrackNamespaceFields = 32
+const maxFullTrackNameBytes = 4096
+const maxReasonPhraseBytes = 1024
+
+// Track Namespace {
+//   Number of Track Namespace Fields (i),
+//   Track Namespace Field {
+//     Length (i),
+//     Value (..)
+//   } ...
+// }
+
+// Note: A namespace with 0 fields is accepted here since namespace prefixes (SUBSCRIBE_NAMESPACE) may be empty,
+// callers that need a complete namespace should check it with IsValid()
+func DecodeMoqtTrackNamespace(b []byte) (model.MoqtTrackNamespace, int, error) {
+	parsed := 0
+	numFields, n, err := quicvarint.Parse(b)
+	parsed += n
+	if err != nil {
+		return nil, parsed, fmt.Errorf("DecodeMoqtTrackNamespace: failed to parse Number of Fields: %w", err)
+	}
+	b = b[n:]
+
+	// If an endpoint receives a Track Namespace consisting of greater than 32 Track Namespace Fields, it MUST close the session with a PROTOCOL_VIOLATION. (2.4.1)
+	if numFields > maxTrackNamespaceFields {
+		return nil, parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Track Namespace has %d fields, maximum is %d", numFields, maxTrackNamespaceFields)),
+		}
+	}
+
+	ns := make(model.MoqtTrackNamespace, numFields)
+	for i := uint64(0); i < numFields; i++ {
+		field, n, err := decodeLengthPrefixedBytes(b)
+		parsed += n
+		if err != nil {
+			return nil, parsed, fmt.Errorf("DecodeMoqtTrackNamespace: failed to parse Field %d: %w", i, err)
+		}
+		ns[i] = field
+		b = b[n:]
+	}
+
+	return ns, parsed, nil
+}
+
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+
+func DecodeMoqtFullTrackName(b []byte) (model.MoqtFullTrackName, int, error) {
+	parsed := 0
+	ns, n, err := DecodeMoqtTrackNamespace(b)
+	parsed += n
+	if err != nil {
+		return model.MoqtFullTrackName{}, parsed, fmt.Errorf("DecodeMoqtFullTrackName: failed to parse Track Namespace: %w", err)
+	}
+	b = b[n:]
+
+	name, n, err := decodeLengthPrefixedBytes(b)
+	parsed += n
+	if err != nil {
+		return model.MoqtFullTrackName{}, parsed, fmt.Errorf("DecodeMoqtFullTrackName: failed to parse Track Name: %w", err)
+	}
+
+	ftn := model.MoqtFullTrackName{Namespace: ns, Name: name}
+
+	// The maximum total length of a Full Track Name is 4,096 bytes.
+	// If an endpoint receives a Full Track Name exceeding this length, it MUST close the session with a PROTOCOL_VIOLATION. (2.4.1)
+	if !ns.IsValid() || ftn.GetLength() > maxFullTrackNameBytes {
+		return model.MoqtFullTrackName{}, parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("Received an invalid Full Track Name"),
+		}
+	}
+
+	return ftn, parsed, nil
+}
+
+// Reason Phrase {
+//   Reason Phrase Length (i),
+//   Reason Phrase Value (..)
+// }
+
+func DecodeMoqtReasonPhrase(b []byte) (model.MoqtReasonPhrase, int, error) {
+	value, n, err := decodeLengthPrefixedBytes(b)
+	if err != nil {
+		return "", n, fmt.Errorf("DecodeMoqtReasonPhrase: %w", err)
+	}
+
+	// model.NewReasonPhrase panics on invalid input, so phrases coming from the wire are validated here instead.
+	if len(value) > maxReasonPhraseBytes || !utf8.Valid(value) {
+		return "", n, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("Reason Phrase must be valid UTF-8 and must not exceed 1024 bytes"),
+		}
+	}
+
+	return model.MoqtReasonPhrase(value), n, nil
+}
+
+// Reads "Length (i)" followed by "Length" bytes, the returned slice is a copy.
+func decodeLengthPrefixedBytes(b []byte) ([]byte, int, error) {
+	parsed := 0
+	length, n, err := quicvarint.Parse(b)
+	parsed += n
+	if err != nil {
+		return nil, parsed, fmt.Errorf("failed to parse Length: %w", err)
+	}
+	b = b[n:]
+
+	if uint64(len(b)) < length {
+		return nil, parsed, fmt.Errorf("insufficient bytes for Value, expected %d, got %d", length, len(b))
+	}
+
+	value := make([]byte, length)
+	copy(value, b[:length])
+	parsed += int(length)
+
+	return value, parsed, nil
+}
@@ -279,6 +279,13 @@ func TestDecodeExtensions(t *testing.T){
 			expectedN: 0,
 			expectErr: true,
 		},
+		{
+			name: "Count larger than the buffer",
+			buf: []byte{0xC0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x01}, // 2^56-1 Extensions, one given
+			expectedKVPs: nil,
+			expectedN: 8,
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -395,6 +402,19 @@ func TestDecodeObjectDatagram(t *testing.T){
 			)),
 			expectedN: 13,
 		},
+		{
+			name: "Forged Extension count",
+			buf: []byte{
+				0x09, // TypeId of the datagram, with extensions
+				0x01, // Track Alias
+				0x00, // GroupId
+				0x00, // ObjectId
+				0xC0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // 2^56-1 Extensions
+				0x02, 0x0A, // The only one given
+				0x78, // Payload
+			},
+			expectErr: true,
+		},
 
 	}
 
@@ -419,4 +439,110 @@ func TestDecodeObjectDatagram(t *testing.T){
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestDecodeMoqtFullTrackName(t *testing.T) {
+	tests := []struct {
+		name        string
+		buf         []byte
+		expectedFTN model.MoqtFullTrackName
+		expectedN   int
+		expectErr   bool
+	}{
+		{
+			name: "Two field namespace",
+			buf: []byte{
+				0x02,       // Number of fields
+				0x01, 0x61, // "a"
+				0x02, 0x62, 0x63, // "bc"
+				0x02, 0x64, 0x65, // Name "de"
+			},
+			expectedFTN: model.MoqtFullTrackName{Namespace: model.MoqtTrackNamespace{[]byte("a"), []byte("bc")}, Name: []byte("de")},
+			expectedN:   9,
+		},
+		{
+			name:      "Zero field namespace is not a valid Full Track Name",
+			buf:       []byte{0x00, 0x01, 0x61},
+			expectErr: true,
+		},
+		{
+			name:      "More than 32 fields",
+			buf:       []byte{0x21},
+			expectErr: true,
+		},
+		{
+			name:      "Truncated field value",
+			buf:       []byte{0x01, 0x05, 0x61},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ftn, n, err := DecodeMoqtFullTrackName(tt.buf)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("DecodeMoqtFullTrackName() expected an error, but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("DecodeMoqtFullTrackName() unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(ftn, tt.expectedFTN) {
+					t.Errorf("DecodeMoqtFullTrackName() got = %v, want %v", ftn, tt.expectedFTN)
+				}
+				if n != tt.expectedN {
+					t.Errorf("DecodeMoqtFullTrackName() got parsed bytes = %v, want %v", n, tt.expectedN)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMoqtReasonPhrase(t *testing.T) {
+	tests := []struct {
+		name      string
+		buf       []byte
+		expected  model.MoqtReasonPhrase
+		expectedN int
+		expectErr bool
+	}{
+		{
+			name:      "Simple phrase",
+			buf:       []byte{0x03, 0x62, 0x79, 0x65},
+			expected:  "bye",
+			expectedN: 4,
+		},
+		{
+			name:      "Empty phrase",
+			buf:       []byte{0x00},
+			expected:  "",
+			expectedN: 1,
+		},
+		{
+			name:      "Invalid UTF-8",
+			buf:       []byte{0x02, 0xC3, 0x28},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, n, err := DecodeMoqtReasonPhrase(tt.buf)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("DecodeMoqtReasonPhrase() expected an error, but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("DecodeMoqtReasonPhrase() unexpected error: %v", err)
+				}
+				if rp != tt.expected || n != tt.expectedN {
+					t.Errorf("DecodeMoqtReasonPhrase() got = (%q, %d), want (%q, %d)", rp, n, tt.expected, tt.expectedN)
+				}
+			}
+		})
+	}
+}
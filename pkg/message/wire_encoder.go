@@ -117,4 +117,118 @@ func EncodeObjectDatagramHeader(b *[]byte, dg *ObjectDatagram){
 	if dg.Status.Valid {
 		*b = quicvarint.Append(*b, uint64(dg.Status.Val))
 	}
-}
\ No newline at end of file
+}
+
+// Track Namespace {
+//   Number of Track Namespace Fields (i),
+//   Track Namespace Field {
+//     Length (i),
+//     Value (..)
+//   } ...
+// }
+
+func EncodeMoqtTrackNamespace(b *[]byte, ns model.MoqtTrackNamespace) {
+	*b = quicvarint.Append(*b, uint64(len(ns)))
+	for _, field := range ns {
+		*b = quicvarint.Append(*b, uint64(len(field)))
+		*b = append(*b, field...)
+	}
+}
+
+// Full Track Name is not a single structure on the wire, every message that carries one encodes it as:
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+
+func EncodeMoqtFullTrackName(b *[]byte, ftn model.MoqtFullTrackName) {
+	EncodeMoqtTrackNamespace(b, ftn.Namespace)
+	*b = quicvarint.Append(*b, uint64(len(ftn.Name)))
+	*b = append(*b, ftn.Name...)
+}
+
+// Reason Phrase {
+//   Reason Phrase Length (i),
+//   Reason Phrase Value (..)
+// }
+
+func EncodeMoqtReasonPhrase(b *[]byte, rp model.MoqtReasonPhrase) {
+	*b = quicvarint.Append(*b, uint64(len(rp)))
+	*b = append(*b, rp...)
+}
+
+// SUBGROUP_HEADER {
+//   Type (i) = 0x10-0x15,0x18-0x1D,0x30-0x35,0x38-0x3D
+//   Track Alias (i),
+//   Group ID (i),
+//   [Subgroup ID (i),]
+//   [Publisher Priority (8),]
+// }
+
+func EncodeSubgroupHeader(b *[]byte, sh *SubgroupHeader) {
+	*b = quicvarint.Append(*b, sh.Htype.TypeID)
+	*b = quicvarint.Append(*b, sh.TrackAlias)
+	*b = quicvarint.Append(*b, sh.GroupId)
+
+	if sh.Htype.SubgroupIdMode == SubgroupIdPresent {
+		*b = quicvarint.Append(*b, sh.SubgroupId)
+	}
+	if sh.PublisherPriority.Valid {
+		*b = append(*b, sh.PublisherPriority.Val)
+	}
+}
+
+// Objects on a subgroup stream:
+// {
+//   Object ID Delta (i),
+//   [Extensions (..),]
+//   Object Payload Length (i),
+//   [Object Status (i),]
+//   Object Payload (..),
+// }
+// Like EncodeObjectDatagramHeader, the payload is not encoded here, so it can be written to the stream directly.
+// Object Status is only present when the payload is empty.
+func EncodeSubgroupObjectHeader(b *[]byte, objectIdDelta uint64, extensionsPresent bool, obj *model.MoqtObject) {
+	*b = quicvarint.Append(*b, objectIdDelta)
+
+	if extensionsPresent {
+		EncodeExtensions(b, obj.ExtensionHeaders)
+	}
+
+	*b = quicvarint.Append(*b, uint64(len(obj.Payload)))
+	if len(obj.Payload) == 0 {
+		*b = quicvarint.Append(*b, uint64(obj.ObjectStatus))
+	}
+}
+
+// FETCH_HEADER, see fetch_header.go
+func EncodeFetchHeader(b *[]byte, requestId uint64) {
+	*b = quicvarint.Append(*b, FetchHeaderType)
+	*b = quicvarint.Append(*b, requestId)
+}
+
+// Encodes an object on a fetch stream up to its payload, only the fields selected by the flags are written.
+// Like EncodeSubgroupObjectHeader, the payload is not encoded here, so it can be written to the stream directly.
+func EncodeFetchObjectHeader(b *[]byte, flags *FetchObjectFlags, obj *model.MoqtObject) {
+	*b = quicvarint.Append(*b, flags.ToUInt64())
+
+	if flags.GroupIdPresent {
+		*b = quicvarint.Append(*b, obj.Location.GroupId)
+	}
+	if flags.SubgroupMode == FetchSubgroupPresent {
+		*b = quicvarint.Append(*b, obj.SubgroupID)
+	}
+	if flags.ObjectIdPresent {
+		*b = quicvarint.Append(*b, obj.Location.ObjectId)
+	}
+	if flags.PriorityPresent {
+		*b = append(*b, obj.PublisherPriority)
+	}
+	if flags.ExtensionsPresent {
+		EncodeExtensions(b, obj.ExtensionHeaders)
+	}
+
+	*b = quicvarint.Append(*b, uint64(len(obj.Payload)))
+	if len(obj.Payload) == 0 {
+		*b = quicvarint.Append(*b, uint64(obj.ObjectStatus))
+	}
+}
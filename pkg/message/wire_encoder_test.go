@@ -221,3 +221,50 @@ func TestEncodeObjectDatagram(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeMoqtFullTrackName(t *testing.T) {
+	tests := []struct {
+		name     string
+		ftn      model.MoqtFullTrackName
+		expected []byte
+	}{
+		{
+			name: "Single field namespace",
+			ftn:  model.MoqtFullTrackName{Namespace: model.MoqtTrackNamespace{[]byte("ns")}, Name: []byte("t")},
+			expected: []byte{
+				0x01,             // Number of fields
+				0x02, 0x6E, 0x73, // "ns"
+				0x01, 0x74, // Name "t"
+			},
+		},
+		{
+			name: "Two field namespace",
+			ftn:  model.MoqtFullTrackName{Namespace: model.MoqtTrackNamespace{[]byte("a"), []byte("bc")}, Name: []byte("de")},
+			expected: []byte{
+				0x02,       // Number of fields
+				0x01, 0x61, // "a"
+				0x02, 0x62, 0x63, // "bc"
+				0x02, 0x64, 0x65, // Name "de"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf []byte
+			EncodeMoqtFullTrackName(&buf, tt.ftn)
+			if !reflect.DeepEqual(buf, tt.expected) {
+				t.Errorf("EncodeMoqtFullTrackName() got = %v, want %v", buf, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEncodeMoqtReasonPhrase(t *testing.T) {
+	var buf []byte
+	EncodeMoqtReasonPhrase(&buf, model.NewReasonPhrase("bye"))
+	expected := []byte{0x03, 0x62, 0x79, 0x65}
+	if !reflect.DeepEqual(buf, expected) {
+		t.Errorf("EncodeMoqtReasonPhrase() got = %v, want %v", buf, expected)
+	}
+}
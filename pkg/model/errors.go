@@ -9,10 +9,27 @@ import (
 type MOQT_SESSION_TERMINATION_ERROR_CODE uint64
 
 const (
+	MOQT_SESSION_TERMINATION_ERROR_CODE_NO_ERROR                   MOQT_SESSION_TERMINATION_ERROR_CODE = 0x0
+	MOQT_SESSION_TERMINATION_ERROR_CODE_INTERNAL_ERROR             MOQT_SESSION_TERMINATION_ERROR_CODE = 0x1
+	MOQT_SESSION_TERMINATION_ERROR_CODE_UNAUTHORIZED               MOQT_SESSION_TERMINATION_ERROR_CODE = 0x2
 	MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION         MOQT_SESSION_TERMINATION_ERROR_CODE = 0x3
+	MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_REQUEST_ID         MOQT_SESSION_TERMINATION_ERROR_CODE = 0x4
+	MOQT_SESSION_TERMINATION_ERROR_CODE_DUPLICATE_TRACK_ALIAS      MOQT_SESSION_TERMINATION_ERROR_CODE = 0x5
 	MOQT_SESSION_TERMINATION_ERROR_CODE_KEY_VALUE_FORMATTING_ERROR MOQT_SESSION_TERMINATION_ERROR_CODE = 0x6
+	MOQT_SESSION_TERMINATION_ERROR_CODE_TOO_MANY_REQUESTS          MOQT_SESSION_TERMINATION_ERROR_CODE = 0x7
 	MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH               MOQT_SESSION_TERMINATION_ERROR_CODE = 0x8
+	MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_PATH             MOQT_SESSION_TERMINATION_ERROR_CODE = 0x9
+	MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT             MOQT_SESSION_TERMINATION_ERROR_CODE = 0x10
+	MOQT_SESSION_TERMINATION_ERROR_CODE_CONTROL_MESSAGE_TIMEOUT    MOQT_SESSION_TERMINATION_ERROR_CODE = 0x11
+	MOQT_SESSION_TERMINATION_ERROR_CODE_DATA_STREAM_TIMEOUT        MOQT_SESSION_TERMINATION_ERROR_CODE = 0x12
+	MOQT_SESSION_TERMINATION_ERROR_CODE_AUTH_TOKEN_CACHE_OVERFLOW  MOQT_SESSION_TERMINATION_ERROR_CODE = 0x13
+	MOQT_SESSION_TERMINATION_ERROR_CODE_DUPLICATE_AUTH_TOKEN_ALIAS MOQT_SESSION_TERMINATION_ERROR_CODE = 0x14
+	MOQT_SESSION_TERMINATION_ERROR_CODE_VERSION_NEGOTIATION_FAILED MOQT_SESSION_TERMINATION_ERROR_CODE = 0x15
+	MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_AUTH_TOKEN       MOQT_SESSION_TERMINATION_ERROR_CODE = 0x16
+	MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS   MOQT_SESSION_TERMINATION_ERROR_CODE = 0x17
+	MOQT_SESSION_TERMINATION_ERROR_CODE_EXPIRED_AUTH_TOKEN         MOQT_SESSION_TERMINATION_ERROR_CODE = 0x18
 	MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_AUTHORITY          MOQT_SESSION_TERMINATION_ERROR_CODE = 0x19
+	MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_AUTHORITY        MOQT_SESSION_TERMINATION_ERROR_CODE = 0x1A
 )
 
 type MOQT_SESSION_TERMINATION_ERROR struct {
@@ -23,3 +40,92 @@ type MOQT_SESSION_TERMINATION_ERROR struct {
 func (e MOQT_SESSION_TERMINATION_ERROR) Error() string {
 	return fmt.Sprintf("MOQT Session Termination Error - Code: %#X, Reason: %s", e.ErrorCode, e.ReasonPhrase)
 }
+
+// Error codes carried in REQUEST_ERROR, a request failing does not terminate the session.
+
+type MOQT_REQUEST_ERROR_CODE uint64
+
+const (
+	MOQT_REQUEST_ERROR_CODE_INTERNAL_ERROR             MOQT_REQUEST_ERROR_CODE = 0x0
+	MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED               MOQT_REQUEST_ERROR_CODE = 0x1
+	MOQT_REQUEST_ERROR_CODE_TIMEOUT                    MOQT_REQUEST_ERROR_CODE = 0x2
+	MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED              MOQT_REQUEST_ERROR_CODE = 0x3
+	MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST             MOQT_REQUEST_ERROR_CODE = 0x4
+	MOQT_REQUEST_ERROR_CODE_INVALID_RANGE              MOQT_REQUEST_ERROR_CODE = 0x5
+	MOQT_REQUEST_ERROR_CODE_NO_OBJECTS                 MOQT_REQUEST_ERROR_CODE = 0x6 // FETCH only
+	MOQT_REQUEST_ERROR_CODE_INVALID_JOINING_REQUEST_ID MOQT_REQUEST_ERROR_CODE = 0x7 // FETCH only
+	MOQT_REQUEST_ERROR_CODE_UNKNOWN_STATUS_IN_RANGE    MOQT_REQUEST_ERROR_CODE = 0x8 // FETCH only
+	MOQT_REQUEST_ERROR_CODE_MALFORMED_TRACK            MOQT_REQUEST_ERROR_CODE = 0x9
+	MOQT_REQUEST_ERROR_CODE_MALFORMED_AUTH_TOKEN       MOQT_REQUEST_ERROR_CODE = 0x10
+	MOQT_REQUEST_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS   MOQT_REQUEST_ERROR_CODE = 0x11
+	MOQT_REQUEST_ERROR_CODE_EXPIRED_AUTH_TOKEN         MOQT_REQUEST_ERROR_CODE = 0x12
+	MOQT_REQUEST_ERROR_CODE_DUPLICATE_SUBSCRIPTION     MOQT_REQUEST_ERROR_CODE = 0x19
+	MOQT_REQUEST_ERROR_CODE_UNINTERESTED               MOQT_REQUEST_ERROR_CODE = 0x20 // PUBLISH_NAMESPACE and PUBLISH only
+	MOQT_REQUEST_ERROR_CODE_PREFIX_OVERLAP             MOQT_REQUEST_ERROR_CODE = 0x30 // SUBSCRIBE_NAMESPACE only
+)
+
+type MOQT_REQUEST_ERROR struct {
+	RequestID    uint64
+	ErrorCode    MOQT_REQUEST_ERROR_CODE
+	ReasonPhrase MoqtReasonPhrase
+}
+
+func (e MOQT_REQUEST_ERROR) Error() string {
+	return fmt.Sprintf("MOQT Request Error - Request ID: %d, Code: %#X, Reason: %s", e.RequestID, e.ErrorCode, e.ReasonPhrase)
+}
+
+// Status codes of PUBLISH_DONE, TRACK_ENDED and SUBSCRIPTION_ENDED end a subscription normally, the others report an error.
+
+type MOQT_PUBLISH_DONE_STATUS_CODE uint64
+
+const (
+	MOQT_PUBLISH_DONE_STATUS_CODE_INTERNAL_ERROR     MOQT_PUBLISH_DONE_STATUS_CODE = 0x0
+	MOQT_PUBLISH_DONE_STATUS_CODE_UNAUTHORIZED       MOQT_PUBLISH_DONE_STATUS_CODE = 0x1
+	MOQT_PUBLISH_DONE_STATUS_CODE_TRACK_ENDED        MOQT_PUBLISH_DONE_STATUS_CODE = 0x2
+	MOQT_PUBLISH_DONE_STATUS_CODE_SUBSCRIPTION_ENDED MOQT_PUBLISH_DONE_STATUS_CODE = 0x3
+	MOQT_PUBLISH_DONE_STATUS_CODE_GOING_AWAY         MOQT_PUBLISH_DONE_STATUS_CODE = 0x4
+	MOQT_PUBLISH_DONE_STATUS_CODE_EXPIRED            MOQT_PUBLISH_DONE_STATUS_CODE = 0x5
+	MOQT_PUBLISH_DONE_STATUS_CODE_TOO_FAR_BEHIND     MOQT_PUBLISH_DONE_STATUS_CODE = 0x6
+	MOQT_PUBLISH_DONE_STATUS_CODE_MALFORMED_TRACK    MOQT_PUBLISH_DONE_STATUS_CODE = 0x7
+)
+
+// Reports whether the subscription ended without an error
+func (c MOQT_PUBLISH_DONE_STATUS_CODE) IsNormal() bool {
+	return c == MOQT_PUBLISH_DONE_STATUS_CODE_TRACK_ENDED || c == MOQT_PUBLISH_DONE_STATUS_CODE_SUBSCRIPTION_ENDED
+}
+
+type MOQT_PUBLISH_DONE_ERROR struct {
+	RequestID    uint64
+	StatusCode   MOQT_PUBLISH_DONE_STATUS_CODE
+	ReasonPhrase MoqtReasonPhrase
+}
+
+func (e MOQT_PUBLISH_DONE_ERROR) Error() string {
+	return fmt.Sprintf("MOQT Publish Done - Request ID: %d, Status: %#X, Reason: %s", e.RequestID, uint64(e.StatusCode), e.ReasonPhrase)
+}
+
+// Error codes of RESET_STREAM and STOP_SENDING on data streams, the session goes on.
+
+type MOQT_STREAM_RESET_ERROR_CODE uint64
+
+const (
+	MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR        MOQT_STREAM_RESET_ERROR_CODE = 0x0
+	MOQT_STREAM_RESET_ERROR_CODE_CANCELLED             MOQT_STREAM_RESET_ERROR_CODE = 0x1
+	MOQT_STREAM_RESET_ERROR_CODE_DELIVERY_TIMEOUT      MOQT_STREAM_RESET_ERROR_CODE = 0x2
+	MOQT_STREAM_RESET_ERROR_CODE_SESSION_CLOSED        MOQT_STREAM_RESET_ERROR_CODE = 0x3
+	MOQT_STREAM_RESET_ERROR_CODE_UNKNOWN_OBJECT_STATUS MOQT_STREAM_RESET_ERROR_CODE = 0x4
+	MOQT_STREAM_RESET_ERROR_CODE_MALFORMED_TRACK       MOQT_STREAM_RESET_ERROR_CODE = 0x12
+)
+
+type MOQT_STREAM_RESET_ERROR struct {
+	ErrorCode MOQT_STREAM_RESET_ERROR_CODE
+	Remote    bool // Whether the peer reset the stream, rather than us
+}
+
+func (e MOQT_STREAM_RESET_ERROR) Error() string {
+	by := "local"
+	if e.Remote {
+		by = "remote"
+	}
+	return fmt.Sprintf("MOQT Stream Reset Error - Code: %#X (%s)", uint64(e.ErrorCode), by)
+}
@@ -84,3 +84,55 @@ func (ftn MoqtFullTrackName) ToString() string {
 	res += string(ftn.Name)
 	return res
 }
+
+// ToString joins the fields of the namespace with "/", e.g. "live/room1"
+func (ns MoqtTrackNamespace) ToString() string {
+	fields := make([]string, len(ns))
+	for i, field := range ns {
+		fields[i] = string(field)
+	}
+	return strings.Join(fields, "/")
+}
+
+// Equal reports whether both namespaces consist of the same fields.
+func (ns MoqtTrackNamespace) Equal(other MoqtTrackNamespace) bool {
+	if len(ns) != len(other) {
+		return false
+	}
+	for i := range ns {
+		if string(ns[i]) != string(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPrefix reports whether the namespace begins with all fields of prefix, matching is done field by field, not byte by byte.
+// e.g. {"live", "room1"} has the prefix {"live"} but not the prefix {"li"}
+func (ns MoqtTrackNamespace) HasPrefix(prefix MoqtTrackNamespace) bool {
+	if len(prefix) > len(ns) {
+		return false
+	}
+	return ns[:len(prefix)].Equal(prefix)
+}
+
+// Key returns a string that uniquely identifies the namespace, to be used as a map key.
+// Unlike joining the fields with '/', fields containing '/' can't produce collisions since every field is length-prefixed.
+func (ns MoqtTrackNamespace) Key() string {
+	var sb strings.Builder
+	for _, field := range ns {
+		sb.WriteString(fmt.Sprintf("%d:", len(field)))
+		sb.Write(field)
+	}
+	return sb.String()
+}
+
+// Key returns a string that uniquely identifies the full track name, to be used as a map key.
+func (ftn MoqtFullTrackName) Key() string {
+	return fmt.Sprintf("%s|%d:%s", ftn.Namespace.Key(), len(ftn.Name), ftn.Name)
+}
+
+// Equal reports whether both full track names are the same.
+func (ftn MoqtFullTrackName) Equal(other MoqtFullTrackName) bool {
+	return ftn.Namespace.Equal(other.Namespace) && string(ftn.Name) == string(other.Name)
+}
@@ -58,3 +58,44 @@ func TestStringToMoqtFullTrackName(t *testing.T) {
 		})
 	}
 }
+
+func TestMoqtTrackNamespaceHasPrefix(t *testing.T) {
+	ns := MoqtTrackNamespace{[]byte("live"), []byte("room1"), []byte("cam")}
+
+	tests := []struct {
+		name     string
+		prefix   MoqtTrackNamespace
+		expected bool
+	}{
+		{"Empty prefix matches everything", MoqtTrackNamespace{}, true},
+		{"Single field prefix", MoqtTrackNamespace{[]byte("live")}, true},
+		{"Whole namespace", MoqtTrackNamespace{[]byte("live"), []byte("room1"), []byte("cam")}, true},
+		{"Partial field is not a prefix", MoqtTrackNamespace{[]byte("li")}, false},
+		{"Longer than the namespace", MoqtTrackNamespace{[]byte("live"), []byte("room1"), []byte("cam"), []byte("hd")}, false},
+		{"Different field", MoqtTrackNamespace{[]byte("live"), []byte("room2")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ns.HasPrefix(tt.prefix); got != tt.expected {
+				t.Errorf("HasPrefix() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMoqtFullTrackNameKey(t *testing.T) {
+	// Both of these would be "a/b/c" when joined with '/'
+	ftn1 := MoqtFullTrackName{Namespace: MoqtTrackNamespace{[]byte("a/b")}, Name: []byte("c")}
+	ftn2 := MoqtFullTrackName{Namespace: MoqtTrackNamespace{[]byte("a"), []byte("b")}, Name: []byte("c")}
+
+	if ftn1.Key() == ftn2.Key() {
+		t.Errorf("Key() of different full track names collided: %q", ftn1.Key())
+	}
+	if ftn1.Key() != (MoqtFullTrackName{Namespace: MoqtTrackNamespace{[]byte("a/b")}, Name: []byte("c")}).Key() {
+		t.Errorf("Key() of equal full track names differ")
+	}
+	if !ftn1.Equal(ftn1) || ftn1.Equal(ftn2) {
+		t.Errorf("Equal() got unexpected result")
+	}
+}
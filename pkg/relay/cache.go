@@ -0,0 +1,367 @@
+package relay
+
+import (
+	"container/list"
+	"go-moq/pkg/model"
+	"iter"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache stores the objects of the tracks passing through the relay, so FETCHes and joining subscriptions can be answered
+// without going upstream. Objects of every status are stored, they MUST NOT be modified once stored.
+//
+// A cache also records which ranges of a track it holds completely. The objects an upstream subscription delivers form a run,
+// from the location the subscription began at up to the largest one stored. Runs shrink as their objects are evicted or expire,
+// and are cut before a group whose objects were lost on the way, e.g. by the reset of a subgroup stream.
+type Cache interface {
+	// Put stores the object under its full track name and location, replacing the one stored there before.
+	// from is the location the upstream subscription delivering the object began at, it extends the run of the subscription.
+	// maxAge limits how long the object may be served, 0 means as long as the cache keeps it (see control.ParamMaxCacheDuration).
+	// An object preceding from is stored, but isn't part of the run.
+	Put(obj *model.MoqtObject, from model.MoqtLocation, maxAge time.Duration) error
+
+	// Cut ends the run that began at from before the group, as objects of the group were lost. The run isn't extended anymore,
+	// the objects that follow are put with the first location after the group as from, so they start a new run.
+	Cut(ftn model.MoqtFullTrackName, from model.MoqtLocation, groupId uint64) error
+
+	// Covers reports whether the runs of the track hold every object from start up to end, both inclusive.
+	Covers(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) bool
+
+	// Range returns the stored objects of the track from start up to end, both inclusive, in ascending order of location,
+	// or with the groups in descending order if descending is set, the objects of a group stay ascending.
+	// The objects are read as the sequence is iterated, it ends after the first error, e.g. for an object removed meanwhile.
+	Range(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation, descending bool) iter.Seq2[*model.MoqtObject, error]
+
+	// Bounds returns the smallest and the largest location of the track that is stored from start up to end, both inclusive,
+	// ok is false if none is. Use wholeTrack as end for the bounds of everything stored.
+	Bounds(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) (oldest model.MoqtLocation, largest model.MoqtLocation, ok bool)
+}
+
+// The largest location a track can have, to ask a Cache about everything stored from a location on
+var wholeTrack = model.MoqtLocation{GroupId: math.MaxUint64, ObjectId: math.MaxUint64}
+
+// Returns the filter of the locations from start up to end, both inclusive.
+func inRange(start model.MoqtLocation, end model.MoqtLocation) func(loc model.MoqtLocation) bool {
+	return func(loc model.MoqtLocation) bool {
+		return !loc.LessThan(start) && !end.LessThan(loc)
+	}
+}
+
+// Orders the locations of Cache.Range, the groups descending if descending is set, the objects of a group always ascending.
+func rangeLess(a model.MoqtLocation, b model.MoqtLocation, descending bool) bool {
+	if descending && a.GroupId != b.GroupId {
+		return a.GroupId > b.GroupId
+	}
+	return a.LessThan(b)
+}
+
+// Counted for every stored object on top of its payload and extension headers
+const cachedObjectOverhead = 64
+
+// MemoryCache is a Cache that keeps the objects in memory, up to a budget of bytes.
+// When the budget is exceeded whole groups are evicted, the least recently created first, so a cached group never has holes.
+// Expired objects are skipped by reads, a group is dropped once all of its objects expired.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	maxBytes uint64
+	now      func() time.Time
+
+	mu     sync.Mutex
+	tracks map[string]map[uint64]*cachedGroup // Groups of every track, keyed by MoqtFullTrackName.Key() and Group ID
+	runs   map[string]cachedRuns              // Runs of every track that has groups, keyed by MoqtFullTrackName.Key()
+	groups *list.List                         // Every *cachedGroup in the order they were created, the front is evicted first
+	size   uint64                             // Sum of the sizes of all groups
+}
+
+// The objects from start to end were all stored, end is smaller than start once all of them were removed.
+type cachedRun struct {
+	start model.MoqtLocation
+	end   model.MoqtLocation
+}
+
+// The runs of a track, keyed by the location their upstream subscription began at
+type cachedRuns map[model.MoqtLocation]*cachedRun
+
+// Extends the run of the subscription that began at from with the object stored at loc, a new run starts at loc.
+func (runs cachedRuns) extend(from model.MoqtLocation, loc model.MoqtLocation) {
+	if loc.LessThan(from) {
+		return // e.g. an object of the group a run was cut before, that arrived late
+	}
+	run, ok := runs[from]
+	if !ok {
+		runs[from] = &cachedRun{start: loc, end: loc}
+		return
+	}
+	if run.end.LessThan(loc) {
+		run.end = loc
+	}
+}
+
+// Ends the run that began at from before the group, reports whether the run held any of it.
+func (runs cachedRuns) cut(from model.MoqtLocation, groupId uint64) bool {
+	run, ok := runs[from]
+	if !ok || run.end.LessThan(model.MoqtLocation{GroupId: groupId}) {
+		return false
+	}
+	if groupId <= run.start.GroupId {
+		delete(runs, from)
+		return true
+	}
+	run.end = model.MoqtLocation{GroupId: groupId - 1, ObjectId: math.MaxUint64}
+	return true
+}
+
+// Removes a group from the runs holding it. Whatever precedes the group in a run is cut off as well, a run never has holes.
+func (runs cachedRuns) removeGroup(groupId uint64) {
+	for _, run := range runs {
+		if run.start.GroupId <= groupId && groupId <= run.end.GroupId {
+			run.start = model.MoqtLocation{GroupId: groupId + 1}
+		}
+	}
+}
+
+// Cuts the groups below floor off the runs.
+func (runs cachedRuns) raiseFloor(floor uint64) {
+	for _, run := range runs {
+		if run.start.GroupId < floor {
+			run.start = model.MoqtLocation{GroupId: floor}
+		}
+	}
+}
+
+// Reports whether the runs hold every location from start to end. Overlapping runs join, e.g. a subscription that resumed
+// on another upstream at the largest location of the previous one.
+func (runs cachedRuns) cover(start model.MoqtLocation, end model.MoqtLocation) bool {
+	sorted := make([]*cachedRun, 0, len(runs))
+	for _, run := range runs {
+		if !run.end.LessThan(run.start) {
+			sorted = append(sorted, run)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start.LessThan(sorted[j].start)
+	})
+
+	covered, reached := false, start
+	for _, run := range sorted {
+		if run.end.LessThan(reached) {
+			continue
+		}
+		if reached.LessThan(run.start) {
+			break
+		}
+		covered, reached = true, run.end
+	}
+	return covered && !reached.LessThan(end)
+}
+
+type cachedGroup struct {
+	trackKey string
+	id       uint64
+	objects  map[uint64]cachedObject // Keyed by Object ID
+	size     uint64
+	expires  time.Time // When the last of its objects expires, zero if one of them never does
+	elem     *list.Element
+}
+
+type cachedObject struct {
+	obj     *model.MoqtObject
+	size    uint64
+	expires time.Time // Zero if it never expires
+}
+
+func NewMemoryCache(maxBytes uint64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		tracks:   make(map[string]map[uint64]*cachedGroup),
+		runs:     make(map[string]cachedRuns),
+		groups:   list.New(),
+	}
+}
+
+// The bytes an object is accounted for in the budget.
+func cachedObjectSize(obj *model.MoqtObject) uint64 {
+	size := uint64(len(obj.Payload)) + cachedObjectOverhead
+	for _, ext := range obj.ExtensionHeaders {
+		size += uint64(len(ext.ValueBytes)) + 16
+	}
+	return size
+}
+
+// Size returns the bytes the stored objects take up in the budget.
+func (c *MemoryCache) Size() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Put stores the object, an object larger than the whole budget is not stored.
+func (c *MemoryCache) Put(obj *model.MoqtObject, from model.MoqtLocation, maxAge time.Duration) error {
+	size := cachedObjectSize(obj)
+	if size > c.maxBytes {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.dropExpired(now)
+
+	key := obj.FullTrackName.Key()
+	groups, ok := c.tracks[key]
+	if !ok {
+		groups = make(map[uint64]*cachedGroup)
+		c.tracks[key] = groups
+		c.runs[key] = make(cachedRuns)
+	}
+	g, ok := groups[obj.Location.GroupId]
+	if !ok {
+		g = &cachedGroup{trackKey: key, id: obj.Location.GroupId, objects: make(map[uint64]cachedObject)}
+		g.elem = c.groups.PushBack(g)
+		groups[g.id] = g
+	}
+
+	if old, ok := g.objects[obj.Location.ObjectId]; ok {
+		g.size -= old.size
+		c.size -= old.size
+	}
+	co := cachedObject{obj: obj, size: size}
+	if maxAge > 0 {
+		co.expires = now.Add(maxAge)
+	}
+	g.objects[obj.Location.ObjectId] = co
+	g.size += size
+	c.size += size
+	g.expires = groupExpiry(g)
+	c.runs[key].extend(from, obj.Location)
+
+	for c.size > c.maxBytes {
+		c.evict(c.groups.Front().Value.(*cachedGroup))
+	}
+	return nil
+}
+
+func (c *MemoryCache) Cut(ftn model.MoqtFullTrackName, from model.MoqtLocation, groupId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if runs, ok := c.runs[ftn.Key()]; ok {
+		runs.cut(from, groupId)
+	}
+	return nil
+}
+
+// When the last object of the group expires, zero if one of them never does.
+func groupExpiry(g *cachedGroup) time.Time {
+	var expires time.Time
+	for _, co := range g.objects {
+		if co.expires.IsZero() {
+			return time.Time{}
+		}
+		if co.expires.After(expires) {
+			expires = co.expires
+		}
+	}
+	return expires
+}
+
+// Must be called with c.mu held
+func (c *MemoryCache) evict(g *cachedGroup) {
+	c.groups.Remove(g.elem)
+	c.size -= g.size
+
+	groups := c.tracks[g.trackKey]
+	delete(groups, g.id)
+	c.runs[g.trackKey].removeGroup(g.id)
+	if len(groups) == 0 {
+		delete(c.tracks, g.trackKey)
+		delete(c.runs, g.trackKey)
+	}
+}
+
+// Drops the groups whose objects all expired, must be called with c.mu held.
+func (c *MemoryCache) dropExpired(now time.Time) {
+	for e := c.groups.Front(); e != nil; {
+		next := e.Next()
+		g := e.Value.(*cachedGroup)
+		if !g.expires.IsZero() && !now.Before(g.expires) {
+			c.evict(g)
+		}
+		e = next
+	}
+}
+
+// Returns the objects of the track that didn't expire, in the order of Range. Must be called with c.mu held.
+func (c *MemoryCache) objects(ftn model.MoqtFullTrackName, descending bool, keep func(loc model.MoqtLocation) bool) []*model.MoqtObject {
+	now := c.now()
+	var objects []*model.MoqtObject
+	for _, g := range c.tracks[ftn.Key()] {
+		for _, co := range g.objects {
+			if !co.expires.IsZero() && !now.Before(co.expires) {
+				continue
+			}
+			if keep(co.obj.Location) {
+				objects = append(objects, co.obj)
+			}
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return rangeLess(objects[i].Location, objects[j].Location, descending)
+	})
+	return objects
+}
+
+func (c *MemoryCache) Covers(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := ftn.Key()
+	if !c.runs[key].cover(start, end) {
+		return false
+	}
+	// Expired objects are only dropped with their whole group, until then they are holes
+	now := c.now()
+	for _, g := range c.tracks[key] {
+		if g.id < start.GroupId || g.id > end.GroupId {
+			continue
+		}
+		for _, co := range g.objects {
+			loc := co.obj.Location
+			if !co.expires.IsZero() && !now.Before(co.expires) && !loc.LessThan(start) && !end.LessThan(loc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Range returns the objects stored when the iteration begins, they are in memory already.
+func (c *MemoryCache) Range(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation, descending bool) iter.Seq2[*model.MoqtObject, error] {
+	return func(yield func(*model.MoqtObject, error) bool) {
+		c.mu.Lock()
+		objects := c.objects(ftn, descending, inRange(start, end))
+		c.mu.Unlock()
+
+		for _, obj := range objects {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *MemoryCache) Bounds(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) (model.MoqtLocation, model.MoqtLocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	objects := c.objects(ftn, false, inRange(start, end))
+	if len(objects) == 0 {
+		return model.MoqtLocation{}, model.MoqtLocation{}, false
+	}
+	return objects[0].Location, objects[len(objects)-1].Location, true
+}
@@ -0,0 +1,221 @@
+package relay
+
+import (
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func cacheObject(track model.MoqtFullTrackName, groupId uint64, objectId uint64, payload string) *model.MoqtObject {
+	return &model.MoqtObject{
+		Location:                   model.MoqtLocation{GroupId: groupId, ObjectId: objectId},
+		FullTrackName:              track,
+		ObjectForwardingPreference: model.Subgroup,
+		Payload:                    []byte(payload),
+	}
+}
+
+func cachedObjects(t *testing.T, c Cache, track model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation, descending bool) []*model.MoqtObject {
+	t.Helper()
+	var objects []*model.MoqtObject
+	for obj, err := range c.Range(track, start, end, descending) {
+		if err != nil {
+			t.Fatalf("Range() unexpected error: %v", err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+func cachedLocations(t *testing.T, c Cache, track model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) []model.MoqtLocation {
+	t.Helper()
+	objects := cachedObjects(t, c, track, start, end, false)
+	locs := make([]model.MoqtLocation, 0, len(objects))
+	for _, obj := range objects {
+		locs = append(locs, obj.Location)
+	}
+	return locs
+}
+
+func equalLocations(a []model.MoqtLocation, b []model.MoqtLocation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryCache(t *testing.T) {
+	video, audio := testutil.FullTrackName("video", "live"), testutil.FullTrackName("audio", "live")
+	objectSize := cachedObjectSize(cacheObject(video, 0, 0, "data"))
+	c := NewMemoryCache(5 * objectSize)
+
+	for _, obj := range []*model.MoqtObject{
+		cacheObject(video, 0, 0, "data"),
+		cacheObject(video, 1, 1, "data"),
+		cacheObject(video, 1, 0, "data"),
+		cacheObject(audio, 0, 0, "data"),
+	} {
+		if err := c.Put(obj, model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put() unexpected error: %v", err)
+		}
+	}
+
+	got := cachedLocations(t, c, video, model.MoqtLocation{GroupId: 0, ObjectId: 0}, model.MoqtLocation{GroupId: 1, ObjectId: 0})
+	if want := []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 1, ObjectId: 0}}; !equalLocations(got, want) {
+		t.Errorf("Range() = %+v, want %+v", got, want)
+	}
+	if oldest, largest, ok := c.Bounds(video, model.MoqtLocation{}, wholeTrack); !ok || oldest != (model.MoqtLocation{}) || largest != (model.MoqtLocation{GroupId: 1, ObjectId: 1}) {
+		t.Errorf("Bounds() = %+v, %+v, %v, want {0 0}, {1 1}, true", oldest, largest, ok)
+	}
+	if oldest, largest, ok := c.Bounds(video, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0}); !ok || oldest != (model.MoqtLocation{GroupId: 1}) || largest != oldest {
+		t.Errorf("Bounds() of {0 1} to {1 0} = %+v, %+v, %v, want {1 0}, {1 0}, true", oldest, largest, ok)
+	}
+
+	// Descending groups keep their objects in ascending order
+	got = nil
+	for _, obj := range cachedObjects(t, c, video, model.MoqtLocation{}, wholeTrack, true) {
+		got = append(got, obj.Location)
+	}
+	if want := []model.MoqtLocation{{GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}, {GroupId: 0, ObjectId: 0}}; !equalLocations(got, want) {
+		t.Errorf("Range() descending = %+v, want %+v", got, want)
+	}
+
+	// Replacing an object doesn't count it twice
+	if err := c.Put(cacheObject(video, 1, 1, "data"), model.MoqtLocation{}, 0); err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	if c.Size() != 4*objectSize {
+		t.Errorf("Size() after replacing = %d, want %d", c.Size(), 4*objectSize)
+	}
+
+	// Exceeding the budget evicts the whole group created first, not only its object
+	for objectId := uint64(0); objectId < 2; objectId++ {
+		if err := c.Put(cacheObject(video, 2, objectId, "data"), model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put() unexpected error: %v", err)
+		}
+	}
+	got = cachedLocations(t, c, video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 2, ObjectId: 1})
+	if want := []model.MoqtLocation{{GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}, {GroupId: 2, ObjectId: 0}, {GroupId: 2, ObjectId: 1}}; !equalLocations(got, want) {
+		t.Errorf("Range() after eviction = %+v, want %+v", got, want)
+	}
+	if _, _, ok := c.Bounds(audio, model.MoqtLocation{}, wholeTrack); !ok {
+		t.Errorf("Bounds() of the other track reports it as evicted, only video group 0 was created before it")
+	}
+}
+
+func TestMemoryCacheCovers(t *testing.T) {
+	video := testutil.FullTrackName("video", "live")
+	objectSize := cachedObjectSize(cacheObject(video, 0, 0, "data"))
+	c := NewMemoryCache(5 * objectSize)
+	put := func(from model.MoqtLocation, locs ...model.MoqtLocation) {
+		t.Helper()
+		for _, loc := range locs {
+			if err := c.Put(cacheObject(video, loc.GroupId, loc.ObjectId, "data"), from, 0); err != nil {
+				t.Fatalf("Put() unexpected error: %v", err)
+			}
+		}
+	}
+	covers := func(start model.MoqtLocation, end model.MoqtLocation, want bool) {
+		t.Helper()
+		if got := c.Covers(video, start, end); got != want {
+			t.Errorf("Covers(%+v, %+v) = %v, want %v", start, end, got, want)
+		}
+	}
+	wholeGroup := func(groupId uint64) model.MoqtLocation {
+		return model.MoqtLocation{GroupId: groupId, ObjectId: math.MaxUint64}
+	}
+
+	// Two subscriptions, with a gap in between
+	put(model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: 0}, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0})
+	put(model.MoqtLocation{GroupId: 3}, model.MoqtLocation{GroupId: 3, ObjectId: 0})
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: 0}, true)
+	covers(model.MoqtLocation{GroupId: 0, ObjectId: 1}, wholeGroup(0), true)
+	covers(model.MoqtLocation{}, wholeGroup(1), false) // Group 1 may still grow
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 3, ObjectId: 0}, false)
+
+	// A subscription overlapping both closes the gap
+	put(model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0}, model.MoqtLocation{GroupId: 2, ObjectId: 0}, model.MoqtLocation{GroupId: 3, ObjectId: 0})
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 3, ObjectId: 0}, true)
+
+	// Evicting the oldest group cuts it off the runs
+	put(model.MoqtLocation{GroupId: 3}, model.MoqtLocation{GroupId: 4, ObjectId: 0})
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 4, ObjectId: 0}, false)
+	covers(model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 4, ObjectId: 0}, true)
+}
+
+func TestMemoryCacheCut(t *testing.T) {
+	video := testutil.FullTrackName("video", "live")
+	c := NewMemoryCache(1 << 20)
+	put := func(from model.MoqtLocation, locs ...model.MoqtLocation) {
+		t.Helper()
+		for _, loc := range locs {
+			if err := c.Put(cacheObject(video, loc.GroupId, loc.ObjectId, "data"), from, 0); err != nil {
+				t.Fatalf("Put() unexpected error: %v", err)
+			}
+		}
+	}
+	covers := func(start model.MoqtLocation, end model.MoqtLocation, want bool) {
+		t.Helper()
+		if got := c.Covers(video, start, end); got != want {
+			t.Errorf("Covers(%+v, %+v) = %v, want %v", start, end, got, want)
+		}
+	}
+
+	// Objects of group 1 were lost, the run ends before it and the objects after it start a new one
+	put(model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: 0}, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0})
+	if err := c.Cut(video, model.MoqtLocation{}, 1); err != nil {
+		t.Fatalf("Cut() unexpected error: %v", err)
+	}
+	put(model.MoqtLocation{GroupId: 2}, model.MoqtLocation{GroupId: 1, ObjectId: 2}, model.MoqtLocation{GroupId: 2, ObjectId: 0}, model.MoqtLocation{GroupId: 2, ObjectId: 1})
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: math.MaxUint64}, true)
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: 0}, false)
+	covers(model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 2}, false)
+	covers(model.MoqtLocation{GroupId: 2}, model.MoqtLocation{GroupId: 2, ObjectId: 1}, true)
+	covers(model.MoqtLocation{}, model.MoqtLocation{GroupId: 2, ObjectId: 1}, false)
+
+	// Cutting the group a run began in removes the run
+	if err := c.Cut(video, model.MoqtLocation{GroupId: 2}, 2); err != nil {
+		t.Fatalf("Cut() unexpected error: %v", err)
+	}
+	covers(model.MoqtLocation{GroupId: 2}, model.MoqtLocation{GroupId: 2, ObjectId: 0}, false)
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	video := testutil.FullTrackName("video", "live")
+	now := time.Unix(1000, 0)
+	c := NewMemoryCache(1 << 20)
+	c.now = func() time.Time { return now }
+
+	c.Put(cacheObject(video, 0, 0, "short"), model.MoqtLocation{}, time.Second)
+	c.Put(cacheObject(video, 0, 1, "long"), model.MoqtLocation{}, time.Minute)
+	c.Put(cacheObject(video, 1, 0, "forever"), model.MoqtLocation{}, 0)
+
+	now = now.Add(2 * time.Second)
+	got := cachedLocations(t, c, video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: 0})
+	if want := []model.MoqtLocation{{GroupId: 0, ObjectId: 1}, {GroupId: 1, ObjectId: 0}}; !equalLocations(got, want) {
+		t.Errorf("Range() after the first expiry = %+v, want %+v", got, want)
+	}
+	if c.Covers(video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: 0}) {
+		t.Errorf("Covers() reports the range with an expired object as complete")
+	}
+	if !c.Covers(video, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0}) {
+		t.Errorf("Covers() reports the range after the expired object as incomplete")
+	}
+
+	// A group is dropped once all of its objects expired
+	now = now.Add(time.Minute)
+	c.Put(cacheObject(video, 2, 0, "forever"), model.MoqtLocation{}, 0)
+	if oldest, _, ok := c.Bounds(video, model.MoqtLocation{}, wholeTrack); !ok || oldest != (model.MoqtLocation{GroupId: 1, ObjectId: 0}) {
+		t.Errorf("Bounds() oldest = %+v, %v, want {1 0}", oldest, ok)
+	}
+	if want := 2 * cachedObjectSize(cacheObject(video, 1, 0, "forever")); c.Size() != want {
+		t.Errorf("Size() = %d, want %d", c.Size(), want)
+	}
+}
@@ -0,0 +1,724 @@
+package relay
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Size from which a segment file is finished, the next group of the track starts a new one
+const defaultSegmentBytes = 16 << 20
+
+const segmentSuffix = ".seg"
+
+var recordChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A segment file is a sequence of records, one for each stored object:
+//
+//	Record {
+//	  Body Length (32),
+//	  Body Checksum (32), CRC-32C of the body
+//	  Body {
+//	    Location (..),
+//	    Run Start (Location), where the upstream subscription that delivered the object began, see Cache
+//	    Subgroup ID (i),
+//	    Publisher Priority (8),
+//	    Object Forwarding Preference (i),
+//	    Object Status (i),
+//	    Expires (i), Unix time in milliseconds, 0 if the object never expires
+//	    Extensions (..),
+//	    Payload (..), the rest of the body
+//	  }
+//	}
+const recordHeaderLength = 8
+
+// The cuts of the runs of a track (see Cache.Cut) are appended to a file next to its segments, and applied
+// to the runs rebuilt from the segments:
+//
+//	Cut {
+//	  Run Start (Location),
+//	  Group ID (i),
+//	}
+const cutsFileName = "cuts"
+
+// DiskStore is a Cache that persists the objects on local disk, so they survive restarts, e.g. for replay.
+// Every track has its own directory, objects are appended to its segment files, each named after the group that started it.
+// The index of the objects is kept in memory and rebuilt from the segment files by OpenDiskStore, along with the runs
+// of the tracks, so the ranges stored completely can still be served after a restart.
+//
+// Retention removes whole segments, the oldest of a track first, along with every group it holds.
+// Segments are removed once they weren't written for maxAge, and while the segment files are larger than maxBytes
+// in the order they were created (after a restart, in the order they were last written).
+// Writes are not synced to stable storage before Close, a record torn by a crash is cut off by the next OpenDiskStore.
+// It is safe for concurrent use.
+type DiskStore struct {
+	dir          string
+	maxBytes     uint64
+	maxAge       time.Duration
+	segmentBytes int64
+	now          func() time.Time
+
+	mu         sync.Mutex
+	tracks     map[string]*diskTrack // Keyed by the name of the track's directory
+	segments   *list.List            // Every *segment in the order they were created, the front is removed first when over maxBytes
+	size       uint64                // Sum of the sizes of all segment files
+	nextAgeOut time.Time             // When the next segment is due for removal by maxAge, zero if none is
+	closed     bool
+}
+
+type diskTrack struct {
+	dir      string
+	segments []*segment                      // In the order they were created, objects are appended to the last one
+	floor    uint64                          // Groups below were removed by retention, or precede the first stored group
+	groups   map[uint64]map[uint64]diskEntry // Keyed by Group ID and Object ID
+	runs     cachedRuns
+}
+
+type segment struct {
+	track     *diskTrack
+	start     uint64 // The group that started the segment, later segments start with larger groups
+	lastGroup uint64 // Largest group stored in the segment
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+	elem      *list.Element
+}
+
+// Where the record body of an object is stored
+type diskEntry struct {
+	seg     *segment
+	offset  int64
+	length  int
+	expires time.Time // Zero if it never expires
+}
+
+// OpenDiskStore opens the store in dir, creating the directory if needed, and recovers the objects stored there before.
+// maxBytes and maxAge limit the retention, 0 doesn't limit it.
+func OpenDiskStore(dir string, maxBytes uint64, maxAge time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("OpenDiskStore(): Failed to create %s: %w", dir, err)
+	}
+
+	s := &DiskStore{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		maxAge:       maxAge,
+		segmentBytes: defaultSegmentBytes,
+		now:          time.Now,
+		tracks:       make(map[string]*diskTrack),
+		segments:     list.New(),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("OpenDiskStore(): Failed to read %s: %w", dir, err)
+	}
+	var recovered []*segment
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t, err := s.recoverTrack(entry.Name())
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("OpenDiskStore(): %w", err)
+		}
+		if t != nil {
+			s.tracks[entry.Name()] = t
+			recovered = append(recovered, t.segments...)
+		}
+	}
+
+	sort.SliceStable(recovered, func(i, j int) bool {
+		return recovered[i].lastWrite.Before(recovered[j].lastWrite)
+	})
+	for _, seg := range recovered {
+		seg.elem = s.segments.PushBack(seg)
+		s.size += uint64(seg.size)
+	}
+
+	s.retain(s.now())
+	return s, nil
+}
+
+// The name of the directory of a track, the full track name can be too long or contain bytes not allowed in file names.
+func trackDirName(ftn model.MoqtFullTrackName) string {
+	sum := sha256.Sum256([]byte(ftn.Key()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Rebuilds the index of a track directory, nil is returned for a directory without segments.
+func (s *DiskStore) recoverTrack(name string) (*diskTrack, error) {
+	t := newDiskTrack(filepath.Join(s.dir, name), 0)
+
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", t.dir, err)
+	}
+	// Names are zero-padded, so they are read in the order the segments were created
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := recoverSegment(t, filepath.Join(t.dir, entry.Name()), start)
+		if err != nil {
+			for _, seg := range t.segments {
+				seg.file.Close()
+			}
+			return nil, err
+		}
+		t.segments = append(t.segments, seg)
+	}
+
+	if len(t.segments) == 0 {
+		return nil, nil
+	}
+	if err := recoverCuts(t); err != nil {
+		for _, seg := range t.segments {
+			seg.file.Close()
+		}
+		return nil, err
+	}
+	t.floor = t.segments[0].start
+	t.dropBelowFloor()
+	return t, nil
+}
+
+// Indexes the records of a segment file. A torn or corrupt record, left by a crash, is cut off with everything after it.
+func recoverSegment(t *diskTrack, path string, start uint64) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to stat %s: %w", path, err)
+	}
+
+	seg := &segment{track: t, start: start, lastGroup: start, file: f, lastWrite: info.ModTime()}
+	r := bufio.NewReader(f)
+	for {
+		body, err := readRecord(r, info.Size()-seg.size)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+		if body == nil {
+			break
+		}
+		obj, from, expires, err := decodeRecord(body)
+		if err != nil {
+			break
+		}
+
+		t.index(obj.Location, diskEntry{seg: seg, offset: seg.size + recordHeaderLength, length: len(body), expires: expires})
+		t.runs.extend(from, obj.Location)
+		seg.size += recordHeaderLength + int64(len(body))
+		seg.lastGroup = max(seg.lastGroup, obj.Location.GroupId)
+	}
+
+	if seg.size < info.Size() {
+		fmt.Printf("[WARN] DiskStore: Cutting off %d bytes of %s left by an interrupted write\n", info.Size()-seg.size, path)
+		if err := f.Truncate(seg.size); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Failed to truncate %s: %w", path, err)
+		}
+	}
+	return seg, nil
+}
+
+// Applies the cuts of the track to the runs recovered from its segments. A cut torn by a crash was never applied, it is ignored.
+func recoverCuts(t *diskTrack) error {
+	data, err := os.ReadFile(filepath.Join(t.dir, cutsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read the cuts of %s: %w", t.dir, err)
+	}
+	for len(data) > 0 {
+		from, n, err := message.DecodeMoqtLocation(data)
+		if err != nil {
+			break
+		}
+		groupId, m, err := quicvarint.Parse(data[n:])
+		if err != nil {
+			break
+		}
+		t.runs.cut(from, groupId)
+		data = data[n+m:]
+	}
+	return nil
+}
+
+// Returns the body of the next record, nil if there is no complete and intact record left. remaining is the number of unread bytes.
+func readRecord(r io.Reader, remaining int64) ([]byte, error) {
+	var header [recordHeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > remaining-recordHeaderLength {
+		return nil, nil
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if crc32.Checksum(body, recordChecksumTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, nil
+	}
+	return body, nil
+}
+
+func encodeRecord(obj *model.MoqtObject, from model.MoqtLocation, expires time.Time) []byte {
+	record := make([]byte, recordHeaderLength, recordHeaderLength+48+len(obj.Payload))
+	message.EncodeMoqtLocation(&record, obj.Location)
+	message.EncodeMoqtLocation(&record, from)
+	record = quicvarint.Append(record, obj.SubgroupID)
+	record = append(record, obj.PublisherPriority)
+	record = quicvarint.Append(record, uint64(obj.ObjectForwardingPreference))
+	record = quicvarint.Append(record, uint64(obj.ObjectStatus))
+	var expiresMs uint64
+	if !expires.IsZero() {
+		expiresMs = uint64(expires.UnixMilli())
+	}
+	record = quicvarint.Append(record, expiresMs)
+	message.EncodeExtensions(&record, obj.ExtensionHeaders)
+	record = append(record, obj.Payload...)
+
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(record)-recordHeaderLength))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(record[recordHeaderLength:], recordChecksumTable))
+	return record
+}
+
+// Decodes a record body into the object, without its full track name, the start of its run and when it expires.
+func decodeRecord(body []byte) (*model.MoqtObject, model.MoqtLocation, time.Time, error) {
+	loc, n, err := message.DecodeMoqtLocation(body)
+	if err != nil {
+		return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse Location: %w", err)
+	}
+	body = body[n:]
+
+	from, n, err := message.DecodeMoqtLocation(body)
+	if err != nil {
+		return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse Run Start: %w", err)
+	}
+	body = body[n:]
+
+	subgroupId, n, err := quicvarint.Parse(body)
+	if err != nil {
+		return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse Subgroup ID: %w", err)
+	}
+	body = body[n:]
+
+	if len(body) == 0 {
+		return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse Publisher Priority: %w", io.ErrUnexpectedEOF)
+	}
+	priority := body[0]
+	body = body[1:]
+
+	var fields [3]uint64 // Object Forwarding Preference, Object Status, Expires
+	for i := range fields {
+		fields[i], n, err = quicvarint.Parse(body)
+		if err != nil {
+			return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse field %d: %w", i, err)
+		}
+		body = body[n:]
+	}
+
+	extensions, n, err := message.DecodeExtensions(body)
+	if err != nil {
+		return nil, model.MoqtLocation{}, time.Time{}, fmt.Errorf("decodeRecord: failed to parse Extensions: %w", err)
+	}
+	if len(extensions) == 0 {
+		extensions = nil
+	}
+	body = body[n:]
+	if len(body) == 0 {
+		body = nil
+	}
+
+	var expires time.Time
+	if fields[2] != 0 {
+		expires = time.UnixMilli(int64(fields[2]))
+	}
+	return &model.MoqtObject{
+		Location:                   loc,
+		SubgroupID:                 subgroupId,
+		PublisherPriority:          priority,
+		ObjectForwardingPreference: model.MoqtObjectForwardingPreference(fields[0]),
+		ObjectStatus:               model.MoqtObjectStatus(fields[1]),
+		ExtensionHeaders:           extensions,
+		Payload:                    body,
+	}, from, expires, nil
+}
+
+func newDiskTrack(dir string, floor uint64) *diskTrack {
+	return &diskTrack{dir: dir, floor: floor, groups: make(map[uint64]map[uint64]diskEntry), runs: make(cachedRuns)}
+}
+
+func (t *diskTrack) index(loc model.MoqtLocation, e diskEntry) {
+	objects, ok := t.groups[loc.GroupId]
+	if !ok {
+		objects = make(map[uint64]diskEntry)
+		t.groups[loc.GroupId] = objects
+	}
+	objects[loc.ObjectId] = e
+}
+
+func (t *diskTrack) dropBelowFloor() {
+	for groupId := range t.groups {
+		if groupId < t.floor {
+			delete(t.groups, groupId)
+		}
+	}
+	t.runs.raiseFloor(t.floor)
+}
+
+type indexedObject struct {
+	loc model.MoqtLocation
+	e   diskEntry
+}
+
+// Returns the objects of the track that didn't expire, in the order of Range.
+func (t *diskTrack) objects(now time.Time, descending bool, keep func(loc model.MoqtLocation) bool) []indexedObject {
+	var objects []indexedObject
+	for groupId, group := range t.groups {
+		for objectId, e := range group {
+			loc := model.MoqtLocation{GroupId: groupId, ObjectId: objectId}
+			if !e.expires.IsZero() && !now.Before(e.expires) {
+				continue
+			}
+			if keep(loc) {
+				objects = append(objects, indexedObject{loc: loc, e: e})
+			}
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return rangeLess(objects[i].loc, objects[j].loc, descending)
+	})
+	return objects
+}
+
+// Put appends the object to the last segment of its track. Objects of groups removed by retention,
+// or preceding the first group stored for the track, are not stored.
+func (s *DiskStore) Put(obj *model.MoqtObject, from model.MoqtLocation, maxAge time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("DiskStore.Put(): The store is closed")
+	}
+
+	now := s.now()
+	name := trackDirName(obj.FullTrackName)
+	t, ok := s.tracks[name]
+	if !ok {
+		t = newDiskTrack(filepath.Join(s.dir, name), obj.Location.GroupId)
+		s.tracks[name] = t
+	}
+	if obj.Location.GroupId < t.floor {
+		return nil
+	}
+
+	seg, err := s.writableSegment(t, obj.Location.GroupId, now)
+	if err != nil {
+		return fmt.Errorf("DiskStore.Put(): %w", err)
+	}
+
+	var expires time.Time
+	if maxAge > 0 {
+		expires = now.Add(maxAge)
+	}
+	record := encodeRecord(obj, from, expires)
+	if _, err := seg.file.Write(record); err != nil {
+		seg.file.Truncate(seg.size) // Don't leave a torn record in front of the next one
+		return fmt.Errorf("DiskStore.Put(): Failed to append to %s: %w", seg.file.Name(), err)
+	}
+
+	t.index(obj.Location, diskEntry{seg: seg, offset: seg.size + recordHeaderLength, length: len(record) - recordHeaderLength, expires: expires})
+	t.runs.extend(from, obj.Location)
+	seg.size += int64(len(record))
+	seg.lastGroup = max(seg.lastGroup, obj.Location.GroupId)
+	seg.lastWrite = now
+	s.size += uint64(len(record))
+
+	s.retain(now)
+	return nil
+}
+
+// Returns the segment to append an object of the group to. A full segment is finished once a new group starts,
+// so the groups of a segment always precede the ones started in the next.
+func (s *DiskStore) writableSegment(t *diskTrack, groupId uint64, now time.Time) (*segment, error) {
+	if n := len(t.segments); n > 0 {
+		seg := t.segments[n-1]
+		if seg.size < s.segmentBytes || groupId <= seg.lastGroup {
+			return seg, nil
+		}
+	}
+
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to create %s: %w", t.dir, err)
+	}
+	path := filepath.Join(t.dir, fmt.Sprintf("%020d%s", groupId, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create %s: %w", path, err)
+	}
+
+	seg := &segment{track: t, start: groupId, lastGroup: groupId, file: f, lastWrite: now}
+	seg.elem = s.segments.PushBack(seg)
+	t.segments = append(t.segments, seg)
+	return seg, nil
+}
+
+// Removes the segments that weren't written for maxAge, then the oldest ones while over maxBytes. Must be called with s.mu held.
+func (s *DiskStore) retain(now time.Time) {
+	if s.maxAge > 0 {
+		for _, t := range s.tracks {
+			for len(t.segments) > 0 && now.Sub(t.segments[0].lastWrite) >= s.maxAge {
+				s.removeOldest(t)
+			}
+		}
+	}
+	for s.maxBytes > 0 && s.size > s.maxBytes {
+		s.removeOldest(s.segments.Front().Value.(*segment).track)
+	}
+
+	// Only the last segment of a track is written, so the first one is always the next to age out
+	s.nextAgeOut = time.Time{}
+	if s.maxAge > 0 {
+		for _, t := range s.tracks {
+			if len(t.segments) == 0 {
+				continue
+			}
+			at := t.segments[0].lastWrite.Add(s.maxAge)
+			if s.nextAgeOut.IsZero() || at.Before(s.nextAgeOut) {
+				s.nextAgeOut = at
+			}
+		}
+	}
+}
+
+// Runs the retention for the reads, only once a segment aged out, the size only grows with Put. Must be called with s.mu held.
+func (s *DiskStore) retainIfDue(now time.Time) {
+	if !s.nextAgeOut.IsZero() && !now.Before(s.nextAgeOut) {
+		s.retain(now)
+	}
+}
+
+// Removes the oldest segment of the track with all of its groups, must be called with s.mu held.
+func (s *DiskStore) removeOldest(t *diskTrack) {
+	seg := t.segments[0]
+	t.segments = t.segments[1:]
+	s.segments.Remove(seg.elem)
+	s.size -= uint64(seg.size)
+
+	seg.file.Close()
+	if err := os.Remove(seg.file.Name()); err != nil {
+		fmt.Printf("[WARN] DiskStore: Failed to remove %s: %v\n", seg.file.Name(), err)
+	}
+
+	// Late objects of the removed groups in later segments are dropped as well, so no group is left with holes
+	if len(t.segments) > 0 {
+		t.floor = t.segments[0].start
+	} else {
+		t.floor = seg.lastGroup + 1
+		os.Remove(filepath.Join(t.dir, cutsFileName)) // No run is left to cut
+		os.Remove(t.dir)                              // Only succeeds if it is empty
+	}
+	t.dropBelowFloor()
+}
+
+// Cut is appended to the cuts of the track, so it survives a restart. If that fails, it still applies until then.
+func (s *DiskStore) Cut(ftn model.MoqtFullTrackName, from model.MoqtLocation, groupId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("DiskStore.Cut(): The store is closed")
+	}
+	t, ok := s.tracks[trackDirName(ftn)]
+	if !ok {
+		return nil
+	}
+	if !t.runs.cut(from, groupId) {
+		return nil // The run doesn't hold any of the group
+	}
+
+	var cut []byte
+	message.EncodeMoqtLocation(&cut, from)
+	cut = quicvarint.Append(cut, groupId)
+	path := filepath.Join(t.dir, cutsFileName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("DiskStore.Cut(): Failed to open %s: %w", path, err)
+	}
+	_, err = f.Write(cut)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("DiskStore.Cut(): Failed to append to %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *DiskStore) Covers(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	now := s.now()
+	s.retainIfDue(now)
+
+	t, ok := s.tracks[trackDirName(ftn)]
+	if !ok || !t.runs.cover(start, end) {
+		return false
+	}
+	// Expired objects are only removed with their segment, until then they are holes
+	for groupId, group := range t.groups {
+		if groupId < start.GroupId || groupId > end.GroupId {
+			continue
+		}
+		for objectId, e := range group {
+			loc := model.MoqtLocation{GroupId: groupId, ObjectId: objectId}
+			if !e.expires.IsZero() && !now.Before(e.expires) && !loc.LessThan(start) && !end.LessThan(loc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Range only holds the lock of the store to look the objects up when the iteration begins, their records are read without it.
+// An object whose segment is removed by retention before it is read ends the sequence with an error.
+func (s *DiskStore) Range(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation, descending bool) iter.Seq2[*model.MoqtObject, error] {
+	return func(yield func(*model.MoqtObject, error) bool) {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			yield(nil, fmt.Errorf("DiskStore.Range(): The store is closed"))
+			return
+		}
+		now := s.now()
+		s.retainIfDue(now)
+
+		var indexed []indexedObject
+		if t, ok := s.tracks[trackDirName(ftn)]; ok {
+			indexed = t.objects(now, descending, inRange(start, end))
+		}
+		s.mu.Unlock()
+
+		for _, o := range indexed {
+			obj, err := readObject(o)
+			if err != nil {
+				yield(nil, fmt.Errorf("DiskStore.Range(): %w", err))
+				return
+			}
+			obj.FullTrackName = ftn
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Reads the record of an object from its segment, the file of a removed segment is closed.
+func readObject(o indexedObject) (*model.MoqtObject, error) {
+	body := make([]byte, o.e.length)
+	if _, err := o.e.seg.file.ReadAt(body, o.e.offset); err != nil {
+		if errors.Is(err, os.ErrClosed) {
+			return nil, fmt.Errorf("Object %v was removed before it was read", o.loc)
+		}
+		return nil, fmt.Errorf("Failed to read %s: %w", o.e.seg.file.Name(), err)
+	}
+	obj, _, _, err := decodeRecord(body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode object %v of %s: %w", o.loc, o.e.seg.file.Name(), err)
+	}
+	return obj, nil
+}
+
+func (s *DiskStore) Bounds(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) (model.MoqtLocation, model.MoqtLocation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return model.MoqtLocation{}, model.MoqtLocation{}, false
+	}
+	now := s.now()
+	s.retainIfDue(now)
+
+	t, ok := s.tracks[trackDirName(ftn)]
+	if !ok {
+		return model.MoqtLocation{}, model.MoqtLocation{}, false
+	}
+	indexed := t.objects(now, false, inRange(start, end))
+	if len(indexed) == 0 {
+		return model.MoqtLocation{}, model.MoqtLocation{}, false
+	}
+	return indexed[0].loc, indexed[len(indexed)-1].loc, true
+}
+
+// Size returns the bytes taken up by the segment files.
+func (s *DiskStore) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close syncs the segment files to stable storage and closes them, the store can't be used afterwards.
+func (s *DiskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	for _, t := range s.tracks {
+		for _, seg := range t.segments {
+			if err := seg.file.Sync(); err != nil {
+				errs = append(errs, fmt.Errorf("DiskStore.Close(): Failed to sync %s: %w", seg.file.Name(), err))
+			}
+			seg.file.Close()
+		}
+	}
+	return errors.Join(errs...)
+}
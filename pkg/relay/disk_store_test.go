@@ -0,0 +1,265 @@
+package relay
+
+import (
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Opens a store whose segments are finished after a single object, so every group starts a new segment.
+func openDiskStore(t *testing.T, dir string, maxBytes uint64, maxAge time.Duration) *DiskStore {
+	t.Helper()
+	s, err := OpenDiskStore(dir, maxBytes, maxAge)
+	if err != nil {
+		t.Fatalf("OpenDiskStore() unexpected error: %v", err)
+	}
+	s.segmentBytes = 1
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"+segmentSuffix))
+	if err != nil {
+		t.Fatalf("Glob() unexpected error: %v", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	video, audio := testutil.FullTrackName("video", "live"), testutil.FullTrackName("audio", "live")
+	s := openDiskStore(t, dir, 0, 0)
+
+	withExtensions := cacheObject(video, 0, 0, "key")
+	withExtensions.SubgroupID = 3
+	withExtensions.PublisherPriority = 7
+	withExtensions.ExtensionHeaders = []model.MoqtKeyValuePair{
+		{Type: 0x2, KVPairType: model.MoqtKeyValuePairValueType_UInt64, ValueUInt64: 42},
+		{Type: 0x3, KVPairType: model.MoqtKeyValuePairValueType_Bytes, ValueBytes: []byte("meta")},
+	}
+	endOfGroup := &model.MoqtObject{
+		Location:                   model.MoqtLocation{GroupId: 1, ObjectId: 1},
+		FullTrackName:              video,
+		ObjectForwardingPreference: model.Datagram,
+		ObjectStatus:               model.EndOfGroup,
+	}
+	for _, obj := range []*model.MoqtObject{
+		withExtensions,
+		cacheObject(video, 1, 0, "delta"),
+		cacheObject(video, 0, 1, "late"), // Appended to the segment of group 1
+		endOfGroup,
+		cacheObject(video, 2, 0, "key"),
+		cacheObject(audio, 5, 0, "audio"),
+	} {
+		if err := s.Put(obj, model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put(%+v) unexpected error: %v", obj.Location, err)
+		}
+	}
+	if files := segmentFiles(t, dir); len(files) != 4 {
+		t.Fatalf("Segment files = %v, want 3 of video and 1 of audio", files)
+	}
+
+	check := func(s *DiskStore) {
+		t.Helper()
+		objects := cachedObjects(t, s, video, model.MoqtLocation{GroupId: 0, ObjectId: 0}, model.MoqtLocation{GroupId: 1, ObjectId: 1}, false)
+		if len(objects) != 4 {
+			t.Fatalf("Range() returned %d objects, want 4", len(objects))
+		}
+		if !reflect.DeepEqual(objects[0], withExtensions) {
+			t.Errorf("Range()[0] = %+v, want %+v", objects[0], withExtensions)
+		}
+		if string(objects[1].Payload) != "late" || !reflect.DeepEqual(objects[3], endOfGroup) {
+			t.Errorf("Range() = %+v %+v, want the late object second and END_OF_GROUP last", objects[1], objects[3])
+		}
+		if oldest, largest, ok := s.Bounds(video, model.MoqtLocation{}, wholeTrack); !ok || oldest != (model.MoqtLocation{}) || largest != (model.MoqtLocation{GroupId: 2}) {
+			t.Errorf("Bounds() = %+v, %+v, %v, want {0 0}, {2 0}, true", oldest, largest, ok)
+		}
+		if !s.Covers(video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 2}) {
+			t.Errorf("Covers() reports the objects stored as incomplete")
+		}
+	}
+	check(s)
+
+	// The objects survive reopening the store
+	size := s.Size()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	s = openDiskStore(t, dir, 0, 0)
+	check(s)
+	if s.Size() != size {
+		t.Errorf("Size() after reopening = %d, want %d", s.Size(), size)
+	}
+	s.Close()
+
+	// Retention removes the oldest segment with its groups, the late object of group 0 in the next segment goes as well.
+	// After a restart the segments are removed in the order they were last written, audio was written last.
+	later := time.Now().Add(time.Hour)
+	audioSegments, _ := filepath.Glob(filepath.Join(dir, trackDirName(audio), "*"+segmentSuffix))
+	for _, file := range audioSegments {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatalf("Chtimes() unexpected error: %v", err)
+		}
+	}
+	s = openDiskStore(t, dir, size-1, 0)
+	if _, _, ok := s.Bounds(audio, model.MoqtLocation{}, wholeTrack); !ok {
+		t.Fatalf("Bounds() of audio reports it as removed")
+	}
+	got := cachedLocations(t, s, video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 2, ObjectId: 0})
+	if want := []model.MoqtLocation{{GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}, {GroupId: 2, ObjectId: 0}}; !equalLocations(got, want) {
+		t.Errorf("Range() after retention = %+v, want %+v", got, want)
+	}
+	if s.Covers(video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 2}) {
+		t.Errorf("Covers() reports the removed group as stored")
+	}
+	if !s.Covers(video, model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 2}) {
+		t.Errorf("Covers() after retention reports the groups left as incomplete")
+	}
+
+	// Later objects of a removed group aren't stored
+	if err := s.Put(cacheObject(video, 0, 2, "late"), model.MoqtLocation{}, 0); err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	if oldest, _, _ := s.Bounds(video, model.MoqtLocation{}, wholeTrack); oldest != (model.MoqtLocation{GroupId: 1}) {
+		t.Errorf("Bounds() oldest after a late Put = %+v, want {1 0}", oldest)
+	}
+}
+
+func TestDiskStoreRetentionByAge(t *testing.T) {
+	video := testutil.FullTrackName("video", "live")
+	now := time.Unix(1000, 0)
+	s := openDiskStore(t, t.TempDir(), 0, time.Minute)
+	s.now = func() time.Time { return now }
+
+	s.Put(cacheObject(video, 0, 0, "old"), model.MoqtLocation{}, 0)
+	now = now.Add(50 * time.Second)
+	s.Put(cacheObject(video, 1, 0, "new"), model.MoqtLocation{}, time.Second)
+	s.Put(cacheObject(video, 1, 1, "new"), model.MoqtLocation{}, 0)
+
+	// Group 0 wasn't written for a minute, object 1/0 itself expired
+	now = now.Add(20 * time.Second)
+	got := cachedLocations(t, s, video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: 1})
+	if want := []model.MoqtLocation{{GroupId: 1, ObjectId: 1}}; !equalLocations(got, want) {
+		t.Errorf("Range() = %+v, want %+v", got, want)
+	}
+}
+
+// The records are read as Range is iterated, without blocking the writes of the store meanwhile.
+func TestDiskStoreRangeWhileWriting(t *testing.T) {
+	video := testutil.FullTrackName("video", "live")
+	s := openDiskStore(t, t.TempDir(), 0, time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	for groupId := uint64(0); groupId < 3; groupId++ {
+		if err := s.Put(cacheObject(video, groupId, 0, "data"), model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put() unexpected error: %v", err)
+		}
+	}
+
+	var got []model.MoqtLocation
+	for obj, err := range s.Range(video, model.MoqtLocation{}, wholeTrack, false) {
+		if err != nil {
+			t.Fatalf("Range() unexpected error: %v", err)
+		}
+		got = append(got, obj.Location)
+		if err := s.Put(cacheObject(video, 3+obj.Location.GroupId, 0, "data"), model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put() during Range() unexpected error: %v", err)
+		}
+	}
+	if want := []model.MoqtLocation{{GroupId: 0}, {GroupId: 1}, {GroupId: 2}}; !equalLocations(got, want) {
+		t.Errorf("Range() = %+v, want the objects stored when it began %+v", got, want)
+	}
+
+	// A segment removed by retention before its records are read ends the sequence with an error
+	got = nil
+	var rangeErr error
+	for obj, err := range s.Range(video, model.MoqtLocation{}, wholeTrack, true) {
+		if err != nil {
+			rangeErr = err
+			continue
+		}
+		got = append(got, obj.Location)
+		now = now.Add(time.Hour)
+		s.Put(cacheObject(video, 6, 0, "data"), model.MoqtLocation{}, 0)
+	}
+	if want := []model.MoqtLocation{{GroupId: 5}}; !equalLocations(got, want) || rangeErr == nil {
+		t.Errorf("Range() after retention = %+v, %v, want %+v and an error", got, rangeErr, want)
+	}
+}
+
+func TestDiskStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	video := testutil.FullTrackName("video", "live")
+	s := openDiskStore(t, dir, 0, 0)
+	for objectId := uint64(0); objectId < 3; objectId++ {
+		if err := s.Put(cacheObject(video, 0, objectId, "data"), model.MoqtLocation{}, 0); err != nil {
+			t.Fatalf("Put() unexpected error: %v", err)
+		}
+	}
+	s.Close()
+
+	// A crash in the middle of appending the next record
+	files := segmentFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("Segment files = %v, want 1", files)
+	}
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatalf("Stat() unexpected error: %v", err)
+	}
+	torn := encodeRecord(cacheObject(video, 0, 3, "torn"), model.MoqtLocation{}, time.Time{})
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile() unexpected error: %v", err)
+	}
+	f.Write(torn[:len(torn)-2])
+	f.Close()
+
+	s = openDiskStore(t, dir, 0, 0)
+	if info2, err := os.Stat(files[0]); err != nil || info2.Size() != info.Size() {
+		t.Fatalf("Segment size after recovery = %v, %v, want %d", info2.Size(), err, info.Size())
+	}
+	if err := s.Put(cacheObject(video, 0, 3, "after"), model.MoqtLocation{}, 0); err != nil {
+		t.Fatalf("Put() after recovery unexpected error: %v", err)
+	}
+	got := cachedLocations(t, s, video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: 3})
+	if want := []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 0, ObjectId: 1}, {GroupId: 0, ObjectId: 2}, {GroupId: 0, ObjectId: 3}}; !equalLocations(got, want) {
+		t.Errorf("Range() after recovery = %+v, want %+v", got, want)
+	}
+
+	// A cut run stays cut after a restart
+	if err := s.Cut(video, model.MoqtLocation{}, 0); err != nil {
+		t.Fatalf("Cut() unexpected error: %v", err)
+	}
+	if s.Covers(video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: 3}) {
+		t.Errorf("Covers() reports the cut group as stored")
+	}
+	s.Close()
+	s = openDiskStore(t, dir, 0, 0)
+	if s.Covers(video, model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: 3}) {
+		t.Errorf("Covers() after recovery reports the cut group as stored")
+	}
+
+	// A corrupt record is cut off with everything after it
+	s.Close()
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(files[0], data, 0o644); err != nil {
+		t.Fatalf("WriteFile() unexpected error: %v", err)
+	}
+	s = openDiskStore(t, dir, 0, 0)
+	if _, largest, _ := s.Bounds(video, model.MoqtLocation{}, wholeTrack); largest != (model.MoqtLocation{GroupId: 0, ObjectId: 2}) {
+		t.Errorf("Bounds() largest after a corrupt record = %+v, want {0 2}", largest)
+	}
+}
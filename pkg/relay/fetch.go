@@ -0,0 +1,167 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"go-moq/pkg/session/control"
+	"io"
+)
+
+// Answers a downstream FETCH from the cache if it holds the whole range, otherwise by fetching the range upstream and copying its objects.
+// Joining fetches refer to the downstream subscription, the upstream has no such subscription to join. They are answered
+// with the range from the joining start up to the LARGEST_OBJECT the relay told the subscriber in its SUBSCRIBE_OK.
+func (r *Relay) fetch(req *session.FetchRequest) {
+	start, end, err := r.fetchRange(req)
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+
+	if r.Cache != nil && r.Cache.Covers(req.FullTrackName, start, end) {
+		r.fetchFromCache(req, start, end)
+		return
+	}
+	r.fetchUpstream(req, start, end)
+}
+
+// Returns the range a FETCH asks for, both ends inclusive. An end Object ID of math.MaxUint64 stands for the whole end group.
+func (r *Relay) fetchRange(req *session.FetchRequest) (model.MoqtLocation, model.MoqtLocation, error) {
+	if req.FetchType == control.FetchTypeStandalone {
+		return req.StartLocation, req.EndLocation, nil
+	}
+
+	joinedAt := r.joinedAt(req.JoiningSubscription)
+	if joinedAt == nil {
+		return model.MoqtLocation{}, model.MoqtLocation{}, model.MOQT_REQUEST_ERROR{
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_NO_OBJECTS,
+			ReasonPhrase: model.NewReasonPhrase("No objects precede the joined subscription"),
+		}
+	}
+
+	var start model.MoqtLocation
+	switch req.FetchType {
+	case control.FetchTypeRelativeJoining:
+		start.GroupId = joinedAt.GroupId - min(req.JoiningStart, joinedAt.GroupId)
+	case control.FetchTypeAbsoluteJoining:
+		if req.JoiningStart > joinedAt.GroupId {
+			return model.MoqtLocation{}, model.MoqtLocation{}, model.MOQT_REQUEST_ERROR{
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE,
+				ReasonPhrase: model.NewReasonPhrase("Joining Start is after the joined subscription's start"),
+			}
+		}
+		start.GroupId = req.JoiningStart
+	}
+	return start, *joinedAt, nil
+}
+
+// Returns the LARGEST_OBJECT of the SUBSCRIBE_OK the relay answered the subscription with, nil if there was none or it ended.
+func (r *Relay) joinedAt(w *session.TrackWriter) *model.MoqtLocation {
+	r.mu.Lock()
+	t, ok := r.tracks[w.FullTrackName.Key()]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for d := range t.downstreams {
+		if d.w == w {
+			return d.joinedAt
+		}
+	}
+	return nil
+}
+
+// Answers the fetch with the cached objects from start to end, the cache holds all of them.
+// The track doesn't need to be subscribed upstream, e.g. for a DiskStore holding the objects from before a restart.
+// The objects are read from the cache as they are written, one that can't be read anymore aborts the fetch.
+func (r *Relay) fetchFromCache(req *session.FetchRequest, start model.MoqtLocation, end model.MoqtLocation) {
+	ftn := req.FullTrackName
+	_, endLocation, ok := r.Cache.Bounds(ftn, start, end)
+	if !ok {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_NO_OBJECTS, "No objects in the requested range")
+		return
+	}
+
+	w, err := req.Accept(false, endLocation)
+	if err != nil {
+		return
+	}
+	// Descending groups, the objects of a group stay ascending
+	for obj, err := range r.Cache.Range(ftn, start, end, req.GroupOrder == 0x2) {
+		if err != nil {
+			fmt.Printf("[WARN] Relay: Failed to read %s from the cache: %v\n", ftn.ToString(), err)
+			w.Abort()
+			return
+		}
+		if err := w.WriteObject(obj); err != nil {
+			if !errors.Is(err, session.ErrFetchCancelled) {
+				w.Abort()
+			}
+			return
+		}
+	}
+	w.Close()
+}
+
+// Fetches the range upstream and copies its objects, objects after end the upstream sends anyway are dropped.
+func (r *Relay) fetchUpstream(req *session.FetchRequest, start model.MoqtLocation, end model.MoqtLocation) {
+	up, err := r.upstreamFor(req.FullTrackName)
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+
+	opts := []session.FetchOption{session.WithFetchSubscriberPriority(req.SubscriberPriority)}
+	if req.GroupOrder != 0 {
+		opts = append(opts, session.WithFetchGroupOrder(req.GroupOrder))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamRequestTimeout)
+	f, err := up.Fetch(ctx, session.StandaloneFetch(req.FullTrackName, start, end), opts...)
+	cancel()
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+
+	endLocation := f.EndLocation
+	if end.LessThan(endLocation) {
+		endLocation = end
+	}
+	w, err := req.Accept(f.EndOfTrack && endLocation.Equal(f.EndLocation), endLocation, f.Parameters...)
+	if err != nil {
+		f.Cancel()
+		return
+	}
+
+	for {
+		obj, err := f.ReadObject(context.Background())
+		if errors.Is(err, io.EOF) {
+			w.Close()
+			return
+		}
+		if err != nil {
+			fmt.Printf("[WARN] Relay: Upstream FETCH of %s failed: %v\n", req.FullTrackName.ToString(), err)
+			w.Abort()
+			return
+		}
+		if end.LessThan(obj.Location) {
+			continue
+		}
+
+		if err := w.WriteObject(obj); err != nil {
+			f.Cancel()
+			if !errors.Is(err, session.ErrFetchCancelled) {
+				w.Abort()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package relay
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"sync"
+)
+
+// Accepts a PUBLISH_NAMESPACE of a served session and routes the namespace to it until it is withdrawn.
+// The route is added before the answer, so requests sent after PUBLISH_NAMESPACE_OK are routed in the order of announcement.
+func (r *Relay) announce(sess *session.Session, req *session.PublishNamespaceRequest) {
+	r.addRoute(req.Namespace, sess)
+	an, err := req.Accept()
+	if err != nil {
+		r.removeRoute(req.Namespace, sess) // Withdrawn before the answer, or the session terminated
+		return
+	}
+
+	select {
+	case <-an.Done():
+		r.removeRoute(an.Namespace, sess)
+	case <-sess.Done():
+		// Serve removes every route of the session
+	}
+}
+
+// Routes the namespace to the session, the namespace subscribers learn about it if it wasn't announced before.
+func (r *Relay) addRoute(ns model.MoqtTrackNamespace, sess *session.Session) {
+	r.namespacesMutex.Lock()
+	defer r.namespacesMutex.Unlock()
+
+	if !r.Routes.Add(ns, sess) {
+		return
+	}
+	for sub := range r.namespaceSubscribers {
+		sub.enqueue(ns, false)
+	}
+}
+
+func (r *Relay) removeRoute(ns model.MoqtTrackNamespace, sess *session.Session) {
+	r.namespacesMutex.Lock()
+	defer r.namespacesMutex.Unlock()
+
+	if r.Routes.Remove(ns, sess) {
+		r.withdraw(ns)
+	}
+}
+
+// Removes every route of a session that terminated.
+func (r *Relay) removeRoutes(sess *session.Session) {
+	r.namespacesMutex.Lock()
+	defer r.namespacesMutex.Unlock()
+
+	for _, ns := range r.Routes.RemoveSession(sess) {
+		r.withdraw(ns)
+	}
+}
+
+// Tells the namespace subscribers that nobody announces the namespace anymore, r.namespacesMutex MUST be held.
+func (r *Relay) withdraw(ns model.MoqtTrackNamespace) {
+	for sub := range r.namespaceSubscribers {
+		sub.enqueue(ns, true)
+	}
+}
+
+// Answers a SUBSCRIBE_NAMESPACE with the routed namespaces matching the prefix, later changes are sent until the subscriber leaves.
+// The subscriber is added before the answer, so the changes made in the meantime are queued for it and none is missed.
+func (r *Relay) subscribeNamespace(req *session.SubscribeNamespaceRequest) {
+	sub := newNamespaceSubscriber(req.NamespacePrefix)
+	r.namespacesMutex.Lock()
+	for _, ns := range r.Routes.Namespaces(req.NamespacePrefix) {
+		sub.enqueue(ns, false)
+	}
+	r.namespaceSubscribers[sub] = struct{}{}
+	r.namespacesMutex.Unlock()
+
+	defer func() {
+		r.namespacesMutex.Lock()
+		delete(r.namespaceSubscribers, sub)
+		r.namespacesMutex.Unlock()
+	}()
+
+	ns, err := req.Accept()
+	if err != nil {
+		return
+	}
+	sub.run(ns)
+}
+
+// A change of the announced namespaces, NAMESPACE or NAMESPACE_DONE
+type namespaceEvent struct {
+	ns   model.MoqtTrackNamespace
+	done bool
+}
+
+// namespaceSubscriber is the SUBSCRIBE_NAMESPACE of one served session, the changes matching its prefix are queued
+// under r.namespacesMutex and written by its own goroutine, so a slow subscriber never holds up the routes.
+type namespaceSubscriber struct {
+	prefix model.MoqtTrackNamespace
+
+	mu     sync.Mutex
+	queue  []namespaceEvent // Changes not written yet
+	notify chan struct{}    // Signaled when the queue becomes non-empty
+}
+
+func newNamespaceSubscriber(prefix model.MoqtTrackNamespace) *namespaceSubscriber {
+	return &namespaceSubscriber{
+		prefix: prefix,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Queues the change if the namespace matches the prefix, it never blocks.
+func (s *namespaceSubscriber) enqueue(ns model.MoqtTrackNamespace, done bool) {
+	if !ns.HasPrefix(s.prefix) {
+		return
+	}
+
+	s.mu.Lock()
+	s.queue = append(s.queue, namespaceEvent{ns: ns, done: done})
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default: // A signal is already pending
+	}
+}
+
+// Writes the queued changes until the subscriber leaves.
+func (s *namespaceSubscriber) run(sub *session.NamespaceSubscriber) {
+	for {
+		s.mu.Lock()
+		events := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, ev := range events {
+			if ev.done {
+				if err := sub.SendNamespaceDone(ev.ns); err != nil {
+					fmt.Printf("[WARN] Relay: Failed to send NAMESPACE_DONE %s: %v\n", ev.ns.ToString(), err)
+				}
+			} else if err := sub.SendNamespace(ev.ns); err != nil {
+				fmt.Printf("[WARN] Relay: Failed to send NAMESPACE %s: %v\n", ev.ns.ToString(), err)
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-sub.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A relay serves the tracks of other sessions (the upstreams) to the sessions it accepts (the downstreams).
+// All SUBSCRIBEs of the downstreams to the same track share a single upstream subscription, every object of it is
+// forwarded to each downstream subscriber through its own TrackWriter, with the Track Alias of that downstream session.
+// Every downstream subscriber has its own queue and writer goroutine, so a slow subscriber never holds back the others.
+// Without an UpstreamFunc, SUBSCRIBE and FETCH are routed to a session that announced the namespace of the track with
+// PUBLISH_NAMESPACE, see RoutingTable. Any session served by the relay can announce namespaces, or subscribe to them with SUBSCRIBE_NAMESPACE.
+// When the upstream session of a track terminates or goes away, the relay subscribes to the track on the next upstream
+// announcing its namespace, resuming with the largest location forwarded, and the downstream subscriptions go on.
+// They are only ended with PUBLISH_DONE once no upstream is left. Sessions can also be added to the routes as alternative
+// upstreams without announcing, with RoutingTable.Add.
+// The forwarded objects are kept in a Cache, FETCHes and joining fetches of a range it holds completely are answered from it,
+// even once the upstream subscription ended or, with a DiskStore, after a restart.
+// TRACK_STATUS is answered with the largest location forwarded on the live upstream subscription, or else the largest one cached.
+
+// How long the relay waits for the answer to its upstream SUBSCRIBE or FETCH
+const upstreamRequestTimeout = 10 * time.Second
+
+// Objects a downstream subscriber may fall behind before it is ended with TOO_FAR_BEHIND, used if Relay.MaxQueuedObjects is 0
+const defaultMaxQueuedObjects = 1024
+
+// Budget of the MemoryCache created by NewRelay
+const defaultCacheBytes = 64 << 20
+
+// UpstreamFunc returns the session the relay subscribes to the track on.
+// A model.MOQT_REQUEST_ERROR is passed on to the downstream subscriber, any other error is reported as DOES_NOT_EXIST.
+// It is asked again when the upstream session of a track fails, returning a session that failed the track ends it.
+type UpstreamFunc func(ftn model.MoqtFullTrackName) (*session.Session, error)
+
+// Relay fans the upstream subscriptions out to the subscribers of the sessions it serves.
+// It is safe for concurrent use.
+type Relay struct {
+	Upstream         UpstreamFunc  // nil routes by the announced namespaces
+	Routes           *RoutingTable // The namespaces announced by the served sessions
+	MaxQueuedObjects int           // Objects a downstream subscriber may fall behind before it is ended with TOO_FAR_BEHIND, 0 uses the default of 1024
+	Cache            Cache         // Where the forwarded objects are kept to answer FETCHes, a MemoryCache or a DiskStore. nil disables caching
+
+	mu     sync.Mutex
+	tracks map[string]*track // Tracks with an upstream subscription, keyed by MoqtFullTrackName.Key()
+
+	// Changes of the routes and queueing them for the namespace subscribers are serialized, so no subscriber misses one
+	namespacesMutex      sync.Mutex
+	namespaceSubscribers map[*namespaceSubscriber]struct{}
+}
+
+// NewRelay creates a relay caching up to 64 MiB of objects in memory, upstream may be nil to route by the namespaces the served sessions announce.
+func NewRelay(upstream UpstreamFunc) *Relay {
+	return &Relay{
+		Upstream:             upstream,
+		Routes:               NewRoutingTable(),
+		Cache:                NewMemoryCache(defaultCacheBytes),
+		tracks:               make(map[string]*track),
+		namespaceSubscribers: make(map[*namespaceSubscriber]struct{}),
+	}
+}
+
+// Serve answers the SUBSCRIBEs, FETCHes and TRACK_STATUSes of a session from the upstreams and routes the namespaces it announces,
+// e.g. for a session initiated with Server.InitateSession. The routes of the session are removed once it terminates.
+// It runs the session and blocks until it terminates, returning the reason like session.Session.Run.
+func (r *Relay) Serve(ctx context.Context, sess *session.Session) error {
+	// Waiting for the upstreams MUST NOT block the event loop
+	pub := session.NewPublisher(sess)
+	pub.HandleNamespace(model.MoqtTrackNamespace{}, func(req *session.SubscribeRequest) {
+		go r.subscribe(sess, req)
+	})
+	pub.HandleFetch(func(req *session.FetchRequest) {
+		go r.fetch(req)
+	})
+	pub.HandleTrackStatus(func(req *session.TrackStatusRequest) {
+		go r.trackStatus(req)
+	})
+	sess.HandlePublishNamespace(func(req *session.PublishNamespaceRequest) {
+		go r.announce(sess, req)
+	})
+	sess.HandleSubscribeNamespace(func(req *session.SubscribeNamespaceRequest) {
+		go r.subscribeNamespace(req)
+	})
+
+	err := sess.Run(ctx)
+	r.removeRoutes(sess)
+	return err
+}
+
+// Returns the session to send a request for the track to, by the UpstreamFunc or by the routing table.
+// Sessions that failed the track before, or terminated, are skipped.
+func (r *Relay) upstreamFor(ftn model.MoqtFullTrackName, failed ...*session.Session) (*session.Session, error) {
+	usable := func(sess *session.Session) bool {
+		select {
+		case <-sess.Done():
+			return false
+		default:
+			return !slices.Contains(failed, sess)
+		}
+	}
+
+	if r.Upstream != nil {
+		sess, err := r.Upstream(ftn)
+		if err != nil || usable(sess) {
+			return sess, err
+		}
+	} else {
+		// The earliest announcer that is usable
+		_, announcers, _ := r.Routes.Lookup(ftn.Namespace)
+		for _, sess := range announcers {
+			if usable(sess) {
+				return sess, nil
+			}
+		}
+	}
+	return nil, model.MOQT_REQUEST_ERROR{
+		ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+		ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("No publisher for the namespace of %s", ftn.ToString())),
+	}
+}
+
+// The REQUEST_ERROR to pass a failed upstream request on downstream with.
+func requestError(err error, ftn model.MoqtFullTrackName) model.MOQT_REQUEST_ERROR {
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) {
+		reqErr.ErrorCode = model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST
+		reqErr.ReasonPhrase = model.NewReasonPhrase(fmt.Sprintf("Track %s is not available", ftn.ToString()))
+	}
+	return reqErr
+}
+
+// Answers a downstream SUBSCRIBE, joining the upstream subscription of the track or starting it.
+func (r *Relay) subscribe(sess *session.Session, req *session.SubscribeRequest) {
+	t, err := r.join(req.FullTrackName)
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+
+	if err := t.accept(sess, req); err != nil {
+		fmt.Printf("[WARN] Relay: Failed to accept SUBSCRIBE for %s: %v\n", req.FullTrackName.ToString(), err)
+	}
+}
+
+// Returns the track with a live upstream subscription, subscribing upstream if there is none yet.
+// The caller MUST accept a downstream subscriber on the track.
+func (r *Relay) join(ftn model.MoqtFullTrackName) (*track, error) {
+	r.mu.Lock()
+	t, ok := r.tracks[ftn.Key()]
+	if ok {
+		// A track that is unsubscribing or ending upstream is replaced by a new upstream subscription
+		t.mu.Lock()
+		if ok = t.joinable(); ok {
+			t.pending++
+		}
+		t.mu.Unlock()
+	}
+	if !ok {
+		t = newTrack(r, ftn)
+		t.pending++
+		r.tracks[ftn.Key()] = t
+		go t.start()
+	}
+	r.mu.Unlock()
+
+	<-t.ready
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t, nil
+}
+
+// Forgets the track, later SUBSCRIBEs start a new upstream subscription.
+func (r *Relay) removeTrack(t *track) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tracks[t.ftn.Key()] == t {
+		delete(r.tracks, t.ftn.Key())
+	}
+}
+
+func (r *Relay) maxQueuedObjects() int {
+	if r.MaxQueuedObjects > 0 {
+		return r.MaxQueuedObjects
+	}
+	return defaultMaxQueuedObjects
+}
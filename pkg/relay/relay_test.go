@@ -0,0 +1,575 @@
+package relay
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"go-moq/pkg/session/control"
+	"io"
+	"math"
+	"testing"
+)
+
+// Returns a client and a server session connected over an in-memory connection, neither is running yet.
+func newSessionPair(t *testing.T) (client *session.Session, server *session.Session) {
+	t.Helper()
+	p := testutil.NewPair(t)
+
+	clientState := session.NewSessionState(session.RoleClient, 100, 0)
+	clientState.MaxOutgoingRequestID = 100
+	serverState := session.NewSessionState(session.RoleServer, 100, 0)
+	serverState.MaxOutgoingRequestID = 100
+
+	return session.NewSession(p.ClientConn, p.ClientStream, clientState), session.NewSession(p.ServerConn, p.ServerStream, serverState)
+}
+
+// Starts a relay whose only upstream is an origin answering every upstream SUBSCRIBE with handler.
+func newRelay(t *testing.T, handler session.SubscribeRequestHandler) *Relay {
+	ctx := testutil.Context(t)
+	upstream, origin := newSessionPair(t)
+	go upstream.Run(ctx)
+	go origin.Run(ctx)
+	session.NewPublisher(origin).HandleNamespace(model.MoqtTrackNamespace{}, handler)
+
+	return NewRelay(func(model.MoqtFullTrackName) (*session.Session, error) {
+		return upstream, nil
+	})
+}
+
+// Connects a new downstream session to the relay.
+func connect(t *testing.T, r *Relay) *session.Session {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	go client.Run(ctx)
+	go r.Serve(ctx, server)
+	return client
+}
+
+func acceptInto(t *testing.T, writers chan<- *session.TrackWriter) session.SubscribeRequestHandler {
+	return func(req *session.SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	}
+}
+
+func TestRelayFanOut(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	writers := make(chan *session.TrackWriter, 2)
+	r := newRelay(t, acceptInto(t, writers))
+
+	subA, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	subB, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	if len(writers) != 0 {
+		t.Fatalf("The relay subscribed upstream %d times, want 1", 1+len(writers))
+	}
+
+	objects := []*model.MoqtObject{
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")},
+		{Location: model.MoqtLocation{GroupId: 1, ObjectId: 0}, ObjectForwardingPreference: model.Datagram, Payload: []byte("datagram")},
+	}
+	for i, obj := range objects {
+		if err := w.WriteObject(obj); err != nil {
+			t.Fatalf("WriteObject() #%d unexpected error: %v", i, err)
+		}
+		for _, sub := range []*session.Subscription{subA, subB} {
+			got, err := sub.ReadObject(ctx)
+			if err != nil {
+				t.Fatalf("ReadObject() #%d unexpected error: %v", i, err)
+			}
+			if got.Location != obj.Location || got.ObjectForwardingPreference != obj.ObjectForwardingPreference || string(got.Payload) != string(obj.Payload) {
+				t.Errorf("ReadObject() #%d got %+v %q, want %+v %q", i, got.Location, got.Payload, obj.Location, obj.Payload)
+			}
+		}
+	}
+
+	// One subscriber leaving doesn't affect the other
+	if err := subA.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe() unexpected error: %v", err)
+	}
+	obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: 2}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")}
+	if err := w.WriteObject(obj); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if got, err := subB.ReadObject(ctx); err != nil || got.Location != obj.Location {
+		t.Fatalf("ReadObject() after the other subscriber left got = %v, %v, want %+v", got, err, obj.Location)
+	}
+
+	// The end of the upstream subscription is passed on
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	if _, err := subB.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadObject() after the track ended error = %v, want io.EOF", err)
+	}
+	if done := subB.PublishDone(); done.StatusCode != control.PublishDoneTrackEnded {
+		t.Errorf("PublishDone() status = %#x, want TRACK_ENDED", uint64(done.StatusCode))
+	}
+}
+
+func TestRelayUnsubscribesUpstream(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	writers := make(chan *session.TrackWriter, 2)
+	r := newRelay(t, acceptInto(t, writers))
+
+	sub, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe() unexpected error: %v", err)
+	}
+	select {
+	case <-w.Done():
+	case <-ctx.Done():
+		t.Fatalf("The upstream subscription wasn't ended after the last subscriber left")
+	}
+
+	// A later subscriber starts a new upstream subscription
+	if _, err := connect(t, r).Subscribe(ctx, track); err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	select {
+	case <-writers:
+	case <-ctx.Done():
+		t.Fatalf("The relay didn't subscribe upstream again")
+	}
+}
+
+func TestRelayUpstreamRejects(t *testing.T) {
+	ctx := testutil.Context(t)
+	r := newRelay(t, func(req *session.SubscribeRequest) {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED, "Not for you")
+	})
+
+	_, err := connect(t, r).Subscribe(ctx, testutil.FullTrackName("video", "live"))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED {
+		t.Fatalf("Subscribe() error = %v, want the UNAUTHORIZED of the upstream", err)
+	}
+}
+
+func TestRelayRoutesByNamespace(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	r := NewRelay(nil)
+
+	// The origin is just another session of the relay that announces its namespace
+	origin := connect(t, r)
+	writers := make(chan *session.TrackWriter, 1)
+	pub := session.NewPublisher(origin)
+	pub.HandleTrack(track, acceptInto(t, writers))
+	pub.HandleFetch(func(req *session.FetchRequest) {
+		go func() {
+			w, err := req.Accept(false, req.EndLocation)
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+				return
+			}
+			w.WriteObject(&model.MoqtObject{Location: req.StartLocation, ObjectForwardingPreference: model.Subgroup, Payload: []byte("old")})
+			w.Close()
+		}()
+	})
+
+	watcher := connect(t, r)
+	namespaces, err := watcher.SubscribeNamespace(ctx, ns("live"))
+	if err != nil {
+		t.Fatalf("SubscribeNamespace() unexpected error: %v", err)
+	}
+
+	pn, err := origin.PublishNamespace(ctx, ns("live"))
+	if err != nil {
+		t.Fatalf("PublishNamespace() unexpected error: %v", err)
+	}
+	if ev, err := namespaces.ReadEvent(ctx); err != nil || ev.Done || !ev.Namespace.Equal(ns("live")) {
+		t.Fatalf("ReadEvent() got = %+v, %v, want NAMESPACE live", ev, err)
+	}
+
+	subscriber := connect(t, r)
+	sub, err := subscriber.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: 3}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")}
+	if err := w.WriteObject(obj); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if got, err := sub.ReadObject(ctx); err != nil || got.Location != obj.Location {
+		t.Fatalf("ReadObject() got = %v, %v, want %+v", got, err, obj.Location)
+	}
+
+	start := model.MoqtLocation{GroupId: 1}
+	f, err := subscriber.Fetch(ctx, session.StandaloneFetch(track, start, model.MoqtLocation{GroupId: 2}))
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error: %v", err)
+	}
+	if got, err := f.ReadObject(ctx); err != nil || got.Location != start || string(got.Payload) != "old" {
+		t.Fatalf("Fetch.ReadObject() got = %v, %v, want %+v", got, err, start)
+	}
+	if _, err := f.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Fetch.ReadObject() after the last object error = %v, want io.EOF", err)
+	}
+
+	// Once withdrawn, the namespace is no longer routed
+	if err := pn.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	if ev, err := namespaces.ReadEvent(ctx); err != nil || !ev.Done || !ev.Namespace.Equal(ns("live")) {
+		t.Fatalf("ReadEvent() got = %+v, %v, want NAMESPACE_DONE live", ev, err)
+	}
+	_, err = subscriber.Subscribe(ctx, testutil.FullTrackName("audio", "live"))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Errorf("Subscribe() after the namespace was withdrawn error = %v, want DOES_NOT_EXIST", err)
+	}
+}
+
+func TestRelayFetchFromCache(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	writers := make(chan *session.TrackWriter, 1)
+	r := newRelay(t, acceptInto(t, writers)) // The origin rejects every FETCH with NOT_SUPPORTED
+
+	sub, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	for _, loc := range []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 0, ObjectId: 1}, {GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}, {GroupId: 2, ObjectId: 0}} {
+		if err := w.WriteObject(&model.MoqtObject{Location: loc, ObjectForwardingPreference: model.Subgroup, Payload: []byte("data")}); err != nil {
+			t.Fatalf("WriteObject(%+v) unexpected error: %v", loc, err)
+		}
+		if _, err := sub.ReadObject(ctx); err != nil {
+			t.Fatalf("ReadObject() unexpected error: %v", err)
+		}
+	}
+
+	readAll := func(f *session.Fetch) []model.MoqtLocation {
+		t.Helper()
+		var locs []model.MoqtLocation
+		for {
+			obj, err := f.ReadObject(ctx)
+			if errors.Is(err, io.EOF) {
+				return locs
+			}
+			if err != nil {
+				t.Fatalf("Fetch.ReadObject() unexpected error: %v", err)
+			}
+			locs = append(locs, obj.Location)
+		}
+	}
+	wantLocs := func(got []model.MoqtLocation, want ...model.MoqtLocation) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Fetched %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("Fetched %+v, want %+v", got, want)
+			}
+		}
+	}
+
+	downstream := connect(t, r)
+	f, err := downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: math.MaxUint64}))
+	if err != nil {
+		t.Fatalf("Fetch() of a cached group unexpected error: %v", err)
+	}
+	wantLocs(readAll(f), model.MoqtLocation{GroupId: 1, ObjectId: 0}, model.MoqtLocation{GroupId: 1, ObjectId: 1})
+
+	// The end is inclusive
+	f, err = downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1}))
+	if err != nil {
+		t.Fatalf("Fetch() of cached objects unexpected error: %v", err)
+	}
+	wantLocs(readAll(f), model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: 0})
+
+	// A joining fetch ends with the LARGEST_OBJECT the subscriber got in its SUBSCRIBE_OK
+	joined, err := downstream.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	f, err = downstream.Fetch(ctx, session.RelativeJoiningFetch(joined, 1))
+	if err != nil {
+		t.Fatalf("Fetch() joining unexpected error: %v", err)
+	}
+	wantLocs(readAll(f), model.MoqtLocation{GroupId: 1, ObjectId: 0}, model.MoqtLocation{GroupId: 1, ObjectId: 1}, model.MoqtLocation{GroupId: 2, ObjectId: 0})
+
+	// The current group may still grow, it is fetched upstream
+	_, err = downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 2, ObjectId: math.MaxUint64}))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Fatalf("Fetch() beyond the cache error = %v, want the NOT_SUPPORTED of the upstream", err)
+	}
+}
+
+func TestRelayFetchAfterRestart(t *testing.T) {
+	ctx := testutil.Context(t)
+	dir := t.TempDir()
+	track := testutil.FullTrackName("video", "live")
+
+	store, err := OpenDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenDiskStore() unexpected error: %v", err)
+	}
+	writers := make(chan *session.TrackWriter, 1)
+	r := newRelay(t, acceptInto(t, writers))
+	r.Cache = store
+
+	sub, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	stored := []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 0, ObjectId: 1}, {GroupId: 1, ObjectId: 0}}
+	for _, loc := range stored {
+		if err := w.WriteObject(&model.MoqtObject{Location: loc, ObjectForwardingPreference: model.Subgroup, Payload: []byte("data")}); err != nil {
+			t.Fatalf("WriteObject(%+v) unexpected error: %v", loc, err)
+		}
+		if _, err := sub.ReadObject(ctx); err != nil {
+			t.Fatalf("ReadObject() unexpected error: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+
+	// A relay without any upstream serves the objects of the reopened store
+	store, err = OpenDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenDiskStore() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	restarted := NewRelay(nil)
+	restarted.Cache = store
+	downstream := connect(t, restarted)
+
+	f, err := downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{}, model.MoqtLocation{GroupId: 1}))
+	if err != nil {
+		t.Fatalf("Fetch() of stored objects unexpected error: %v", err)
+	}
+	var got []model.MoqtLocation
+	for {
+		obj, err := f.ReadObject(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Fetch.ReadObject() unexpected error: %v", err)
+		}
+		got = append(got, obj.Location)
+	}
+	if !equalLocations(got, stored) {
+		t.Errorf("Fetched %+v, want %+v", got, stored)
+	}
+
+	// Group 1 may have had more objects, that range isn't stored completely
+	_, err = downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{}, model.MoqtLocation{GroupId: 1, ObjectId: math.MaxUint64}))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Errorf("Fetch() beyond the stored objects error = %v, want DOES_NOT_EXIST as there is no upstream", err)
+	}
+}
+
+// A datagram that doesn't follow the previous one tells of a lost datagram, its group isn't served from the cache.
+func TestRelayFetchAfterLostDatagram(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	writers := make(chan *session.TrackWriter, 1)
+	r := newRelay(t, acceptInto(t, writers)) // The origin rejects every FETCH with NOT_SUPPORTED
+
+	sub, err := connect(t, r).Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	for _, loc := range []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 0, ObjectId: 2}, {GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}, {GroupId: 2, ObjectId: 0}} {
+		if err := w.WriteObject(&model.MoqtObject{Location: loc, ObjectForwardingPreference: model.Datagram, Payload: []byte("data")}); err != nil {
+			t.Fatalf("WriteObject(%+v) unexpected error: %v", loc, err)
+		}
+		if _, err := sub.ReadObject(ctx); err != nil {
+			t.Fatalf("ReadObject() unexpected error: %v", err)
+		}
+	}
+
+	downstream := connect(t, r)
+	_, err = downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{}, model.MoqtLocation{GroupId: 0, ObjectId: math.MaxUint64}))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Fatalf("Fetch() of the group with the lost datagram error = %v, want the NOT_SUPPORTED of the upstream", err)
+	}
+
+	// The groups after it are served from the cache
+	f, err := downstream.Fetch(ctx, session.StandaloneFetch(track, model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 1, ObjectId: math.MaxUint64}))
+	if err != nil {
+		t.Fatalf("Fetch() of the group after it unexpected error: %v", err)
+	}
+	var got []model.MoqtLocation
+	for {
+		obj, err := f.ReadObject(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Fetch.ReadObject() unexpected error: %v", err)
+		}
+		got = append(got, obj.Location)
+	}
+	if want := []model.MoqtLocation{{GroupId: 1, ObjectId: 0}, {GroupId: 1, ObjectId: 1}}; !equalLocations(got, want) {
+		t.Errorf("Fetched %+v, want %+v", got, want)
+	}
+}
+
+func TestRelayTrackStatus(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	writers := make(chan *session.TrackWriter, 1)
+	r := newRelay(t, acceptInto(t, writers)) // The origin rejects every TRACK_STATUS with NOT_SUPPORTED
+	downstream := connect(t, r)
+
+	// Tracks the relay knows nothing about are asked for upstream
+	_, err := downstream.TrackStatus(ctx, track)
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Fatalf("TrackStatus() of an unknown track error = %v, want the NOT_SUPPORTED of the upstream", err)
+	}
+
+	sub, err := downstream.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+	for _, loc := range []model.MoqtLocation{{GroupId: 0, ObjectId: 0}, {GroupId: 0, ObjectId: 1}} {
+		if err := w.WriteObject(&model.MoqtObject{Location: loc, ObjectForwardingPreference: model.Subgroup, Payload: []byte("data")}); err != nil {
+			t.Fatalf("WriteObject(%+v) unexpected error: %v", loc, err)
+		}
+		if _, err := sub.ReadObject(ctx); err != nil {
+			t.Fatalf("ReadObject() unexpected error: %v", err)
+		}
+	}
+	want := model.MoqtLocation{GroupId: 0, ObjectId: 1}
+	status, err := downstream.TrackStatus(ctx, track)
+	if err != nil {
+		t.Fatalf("TrackStatus() of a live track unexpected error: %v", err)
+	}
+	if !status.ContentExists || status.LargestLocation != want {
+		t.Errorf("TrackStatus() of a live track got ContentExists = %v, LargestLocation = %+v, want %+v", status.ContentExists, status.LargestLocation, want)
+	}
+
+	// Once the upstream subscription ended, the cache answers
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadObject() after the track ended error = %v, want io.EOF", err)
+	}
+	status, err = downstream.TrackStatus(ctx, track)
+	if err != nil {
+		t.Fatalf("TrackStatus() of a cached track unexpected error: %v", err)
+	}
+	if !status.ContentExists || status.LargestLocation != want {
+		t.Errorf("TrackStatus() of a cached track got ContentExists = %v, LargestLocation = %+v, want %+v", status.ContentExists, status.LargestLocation, want)
+	}
+
+	// Without an upstream or cached objects, the track doesn't exist
+	_, err = connect(t, NewRelay(nil)).TrackStatus(ctx, track)
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Errorf("TrackStatus() without an upstream error = %v, want DOES_NOT_EXIST", err)
+	}
+}
+
+func TestRelayFailover(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	r := NewRelay(nil)
+
+	// Two origins announce the namespace, the first one announcing is subscribed to
+	var origins []*session.Session
+	var requests []chan *session.SubscribeRequest
+	for i := 0; i < 2; i++ {
+		origin := connect(t, r)
+		reqs := make(chan *session.SubscribeRequest, 1)
+		session.NewPublisher(origin).HandleTrack(track, func(req *session.SubscribeRequest) { reqs <- req })
+		if _, err := origin.PublishNamespace(ctx, ns("live")); err != nil {
+			t.Fatalf("PublishNamespace() unexpected error: %v", err)
+		}
+		origins = append(origins, origin)
+		requests = append(requests, reqs)
+	}
+
+	subscribed := make(chan *session.Subscription)
+	go func() {
+		sub, err := connect(t, r).Subscribe(ctx, track)
+		if err != nil {
+			t.Errorf("Subscribe() unexpected error: %v", err)
+		}
+		subscribed <- sub
+	}()
+	w, err := (<-requests[0]).Accept()
+	if err != nil {
+		t.Fatalf("Accept() unexpected error: %v", err)
+	}
+	sub := <-subscribed
+	if sub == nil {
+		t.FailNow()
+	}
+
+	write := func(w *session.TrackWriter, locs ...model.MoqtLocation) {
+		t.Helper()
+		for _, loc := range locs {
+			if err := w.WriteObject(&model.MoqtObject{Location: loc, ObjectForwardingPreference: model.Subgroup, Payload: []byte("data")}); err != nil {
+				t.Fatalf("WriteObject(%+v) unexpected error: %v", loc, err)
+			}
+		}
+	}
+	read := func(want model.MoqtLocation) {
+		t.Helper()
+		if got, err := sub.ReadObject(ctx); err != nil || got.Location != want {
+			t.Fatalf("ReadObject() got = %v, %v, want %+v", got, err, want)
+		}
+	}
+	write(w, model.MoqtLocation{GroupId: 0, ObjectId: 0}, model.MoqtLocation{GroupId: 0, ObjectId: 1})
+	read(model.MoqtLocation{GroupId: 0, ObjectId: 0})
+	read(model.MoqtLocation{GroupId: 0, ObjectId: 1})
+
+	// The second origin takes over from the last location delivered, the object delivered before isn't repeated
+	origins[0].CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{ErrorCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_NO_ERROR})
+	var req *session.SubscribeRequest
+	select {
+	case req = <-requests[1]:
+	case <-ctx.Done():
+		t.Fatalf("The relay didn't subscribe to the second origin")
+	}
+	if want := (model.MoqtLocation{GroupId: 0, ObjectId: 1}); req.Filter.Type != control.FilterAbsoluteStart || req.Filter.StartLocation != want {
+		t.Errorf("SUBSCRIBE filter = %+v, want Absolute Start at %+v", req.Filter, want)
+	}
+	w, err = req.Accept()
+	if err != nil {
+		t.Fatalf("Accept() unexpected error: %v", err)
+	}
+	write(w, model.MoqtLocation{GroupId: 0, ObjectId: 1}, model.MoqtLocation{GroupId: 0, ObjectId: 2})
+	read(model.MoqtLocation{GroupId: 0, ObjectId: 2})
+
+	// Without any upstream left the subscription ends
+	origins[1].CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{ErrorCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_NO_ERROR})
+	_, err = sub.ReadObject(ctx)
+	var doneErr model.MOQT_PUBLISH_DONE_ERROR
+	if !errors.As(err, &doneErr) || doneErr.StatusCode != control.PublishDoneInternalError {
+		t.Fatalf("ReadObject() without an upstream error = %v, want PUBLISH_DONE INTERNAL_ERROR", err)
+	}
+}
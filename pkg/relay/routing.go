@@ -0,0 +1,187 @@
+package relay
+
+import (
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"sync"
+)
+
+// RoutingTable maps namespaces to the sessions that announced them with PUBLISH_NAMESPACE.
+// Namespaces are stored in a trie with one level per namespace field, so the longest announced prefix of a track's namespace
+// is found in a single walk down the trie, and the namespaces matching a SUBSCRIBE_NAMESPACE prefix are enumerated from one subtree.
+// It is safe for concurrent use.
+type RoutingTable struct {
+	mu       sync.RWMutex
+	root     *routeNode
+	sessions map[*session.Session]map[string]model.MoqtTrackNamespace // Namespaces announced by each session, keyed by MoqtTrackNamespace.Key()
+}
+
+type routeNode struct {
+	namespace  model.MoqtTrackNamespace
+	parent     *routeNode
+	children   map[string]*routeNode // Keyed by the next namespace field
+	announcers []*session.Session    // In the order they announced the namespace, empty for nodes that only lead to longer namespaces
+}
+
+func NewRoutingTable() *RoutingTable {
+	return &RoutingTable{
+		root:     newRouteNode(nil, model.MoqtTrackNamespace{}),
+		sessions: make(map[*session.Session]map[string]model.MoqtTrackNamespace),
+	}
+}
+
+func newRouteNode(parent *routeNode, ns model.MoqtTrackNamespace) *routeNode {
+	return &routeNode{namespace: ns, parent: parent, children: make(map[string]*routeNode)}
+}
+
+// Add records that the session announced the namespace, it reports whether nobody announced the namespace before.
+// Announcing the same namespace twice on a session has no effect.
+func (rt *RoutingTable) Add(ns model.MoqtTrackNamespace, sess *session.Session) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	ns = append(model.MoqtTrackNamespace{}, ns...) // The nodes keep prefixes of it
+	node := rt.root
+	for i, field := range ns {
+		child, ok := node.children[string(field)]
+		if !ok {
+			child = newRouteNode(node, ns[:i+1])
+			node.children[string(field)] = child
+		}
+		node = child
+	}
+
+	for _, announcer := range node.announcers {
+		if announcer == sess {
+			return false
+		}
+	}
+	node.announcers = append(node.announcers, sess)
+
+	if rt.sessions[sess] == nil {
+		rt.sessions[sess] = make(map[string]model.MoqtTrackNamespace)
+	}
+	rt.sessions[sess][ns.Key()] = ns
+	return len(node.announcers) == 1
+}
+
+// Remove forgets that the session announced the namespace, e.g. on PUBLISH_NAMESPACE_DONE.
+// It reports whether the session was the last announcer of the namespace.
+func (rt *RoutingTable) Remove(ns model.MoqtTrackNamespace, sess *session.Session) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.remove(ns, sess)
+}
+
+// RemoveSession forgets every namespace the session announced, e.g. once it terminated.
+// It returns the namespaces that have no announcer left.
+func (rt *RoutingTable) RemoveSession(sess *session.Session) []model.MoqtTrackNamespace {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var withdrawn []model.MoqtTrackNamespace
+	for _, ns := range rt.sessions[sess] {
+		if rt.remove(ns, sess) {
+			withdrawn = append(withdrawn, ns)
+		}
+	}
+	return withdrawn
+}
+
+// Must be called with rt.mu held
+func (rt *RoutingTable) remove(ns model.MoqtTrackNamespace, sess *session.Session) bool {
+	node := rt.find(ns)
+	if node == nil {
+		return false
+	}
+
+	removed := false
+	for i, announcer := range node.announcers {
+		if announcer == sess {
+			node.announcers = append(node.announcers[:i:i], node.announcers[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return false
+	}
+	last := len(node.announcers) == 0
+
+	if namespaces := rt.sessions[sess]; namespaces != nil {
+		delete(namespaces, ns.Key())
+		if len(namespaces) == 0 {
+			delete(rt.sessions, sess)
+		}
+	}
+
+	// Nodes that neither route nor lead to a longer namespace are pruned
+	for node.parent != nil && len(node.announcers) == 0 && len(node.children) == 0 {
+		delete(node.parent.children, string(node.namespace[len(node.namespace)-1]))
+		node = node.parent
+	}
+	return last
+}
+
+// Returns the node of exactly the namespace, nil if there is none. Must be called with rt.mu held.
+func (rt *RoutingTable) find(ns model.MoqtTrackNamespace) *routeNode {
+	node := rt.root
+	for _, field := range ns {
+		child, ok := node.children[string(field)]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	return node
+}
+
+// Lookup finds the longest announced namespace that is a prefix of ns, e.g. the namespace of a track to SUBSCRIBE or FETCH.
+// It returns that namespace and its announcers, the earliest first. ok is false if no announced namespace matches.
+func (rt *RoutingTable) Lookup(ns model.MoqtTrackNamespace) (prefix model.MoqtTrackNamespace, announcers []*session.Session, ok bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	var best *routeNode
+	node := rt.root
+	if len(node.announcers) > 0 {
+		best = node
+	}
+	for _, field := range ns {
+		child, ok := node.children[string(field)]
+		if !ok {
+			break
+		}
+		node = child
+		if len(node.announcers) > 0 {
+			best = node
+		}
+	}
+
+	if best == nil {
+		return nil, nil, false
+	}
+	return best.namespace, append([]*session.Session{}, best.announcers...), true
+}
+
+// Namespaces returns every announced namespace that begins with prefix, as matched by SUBSCRIBE_NAMESPACE.
+// Only the subtree of the prefix is visited.
+func (rt *RoutingTable) Namespaces(prefix model.MoqtTrackNamespace) []model.MoqtTrackNamespace {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	var namespaces []model.MoqtTrackNamespace
+	var walk func(n *routeNode)
+	walk = func(n *routeNode) {
+		if len(n.announcers) > 0 {
+			namespaces = append(namespaces, n.namespace)
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	if node := rt.find(prefix); node != nil {
+		walk(node)
+	}
+	return namespaces
+}
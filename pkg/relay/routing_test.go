@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func ns(fields ...string) model.MoqtTrackNamespace {
+	namespace := model.MoqtTrackNamespace{}
+	for _, field := range fields {
+		namespace = append(namespace, []byte(field))
+	}
+	return namespace
+}
+
+func TestRoutingTable(t *testing.T) {
+	rt := NewRoutingTable()
+	a, b := &session.Session{}, &session.Session{}
+
+	if !rt.Add(ns("live"), a) {
+		t.Errorf("Add() of a new namespace = false, want true")
+	}
+	if rt.Add(ns("live"), b) {
+		t.Errorf("Add() of a second announcer = true, want false")
+	}
+	rt.Add(ns("live", "room1"), b)
+
+	tests := []struct {
+		name       string
+		ns         model.MoqtTrackNamespace
+		wantPrefix model.MoqtTrackNamespace
+		want       []*session.Session
+	}{
+		{"Longest prefix", ns("live", "room1", "cam"), ns("live", "room1"), []*session.Session{b}},
+		{"Exact namespace", ns("live", "room1"), ns("live", "room1"), []*session.Session{b}},
+		{"Shorter prefix, earliest announcer first", ns("live", "room2"), ns("live"), []*session.Session{a, b}},
+		{"Prefix of a field doesn't match", ns("li"), nil, nil},
+		{"No route", ns("vod"), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, announcers, ok := rt.Lookup(tt.ns)
+			if ok != (tt.want != nil) || !prefix.Equal(tt.wantPrefix) || !reflect.DeepEqual(announcers, tt.want) {
+				t.Errorf("Lookup(%s) got = (%s, %v, %v), want (%s, %v)", tt.ns.ToString(), prefix.ToString(), announcers, ok, tt.wantPrefix.ToString(), tt.want)
+			}
+		})
+	}
+
+	namespaces := func(prefix model.MoqtTrackNamespace) []string {
+		var got []string
+		for _, n := range rt.Namespaces(prefix) {
+			got = append(got, n.ToString())
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got, want := namespaces(ns("live")), []string{"live", "live/room1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Namespaces(live) got = %v, want %v", got, want)
+	}
+	if got := namespaces(ns("live", "room2")); got != nil {
+		t.Errorf("Namespaces(live/room2) got = %v, want none", got)
+	}
+
+	// The namespace stays routed as long as one announcer is left
+	if rt.Remove(ns("live"), a) {
+		t.Errorf("Remove() with an announcer left = true, want false")
+	}
+	withdrawn := rt.RemoveSession(b)
+	if len(withdrawn) != 2 {
+		t.Errorf("RemoveSession() withdrew %d namespaces, want 2", len(withdrawn))
+	}
+	if _, _, ok := rt.Lookup(ns("live", "room1")); ok {
+		t.Errorf("Lookup() after every announcer left found a route")
+	}
+	if len(rt.root.children) != 0 {
+		t.Errorf("Empty nodes were not pruned, %d left below the root", len(rt.root.children))
+	}
+}
@@ -0,0 +1,479 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"go-moq/pkg/session/control"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// How a downstream subscription is ended with PUBLISH_DONE
+type doneStatus struct {
+	code   control.PublishDoneStatusCode
+	reason string
+}
+
+// track is a single upstream subscription and the downstream subscribers it is fanned out to.
+type track struct {
+	relay *Relay
+	ftn   model.MoqtFullTrackName
+
+	ready chan struct{} // Closed once the upstream answered the SUBSCRIBE
+	err   error         // Why the upstream SUBSCRIBE failed, set before ready is closed
+
+	// Set before ready is closed if the upstream accepted, replaced under mu when failing over to another upstream
+	upstream        *session.Subscription
+	upstreamSession *session.Session
+	cached          bool          // Whether the objects are put in Relay.Cache
+	cacheAge        time.Duration // How long cached objects may be served by the upstream's MAX_CACHE_DURATION, 0 for no limit
+
+	// Only used by run
+	runStart     *model.MoqtLocation // Where the run of Relay.Cache the objects are put in began, nil if nothing was forwarded
+	lastDatagram *model.MoqtLocation // Largest location that arrived in a datagram, nil if none did
+
+	mu          sync.Mutex
+	downstreams map[*downstream]struct{}
+	pending     int                 // Joined the track, but no downstream subscriber was accepted for it yet
+	largest     *model.MoqtLocation // Largest location forwarded so far, nil if nothing was forwarded
+	resumedAt   *model.MoqtLocation // Where the current upstream subscription resumed after a failover, objects up to it were forwarded already
+	status      *doneStatus         // How the upstream subscription ended, nil while it goes on
+	stopping    bool                // Whether we sent UNSUBSCRIBE upstream, as nobody downstream is interested anymore
+}
+
+func newTrack(r *Relay, ftn model.MoqtFullTrackName) *track {
+	return &track{
+		relay:       r,
+		ftn:         ftn,
+		ready:       make(chan struct{}),
+		downstreams: make(map[*downstream]struct{}),
+	}
+}
+
+// Subscribes upstream, then forwards the objects until the upstream subscription ends.
+func (t *track) start() {
+	defer close(t.ready)
+
+	up, sub, err := t.subscribeUpstream(nil)
+	if err != nil {
+		t.err = err
+		t.relay.removeTrack(t)
+		return
+	}
+	t.useUpstream(up, sub, nil)
+	go t.run()
+}
+
+// Subscribes to the track on the first usable upstream, resuming at resumeAt if it isn't nil.
+// When failing over, upstreams rejecting the SUBSCRIBE are added to failed and the next one is tried.
+func (t *track) subscribeUpstream(resumeAt *model.MoqtLocation, failed ...*session.Session) (*session.Session, *session.Subscription, error) {
+	var opts []session.SubscribeOption
+	if resumeAt != nil {
+		opts = append(opts, session.WithSubscriptionFilter(control.SubscriptionFilter{Type: control.FilterAbsoluteStart, StartLocation: *resumeAt}))
+	}
+
+	for {
+		up, err := t.relay.upstreamFor(t.ftn, failed...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamRequestTimeout)
+		sub, err := up.Subscribe(ctx, t.ftn, opts...)
+		cancel()
+		if err == nil {
+			return up, sub, nil
+		}
+		if len(failed) == 0 {
+			return nil, nil, err // Not failing over, the upstream's answer is passed on downstream
+		}
+		fmt.Printf("[WARN] Relay: Failed to resume %s on another upstream: %v\n", t.ftn.ToString(), err)
+		failed = append(failed, up)
+	}
+}
+
+// Switches to the upstream subscription, taking its MAX_CACHE_DURATION.
+// Reports whether stopIfUnused unsubscribed before, from the previous upstream subscription.
+func (t *track) useUpstream(up *session.Session, sub *session.Subscription, resumedAt *model.MoqtLocation) (stopping bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.upstream = sub
+	t.upstreamSession = up
+	t.resumedAt = resumedAt
+	t.cached = t.relay.Cache != nil
+	t.cacheAge = 0
+	if param, ok := control.FindParam(sub.Parameters, control.ParamMaxCacheDuration); ok {
+		// A MAX_CACHE_DURATION of 0 forbids caching at all
+		t.cached = t.cached && param.ValueUInt64 > 0
+		t.cacheAge = time.Duration(param.ValueUInt64) * time.Millisecond
+	}
+	return t.stopping
+}
+
+func (t *track) run() {
+	var failed []*session.Session
+	for {
+		// Only run replaces the upstream, so it reads it without t.mu
+		obj, err := t.upstream.ReadObject(context.Background())
+		if err == nil {
+			t.forward(obj)
+			continue
+		}
+		var resetErr *session.SubgroupResetError
+		if errors.As(err, &resetErr) {
+			t.lost(resetErr.GroupID)
+			continue
+		}
+
+		if !t.upstreamFailed(err) {
+			t.finish(t.doneStatus(err))
+			return
+		}
+		failed = append(failed, t.upstreamSession)
+		if !t.failover(failed) {
+			t.finish(t.doneStatus(err))
+			return
+		}
+	}
+}
+
+// Reports whether the upstream subscription ended because its session terminated or goes away, rather than the track ending.
+func (t *track) upstreamFailed(err error) bool {
+	select {
+	case <-t.upstreamSession.Done():
+		return true
+	default:
+	}
+	return errors.Is(err, io.EOF) && t.upstream.PublishDone().StatusCode == control.PublishDoneGoingAway
+}
+
+// Subscribes to the track on another upstream, resuming with the largest location forwarded.
+// false is returned if no upstream is left, or nobody downstream is interested in the track anymore.
+func (t *track) failover(failed []*session.Session) bool {
+	t.mu.Lock()
+	stopping := t.stopping
+	var resumeAt *model.MoqtLocation
+	if t.largest != nil {
+		loc := *t.largest
+		resumeAt = &loc
+	}
+	t.mu.Unlock()
+	if stopping {
+		return false
+	}
+
+	up, sub, err := t.subscribeUpstream(resumeAt, failed...)
+	if err != nil {
+		fmt.Printf("[WARN] Relay: No upstream left for %s: %v\n", t.ftn.ToString(), err)
+		return false
+	}
+	// The last downstream subscriber might have left while we subscribed, the new subscription is ended like the failed one
+	if t.useUpstream(up, sub, resumeAt) {
+		if err := sub.Unsubscribe(); err != nil {
+			fmt.Printf("[WARN] Relay: Failed to unsubscribe from %s: %v\n", t.ftn.ToString(), err)
+		}
+	}
+	return true
+}
+
+// Translates why reading the upstream subscription stopped into the PUBLISH_DONE for the downstream subscribers.
+func (t *track) doneStatus(err error) doneStatus {
+	var doneErr model.MOQT_PUBLISH_DONE_ERROR
+	switch {
+	case errors.Is(err, io.EOF):
+		done := t.upstream.PublishDone()
+		return doneStatus{code: done.StatusCode, reason: string(done.ReasonPhrase)}
+	case errors.As(err, &doneErr):
+		return doneStatus{code: doneErr.StatusCode, reason: string(doneErr.ReasonPhrase)}
+	case errors.Is(err, session.ErrTooFarBehind):
+		return doneStatus{code: control.PublishDoneTooFarBehind, reason: "Relay fell too far behind the upstream"}
+	}
+	return doneStatus{code: control.PublishDoneInternalError, reason: "Upstream session terminated"}
+}
+
+func (t *track) forward(obj *model.MoqtObject) {
+	// Only run switches upstreams, so where the current one resumed and whether it is cached are read without t.mu
+	loc := obj.Location
+	if t.resumedAt != nil && !t.resumedAt.LessThan(loc) {
+		return // Forwarded already by the upstream we failed over from
+	}
+	// Datagrams that were lost aren't reported, one that doesn't follow the previous one in its group tells of a hole
+	if obj.ObjectForwardingPreference == model.Datagram {
+		if t.lastDatagram != nil && !follows(*t.lastDatagram, loc) {
+			t.lost(loc.GroupId)
+		}
+		if t.lastDatagram == nil || t.lastDatagram.LessThan(loc) {
+			t.lastDatagram = &loc
+		}
+	}
+	// The objects forwarded since the run started form a run of the cache. Put may block, e.g. on a disk
+	if t.cached {
+		if t.runStart == nil {
+			t.runStart = &loc
+		}
+		if err := t.relay.Cache.Put(obj, *t.runStart, t.cacheAge); err != nil {
+			fmt.Printf("[WARN] Relay: Failed to cache object %v of %s: %v\n", loc, t.ftn.ToString(), err)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.largest == nil || t.largest.LessThan(loc) {
+		t.largest = &loc
+	}
+	for d := range t.downstreams {
+		d.enqueue(obj)
+	}
+}
+
+// Reports whether loc directly follows prev, as the next object of its group or the first object of a later group.
+func follows(prev model.MoqtLocation, loc model.MoqtLocation) bool {
+	if loc.GroupId == prev.GroupId {
+		return loc.ObjectId == prev.ObjectId+1
+	}
+	return loc.GroupId > prev.GroupId && loc.ObjectId == 0
+}
+
+// Objects of the group were lost on the way, e.g. as its subgroup stream was reset upstream. The run of the cache is cut
+// before the group, so the group isn't served from the cache as if it was complete, and the objects after it start a new run.
+func (t *track) lost(groupId uint64) {
+	next := model.MoqtLocation{GroupId: groupId + 1}
+	if !t.cached || groupId == math.MaxUint64 || (t.runStart != nil && !t.runStart.LessThan(next)) {
+		return // Not cached, or the current run already began after the group
+	}
+	if t.runStart != nil {
+		if err := t.relay.Cache.Cut(t.ftn, *t.runStart, groupId); err != nil {
+			fmt.Printf("[WARN] Relay: Failed to cut the cached run of %s before group %d: %v\n", t.ftn.ToString(), groupId, err)
+		}
+	}
+	t.runStart = &next
+}
+
+// Ends every downstream subscription once the objects queued for it were written.
+func (t *track) finish(status doneStatus) {
+	t.relay.removeTrack(t)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = &status
+	for d := range t.downstreams {
+		d.finish(status)
+	}
+}
+
+// Answers the downstream SUBSCRIBE of a joiner and adds the subscriber. It is added before SUBSCRIBE_OK is sent,
+// so the objects forwarded in the meantime are queued for it, after the LARGEST_OBJECT it is told.
+func (t *track) accept(sess *session.Session, req *session.SubscribeRequest) error {
+	t.mu.Lock()
+	t.pending--
+	params := t.subscribeOkParams()
+	d := newDownstream(t, sess, t.relay.maxQueuedObjects())
+	if t.largest != nil {
+		joinedAt := *t.largest
+		d.joinedAt = &joinedAt
+	}
+	t.downstreams[d] = struct{}{}
+	if t.status != nil {
+		d.finish(*t.status) // Ended between join and accept
+	}
+	t.mu.Unlock()
+
+	w, err := req.Accept(params...)
+	if err != nil {
+		t.remove(d)
+		return err
+	}
+
+	t.mu.Lock()
+	d.w = w
+	t.mu.Unlock()
+
+	go d.run()
+	return nil
+}
+
+// The parameters of the downstream SUBSCRIBE_OK, the ones of the upstream SUBSCRIBE_OK with LARGEST_OBJECT brought up to date.
+// Must be called with t.mu held.
+func (t *track) subscribeOkParams() []model.MoqtKeyValuePair {
+	params := make([]model.MoqtKeyValuePair, 0, len(t.upstream.Parameters))
+	for _, param := range t.upstream.Parameters {
+		if t.largest != nil && param.Type == control.ParamLargestObject {
+			continue
+		}
+		params = append(params, param)
+	}
+	if t.largest != nil {
+		params = append(params, control.LargestObjectParam(*t.largest))
+	}
+	return params
+}
+
+// Reports whether a joiner can still use the track, must be called with t.mu held.
+func (t *track) joinable() bool {
+	return !t.stopping && t.status == nil
+}
+
+func (t *track) remove(d *downstream) {
+	t.mu.Lock()
+	delete(t.downstreams, d)
+	t.mu.Unlock()
+	t.stopIfUnused()
+}
+
+// Unsubscribes upstream once the last downstream subscriber is gone, the upstream's PUBLISH_DONE then ends run.
+func (t *track) stopIfUnused() {
+	t.mu.Lock()
+	unused := len(t.downstreams) == 0 && t.pending == 0 && t.joinable()
+	if unused {
+		t.stopping = true
+	}
+	upstream := t.upstream
+	t.mu.Unlock()
+
+	if !unused {
+		return
+	}
+	t.relay.removeTrack(t)
+	if err := upstream.Unsubscribe(); err != nil {
+		fmt.Printf("[WARN] Relay: Failed to unsubscribe from %s: %v\n", t.ftn.ToString(), err)
+	}
+}
+
+// downstream is the subscription of one downstream session to a track, written by its own goroutine.
+type downstream struct {
+	t         *track
+	sess      *session.Session
+	w         *session.TrackWriter // Set under t.mu once SUBSCRIBE_OK was sent, before run starts
+	maxQueued int
+	joinedAt  *model.MoqtLocation // The LARGEST_OBJECT of its SUBSCRIBE_OK, where joining fetches end. nil if there was none
+
+	mu     sync.Mutex
+	queue  []*model.MoqtObject // Objects forwarded by the track but not written yet
+	notify chan struct{}       // Signaled when the queue or status changes
+	status *doneStatus         // How to end the subscription once the queue is written, nil while it goes on
+
+	openGroups map[uint64]struct{} // Groups that might still have open subgroup streams, only used by run
+}
+
+func newDownstream(t *track, sess *session.Session, maxQueued int) *downstream {
+	return &downstream{
+		t:          t,
+		sess:       sess,
+		maxQueued:  maxQueued,
+		notify:     make(chan struct{}, 1),
+		openGroups: make(map[uint64]struct{}),
+	}
+}
+
+// Queues the object for writing, it never blocks. A subscriber whose queue is full is ended with TOO_FAR_BEHIND.
+func (d *downstream) enqueue(obj *model.MoqtObject) {
+	d.mu.Lock()
+	if d.status != nil {
+		d.mu.Unlock()
+		return
+	}
+	if len(d.queue) >= d.maxQueued {
+		d.queue = nil
+		d.status = &doneStatus{code: control.PublishDoneTooFarBehind, reason: "Subscriber fell too far behind"}
+	} else {
+		d.queue = append(d.queue, obj)
+	}
+	d.mu.Unlock()
+	d.signal()
+}
+
+func (d *downstream) finish(status doneStatus) {
+	d.mu.Lock()
+	if d.status == nil {
+		d.status = &status
+	}
+	d.mu.Unlock()
+	d.signal()
+}
+
+func (d *downstream) signal() {
+	select {
+	case d.notify <- struct{}{}:
+	default: // A signal is already pending
+	}
+}
+
+// Writes the queued objects until the subscription ends, by the upstream, the subscriber's UNSUBSCRIBE or its session terminating.
+func (d *downstream) run() {
+	defer d.t.remove(d)
+
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			status := d.status
+			d.mu.Unlock()
+
+			if status != nil {
+				if err := d.w.CloseWithStatus(status.code, status.reason); err != nil {
+					fmt.Printf("[WARN] Relay: Failed to end subscription %d: %v\n", d.w.RequestID, err)
+				}
+				return
+			}
+
+			select {
+			case <-d.notify:
+			case <-d.w.Done():
+				return
+			case <-d.sess.Done():
+				return
+			}
+			continue
+		}
+
+		obj := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+
+		if !d.write(obj) {
+			return
+		}
+	}
+}
+
+// Writes a single object, false is returned if the subscription can't take any more objects.
+func (d *downstream) write(obj *model.MoqtObject) bool {
+	if obj.ObjectForwardingPreference == model.Subgroup {
+		d.closeStaleGroups(obj.Location.GroupId)
+	}
+
+	if err := d.w.WriteObject(obj); err != nil {
+		select {
+		case <-d.w.Done():
+			return false
+		case <-d.sess.Done():
+			return false
+		default:
+		}
+		// e.g. the subscriber reset a subgroup stream, later objects of the subgroup open a new one
+		fmt.Printf("[WARN] Relay: Failed to forward object %v of %s: %v\n", obj.Location, d.t.ftn.ToString(), err)
+	}
+	return true
+}
+
+// The Subscription doesn't tell when an upstream subgroup stream ends, so the downstream streams of a group are finished
+// once a group two newer started. This keeps the number of open streams bounded, late objects of the group open a new stream.
+func (d *downstream) closeStaleGroups(groupId uint64) {
+	if _, ok := d.openGroups[groupId]; ok {
+		return
+	}
+	for open := range d.openGroups {
+		if open+1 < groupId {
+			d.w.CloseGroup(open)
+			delete(d.openGroups, open)
+		}
+	}
+	d.openGroups[groupId] = struct{}{}
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"context"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session"
+	"go-moq/pkg/session/control"
+)
+
+// Answers a downstream TRACK_STATUS from the live upstream subscription of the track, or from the cache once there is none.
+// Tracks the relay knows nothing about are asked for upstream.
+func (r *Relay) trackStatus(req *session.TrackStatusRequest) {
+	if params, ok := r.liveStatus(req.FullTrackName); ok {
+		req.Accept(params...)
+		return
+	}
+
+	if r.Cache != nil {
+		if _, largest, ok := r.Cache.Bounds(req.FullTrackName, model.MoqtLocation{}, wholeTrack); ok {
+			req.Accept(control.LargestObjectParam(largest))
+			return
+		}
+	}
+
+	up, err := r.upstreamFor(req.FullTrackName)
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamRequestTimeout)
+	status, err := up.TrackStatus(ctx, req.FullTrackName)
+	cancel()
+	if err != nil {
+		reqErr := requestError(err, req.FullTrackName)
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+	req.Accept(status.Parameters...)
+}
+
+// Returns the parameters of the downstream SUBSCRIBE_OK for the track, ok is false unless it has a live upstream subscription.
+func (r *Relay) liveStatus(ftn model.MoqtFullTrackName) ([]model.MoqtKeyValuePair, bool) {
+	r.mu.Lock()
+	t, ok := r.tracks[ftn.Key()]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-t.ready:
+	default:
+		return nil, false // Still subscribing upstream
+	}
+	if t.err != nil {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status != nil {
+		return nil, false
+	}
+	return t.subscribeOkParams(), true
+}
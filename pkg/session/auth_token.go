@@ -0,0 +1,206 @@
+package session
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"sync"
+)
+
+// Tokens of AUTHORIZATION_TOKEN can be registered under an alias, so later requests only carry the alias (Section 9.2.1.1)
+// Every endpoint limits the token data it stores for the peer with the MAX_AUTH_TOKEN_CACHE_SIZE setup parameter.
+// Incoming tokens are resolved by the session before the request reaches its handler: registered and aliased tokens
+// are rewritten to USE_VALUE and DELETE is removed, so handlers always see the token values, see control.AuthTokensFromParams.
+
+// The size a registered token occupies in the cache, its Token Value plus the alias and the type.
+func authTokenSize(t control.AuthToken) uint64 {
+	return uint64(len(t.Value)) + 16
+}
+
+// AuthTokenCache holds the tokens registered under an alias on one side of the session.
+// It is safe for concurrent use.
+type AuthTokenCache struct {
+	mu     sync.Mutex
+	tokens map[uint64]control.AuthToken // Registered tokens by Token Alias, stored as USE_VALUE
+	size   uint64                       // Sum of authTokenSize of the registered tokens
+}
+
+func NewAuthTokenCache() *AuthTokenCache {
+	return &AuthTokenCache{tokens: make(map[uint64]control.AuthToken)}
+}
+
+// Size returns the amount of token data that is registered.
+func (c *AuthTokenCache) Size() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Apply processes the token against the cache and returns the token the request actually carries, as USE_VALUE.
+// REGISTER adds the token, USE_ALIAS looks it up and DELETE removes it, ok is false for DELETE as it carries no token.
+// A REGISTER beyond maxSize is an AUTH_TOKEN_CACHE_OVERFLOW, an alias registered twice a DUPLICATE_AUTH_TOKEN_ALIAS
+// and an alias that isn't registered an UNKNOWN_AUTH_TOKEN_ALIAS, nothing is changed then.
+func (c *AuthTokenCache) Apply(t control.AuthToken, maxSize uint64) (control.AuthToken, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apply(t, maxSize)
+}
+
+// ApplyAndSend applies the tokens of a message we send and sends it with send, without letting another message in between,
+// so a USE_ALIAS can't reach the peer before the REGISTER of its alias. Either all tokens are applied and the message is sent,
+// or the cache is left unchanged and the error of the first invalid token, or of send, is returned.
+// A nil send only checks the tokens.
+func (c *AuthTokenCache) ApplyAndSend(tokens []control.AuthToken, maxSize uint64, send func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// What every alias held before the message, restored in reverse order if it isn't sent
+	type previous struct {
+		alias      uint64
+		token      control.AuthToken
+		registered bool
+	}
+	var undo []previous
+	size := c.size
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undo[i].registered {
+				c.tokens[undo[i].alias] = undo[i].token
+			} else {
+				delete(c.tokens, undo[i].alias)
+			}
+		}
+		c.size = size
+	}
+
+	for _, t := range tokens {
+		token, registered := c.tokens[t.Alias]
+		undo = append(undo, previous{alias: t.Alias, token: token, registered: registered})
+		if _, _, err := c.apply(t, maxSize); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if send == nil {
+		rollback()
+		return nil
+	}
+	if err := send(); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// Must be called with c.mu held
+func (c *AuthTokenCache) apply(t control.AuthToken, maxSize uint64) (control.AuthToken, bool, error) {
+	switch t.AliasType {
+	case control.AuthTokenUseValue:
+		return t, true, nil
+
+	case control.AuthTokenRegister:
+		if _, ok := c.tokens[t.Alias]; ok {
+			return control.AuthToken{}, false, authTokenError(model.MOQT_SESSION_TERMINATION_ERROR_CODE_DUPLICATE_AUTH_TOKEN_ALIAS,
+				fmt.Sprintf("Token Alias %d is already registered", t.Alias))
+		}
+		size := authTokenSize(t)
+		if c.size+size > maxSize {
+			return control.AuthToken{}, false, authTokenError(model.MOQT_SESSION_TERMINATION_ERROR_CODE_AUTH_TOKEN_CACHE_OVERFLOW,
+				fmt.Sprintf("Registering Token Alias %d exceeds the token cache size of %d bytes", t.Alias, maxSize))
+		}
+		value := control.AuthToken{AliasType: control.AuthTokenUseValue, TokenType: t.TokenType, Value: t.Value}
+		c.tokens[t.Alias] = value
+		c.size += size
+		return value, true, nil
+
+	case control.AuthTokenUseAlias:
+		value, ok := c.tokens[t.Alias]
+		if !ok {
+			return control.AuthToken{}, false, unknownAuthTokenAlias(t.Alias)
+		}
+		return value, true, nil
+
+	case control.AuthTokenDelete:
+		value, ok := c.tokens[t.Alias]
+		if !ok {
+			return control.AuthToken{}, false, unknownAuthTokenAlias(t.Alias)
+		}
+		delete(c.tokens, t.Alias)
+		c.size -= authTokenSize(value)
+		return control.AuthToken{}, false, nil
+	}
+	return control.AuthToken{}, false, authTokenError(model.MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_AUTH_TOKEN,
+		fmt.Sprintf("Unknown Alias Type: %#X", uint64(t.AliasType)))
+}
+
+func unknownAuthTokenAlias(alias uint64) model.MOQT_SESSION_TERMINATION_ERROR {
+	return authTokenError(model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS, fmt.Sprintf("Token Alias %d is not registered", alias))
+}
+
+func authTokenError(code model.MOQT_SESSION_TERMINATION_ERROR_CODE, reason string) model.MOQT_SESSION_TERMINATION_ERROR {
+	return model.MOQT_SESSION_TERMINATION_ERROR{ErrorCode: code, ReasonPhrase: model.NewReasonPhrase(reason)}
+}
+
+// Resolves the AUTHORIZATION_TOKEN parameters the peer sent against PeerAuthTokens, the parameters are rewritten in place.
+// Any error terminates the session.
+func (state *SessionState) resolvePeerAuthTokens(params *[]model.MoqtKeyValuePair) error {
+	resolved := (*params)[:0:0]
+	for _, param := range *params {
+		if param.Type != control.ParamAuthToken {
+			resolved = append(resolved, param)
+			continue
+		}
+
+		var t control.AuthToken
+		if err := t.Decode(param.ValueBytes); err != nil {
+			return err
+		}
+		value, ok, err := state.PeerAuthTokens.Apply(t, state.LocalTokenCacheSize)
+		if err != nil {
+			return err
+		}
+		if ok {
+			resolved = append(resolved, value.ToParam())
+		}
+	}
+	*params = resolved
+	return nil
+}
+
+// Checks the AUTHORIZATION_TOKEN parameters of a message WE are about to send against LocalAuthTokens without applying them,
+// so a request the peer would terminate the session for fails before it takes a Request ID.
+func (state *SessionState) checkLocalAuthTokens(params []model.MoqtKeyValuePair) error {
+	return state.sendWithLocalAuthTokens(params, nil)
+}
+
+// Applies the AUTHORIZATION_TOKEN parameters of a message WE send to LocalAuthTokens and sends it with send, so we never overflow
+// the peer's cache or reuse an alias. The cache is only changed if the message was sent, the errors of the tokens
+// are the ones the peer would terminate the session with, nothing is sent then.
+func (state *SessionState) sendWithLocalAuthTokens(params []model.MoqtKeyValuePair, send func() error) error {
+	tokens, err := control.AuthTokensFromParams(params)
+	if err != nil {
+		return err
+	}
+	return state.LocalAuthTokens.ApplyAndSend(tokens, state.PeerMaxTokenCacheSize, send)
+}
+
+// Returns the parameters of a message that can carry AUTHORIZATION_TOKEN, nil for any other message.
+func authTokenParams(msg control.ControlMessage) *[]model.MoqtKeyValuePair {
+	switch m := msg.(type) {
+	case *control.SubscribeMessage:
+		return &m.Parameters
+	case *control.FetchMessage:
+		return &m.Parameters
+	case *control.PublishMessage:
+		return &m.Parameters
+	case *control.PublishNamespaceMessage:
+		return &m.Parameters
+	case *control.SubscribeNamespaceMessage:
+		return &m.Parameters
+	case *control.TrackStatusMessage:
+		return &m.Parameters
+	case *control.RequestUpdateMessage:
+		return &m.Parameters
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"reflect"
+	"testing"
+)
+
+func TestAuthTokenCache(t *testing.T) {
+	cache := NewAuthTokenCache()
+	register := control.AuthToken{AliasType: control.AuthTokenRegister, Alias: 1, TokenType: 7, Value: []byte("0123456789")}
+	size := authTokenSize(register)
+
+	expectCode := func(err error, code model.MOQT_SESSION_TERMINATION_ERROR_CODE) {
+		t.Helper()
+		var termErr model.MOQT_SESSION_TERMINATION_ERROR
+		if !errors.As(err, &termErr) || termErr.ErrorCode != code {
+			t.Errorf("Apply() error = %v, want code %#X", err, uint64(code))
+		}
+	}
+
+	if _, _, err := cache.Apply(register, size-1); err == nil {
+		t.Fatalf("Apply() of a token larger than the cache expected an error, but got none")
+	} else {
+		expectCode(err, model.MOQT_SESSION_TERMINATION_ERROR_CODE_AUTH_TOKEN_CACHE_OVERFLOW)
+	}
+
+	value, ok, err := cache.Apply(register, size)
+	if err != nil || !ok || value.AliasType != control.AuthTokenUseValue || string(value.Value) != "0123456789" {
+		t.Fatalf("Apply() of REGISTER got = (%+v, %v, %v), want the USE_VALUE token", value, ok, err)
+	}
+	_, _, err = cache.Apply(register, 2*size)
+	expectCode(err, model.MOQT_SESSION_TERMINATION_ERROR_CODE_DUPLICATE_AUTH_TOKEN_ALIAS)
+
+	if value, ok, err := cache.Apply(control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 1}, size); err != nil || !ok || value.TokenType != 7 {
+		t.Errorf("Apply() of USE_ALIAS got = (%+v, %v, %v), want the registered token", value, ok, err)
+	}
+	_, _, err = cache.Apply(control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 2}, size)
+	expectCode(err, model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS)
+
+	// Deleting frees the space for another token
+	if _, ok, err := cache.Apply(control.AuthToken{AliasType: control.AuthTokenDelete, Alias: 1}, size); err != nil || ok {
+		t.Errorf("Apply() of DELETE got = (%v, %v), want (false, nil)", ok, err)
+	}
+	if cache.Size() != 0 {
+		t.Errorf("Size() after DELETE got = %d, want 0", cache.Size())
+	}
+	register.Alias = 2
+	if _, _, err := cache.Apply(register, size); err != nil {
+		t.Errorf("Apply() of REGISTER after DELETE unexpected error: %v", err)
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	client.State.PeerMaxTokenCacheSize = 64
+	server.State.LocalTokenCacheSize = 64
+	track := testutil.FullTrackName("video", "live")
+
+	received := make(chan []control.AuthToken, 2)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		tokens, err := control.AuthTokensFromParams(req.Parameters)
+		if err != nil {
+			t.Errorf("AuthTokensFromParams() unexpected error: %v", err)
+		}
+		received <- tokens
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED, "Just checking")
+	})
+
+	// The handler sees the token value, whether it was registered or used by alias
+	want := control.AuthToken{AliasType: control.AuthTokenUseValue, TokenType: 1, Value: []byte("secret")}
+	register := control.AuthToken{AliasType: control.AuthTokenRegister, Alias: 5, TokenType: 1, Value: []byte("secret")}
+	useAlias := control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 5}
+	for _, token := range []control.AuthToken{register, useAlias} {
+		client.Subscribe(ctx, track, WithAuthToken(token))
+		if got := <-received; len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("Tokens of SUBSCRIBE with %v got = %+v, want %+v", token.AliasType, got, want)
+		}
+	}
+
+	// The client knows the alias is taken and the peer's cache is full, neither is sent
+	if _, err := client.Subscribe(ctx, track, WithAuthToken(register)); err == nil {
+		t.Errorf("Subscribe() registering an alias twice expected an error, but got none")
+	}
+	big := control.AuthToken{AliasType: control.AuthTokenRegister, Alias: 6, TokenType: 1, Value: make([]byte, 64)}
+	if _, err := client.Subscribe(ctx, track, WithAuthToken(big)); err == nil {
+		t.Errorf("Subscribe() overflowing the peer's token cache expected an error, but got none")
+	}
+
+	// Bypassing the client's checks, the server terminates the session
+	client.Cmf.WriteControlMessage(&control.SubscribeMessage{
+		RequestID:     4,
+		FullTrackName: track,
+		Parameters:    []model.MoqtKeyValuePair{control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 9}.ToParam()},
+	})
+	<-server.Done()
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if !errors.As(server.Err(), &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS {
+		t.Errorf("Err() after an unknown Token Alias = %v, want UNKNOWN_AUTH_TOKEN_ALIAS", server.Err())
+	}
+}
+
+func TestAuthTokenCacheApplyAndSend(t *testing.T) {
+	cache := NewAuthTokenCache()
+	register := control.AuthToken{AliasType: control.AuthTokenRegister, Alias: 1, TokenType: 7, Value: []byte("0123456789")}
+	if _, _, err := cache.Apply(register, 1024); err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+	size := cache.Size()
+
+	// The tokens of a message that isn't sent leave no trace, even the valid ones before the failing one
+	failure := errors.New("stream closed")
+	tokens := []control.AuthToken{
+		{AliasType: control.AuthTokenDelete, Alias: 1},
+		{AliasType: control.AuthTokenRegister, Alias: 2, TokenType: 7, Value: []byte("abc")},
+	}
+	if err := cache.ApplyAndSend(tokens, 1024, func() error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("ApplyAndSend() error = %v, want the error of send", err)
+	}
+	invalid := append(tokens, control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 3})
+	sent := false
+	err := cache.ApplyAndSend(invalid, 1024, func() error {
+		sent = true
+		return nil
+	})
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS || sent {
+		t.Fatalf("ApplyAndSend() with an unknown alias got = (%v, sent: %v), want UNKNOWN_AUTH_TOKEN_ALIAS and nothing sent", err, sent)
+	}
+	if err := cache.ApplyAndSend(tokens, 1024, nil); err != nil {
+		t.Fatalf("ApplyAndSend() only checking unexpected error: %v", err)
+	}
+	if value, _, err := cache.Apply(control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 1}, 1024); err != nil || string(value.Value) != "0123456789" {
+		t.Errorf("Apply() of USE_ALIAS 1 after the rollbacks got = (%+v, %v), want the registered token", value, err)
+	}
+	if cache.Size() != size {
+		t.Errorf("Size() after the rollbacks got = %d, want %d", cache.Size(), size)
+	}
+
+	// Once sent, the tokens are applied
+	if err := cache.ApplyAndSend(tokens, 1024, func() error { return nil }); err != nil {
+		t.Fatalf("ApplyAndSend() unexpected error: %v", err)
+	}
+	if _, _, err := cache.Apply(control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 1}, 1024); err == nil {
+		t.Errorf("Apply() of USE_ALIAS 1 after its DELETE was sent expected an error, but got none")
+	}
+	if cache.Size() != authTokenSize(tokens[1]) {
+		t.Errorf("Size() after sending got = %d, want %d", cache.Size(), authTokenSize(tokens[1]))
+	}
+}
+
+// An alias is only known once the request registering it was sent, a request waiting for its Request ID doesn't count.
+func TestAuthTokenRegisteredOnSend(t *testing.T) {
+	ctx := testutil.Context(t)
+	state := NewSessionState(RoleClient, 100, 0)
+	state.PeerMaxTokenCacheSize = 64
+	client, peer := newRawPeer(t, state)
+	track := testutil.FullTrackName("video", "live")
+
+	register := control.AuthToken{AliasType: control.AuthTokenRegister, Alias: 5, TokenType: 1, Value: []byte("secret")}
+	go client.Subscribe(ctx, track, WithAuthToken(register))
+	if msg, ok := readMessage(t, peer).(*control.RequestsBlockedMessage); !ok || msg.MaximumRequestID != 0 {
+		t.Fatalf("Got %#v, want REQUESTS_BLOCKED with Maximum Request ID 0", msg)
+	}
+
+	useAlias := control.AuthToken{AliasType: control.AuthTokenUseAlias, Alias: 5}
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if _, err := client.Subscribe(ctx, track, WithAuthToken(useAlias)); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNKNOWN_AUTH_TOKEN_ALIAS {
+		t.Fatalf("Subscribe() using the alias before its REGISTER was sent error = %v, want UNKNOWN_AUTH_TOKEN_ALIAS", err)
+	}
+
+	if err := peer.WriteControlMessage(&control.MaxRequestIdMessage{MaxRequestID: 2}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	msg, ok := readMessage(t, peer).(*control.SubscribeMessage)
+	if !ok || msg.RequestID != 0 {
+		t.Fatalf("Got %#v, want SUBSCRIBE with Request ID 0", msg)
+	}
+	if tokens, err := control.AuthTokensFromParams(msg.Parameters); err != nil || len(tokens) != 1 || tokens[0].AliasType != control.AuthTokenRegister {
+		t.Errorf("Tokens of SUBSCRIBE got = (%+v, %v), want the REGISTER", tokens, err)
+	}
+	if client.State.LocalAuthTokens.Size() != authTokenSize(register) {
+		t.Errorf("LocalAuthTokens.Size() after the REGISTER was sent got = %d, want %d", client.State.LocalAuthTokens.Size(), authTokenSize(register))
+	}
+}
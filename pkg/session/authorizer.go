@@ -0,0 +1,127 @@
+package session
+
+import (
+	"errors"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"go-moq/pkg/transport"
+)
+
+// AuthRequest describes what the peer asks to be authorized for, at setup or with a request.
+type AuthRequest struct {
+	Conn  transport.MOQTConnection
+	State *SessionState // Path, Authority and the tokens of CLIENT_SETUP (SetupAuthTokens)
+
+	Type      control.ControlMessageType // CLIENT_SETUP at setup, the type of the request otherwise
+	RequestID uint64                     // Not set at setup
+	Tokens    []control.AuthToken        // The AUTHORIZATION_TOKENs of CLIENT_SETUP or of the request, resolved to USE_VALUE
+
+	FullTrackName model.MoqtFullTrackName  // The track of SUBSCRIBE, PUBLISH, TRACK_STATUS and standalone FETCH
+	Namespace     model.MoqtTrackNamespace // The namespace of PUBLISH_NAMESPACE, the prefix of SUBSCRIBE_NAMESPACE
+}
+
+// Authorizer decides whether the peer may use the session and each of its requests.
+// It is called from the goroutine reading the control stream (or the SUBSCRIBE_NAMESPACE stream), so it should return quickly.
+type Authorizer interface {
+	// AuthorizeSetup is called once the peer's CLIENT_SETUP is received, before SERVER_SETUP is sent.
+	// An error terminates the session, with its own code for a model.MOQT_SESSION_TERMINATION_ERROR and UNAUTHORIZED otherwise.
+	AuthorizeSetup(req *AuthRequest) error
+
+	// AuthorizeRequest is called for every request of the peer, before its handler.
+	// An error rejects the request with REQUEST_ERROR, with its own code for a model.MOQT_REQUEST_ERROR and UNAUTHORIZED otherwise.
+	// A model.MOQT_SESSION_TERMINATION_ERROR terminates the session instead, e.g. for EXPIRED_AUTH_TOKEN.
+	AuthorizeRequest(req *AuthRequest) error
+}
+
+// SetAuthorizer installs the Authorizer for the requests of the peer, nil authorizes everything.
+func (s *Session) SetAuthorizer(a Authorizer) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.authorizer = a
+}
+
+// Runs the Authorizer for a request of the peer, whose tokens were already resolved.
+// The returned error is a model.MOQT_REQUEST_ERROR to reject the request with or a model.MOQT_SESSION_TERMINATION_ERROR.
+func (s *Session) authorizeRequest(msg control.ControlMessage) error {
+	s.handlersMutex.Lock()
+	a := s.authorizer
+	s.handlersMutex.Unlock()
+
+	if a == nil {
+		return nil
+	}
+
+	requestID := msg.(control.RequestMessage).GetRequestID()
+	req := &AuthRequest{
+		Conn:      s.Conn,
+		State:     s.State,
+		Type:      msg.Type(),
+		RequestID: requestID,
+	}
+	if params := authTokenParams(msg); params != nil {
+		tokens, err := control.AuthTokensFromParams(*params)
+		if err != nil {
+			return err
+		}
+		req.Tokens = tokens
+	}
+
+	switch m := msg.(type) {
+	case *control.SubscribeMessage:
+		req.FullTrackName = m.FullTrackName
+	case *control.FetchMessage:
+		req.FullTrackName = m.FullTrackName
+	case *control.PublishMessage:
+		req.FullTrackName = m.FullTrackName
+	case *control.TrackStatusMessage:
+		req.FullTrackName = m.FullTrackName
+	case *control.PublishNamespaceMessage:
+		req.Namespace = m.Namespace
+	case *control.SubscribeNamespaceMessage:
+		req.Namespace = m.NamespacePrefix
+	}
+
+	err := a.AuthorizeRequest(req)
+	if err == nil {
+		return nil
+	}
+
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if errors.As(err, &termErr) {
+		return termErr
+	}
+	var reqErr model.MOQT_REQUEST_ERROR
+	if errors.As(err, &reqErr) {
+		reqErr.RequestID = requestID
+		return reqErr
+	}
+	// The reason of an arbitrary error isn't sent, it might not be meant for the peer
+	return model.MOQT_REQUEST_ERROR{
+		RequestID:    requestID,
+		ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED,
+		ReasonPhrase: model.NewReasonPhrase("Unauthorized"),
+	}
+}
+
+// AuthorizeSetup runs a.AuthorizeSetup for the peer's CLIENT_SETUP, after SessionState.FromParams.
+// The returned error is the model.MOQT_SESSION_TERMINATION_ERROR to close the session with.
+func (s *Session) AuthorizeSetup(a Authorizer) error {
+	err := a.AuthorizeSetup(&AuthRequest{
+		Conn:   s.Conn,
+		State:  s.State,
+		Type:   control.CLIENT_SETUP,
+		Tokens: s.State.SetupAuthTokens,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if errors.As(err, &termErr) {
+		return termErr
+	}
+	return model.MOQT_SESSION_TERMINATION_ERROR{
+		ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNAUTHORIZED,
+		ReasonPhrase: model.NewReasonPhrase("Unauthorized"),
+	}
+}
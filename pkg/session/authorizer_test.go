@@ -0,0 +1,87 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"reflect"
+	"testing"
+)
+
+// Authorizes by the token value: "setup" for the session, the track name for a request.
+type tokenAuthorizer struct {
+	requests chan *AuthRequest
+}
+
+func (a *tokenAuthorizer) AuthorizeSetup(req *AuthRequest) error {
+	if len(req.Tokens) == 1 && string(req.Tokens[0].Value) == "setup" {
+		return nil
+	}
+	return errors.New("no setup token")
+}
+
+func (a *tokenAuthorizer) AuthorizeRequest(req *AuthRequest) error {
+	a.requests <- req
+	if len(req.Tokens) == 0 {
+		return errors.New("no token")
+	}
+	if string(req.Tokens[0].Value) == "expired" {
+		return model.MOQT_REQUEST_ERROR{ErrorCode: model.MOQT_REQUEST_ERROR_CODE_EXPIRED_AUTH_TOKEN, ReasonPhrase: model.NewReasonPhrase("Expired")}
+	}
+	if string(req.Tokens[0].Value) != string(req.FullTrackName.Name) {
+		return errors.New("wrong track")
+	}
+	return nil
+}
+
+func TestAuthorizer(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	authorizer := &tokenAuthorizer{requests: make(chan *AuthRequest, 4)}
+	server.SetAuthorizer(authorizer)
+	track := testutil.FullTrackName("video", "live")
+
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST, "Reached the handler")
+	})
+
+	token := func(value string) SubscribeOption {
+		return WithAuthToken(control.AuthToken{AliasType: control.AuthTokenUseValue, TokenType: 1, Value: []byte(value)})
+	}
+	tests := []struct {
+		name string
+		opts []SubscribeOption
+		want model.MOQT_REQUEST_ERROR_CODE
+	}{
+		{"No token", nil, model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED},
+		{"Wrong track", []SubscribeOption{token("other")}, model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED},
+		{"Code of the authorizer", []SubscribeOption{token("expired")}, model.MOQT_REQUEST_ERROR_CODE_EXPIRED_AUTH_TOKEN},
+		{"Authorized", []SubscribeOption{token("video")}, model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Subscribe(ctx, track, tt.opts...)
+			var reqErr model.MOQT_REQUEST_ERROR
+			if !errors.As(err, &reqErr) || reqErr.ErrorCode != tt.want {
+				t.Errorf("Subscribe() error = %v, want code %#X", err, uint64(tt.want))
+			}
+
+			req := <-authorizer.requests
+			if req.Type != control.SUBSCRIBE || !reflect.DeepEqual(req.FullTrackName, track) || req.Conn != server.Conn {
+				t.Errorf("AuthorizeRequest() got %+v, want the SUBSCRIBE for %v", req, track)
+			}
+		})
+	}
+
+	// Setup is authorized by the tokens of CLIENT_SETUP, a rejection terminates the session with UNAUTHORIZED
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := server.AuthorizeSetup(authorizer); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_UNAUTHORIZED {
+		t.Errorf("AuthorizeSetup() without a token error = %v, want UNAUTHORIZED", err)
+	}
+	server.State.SetupAuthTokens = []control.AuthToken{{AliasType: control.AuthTokenUseValue, TokenType: 1, Value: []byte("setup")}}
+	if err := server.AuthorizeSetup(authorizer); err != nil {
+		t.Errorf("AuthorizeSetup() unexpected error: %v", err)
+	}
+}
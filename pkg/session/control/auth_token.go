@@ -0,0 +1,119 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Token, carried in the AUTHORIZATION_TOKEN parameter (Section 9.2.1.1) --- //
+
+// Token {
+//   Alias Type (i),
+//   [Token Alias (i),]
+//   [Token Type (i),]
+//   [Token Value (..)]
+// }
+
+// The same structure is used by the AUTHORIZATION_TOKEN setup parameter of CLIENT_SETUP, both parameters have the type 0x03.
+// The parameter may be repeated, a request can carry several tokens.
+
+type AuthTokenAliasType uint64
+
+const (
+	AuthTokenDelete   AuthTokenAliasType = 0x0 // Token Alias only, removes a registered token from the peer's cache
+	AuthTokenRegister AuthTokenAliasType = 0x1 // Token Alias, Token Type and Token Value, registers the token and also uses it
+	AuthTokenUseAlias AuthTokenAliasType = 0x2 // Token Alias only, uses a token registered before
+	AuthTokenUseValue AuthTokenAliasType = 0x3 // Token Type and Token Value, uses the token without registering it
+)
+
+type AuthToken struct {
+	AliasType AuthTokenAliasType
+	Alias     uint64 // Only on the wire for AuthTokenDelete, AuthTokenRegister and AuthTokenUseAlias
+	TokenType uint64 // Only on the wire for AuthTokenRegister and AuthTokenUseValue, values are registered by IANA
+	Value     []byte // Only on the wire for AuthTokenRegister and AuthTokenUseValue, opaque to MOQT
+}
+
+func (t AuthToken) Encode() []byte {
+	buf := make([]byte, 0)
+	buf = quicvarint.Append(buf, uint64(t.AliasType))
+
+	switch t.AliasType {
+	case AuthTokenDelete, AuthTokenUseAlias:
+		buf = quicvarint.Append(buf, t.Alias)
+	case AuthTokenRegister:
+		buf = quicvarint.Append(buf, t.Alias)
+		buf = quicvarint.Append(buf, t.TokenType)
+		buf = append(buf, t.Value...)
+	case AuthTokenUseValue:
+		buf = quicvarint.Append(buf, t.TokenType)
+		buf = append(buf, t.Value...)
+	}
+	return buf
+}
+
+// The Token Value takes the rest of b, so the whole parameter value must be given.
+func (t *AuthToken) Decode(b []byte) error {
+	aliasType, n, err := quicvarint.Parse(b)
+	if err != nil {
+		return malformedAuthToken("Failed to parse Alias Type")
+	}
+	b = b[n:]
+	t.AliasType = AuthTokenAliasType(aliasType)
+
+	switch t.AliasType {
+	case AuthTokenDelete, AuthTokenUseAlias, AuthTokenRegister:
+		if t.Alias, n, err = quicvarint.Parse(b); err != nil {
+			return malformedAuthToken("Failed to parse Token Alias")
+		}
+		b = b[n:]
+		if t.AliasType != AuthTokenRegister {
+			if len(b) != 0 {
+				return malformedAuthToken(fmt.Sprintf("Alias Type %#X carries no Token Value", aliasType))
+			}
+			return nil
+		}
+	case AuthTokenUseValue:
+	default:
+		return malformedAuthToken(fmt.Sprintf("Unknown Alias Type: %#X", aliasType))
+	}
+
+	if t.TokenType, n, err = quicvarint.Parse(b); err != nil {
+		return malformedAuthToken("Failed to parse Token Type")
+	}
+	t.Value = append([]byte{}, b[n:]...)
+	return nil
+}
+
+func malformedAuthToken(reason string) model.MOQT_SESSION_TERMINATION_ERROR {
+	return model.MOQT_SESSION_TERMINATION_ERROR{
+		ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_AUTH_TOKEN,
+		ReasonPhrase: model.NewReasonPhrase("Malformed AUTHORIZATION_TOKEN: " + reason),
+	}
+}
+
+// Wraps the token in an AUTHORIZATION_TOKEN parameter, valid both in requests and in CLIENT_SETUP
+func (t AuthToken) ToParam() model.MoqtKeyValuePair {
+	return model.MoqtKeyValuePair{
+		Type:       ParamAuthToken,
+		KVPairType: model.MoqtKeyValuePairValueType_Bytes,
+		ValueBytes: t.Encode(),
+	}
+}
+
+// Extracts every AUTHORIZATION_TOKEN parameter, in the order they appear.
+func AuthTokensFromParams(params []model.MoqtKeyValuePair) ([]AuthToken, error) {
+	var tokens []AuthToken
+	for _, param := range params {
+		if param.Type != ParamAuthToken {
+			continue
+		}
+		var t AuthToken
+		if err := t.Decode(param.ValueBytes); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
@@ -2,6 +2,7 @@ package control
 
 import (
 	"bufio"
+	"errors"
 	"sync"
 
 	"fmt"
@@ -51,6 +52,33 @@ type ControlMessage interface {
 	Decode(payload []byte) (int, error) // Deserializes the control message PAYLOAD from the wire, Populates the ControlMessage with payload, again header deserialization should be handled by a wrapper
 }
 
+// RequestMessage is implemented by control messages that carry a Request ID, either opening a request or responding to one.
+// The session uses it to route responses back to the request they belong to.
+type RequestMessage interface {
+	ControlMessage
+	GetRequestID() uint64
+}
+
+// IsRequest reports whether messages of this type open a new request, consuming a Request ID of the sender.
+func (t ControlMessageType) IsRequest() bool {
+	switch t {
+	case SUBSCRIBE, PUBLISH, FETCH, TRACK_STATUS, PUBLISH_NAMESPACE, SUBSCRIBE_NAMESPACE, REQUEST_UPDATE:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsResponse reports whether messages of this type answer a request previously sent by the receiving endpoint.
+func (t ControlMessageType) IsResponse() bool {
+	switch t {
+	case SUBSCRIBE_OK, PUBLISH_OK, FETCH_OK, REQUEST_OK, REQUEST_ERROR:
+		return true
+	default:
+		return false
+	}
+}
+
 // 1. Why you need bufio
 // For Reading (Critical)
 
@@ -78,6 +106,9 @@ type ControlMessage interface {
 
 //     Verdict: Highly recommended, but you must remember to call Flush().
 
+// The largest payload of a control message, its Length field is 16 bits
+const maxControlMessageLength = 1<<16 - 1
+
 type ControlMessageFactory struct {
 	r *bufio.Reader // Stream reader
 	w *bufio.Writer // Stream writer
@@ -105,6 +136,13 @@ func (cmf *ControlMessageFactory) ReadControlMessage() (ControlMessage, error) {
 		return nil, fmt.Errorf("ControlMessageFactory.ReadControlMessage():\n\t Read stream failed while reading control message length:\n\t %w", err)
 	}
 	// NOTE: Message length is a Varint in Draft-15.
+	// The draft limits it to 16 bits, larger values must not size the allocation
+	if msgLength > maxControlMessageLength {
+		return nil, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Control Message length %d exceeds %d", msgLength, maxControlMessageLength)),
+		}
+	}
 
 	// Read the payload, differently depending on the type of the control message
 	payload := make([]byte, msgLength)
@@ -121,7 +159,72 @@ func (cmf *ControlMessageFactory) ReadControlMessage() (ControlMessage, error) {
 	case uint64(SERVER_SETUP):
 		msg = &ServerSetupMessage{}
 
-	// TODO: More control messages as we go
+	case uint64(SUBSCRIBE):
+		msg = &SubscribeMessage{}
+
+	case uint64(SUBSCRIBE_OK):
+		msg = &SubscribeOkMessage{}
+
+	case uint64(REQUEST_ERROR):
+		msg = &RequestErrorMessage{}
+
+	case uint64(MAX_REQUEST_ID):
+		msg = &MaxRequestIdMessage{}
+
+	case uint64(REQUESTS_BLOCKED):
+		msg = &RequestsBlockedMessage{}
+
+	case uint64(UNSUBSCRIBE):
+		msg = &UnsubscribeMessage{}
+
+	case uint64(FETCH):
+		msg = &FetchMessage{}
+
+	case uint64(FETCH_OK):
+		msg = &FetchOkMessage{}
+
+	case uint64(FETCH_CANCEL):
+		msg = &FetchCancelMessage{}
+
+	case uint64(GOAWAY):
+		msg = &GoAwayMessage{}
+
+	case uint64(PUBLISH):
+		msg = &PublishMessage{}
+
+	case uint64(PUBLISH_OK):
+		msg = &PublishOkMessage{}
+
+	case uint64(PUBLISH_DONE):
+		msg = &PublishDoneMessage{}
+
+	case uint64(REQUEST_OK):
+		msg = &RequestOkMessage{}
+
+	case uint64(PUBLISH_NAMESPACE):
+		msg = &PublishNamespaceMessage{}
+
+	case uint64(PUBLISH_NAMESPACE_DONE):
+		msg = &PublishNamespaceDoneMessage{}
+
+	case uint64(PUBLISH_NAMESPACE_CANCEL):
+		msg = &PublishNamespaceCancelMessage{}
+
+	case uint64(SUBSCRIBE_NAMESPACE):
+		msg = &SubscribeNamespaceMessage{}
+
+	case uint64(NAMESPACE):
+		msg = &NamespaceMessage{}
+
+	case uint64(NAMESPACE_DONE):
+		msg = &NamespaceDoneMessage{}
+
+	case uint64(TRACK_STATUS):
+		msg = &TrackStatusMessage{}
+
+	case uint64(REQUEST_UPDATE):
+		msg = &RequestUpdateMessage{}
+
 	default:
 		return nil, model.MOQT_SESSION_TERMINATION_ERROR{
 			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
@@ -135,6 +238,14 @@ func (cmf *ControlMessageFactory) ReadControlMessage() (ControlMessage, error) {
 	// Cite Section 9:
 	// If the length does not match the length of the Message Payload, the receiver MUST close the session with a PROTOCOL_VIOLATION.
 	if err != nil {
+		var termErr model.MOQT_SESSION_TERMINATION_ERROR
+		if !errors.As(err, &termErr) {
+			// The whole payload is already in memory, so any other decoding failure means the message is malformed.
+			err = model.MOQT_SESSION_TERMINATION_ERROR{
+				ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Malformed Control Message of Type: %#X", msgType)),
+			}
+		}
 		return nil, fmt.Errorf("ControlMessageFactory.ReadControlMessage():\n\t Decoding control message payload failed:\n\t %w", err)
 	}
 	if decodedBytes != int(msgLength) {
@@ -158,6 +269,9 @@ func (cmf *ControlMessageFactory) WriteControlMessage(msg ControlMessage) error
 	if err != nil {
 		return fmt.Errorf("encode failed: %w", err)
 	}
+	if len(payload) > maxControlMessageLength {
+		return fmt.Errorf("encode failed: payload of %d bytes exceeds %d", len(payload), maxControlMessageLength)
+	}
 
 	// 2. Write Header (Type + Length) directly to buffer
 	// Note: quicvarint.Append is great, but we can also use quicvarint.Write
@@ -0,0 +1,422 @@
+package control
+
+import (
+	"bytes"
+	"errors"
+	"go-moq/internal"
+	"go-moq/pkg/model"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Writes each message through a ControlMessageFactory and reads it back from the same buffer.
+func TestControlMessageRoundTrip(t *testing.T) {
+	ftn := internal.Must(model.StringToMoqtFullTrackName("live/room1/video"))
+
+	tests := []struct {
+		name string
+		msg  ControlMessage
+	}{
+		{
+			name: "SUBSCRIBE with filter",
+			msg: &SubscribeMessage{
+				RequestID:     4,
+				FullTrackName: ftn,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamSubscriberPriority, uint64(10))),
+					internal.Must(model.NewMoqtKeyValuePair(ParamForward, uint64(1))),
+					SubscriptionFilter{Type: FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 3, ObjectId: 1}, EndGroup: 9}.ToParam(),
+				},
+			},
+		},
+		{
+			name: "SUBSCRIBE_OK",
+			msg: &SubscribeOkMessage{
+				RequestID:  4,
+				TrackAlias: 77,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamExpires, uint64(0))),
+				},
+			},
+		},
+		{
+			name: "REQUEST_ERROR",
+			msg: &RequestErrorMessage{
+				RequestID:    4,
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+				ReasonPhrase: model.NewReasonPhrase("no such track"),
+			},
+		},
+		{
+			name: "UNSUBSCRIBE",
+			msg:  &UnsubscribeMessage{RequestID: 4},
+		},
+		{
+			name: "MAX_REQUEST_ID",
+			msg:  &MaxRequestIdMessage{MaxRequestID: 1024},
+		},
+		{
+			name: "REQUESTS_BLOCKED",
+			msg:  &RequestsBlockedMessage{MaximumRequestID: 100},
+		},
+		{
+			name: "FETCH standalone",
+			msg: &FetchMessage{
+				RequestID:     6,
+				FetchType:     FetchTypeStandalone,
+				FullTrackName: ftn,
+				StartLocation: model.MoqtLocation{GroupId: 1, ObjectId: 0},
+				EndLocation:   model.MoqtLocation{GroupId: 5, ObjectId: 3},
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamGroupOrder, uint64(1))),
+				},
+			},
+		},
+		{
+			name: "FETCH relative joining",
+			msg: &FetchMessage{
+				RequestID:        8,
+				FetchType:        FetchTypeRelativeJoining,
+				JoiningRequestID: 4,
+				JoiningStart:     2,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamSubscriberPriority, uint64(3))),
+				},
+			},
+		},
+		{
+			name: "FETCH_OK",
+			msg: &FetchOkMessage{
+				RequestID:   6,
+				EndOfTrack:  true,
+				EndLocation: model.MoqtLocation{GroupId: 5, ObjectId: 3},
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamMaxCacheDuration, uint64(60000))),
+				},
+			},
+		},
+		{
+			name: "FETCH_CANCEL",
+			msg:  &FetchCancelMessage{RequestID: 6},
+		},
+		{
+			name: "GOAWAY with New Session URI",
+			msg:  &GoAwayMessage{NewSessionURI: "moqt://relay2.example.com:4443"},
+		},
+		{
+			name: "GOAWAY without New Session URI",
+			msg:  &GoAwayMessage{},
+		},
+		{
+			name: "PUBLISH",
+			msg: &PublishMessage{
+				RequestID:     5,
+				FullTrackName: ftn,
+				TrackAlias:    12,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamGroupOrder, uint64(1))),
+				},
+			},
+		},
+		{
+			name: "PUBLISH_OK",
+			msg: &PublishOkMessage{
+				RequestID: 5,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamForward, uint64(0))),
+				},
+			},
+		},
+		{
+			name: "PUBLISH_DONE",
+			msg: &PublishDoneMessage{
+				RequestID:    5,
+				StatusCode:   PublishDoneTrackEnded,
+				StreamCount:  42,
+				ReasonPhrase: model.NewReasonPhrase("End of broadcast"),
+			},
+		},
+		{
+			name: "REQUEST_OK",
+			msg: &RequestOkMessage{
+				RequestID: 8,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamExpires, uint64(3000))),
+				},
+			},
+		},
+		{
+			name: "PUBLISH_NAMESPACE",
+			msg:  &PublishNamespaceMessage{RequestID: 8, Namespace: ftn.Namespace, Parameters: []model.MoqtKeyValuePair{}},
+		},
+		{
+			name: "PUBLISH_NAMESPACE_DONE",
+			msg:  &PublishNamespaceDoneMessage{Namespace: ftn.Namespace},
+		},
+		{
+			name: "PUBLISH_NAMESPACE_CANCEL",
+			msg: &PublishNamespaceCancelMessage{
+				Namespace:    ftn.Namespace,
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED,
+				ReasonPhrase: model.NewReasonPhrase("Token expired"),
+			},
+		},
+		{
+			name: "SUBSCRIBE_NAMESPACE",
+			msg: &SubscribeNamespaceMessage{
+				RequestID:       8,
+				NamespacePrefix: ftn.Namespace[:1],
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamAuthToken, []byte("token"))),
+				},
+			},
+		},
+		{
+			name: "SUBSCRIBE_NAMESPACE empty prefix",
+			msg: &SubscribeNamespaceMessage{
+				RequestID:       10,
+				NamespacePrefix: model.MoqtTrackNamespace{},
+				Parameters:      []model.MoqtKeyValuePair{},
+			},
+		},
+		{
+			name: "NAMESPACE",
+			msg:  &NamespaceMessage{NamespaceSuffix: ftn.Namespace[1:]},
+		},
+		{
+			name: "NAMESPACE_DONE",
+			msg:  &NamespaceDoneMessage{NamespaceSuffix: ftn.Namespace[1:]},
+		},
+		{
+			name: "TRACK_STATUS",
+			msg: &TrackStatusMessage{
+				RequestID:     12,
+				FullTrackName: ftn,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamAuthToken, []byte("token"))),
+				},
+			},
+		},
+		{
+			name: "REQUEST_UPDATE",
+			msg: &RequestUpdateMessage{
+				RequestID:         14,
+				ExistingRequestID: 4,
+				Parameters: []model.MoqtKeyValuePair{
+					internal.Must(model.NewMoqtKeyValuePair(ParamForward, uint64(0))),
+					SubscriptionFilter{Type: FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 4}, EndGroup: 8}.ToParam(),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cmf := NewControlMessageFactory(&buf)
+
+			if err := cmf.WriteControlMessage(tt.msg); err != nil {
+				t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+			}
+			got, err := cmf.ReadControlMessage()
+			if err != nil {
+				t.Fatalf("ReadControlMessage() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("ReadControlMessage() got = %#v, want %#v", got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestSubscriptionFilterFromParams(t *testing.T) {
+	f, err := SubscriptionFilterFromParams(nil)
+	if err != nil || f != DefaultSubscriptionFilter {
+		t.Errorf("SubscriptionFilterFromParams(nil) got = (%v, %v), want (%v, nil)", f, err, DefaultSubscriptionFilter)
+	}
+
+	invalid := SubscriptionFilter{Type: FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 5}, EndGroup: 4}
+	if _, err := SubscriptionFilterFromParams([]model.MoqtKeyValuePair{invalid.ToParam()}); err == nil {
+		t.Errorf("SubscriptionFilterFromParams() expected an error for End Group < Start Group, but got none")
+	}
+}
+
+func TestLargestObjectFromParams(t *testing.T) {
+	if _, ok, err := LargestObjectFromParams(nil); ok || err != nil {
+		t.Errorf("LargestObjectFromParams(nil) got = (%v, %v), want (false, nil)", ok, err)
+	}
+
+	want := model.MoqtLocation{GroupId: 7, ObjectId: 300}
+	loc, ok, err := LargestObjectFromParams([]model.MoqtKeyValuePair{LargestObjectParam(want)})
+	if err != nil || !ok || !loc.Equal(want) {
+		t.Errorf("LargestObjectFromParams() got = (%v, %v, %v), want (%v, true, nil)", loc, ok, err, want)
+	}
+
+	trailing := LargestObjectParam(want)
+	trailing.ValueBytes = append(trailing.ValueBytes, 0x0)
+	if _, _, err := LargestObjectFromParams([]model.MoqtKeyValuePair{trailing}); err == nil {
+		t.Errorf("LargestObjectFromParams() expected an error for trailing bytes, but got none")
+	}
+}
+
+func TestFetchLastLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		end  model.MoqtLocation // On the wire
+		last model.MoqtLocation
+	}{
+		{"object", model.MoqtLocation{GroupId: 5, ObjectId: 3}, model.MoqtLocation{GroupId: 5, ObjectId: 2}},
+		{"first object", model.MoqtLocation{GroupId: 5, ObjectId: 1}, model.MoqtLocation{GroupId: 5, ObjectId: 0}},
+		{"whole group", model.MoqtLocation{GroupId: 5, ObjectId: 0}, model.MoqtLocation{GroupId: 5, ObjectId: math.MaxUint64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FetchLastLocation(tt.end); got != tt.last {
+				t.Errorf("FetchLastLocation() got = %+v, want %+v", got, tt.last)
+			}
+			if got, err := FetchEndLocation(tt.last); err != nil || got != tt.end {
+				t.Errorf("FetchEndLocation() got = %+v, %v, want %+v", got, err, tt.end)
+			}
+		})
+	}
+
+	// The End Location would overflow the varint, only math.MaxUint64 stands for the whole group
+	for _, last := range []model.MoqtLocation{
+		{GroupId: 5, ObjectId: quicvarint.Max},
+		{GroupId: 5, ObjectId: math.MaxUint64 - 1},
+		{GroupId: quicvarint.Max + 1, ObjectId: math.MaxUint64},
+	} {
+		if got, err := FetchEndLocation(last); err == nil {
+			t.Errorf("FetchEndLocation(%+v) got = %+v, want an error", last, got)
+		}
+	}
+}
+
+func TestSubscriptionFilterNarrows(t *testing.T) {
+	start := func(g, o uint64) SubscriptionFilter {
+		return SubscriptionFilter{Type: FilterAbsoluteStart, StartLocation: model.MoqtLocation{GroupId: g, ObjectId: o}}
+	}
+	ranged := func(g, o, end uint64) SubscriptionFilter {
+		return SubscriptionFilter{Type: FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: g, ObjectId: o}, EndGroup: end}
+	}
+
+	largest := &model.MoqtLocation{GroupId: 20, ObjectId: 4}
+	nextGroup := SubscriptionFilter{Type: FilterNextGroupStart}
+
+	tests := []struct {
+		name    string
+		update  SubscriptionFilter
+		current SubscriptionFilter
+		largest *model.MoqtLocation
+		want    bool
+	}{
+		{"later start", start(5, 0), start(3, 2), nil, true},
+		{"same start", start(3, 2), start(3, 2), nil, true},
+		{"earlier start", start(3, 1), start(3, 2), nil, false},
+		{"adding an end group", ranged(3, 2, 9), start(3, 2), nil, true},
+		{"lower end group", ranged(3, 2, 7), ranged(3, 2, 9), nil, true},
+		{"higher end group", ranged(3, 2, 10), ranged(3, 2, 9), nil, false},
+		{"removing the end group", start(4, 0), ranged(3, 2, 9), nil, false},
+		{"absolute after Largest Object", ranged(20, 5, 25), DefaultSubscriptionFilter, largest, true},
+		{"absolute before Largest Object", ranged(20, 4, 25), DefaultSubscriptionFilter, largest, false},
+		{"absolute on an empty track", start(0, 0), DefaultSubscriptionFilter, nil, true},
+		{"absolute at Next Group Start", start(21, 0), nextGroup, largest, true},
+		{"absolute before Next Group Start", start(20, 5), nextGroup, largest, false},
+		{"back to Largest Object", DefaultSubscriptionFilter, start(3, 2), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.update.Narrows(tt.current, tt.current.Start(tt.largest)); got != tt.want {
+				t.Errorf("Narrows() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthTokenRoundTrip(t *testing.T) {
+	tokens := []AuthToken{
+		{AliasType: AuthTokenDelete, Alias: 3},
+		{AliasType: AuthTokenRegister, Alias: 3, TokenType: 1, Value: []byte("secret")},
+		{AliasType: AuthTokenUseAlias, Alias: 3},
+		{AliasType: AuthTokenUseValue, TokenType: 1, Value: []byte("secret")},
+		{AliasType: AuthTokenUseValue, TokenType: 2, Value: []byte{}},
+	}
+
+	params := make([]model.MoqtKeyValuePair, 0, len(tokens))
+	for _, token := range tokens {
+		params = append(params, token.ToParam())
+	}
+	got, err := AuthTokensFromParams(params)
+	if err != nil {
+		t.Fatalf("AuthTokensFromParams() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, tokens) {
+		t.Errorf("AuthTokensFromParams() got = %+v, want %+v", got, tokens)
+	}
+
+	malformed := [][]byte{
+		{},               // No Alias Type
+		{0x4, 0x1},       // Unknown Alias Type
+		{0x2},            // USE_ALIAS without Token Alias
+		{0x0, 0x3, 0x61}, // DELETE with a Token Value
+		{0x1, 0x3},       // REGISTER without Token Type
+	}
+	for _, b := range malformed {
+		var token AuthToken
+		var termErr model.MOQT_SESSION_TERMINATION_ERROR
+		if err := token.Decode(b); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_MALFORMED_AUTH_TOKEN {
+			t.Errorf("Decode(%x) error = %v, want MALFORMED_AUTH_TOKEN", b, err)
+		}
+	}
+}
+
+// Counts and lengths the peer sends are checked against the bytes that are actually there before anything is allocated.
+func TestReadControlMessageOversized(t *testing.T) {
+	// SUBSCRIBE with Request ID 4 for track "l/a", followed by the Number of Parameters
+	subscribe := func(params ...byte) []byte {
+		payload := append([]byte{0x04, 0x01, 0x01, 'l', 0x01, 'a'}, params...)
+		return append([]byte{byte(SUBSCRIBE), byte(len(payload))}, payload...)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+		ok   bool
+	}{
+		{
+			name: "no parameters",
+			buf:  subscribe(0x00),
+			ok:   true,
+		},
+		{
+			name: "parameter count",
+			buf:  subscribe(0xC0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x02, 0x01),
+		},
+		{
+			name: "message length",
+			buf:  []byte{byte(SUBSCRIBE), 0xC0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmf := NewControlMessageFactory(bytes.NewBuffer(tt.buf))
+			_, err := cmf.ReadControlMessage()
+			if tt.ok {
+				if err != nil {
+					t.Errorf("ReadControlMessage() unexpected error: %v", err)
+				}
+				return
+			}
+			var termErr model.MOQT_SESSION_TERMINATION_ERROR
+			if !errors.As(err, &termErr) {
+				t.Errorf("ReadControlMessage() error = %v, want a session termination error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"math"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Fetch Message Section 9.16 -- //
+
+// FETCH Message {
+//   Type (i) = 0x16,
+//   Length (16),
+//   Request ID (i),
+//   Fetch Type (i),
+//   [Standalone (Standalone Fetch),]
+//   [Joining (Joining Fetch),]
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Standalone Fetch {
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+//   Start Location (Location),
+//   End Location (Location),
+// }
+
+// Joining Fetch {
+//   Joining Request ID (i),
+//   Joining Start (i),
+// }
+
+// Subscriber Priority and Group Order are carried as version-specific parameters in Draft-15.
+// See: ParamSubscriberPriority, ParamGroupOrder
+
+type FetchType uint64
+
+const (
+	FetchTypeStandalone      FetchType = 0x1 // Objects of the track between Start Location and End Location
+	FetchTypeRelativeJoining FetchType = 0x2 // Joining Start groups before the Largest Location of the joined subscription
+	FetchTypeAbsoluteJoining FetchType = 0x3 // From group Joining Start up to the Largest Location of the joined subscription
+)
+
+type FetchMessage struct {
+	RequestID uint64
+	FetchType FetchType
+
+	// Only on the wire for FetchTypeStandalone
+	FullTrackName model.MoqtFullTrackName
+	StartLocation model.MoqtLocation
+	EndLocation   model.MoqtLocation // The last location plus one object, an Object ID of 0 means the whole End Group. See FetchLastLocation
+
+	// Only on the wire for the joining fetch types
+	JoiningRequestID uint64 // Request ID of the subscription the fetch joins
+	JoiningStart     uint64 // Group offset for FetchTypeRelativeJoining, Group ID for FetchTypeAbsoluteJoining
+
+	Parameters []model.MoqtKeyValuePair
+}
+
+// FetchLastLocation converts the End Location of a standalone FETCH into the last location it asks for, inclusive.
+// The End Location is one object past the last one, an End Location with Object ID 0 asks for the whole End Group,
+// which is returned with the Object ID math.MaxUint64.
+func FetchLastLocation(end model.MoqtLocation) model.MoqtLocation {
+	if end.ObjectId == 0 {
+		return model.MoqtLocation{GroupId: end.GroupId, ObjectId: math.MaxUint64}
+	}
+	return model.MoqtLocation{GroupId: end.GroupId, ObjectId: end.ObjectId - 1}
+}
+
+// FetchEndLocation is the inverse of FetchLastLocation, it returns the End Location for the last location a FETCH asks for.
+// It fails if the End Location doesn't fit on the wire: the last Object ID must be below quicvarint.Max, unless it's math.MaxUint64.
+func FetchEndLocation(last model.MoqtLocation) (model.MoqtLocation, error) {
+	if last.GroupId > quicvarint.Max {
+		return model.MoqtLocation{}, fmt.Errorf("FetchEndLocation(): Group ID %d exceeds the maximum varint value", last.GroupId)
+	}
+	if last.ObjectId == math.MaxUint64 {
+		return model.MoqtLocation{GroupId: last.GroupId}, nil
+	}
+	if last.ObjectId >= quicvarint.Max {
+		return model.MoqtLocation{}, fmt.Errorf("FetchEndLocation(): Object ID %d is the last one a varint can carry, use math.MaxUint64 for the whole group", last.ObjectId)
+	}
+	return model.MoqtLocation{GroupId: last.GroupId, ObjectId: last.ObjectId + 1}, nil
+}
+
+func (fm *FetchMessage) Type() ControlMessageType {
+	return FETCH
+}
+
+func (fm *FetchMessage) GetRequestID() uint64 {
+	return fm.RequestID
+}
+
+// IsJoining reports whether the fetch refers to a subscription instead of naming a track itself.
+func (fm *FetchMessage) IsJoining() bool {
+	return fm.FetchType == FetchTypeRelativeJoining || fm.FetchType == FetchTypeAbsoluteJoining
+}
+
+func (fm *FetchMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, fm.RequestID)
+	payloadBuf = quicvarint.Append(payloadBuf, uint64(fm.FetchType))
+
+	switch fm.FetchType {
+	case FetchTypeStandalone:
+		message.EncodeMoqtFullTrackName(&payloadBuf, fm.FullTrackName)
+		message.EncodeMoqtLocation(&payloadBuf, fm.StartLocation)
+		message.EncodeMoqtLocation(&payloadBuf, fm.EndLocation)
+	case FetchTypeRelativeJoining, FetchTypeAbsoluteJoining:
+		payloadBuf = quicvarint.Append(payloadBuf, fm.JoiningRequestID)
+		payloadBuf = quicvarint.Append(payloadBuf, fm.JoiningStart)
+	default:
+		return nil, fmt.Errorf("FetchMessage.Encode(): unknown Fetch Type: %#X", uint64(fm.FetchType))
+	}
+
+	message.EncodeExtensions(&payloadBuf, fm.Parameters)
+	return payloadBuf, nil
+}
+
+func (fm *FetchMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	fetchType, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Fetch Type: %w", err)
+	}
+	payload = payload[n:]
+
+	switch FetchType(fetchType) {
+	case FetchTypeStandalone:
+		ftn, n, err := message.DecodeMoqtFullTrackName(payload)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Full Track Name: %w", err)
+		}
+		payload = payload[n:]
+
+		start, n, err := message.DecodeMoqtLocation(payload)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Start Location: %w", err)
+		}
+		payload = payload[n:]
+
+		end, n, err := message.DecodeMoqtLocation(payload)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse End Location: %w", err)
+		}
+		payload = payload[n:]
+
+		fm.FullTrackName = ftn
+		fm.StartLocation = start
+		fm.EndLocation = end
+
+	case FetchTypeRelativeJoining, FetchTypeAbsoluteJoining:
+		joiningRequestId, n, err := quicvarint.Parse(payload)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Joining Request ID: %w", err)
+		}
+		payload = payload[n:]
+
+		joiningStart, n, err := quicvarint.Parse(payload)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Joining Start: %w", err)
+		}
+		payload = payload[n:]
+
+		fm.JoiningRequestID = joiningRequestId
+		fm.JoiningStart = joiningStart
+
+	default:
+		return parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Unknown Fetch Type: %#X", fetchType)),
+		}
+	}
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	fm.RequestID = requestId
+	fm.FetchType = FetchType(fetchType)
+	fm.Parameters = params
+	return parsed, nil
+}
@@ -0,0 +1,46 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Fetch Cancel Message Section 9.18 -- //
+
+// FETCH_CANCEL Message {
+//   Type (i) = 0x17,
+//   Length (16),
+//   Request ID (i),
+// }
+
+// Sent by the subscriber to stop a fetch it is no longer interested in, the publisher resets the fetch stream if it is open.
+
+type FetchCancelMessage struct {
+	RequestID uint64 // Request ID of the FETCH being cancelled
+}
+
+func (fcm *FetchCancelMessage) Type() ControlMessageType {
+	return FETCH_CANCEL
+}
+
+func (fcm *FetchCancelMessage) GetRequestID() uint64 {
+	return fcm.RequestID
+}
+
+func (fcm *FetchCancelMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, fcm.RequestID)
+
+	return payloadBuf, nil
+}
+
+func (fcm *FetchCancelMessage) Decode(payload []byte) (int, error) {
+	requestId, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return n, fmt.Errorf("FetchCancelMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+
+	fcm.RequestID = requestId
+	return n, nil
+}
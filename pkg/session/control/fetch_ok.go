@@ -0,0 +1,94 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Fetch OK Message Section 9.17 -- //
+
+// FETCH_OK Message {
+//   Type (i) = 0x18,
+//   Length (16),
+//   Request ID (i),
+//   End Of Track (8),
+//   End Location (Location),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+type FetchOkMessage struct {
+	RequestID   uint64
+	EndOfTrack  bool               // Whether all objects up to the end of the track are covered by the fetch
+	EndLocation model.MoqtLocation // The largest location the publisher will deliver for the fetch
+	Parameters  []model.MoqtKeyValuePair
+}
+
+func (fom *FetchOkMessage) Type() ControlMessageType {
+	return FETCH_OK
+}
+
+func (fom *FetchOkMessage) GetRequestID() uint64 {
+	return fom.RequestID
+}
+
+func (fom *FetchOkMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, fom.RequestID)
+	if fom.EndOfTrack {
+		payloadBuf = append(payloadBuf, 1)
+	} else {
+		payloadBuf = append(payloadBuf, 0)
+	}
+	message.EncodeMoqtLocation(&payloadBuf, fom.EndLocation)
+	message.EncodeExtensions(&payloadBuf, fom.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (fom *FetchOkMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchOkMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	if len(payload) < 1 {
+		return parsed, fmt.Errorf("FetchOkMessage.Decode(): failed to parse End Of Track: buffer too short")
+	}
+	endOfTrack := payload[0]
+	parsed += 1
+	payload = payload[1:]
+
+	// End Of Track is a boolean, anything other than 0 or 1 is a PROTOCOL_VIOLATION
+	if endOfTrack > 1 {
+		return parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Invalid End Of Track value in FETCH_OK: %d", endOfTrack)),
+		}
+	}
+
+	endLocation, n, err := message.DecodeMoqtLocation(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchOkMessage.Decode(): failed to parse End Location: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("FetchOkMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	fom.RequestID = requestId
+	fom.EndOfTrack = endOfTrack == 1
+	fom.EndLocation = endLocation
+	fom.Parameters = params
+	return parsed, nil
+}
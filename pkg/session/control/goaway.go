@@ -0,0 +1,65 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Goaway Message Section 9.4 -- //
+
+// GOAWAY Message {
+//   Type (i) = 0x10,
+//   Length (16),
+//   New Session URI Length (i),
+//   New Session URI (..),
+// }
+
+// Sent by an endpoint to initiate the graceful shutdown of a session.
+// New Session URI is where the client can establish a new session, only the server may include it.
+// If it is empty, the client reconnects to the current URI.
+
+// The maximum length of the New Session URI, a longer one is a PROTOCOL_VIOLATION.
+const GoAwayMaxURILength = 8192
+
+type GoAwayMessage struct {
+	NewSessionURI string
+}
+
+func (gam *GoAwayMessage) Type() ControlMessageType {
+	return GOAWAY
+}
+
+func (gam *GoAwayMessage) Encode() ([]byte, error) {
+	if len(gam.NewSessionURI) > GoAwayMaxURILength {
+		return nil, fmt.Errorf("GoAwayMessage.Encode(): New Session URI must not exceed %d bytes", GoAwayMaxURILength)
+	}
+
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, uint64(len(gam.NewSessionURI)))
+	payloadBuf = append(payloadBuf, gam.NewSessionURI...)
+
+	return payloadBuf, nil
+}
+
+func (gam *GoAwayMessage) Decode(payload []byte) (int, error) {
+	uriLength, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return n, fmt.Errorf("GoAwayMessage.Decode(): failed to parse New Session URI Length: %w", err)
+	}
+	payload = payload[n:]
+
+	if uriLength > GoAwayMaxURILength {
+		return n, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("GOAWAY New Session URI exceeds %d bytes", GoAwayMaxURILength)),
+		}
+	}
+	if uint64(len(payload)) < uriLength {
+		return n, fmt.Errorf("GoAwayMessage.Decode(): failed to parse New Session URI: payload is too short")
+	}
+
+	gam.NewSessionURI = string(payload[:uriLength])
+	return n + int(uriLength), nil
+}
@@ -0,0 +1,43 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Max Request ID Message Section 9.5 -- //
+
+// MAX_REQUEST_ID Message {
+//   Type (i) = 0x15,
+//   Length (16),
+//   Max Request ID (i),
+// }
+
+// Max Request ID is exclusive, the receiver may send requests with IDs strictly smaller than it.
+// It MUST only ever increase, receiving a smaller or equal value is a PROTOCOL_VIOLATION.
+
+type MaxRequestIdMessage struct {
+	MaxRequestID uint64
+}
+
+func (mrm *MaxRequestIdMessage) Type() ControlMessageType {
+	return MAX_REQUEST_ID
+}
+
+func (mrm *MaxRequestIdMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, mrm.MaxRequestID)
+
+	return payloadBuf, nil
+}
+
+func (mrm *MaxRequestIdMessage) Decode(payload []byte) (int, error) {
+	maxRequestId, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return n, fmt.Errorf("MaxRequestIdMessage.Decode(): failed to parse Max Request ID: %w", err)
+	}
+
+	mrm.MaxRequestID = maxRequestId
+	return n, nil
+}
@@ -0,0 +1,43 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+)
+
+// --- Namespace Message Section 9.26 -- //
+
+// NAMESPACE Message {
+//   Type (i) = 0x8,
+//   Length (16),
+//   Track Namespace Suffix (tuple),
+// }
+
+// Sent on the stream of a SUBSCRIBE_NAMESPACE when a namespace matching the prefix becomes available.
+// Only the fields following the prefix are carried, the full namespace is the prefix followed by the suffix.
+
+type NamespaceMessage struct {
+	NamespaceSuffix model.MoqtTrackNamespace
+}
+
+func (nm *NamespaceMessage) Type() ControlMessageType {
+	return NAMESPACE
+}
+
+func (nm *NamespaceMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, nm.NamespaceSuffix)
+
+	return payloadBuf, nil
+}
+
+func (nm *NamespaceMessage) Decode(payload []byte) (int, error) {
+	suffix, n, err := message.DecodeMoqtTrackNamespace(payload)
+	if err != nil {
+		return n, fmt.Errorf("NamespaceMessage.Decode(): failed to parse Track Namespace Suffix: %w", err)
+	}
+
+	nm.NamespaceSuffix = suffix
+	return n, nil
+}
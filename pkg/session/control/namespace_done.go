@@ -0,0 +1,42 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+)
+
+// --- Namespace Done Message Section 9.27 -- //
+
+// NAMESPACE_DONE Message {
+//   Type (i) = 0xE,
+//   Length (16),
+//   Track Namespace Suffix (tuple),
+// }
+
+// Sent on the stream of a SUBSCRIBE_NAMESPACE when a namespace previously sent with NAMESPACE is no longer available.
+
+type NamespaceDoneMessage struct {
+	NamespaceSuffix model.MoqtTrackNamespace
+}
+
+func (ndm *NamespaceDoneMessage) Type() ControlMessageType {
+	return NAMESPACE_DONE
+}
+
+func (ndm *NamespaceDoneMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, ndm.NamespaceSuffix)
+
+	return payloadBuf, nil
+}
+
+func (ndm *NamespaceDoneMessage) Decode(payload []byte) (int, error) {
+	suffix, n, err := message.DecodeMoqtTrackNamespace(payload)
+	if err != nil {
+		return n, fmt.Errorf("NamespaceDoneMessage.Decode(): failed to parse Track Namespace Suffix: %w", err)
+	}
+
+	ndm.NamespaceSuffix = suffix
+	return n, nil
+}
@@ -1,5 +1,10 @@
 package control
 
+import (
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+)
+
 // Note, [Cite: Section 9.3]: To ensure future extensibility of MOQT, endpoints MUST ignore unknown setup parameters.
 
 // Setup Parameter IDs (Section 9.3.1)
@@ -29,3 +34,42 @@ const (
 	ParamDynamicGroups      = 0x30 // [cite: 896]
 	ParamNewGroupRequest    = 0x32 // [cite: 900]
 )
+
+// FindParam returns the first parameter of the given type, the second return value reports whether it was found.
+// Parameters of unknown types are simply never looked up, which satisfies the rule of ignoring them.
+func FindParam(params []model.MoqtKeyValuePair, typ uint64) (model.MoqtKeyValuePair, bool) {
+	for _, param := range params {
+		if param.Type == typ {
+			return param, true
+		}
+	}
+	return model.MoqtKeyValuePair{}, false
+}
+
+// Wraps the location in a LARGEST_OBJECT parameter
+func LargestObjectParam(loc model.MoqtLocation) model.MoqtKeyValuePair {
+	buf := make([]byte, 0)
+	message.EncodeMoqtLocation(&buf, loc)
+	return model.MoqtKeyValuePair{
+		Type:       ParamLargestObject,
+		KVPairType: model.MoqtKeyValuePairValueType_Bytes,
+		ValueBytes: buf,
+	}
+}
+
+// Extracts the LARGEST_OBJECT parameter, the second return value reports whether it was found.
+func LargestObjectFromParams(params []model.MoqtKeyValuePair) (model.MoqtLocation, bool, error) {
+	param, ok := FindParam(params, ParamLargestObject)
+	if !ok {
+		return model.MoqtLocation{}, false, nil
+	}
+
+	loc, n, err := message.DecodeMoqtLocation(param.ValueBytes)
+	if err != nil || n != len(param.ValueBytes) {
+		return model.MoqtLocation{}, false, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("Malformed LARGEST_OBJECT parameter"),
+		}
+	}
+	return loc, true, nil
+}
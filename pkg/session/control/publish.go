@@ -0,0 +1,89 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Publish Message Section 9.13 -- //
+
+// PUBLISH Message {
+//   Type (i) = 0x1D,
+//   Length (16),
+//   Request ID (i),
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+//   Track Alias (i),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Sent by a publisher to push a track to the peer without waiting for SUBSCRIBE.
+// The Track Alias is assigned by the publisher, just like in SUBSCRIBE_OK. Group Order, Largest Object and Forward
+// are carried as version-specific parameters in Draft-15.
+// See: ParamGroupOrder, ParamLargestObject, ParamForward
+
+type PublishMessage struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	TrackAlias    uint64
+	Parameters    []model.MoqtKeyValuePair
+}
+
+func (pm *PublishMessage) Type() ControlMessageType {
+	return PUBLISH
+}
+
+func (pm *PublishMessage) GetRequestID() uint64 {
+	return pm.RequestID
+}
+
+func (pm *PublishMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, pm.RequestID)
+	message.EncodeMoqtFullTrackName(&payloadBuf, pm.FullTrackName)
+	payloadBuf = quicvarint.Append(payloadBuf, pm.TrackAlias)
+	message.EncodeExtensions(&payloadBuf, pm.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (pm *PublishMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	ftn, n, err := message.DecodeMoqtFullTrackName(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishMessage.Decode(): failed to parse Full Track Name: %w", err)
+	}
+	payload = payload[n:]
+
+	trackAlias, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishMessage.Decode(): failed to parse Track Alias: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	pm.RequestID = requestId
+	pm.FullTrackName = ftn
+	pm.TrackAlias = trackAlias
+	pm.Parameters = params
+	return parsed, nil
+}
@@ -0,0 +1,108 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Publish Done Message Section 9.12 -- //
+
+// PUBLISH_DONE Message {
+//   Type (i) = 0xB,
+//   Length (16),
+//   Request ID (i),
+//   Status Code (i),
+//   Stream Count (i),
+//   Error Reason (Reason Phrase)
+// }
+
+// Sent by the publisher to end a subscription, whether it was started by SUBSCRIBE or PUBLISH.
+// Stream Count is the number of data streams the publisher opened for the subscription, so the subscriber
+// knows when all of them were received.
+
+type PublishDoneStatusCode = model.MOQT_PUBLISH_DONE_STATUS_CODE
+
+// Status codes of PUBLISH_DONE (Section 13.4.3), see model.MOQT_PUBLISH_DONE_STATUS_CODE
+const (
+	PublishDoneInternalError     = model.MOQT_PUBLISH_DONE_STATUS_CODE_INTERNAL_ERROR
+	PublishDoneUnauthorized      = model.MOQT_PUBLISH_DONE_STATUS_CODE_UNAUTHORIZED
+	PublishDoneTrackEnded        = model.MOQT_PUBLISH_DONE_STATUS_CODE_TRACK_ENDED
+	PublishDoneSubscriptionEnded = model.MOQT_PUBLISH_DONE_STATUS_CODE_SUBSCRIPTION_ENDED
+	PublishDoneGoingAway         = model.MOQT_PUBLISH_DONE_STATUS_CODE_GOING_AWAY
+	PublishDoneExpired           = model.MOQT_PUBLISH_DONE_STATUS_CODE_EXPIRED
+	PublishDoneTooFarBehind      = model.MOQT_PUBLISH_DONE_STATUS_CODE_TOO_FAR_BEHIND
+	PublishDoneMalformedTrack    = model.MOQT_PUBLISH_DONE_STATUS_CODE_MALFORMED_TRACK
+)
+
+type PublishDoneMessage struct {
+	RequestID    uint64
+	StatusCode   PublishDoneStatusCode
+	StreamCount  uint64
+	ReasonPhrase model.MoqtReasonPhrase
+}
+
+func (pdm *PublishDoneMessage) Type() ControlMessageType {
+	return PUBLISH_DONE
+}
+
+func (pdm *PublishDoneMessage) GetRequestID() uint64 {
+	return pdm.RequestID
+}
+
+func (pdm *PublishDoneMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, pdm.RequestID)
+	payloadBuf = quicvarint.Append(payloadBuf, uint64(pdm.StatusCode))
+	payloadBuf = quicvarint.Append(payloadBuf, pdm.StreamCount)
+	message.EncodeMoqtReasonPhrase(&payloadBuf, pdm.ReasonPhrase)
+
+	return payloadBuf, nil
+}
+
+func (pdm *PublishDoneMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishDoneMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	statusCode, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishDoneMessage.Decode(): failed to parse Status Code: %w", err)
+	}
+	payload = payload[n:]
+
+	streamCount, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishDoneMessage.Decode(): failed to parse Stream Count: %w", err)
+	}
+	payload = payload[n:]
+
+	reason, n, err := message.DecodeMoqtReasonPhrase(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishDoneMessage.Decode(): failed to parse Error Reason: %w", err)
+	}
+
+	pdm.RequestID = requestId
+	pdm.StatusCode = PublishDoneStatusCode(statusCode)
+	pdm.StreamCount = streamCount
+	pdm.ReasonPhrase = reason
+	return parsed, nil
+}
+
+// Converts the message into a go error that can be returned to the application, see model.MOQT_PUBLISH_DONE_STATUS_CODE.IsNormal
+func (pdm *PublishDoneMessage) ToError() model.MOQT_PUBLISH_DONE_ERROR {
+	return model.MOQT_PUBLISH_DONE_ERROR{
+		RequestID:    pdm.RequestID,
+		StatusCode:   pdm.StatusCode,
+		ReasonPhrase: pdm.ReasonPhrase,
+	}
+}
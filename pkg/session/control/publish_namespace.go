@@ -0,0 +1,73 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Publish Namespace Message Section 9.20 -- //
+
+// PUBLISH_NAMESPACE Message {
+//   Type (i) = 0x6,
+//   Length (16),
+//   Request ID (i),
+//   Track Namespace (tuple),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Advertises that the sender can serve tracks of the namespace, answered with REQUEST_OK or REQUEST_ERROR.
+
+type PublishNamespaceMessage struct {
+	RequestID  uint64
+	Namespace  model.MoqtTrackNamespace
+	Parameters []model.MoqtKeyValuePair
+}
+
+func (pnm *PublishNamespaceMessage) Type() ControlMessageType {
+	return PUBLISH_NAMESPACE
+}
+
+func (pnm *PublishNamespaceMessage) GetRequestID() uint64 {
+	return pnm.RequestID
+}
+
+func (pnm *PublishNamespaceMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, pnm.RequestID)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, pnm.Namespace)
+	message.EncodeExtensions(&payloadBuf, pnm.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (pnm *PublishNamespaceMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	ns, n, err := message.DecodeMoqtTrackNamespace(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceMessage.Decode(): failed to parse Track Namespace: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	pnm.RequestID = requestId
+	pnm.Namespace = ns
+	pnm.Parameters = params
+	return parsed, nil
+}
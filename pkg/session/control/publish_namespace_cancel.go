@@ -0,0 +1,68 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Publish Namespace Cancel Message Section 9.22 -- //
+
+// PUBLISH_NAMESPACE_CANCEL Message {
+//   Type (i) = 0xC,
+//   Length (16),
+//   Track Namespace (tuple),
+//   Error Code (i),
+//   Error Reason (Reason Phrase),
+// }
+
+// Sent by the receiver of a PUBLISH_NAMESPACE to withdraw its acceptance, the Error Code is from the REQUEST_ERROR code space.
+
+type PublishNamespaceCancelMessage struct {
+	Namespace    model.MoqtTrackNamespace
+	ErrorCode    model.MOQT_REQUEST_ERROR_CODE
+	ReasonPhrase model.MoqtReasonPhrase
+}
+
+func (pncm *PublishNamespaceCancelMessage) Type() ControlMessageType {
+	return PUBLISH_NAMESPACE_CANCEL
+}
+
+func (pncm *PublishNamespaceCancelMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, pncm.Namespace)
+	payloadBuf = quicvarint.Append(payloadBuf, uint64(pncm.ErrorCode))
+	message.EncodeMoqtReasonPhrase(&payloadBuf, pncm.ReasonPhrase)
+
+	return payloadBuf, nil
+}
+
+func (pncm *PublishNamespaceCancelMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	ns, n, err := message.DecodeMoqtTrackNamespace(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceCancelMessage.Decode(): failed to parse Track Namespace: %w", err)
+	}
+	payload = payload[n:]
+
+	errorCode, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceCancelMessage.Decode(): failed to parse Error Code: %w", err)
+	}
+	payload = payload[n:]
+
+	reason, n, err := message.DecodeMoqtReasonPhrase(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishNamespaceCancelMessage.Decode(): failed to parse Error Reason: %w", err)
+	}
+
+	pncm.Namespace = ns
+	pncm.ErrorCode = model.MOQT_REQUEST_ERROR_CODE(errorCode)
+	pncm.ReasonPhrase = reason
+	return parsed, nil
+}
@@ -0,0 +1,42 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+)
+
+// --- Publish Namespace Done Message Section 9.21 -- //
+
+// PUBLISH_NAMESPACE_DONE Message {
+//   Type (i) = 0x9,
+//   Length (16),
+//   Track Namespace (tuple),
+// }
+
+// Sent by the publisher of a namespace to withdraw a PUBLISH_NAMESPACE the peer accepted.
+
+type PublishNamespaceDoneMessage struct {
+	Namespace model.MoqtTrackNamespace
+}
+
+func (pndm *PublishNamespaceDoneMessage) Type() ControlMessageType {
+	return PUBLISH_NAMESPACE_DONE
+}
+
+func (pndm *PublishNamespaceDoneMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, pndm.Namespace)
+
+	return payloadBuf, nil
+}
+
+func (pndm *PublishNamespaceDoneMessage) Decode(payload []byte) (int, error) {
+	ns, n, err := message.DecodeMoqtTrackNamespace(payload)
+	if err != nil {
+		return n, fmt.Errorf("PublishNamespaceDoneMessage.Decode(): failed to parse Track Namespace: %w", err)
+	}
+
+	pndm.Namespace = ns
+	return n, nil
+}
@@ -0,0 +1,69 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Publish OK Message Section 9.14 -- //
+
+// PUBLISH_OK Message {
+//   Type (i) = 0x1E,
+//   Length (16),
+//   Request ID (i),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Accepts a PUBLISH, the subscriber's Forward, Subscriber Priority, Group Order and Subscription Filter
+// are carried as version-specific parameters, exactly like in SUBSCRIBE.
+// See: ParamForward, ParamSubscriberPriority, ParamGroupOrder, ParamSubscriptionFilter
+
+type PublishOkMessage struct {
+	RequestID  uint64
+	Parameters []model.MoqtKeyValuePair
+}
+
+func (pom *PublishOkMessage) Type() ControlMessageType {
+	return PUBLISH_OK
+}
+
+func (pom *PublishOkMessage) GetRequestID() uint64 {
+	return pom.RequestID
+}
+
+func (pom *PublishOkMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, pom.RequestID)
+	message.EncodeExtensions(&payloadBuf, pom.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (pom *PublishOkMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishOkMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("PublishOkMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	pom.RequestID = requestId
+	pom.Parameters = params
+	return parsed, nil
+}
+
+// Returns the subscription filter requested by the subscriber.
+func (pom *PublishOkMessage) Filter() (SubscriptionFilter, error) {
+	return SubscriptionFilterFromParams(pom.Parameters)
+}
@@ -0,0 +1,81 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Request Error Message Section 9.6 -- //
+
+// REQUEST_ERROR Message {
+//   Type (i) = 0x5,
+//   Length (16),
+//   Request ID (i),
+//   Error Code (i),
+//   Error Reason (Reason Phrase),
+// }
+
+// REQUEST_ERROR is the common failure response to SUBSCRIBE, FETCH, PUBLISH, PUBLISH_NAMESPACE, TRACK_STATUS etc.
+
+type RequestErrorMessage struct {
+	RequestID    uint64
+	ErrorCode    model.MOQT_REQUEST_ERROR_CODE
+	ReasonPhrase model.MoqtReasonPhrase
+}
+
+func (rem *RequestErrorMessage) Type() ControlMessageType {
+	return REQUEST_ERROR
+}
+
+func (rem *RequestErrorMessage) GetRequestID() uint64 {
+	return rem.RequestID
+}
+
+func (rem *RequestErrorMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, rem.RequestID)
+	payloadBuf = quicvarint.Append(payloadBuf, uint64(rem.ErrorCode))
+	message.EncodeMoqtReasonPhrase(&payloadBuf, rem.ReasonPhrase)
+
+	return payloadBuf, nil
+}
+
+func (rem *RequestErrorMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestErrorMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	errorCode, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestErrorMessage.Decode(): failed to parse Error Code: %w", err)
+	}
+	payload = payload[n:]
+
+	reason, n, err := message.DecodeMoqtReasonPhrase(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestErrorMessage.Decode(): failed to parse Error Reason: %w", err)
+	}
+
+	rem.RequestID = requestId
+	rem.ErrorCode = model.MOQT_REQUEST_ERROR_CODE(errorCode)
+	rem.ReasonPhrase = reason
+	return parsed, nil
+}
+
+// Converts the message into a go error that can be returned to the application
+func (rem *RequestErrorMessage) ToError() model.MOQT_REQUEST_ERROR {
+	return model.MOQT_REQUEST_ERROR{
+		RequestID:    rem.RequestID,
+		ErrorCode:    rem.ErrorCode,
+		ReasonPhrase: rem.ReasonPhrase,
+	}
+}
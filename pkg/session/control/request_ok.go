@@ -0,0 +1,62 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Request OK Message, the counterpart of REQUEST_ERROR (Section 9.6) -- //
+
+// REQUEST_OK Message {
+//   Type (i) = 0x7,
+//   Length (16),
+//   Request ID (i),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// REQUEST_OK is the common success response to requests that don't have a dedicated one, e.g. PUBLISH_NAMESPACE and TRACK_STATUS.
+
+type RequestOkMessage struct {
+	RequestID  uint64
+	Parameters []model.MoqtKeyValuePair
+}
+
+func (rom *RequestOkMessage) Type() ControlMessageType {
+	return REQUEST_OK
+}
+
+func (rom *RequestOkMessage) GetRequestID() uint64 {
+	return rom.RequestID
+}
+
+func (rom *RequestOkMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, rom.RequestID)
+	message.EncodeExtensions(&payloadBuf, rom.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (rom *RequestOkMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestOkMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestOkMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	rom.RequestID = requestId
+	rom.Parameters = params
+	return parsed, nil
+}
@@ -0,0 +1,76 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Request Update Message Section 9.10 -- //
+
+// REQUEST_UPDATE Message {
+//   Type (i) = 0x2,
+//   Length (16),
+//   Request ID (i),
+//   Existing Request ID (i),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Modifies a subscription that is in progress, the one started by the SUBSCRIBE or PUBLISH with Existing Request ID.
+// It is a request of its own, answered with REQUEST_OK or REQUEST_ERROR. Only the parameters present are changed.
+// An update may only narrow the subscription, the start location can't decrease and the end group can't increase.
+// See: ParamSubscriberPriority, ParamForward, ParamSubscriptionFilter
+
+type RequestUpdateMessage struct {
+	RequestID         uint64
+	ExistingRequestID uint64
+	Parameters        []model.MoqtKeyValuePair
+}
+
+func (rum *RequestUpdateMessage) Type() ControlMessageType {
+	return REQUEST_UPDATE
+}
+
+func (rum *RequestUpdateMessage) GetRequestID() uint64 {
+	return rum.RequestID
+}
+
+func (rum *RequestUpdateMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, rum.RequestID)
+	payloadBuf = quicvarint.Append(payloadBuf, rum.ExistingRequestID)
+	message.EncodeExtensions(&payloadBuf, rum.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (rum *RequestUpdateMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestUpdateMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	existingRequestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestUpdateMessage.Decode(): failed to parse Existing Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("RequestUpdateMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	rum.RequestID = requestId
+	rum.ExistingRequestID = existingRequestId
+	rum.Parameters = params
+	return parsed, nil
+}
@@ -0,0 +1,43 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Requests Blocked Message Section 9.23 -- //
+
+// REQUESTS_BLOCKED Message {
+//   Type (i) = 0x1A,
+//   Length (16),
+//   Maximum Request ID (i),
+// }
+
+// Sent when an endpoint would like to send a new request, but cannot because the peer's Maximum Request ID is reached.
+// Maximum Request ID is the limit that blocked the sender.
+
+type RequestsBlockedMessage struct {
+	MaximumRequestID uint64
+}
+
+func (rbm *RequestsBlockedMessage) Type() ControlMessageType {
+	return REQUESTS_BLOCKED
+}
+
+func (rbm *RequestsBlockedMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, rbm.MaximumRequestID)
+
+	return payloadBuf, nil
+}
+
+func (rbm *RequestsBlockedMessage) Decode(payload []byte) (int, error) {
+	maximumRequestId, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return n, fmt.Errorf("RequestsBlockedMessage.Decode(): failed to parse Maximum Request ID: %w", err)
+	}
+
+	rbm.MaximumRequestID = maximumRequestId
+	return n, nil
+}
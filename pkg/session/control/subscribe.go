@@ -0,0 +1,81 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Subscribe Message Section 9.7 -- //
+
+// SUBSCRIBE Message {
+//   Type (i) = 0x3,
+//   Length (16),
+//   Request ID (i),
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Subscriber Priority, Group Order, Forward and the Subscription Filter are all carried as version-specific parameters in Draft-15.
+// See: ParamSubscriberPriority, ParamGroupOrder, ParamForward, ParamSubscriptionFilter
+
+type SubscribeMessage struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	Parameters    []model.MoqtKeyValuePair
+}
+
+func (sm *SubscribeMessage) Type() ControlMessageType {
+	return SUBSCRIBE
+}
+
+func (sm *SubscribeMessage) GetRequestID() uint64 {
+	return sm.RequestID
+}
+
+func (sm *SubscribeMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, sm.RequestID)
+	message.EncodeMoqtFullTrackName(&payloadBuf, sm.FullTrackName)
+	message.EncodeExtensions(&payloadBuf, sm.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (sm *SubscribeMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	ftn, n, err := message.DecodeMoqtFullTrackName(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeMessage.Decode(): failed to parse Full Track Name: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	sm.RequestID = requestId
+	sm.FullTrackName = ftn
+	sm.Parameters = params
+	return parsed, nil
+}
+
+// Returns the subscription filter requested by the subscriber.
+func (sm *SubscribeMessage) Filter() (SubscriptionFilter, error) {
+	return SubscriptionFilterFromParams(sm.Parameters)
+}
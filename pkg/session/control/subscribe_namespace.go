@@ -0,0 +1,75 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Subscribe Namespace Message Section 9.25 -- //
+
+// SUBSCRIBE_NAMESPACE Message {
+//   Type (i) = 0x11,
+//   Length (16),
+//   Request ID (i),
+//   Track Namespace Prefix (tuple),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Opens its own bidirectional stream, the publisher answers on the same stream with REQUEST_OK or REQUEST_ERROR,
+// followed by NAMESPACE and NAMESPACE_DONE for every namespace matching the prefix. Closing the stream ends the subscription.
+// The prefix may consist of 0 fields, matching every namespace.
+
+type SubscribeNamespaceMessage struct {
+	RequestID       uint64
+	NamespacePrefix model.MoqtTrackNamespace
+	Parameters      []model.MoqtKeyValuePair
+}
+
+func (snm *SubscribeNamespaceMessage) Type() ControlMessageType {
+	return SUBSCRIBE_NAMESPACE
+}
+
+func (snm *SubscribeNamespaceMessage) GetRequestID() uint64 {
+	return snm.RequestID
+}
+
+func (snm *SubscribeNamespaceMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, snm.RequestID)
+	message.EncodeMoqtTrackNamespace(&payloadBuf, snm.NamespacePrefix)
+	message.EncodeExtensions(&payloadBuf, snm.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (snm *SubscribeNamespaceMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeNamespaceMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	prefix, n, err := message.DecodeMoqtTrackNamespace(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeNamespaceMessage.Decode(): failed to parse Track Namespace Prefix: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeNamespaceMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	snm.RequestID = requestId
+	snm.NamespacePrefix = prefix
+	snm.Parameters = params
+	return parsed, nil
+}
@@ -0,0 +1,74 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Subscribe OK Message Section 9.8 -- //
+
+// SUBSCRIBE_OK Message {
+//   Type (i) = 0x4,
+//   Length (16),
+//   Request ID (i),
+//   Track Alias (i),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Expires, Group Order and Largest Object are carried as version-specific parameters in Draft-15.
+// See: ParamExpires, ParamGroupOrder, ParamLargestObject
+
+type SubscribeOkMessage struct {
+	RequestID  uint64
+	TrackAlias uint64 // The alias the publisher will use on data streams and datagrams of this subscription
+	Parameters []model.MoqtKeyValuePair
+}
+
+func (som *SubscribeOkMessage) Type() ControlMessageType {
+	return SUBSCRIBE_OK
+}
+
+func (som *SubscribeOkMessage) GetRequestID() uint64 {
+	return som.RequestID
+}
+
+func (som *SubscribeOkMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, som.RequestID)
+	payloadBuf = quicvarint.Append(payloadBuf, som.TrackAlias)
+	message.EncodeExtensions(&payloadBuf, som.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (som *SubscribeOkMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeOkMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	trackAlias, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeOkMessage.Decode(): failed to parse Track Alias: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscribeOkMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	som.RequestID = requestId
+	som.TrackAlias = trackAlias
+	som.Parameters = params
+	return parsed, nil
+}
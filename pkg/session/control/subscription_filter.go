@@ -0,0 +1,166 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Subscription Filter, carried in the SUBSCRIPTION_FILTER parameter (Section 9.2.1) --- //
+
+// Subscription Filter {
+//   Filter Type (i),
+//   [Start Location (Location),]
+//   [End Group (i),]
+// }
+
+type SubscriptionFilterType uint64
+
+const (
+	FilterNextGroupStart SubscriptionFilterType = 0x1 // Start at the beginning of the next group, no end
+	FilterLargestObject  SubscriptionFilterType = 0x2 // Start after the largest object published so far, no end
+	FilterAbsoluteStart  SubscriptionFilterType = 0x3 // Start at StartLocation, no end
+	FilterAbsoluteRange  SubscriptionFilterType = 0x4 // Start at StartLocation, end at the end of EndGroup (inclusive)
+)
+
+type SubscriptionFilter struct {
+	Type          SubscriptionFilterType
+	StartLocation model.MoqtLocation // Only on the wire for FilterAbsoluteStart and FilterAbsoluteRange
+	EndGroup      uint64             // Only on the wire for FilterAbsoluteRange
+}
+
+// When the SUBSCRIPTION_FILTER parameter is omitted, the subscription behaves as a Largest Object filter.
+var DefaultSubscriptionFilter = SubscriptionFilter{Type: FilterLargestObject}
+
+func (f SubscriptionFilter) Encode() []byte {
+	buf := make([]byte, 0)
+	buf = quicvarint.Append(buf, uint64(f.Type))
+
+	switch f.Type {
+	case FilterAbsoluteStart:
+		message.EncodeMoqtLocation(&buf, f.StartLocation)
+	case FilterAbsoluteRange:
+		message.EncodeMoqtLocation(&buf, f.StartLocation)
+		buf = quicvarint.Append(buf, f.EndGroup)
+	}
+	return buf
+}
+
+func (f *SubscriptionFilter) Decode(b []byte) (int, error) {
+	parsed := 0
+	typ, n, err := quicvarint.Parse(b)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("SubscriptionFilter.Decode(): failed to parse Filter Type: %w", err)
+	}
+	b = b[n:]
+	f.Type = SubscriptionFilterType(typ)
+
+	switch f.Type {
+	case FilterNextGroupStart, FilterLargestObject:
+		return parsed, nil
+
+	case FilterAbsoluteStart, FilterAbsoluteRange:
+		loc, n, err := message.DecodeMoqtLocation(b)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("SubscriptionFilter.Decode(): failed to parse Start Location: %w", err)
+		}
+		b = b[n:]
+		f.StartLocation = loc
+
+		if f.Type == FilterAbsoluteStart {
+			return parsed, nil
+		}
+
+		endGroup, n, err := quicvarint.Parse(b)
+		parsed += n
+		if err != nil {
+			return parsed, fmt.Errorf("SubscriptionFilter.Decode(): failed to parse End Group: %w", err)
+		}
+		f.EndGroup = endGroup
+
+		// The End Group MUST specify the same or a later group than the Start Location.
+		if f.EndGroup < f.StartLocation.GroupId {
+			return parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+				ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+				ReasonPhrase: model.NewReasonPhrase("Subscription filter End Group is smaller than the Start Location's group"),
+			}
+		}
+		return parsed, nil
+
+	default:
+		return parsed, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Unknown subscription filter type: %#X", typ)),
+		}
+	}
+}
+
+// Wraps the filter in a SUBSCRIPTION_FILTER parameter
+func (f SubscriptionFilter) ToParam() model.MoqtKeyValuePair {
+	return model.MoqtKeyValuePair{
+		Type:       ParamSubscriptionFilter,
+		KVPairType: model.MoqtKeyValuePairValueType_Bytes,
+		ValueBytes: f.Encode(),
+	}
+}
+
+// Extracts the subscription filter from the given parameters, DefaultSubscriptionFilter is returned if the parameter is absent.
+func SubscriptionFilterFromParams(params []model.MoqtKeyValuePair) (SubscriptionFilter, error) {
+	param, ok := FindParam(params, ParamSubscriptionFilter)
+	if !ok {
+		return DefaultSubscriptionFilter, nil
+	}
+
+	var f SubscriptionFilter
+	n, err := f.Decode(param.ValueBytes)
+	if err != nil {
+		return SubscriptionFilter{}, err
+	}
+	if n != len(param.ValueBytes) {
+		return SubscriptionFilter{}, model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("SUBSCRIPTION_FILTER parameter length mismatch"),
+		}
+	}
+	return f, nil
+}
+
+// Absolute reports whether the filter carries its Start Location, rather than starting where the publisher currently is.
+func (f SubscriptionFilter) Absolute() bool {
+	return f.Type == FilterAbsoluteStart || f.Type == FilterAbsoluteRange
+}
+
+// Start returns the location a subscription with the filter begins at. largest is the LARGEST_OBJECT the publisher
+// accepted the subscription with, nil if the track had no objects yet. It only matters for the Largest Object and Next Group Start filters.
+func (f SubscriptionFilter) Start(largest *model.MoqtLocation) model.MoqtLocation {
+	switch {
+	case f.Absolute():
+		return f.StartLocation
+	case largest == nil:
+		return model.MoqtLocation{}
+	case f.Type == FilterNextGroupStart:
+		return model.MoqtLocation{GroupId: largest.GroupId + 1}
+	default:
+		return model.MoqtLocation{GroupId: largest.GroupId, ObjectId: largest.ObjectId + 1}
+	}
+}
+
+// Narrows reports whether the filter, sent in REQUEST_UPDATE, only narrows the current filter of the subscription that began at start.
+// The start location can't decrease and the end group can't increase or be removed. The new filter MUST be absolute,
+// so a Largest Object or Next Group Start subscription is checked against the start it was resolved to when accepted.
+func (f SubscriptionFilter) Narrows(current SubscriptionFilter, start model.MoqtLocation) bool {
+	if !f.Absolute() {
+		return false
+	}
+	if f.StartLocation.LessThan(start) {
+		return false
+	}
+	if current.Type == FilterAbsoluteRange {
+		return f.Type == FilterAbsoluteRange && f.EndGroup <= current.EndGroup
+	}
+	return true
+}
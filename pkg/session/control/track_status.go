@@ -0,0 +1,77 @@
+package control
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Track Status Message Section 9.19 -- //
+
+// TRACK_STATUS Message {
+//   Type (i) = 0xD,
+//   Length (16),
+//   Request ID (i),
+//   Track Namespace (tuple),
+//   Track Name Length (i),
+//   Track Name (..),
+//   Number of Parameters (i),
+//   Parameters (..) ...
+// }
+
+// Asks for the status of a track without subscribing to it, the publisher answers with REQUEST_OK or REQUEST_ERROR.
+// The status is carried as parameters of REQUEST_OK, the same ones SUBSCRIBE_OK would carry.
+// See: ParamLargestObject, ParamExpires, ParamGroupOrder
+
+type TrackStatusMessage struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	Parameters    []model.MoqtKeyValuePair
+}
+
+func (tsm *TrackStatusMessage) Type() ControlMessageType {
+	return TRACK_STATUS
+}
+
+func (tsm *TrackStatusMessage) GetRequestID() uint64 {
+	return tsm.RequestID
+}
+
+func (tsm *TrackStatusMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, tsm.RequestID)
+	message.EncodeMoqtFullTrackName(&payloadBuf, tsm.FullTrackName)
+	message.EncodeExtensions(&payloadBuf, tsm.Parameters)
+
+	return payloadBuf, nil
+}
+
+func (tsm *TrackStatusMessage) Decode(payload []byte) (int, error) {
+	parsed := 0
+	requestId, n, err := quicvarint.Parse(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("TrackStatusMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+	payload = payload[n:]
+
+	ftn, n, err := message.DecodeMoqtFullTrackName(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("TrackStatusMessage.Decode(): failed to parse Full Track Name: %w", err)
+	}
+	payload = payload[n:]
+
+	params, n, err := message.DecodeExtensions(payload)
+	parsed += n
+	if err != nil {
+		return parsed, fmt.Errorf("TrackStatusMessage.Decode(): failed to parse Parameters: %w", err)
+	}
+
+	tsm.RequestID = requestId
+	tsm.FullTrackName = ftn
+	tsm.Parameters = params
+	return parsed, nil
+}
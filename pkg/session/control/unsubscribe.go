@@ -0,0 +1,47 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// --- Unsubscribe Message Section 9.11 -- //
+
+// UNSUBSCRIBE Message {
+//   Type (i) = 0xA,
+//   Length (16),
+//   Request ID (i),
+// }
+
+// Sent by the subscriber to end a subscription, started either by its SUBSCRIBE or by the publisher's PUBLISH.
+// The publisher resets the open subgroup streams of the track and answers with PUBLISH_DONE.
+
+type UnsubscribeMessage struct {
+	RequestID uint64 // Request ID of the SUBSCRIBE or PUBLISH that started the subscription
+}
+
+func (um *UnsubscribeMessage) Type() ControlMessageType {
+	return UNSUBSCRIBE
+}
+
+func (um *UnsubscribeMessage) GetRequestID() uint64 {
+	return um.RequestID
+}
+
+func (um *UnsubscribeMessage) Encode() ([]byte, error) {
+	payloadBuf := make([]byte, 0)
+	payloadBuf = quicvarint.Append(payloadBuf, um.RequestID)
+
+	return payloadBuf, nil
+}
+
+func (um *UnsubscribeMessage) Decode(payload []byte) (int, error) {
+	requestId, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return n, fmt.Errorf("UnsubscribeMessage.Decode(): failed to parse Request ID: %w", err)
+	}
+
+	um.RequestID = requestId
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"errors"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"go-moq/pkg/transport"
+	"io"
+	"time"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// How long a data stream of an unknown Track Alias is held back, waiting for the control message that tells us the alias.
+const unknownTrackAliasTimeout = 2 * time.Second
+
+// Accepts the unidirectional data streams of the peer until the connection is closed, started by Run.
+// Every stream is read on its own goroutine, so a slow subgroup doesn't hold back the others.
+func (s *Session) receiveUniStreams() {
+	for {
+		stream, err := s.Conn.AcceptUniStream(s.Conn.Context())
+		if err != nil {
+			return // The connection is closed, Run reports the reason
+		}
+		go s.handleUniStream(stream)
+	}
+}
+
+func (s *Session) handleUniStream(stream transport.ReceiveStream) {
+	bs := message.NewBufferedReceiveStream(stream)
+
+	// The first varint of every data stream tells its kind
+	typeId, err := quicvarint.Read(bs)
+	if err != nil {
+		return // Reset or finished before it carried anything, nothing to deliver
+	}
+
+	switch typeId {
+	case message.FetchHeaderType:
+		err = s.acceptFetchStream(bs, typeId)
+	default:
+		err = s.readSubgroupStream(bs, typeId) // Anything else must be a SUBGROUP_HEADER type
+	}
+	s.closeOnMalformedStream(err)
+}
+
+// Malformed data streams terminate the session, any other error (e.g. a reset by the publisher) only ends the stream.
+func (s *Session) closeOnMalformedStream(err error) {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("Data stream ended in the middle of an object"),
+		}
+	}
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if errors.As(err, &termErr) {
+		s.CloseWithError(termErr)
+	}
+}
+
+// Reads a subgroup stream and routes its objects by the Track Alias in the header.
+func (s *Session) readSubgroupStream(bs *message.BufferedReceiveStream, typeId uint64) error {
+	sr, err := message.NewSubgroupReaderWithType(bs, typeId)
+	if err != nil {
+		return err
+	}
+
+	alias := sr.Header().TrackAlias
+	ftn, h, tracker, ok := s.waitTrackAlias(alias, unknownTrackAliasTimeout)
+	if !ok {
+		// e.g. the subscription ended before the stream arrived
+		sr.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR))
+		return nil
+	}
+	if tracker != nil {
+		// Finished, reset or malformed, the stream is accounted for either way
+		tracker.streamOpened()
+		defer tracker.streamClosed()
+	}
+
+	for {
+		obj, err := sr.ReadObject()
+		if errors.Is(err, io.EOF) {
+			return nil // The publisher finished the subgroup
+		}
+		var resetErr model.MOQT_STREAM_RESET_ERROR
+		if tracker != nil && errors.As(streamResetError(err), &resetErr) {
+			tracker.streamReset(&SubgroupResetError{GroupID: sr.Header().GroupId, Err: resetErr})
+		}
+		if err != nil {
+			return err
+		}
+
+		obj.FullTrackName = ftn
+		h(obj)
+	}
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+)
+
+// SendObjectDatagram sends a single object as an OBJECT_DATAGRAM.
+func (s *Session) SendObjectDatagram(dg *message.ObjectDatagram) error {
+	buf := make([]byte, 0)
+	message.EncodeObjectDatagram(&buf, dg)
+
+	if err := s.Conn.SendDatagram(buf); err != nil {
+		return fmt.Errorf("Session.SendObjectDatagram(): Failed to send datagram: %w", err)
+	}
+	return nil
+}
+
+// Receives datagrams until the connection is closed, started by Run.
+// Every datagram is decoded and routed by its Track Alias, datagrams of unknown aliases are dropped,
+// since they might legitimately arrive before the response that tells us the alias.
+func (s *Session) receiveDatagrams() {
+	for {
+		b, err := s.Conn.ReceiveDatagram(s.Conn.Context())
+		if err != nil {
+			return // The connection is closed, Run reports the reason
+		}
+
+		if err := s.handleDatagram(b); err != nil {
+			s.CloseWithError(err)
+			return
+		}
+	}
+}
+
+func (s *Session) handleDatagram(b []byte) error {
+	dg, n, err := message.DecodeObjectDatagram(b)
+	if err != nil || n != len(b) {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase("Received a malformed OBJECT_DATAGRAM"),
+		}
+	}
+
+	ftn, h, ok := s.lookupTrackAlias(dg.TrackAlias)
+	if !ok {
+		return nil // e.g. the subscription ended, datagrams may arrive late
+	}
+
+	obj, err := dg.ToMoqtObject(ftn)
+	if err != nil {
+		return err // Status/extension rule violations are MOQT_SESSION_TERMINATION_ERRORs already
+	}
+	h(obj)
+	return nil
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"errors"
+	"go-moq/pkg/model"
+	"testing"
+)
+
+// A malformed datagram terminates the session, even one whose counts would exhaust the memory if they were trusted.
+func TestMalformedDatagram(t *testing.T) {
+	sess, peer := newRawPeer(t, NewSessionState(RoleClient, 100, 0))
+
+	forged := []byte{
+		0x09,             // OBJECT_DATAGRAM with extensions
+		0x01, 0x00, 0x00, // Track Alias, Group ID, Object ID
+		0xC0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // 2^56-1 extensions
+		0x02, 0x0A, 0x78, // The only extension and the payload
+	}
+	if err := peer.conn.SendDatagram(forged); err != nil {
+		t.Fatalf("SendDatagram() unexpected error: %v", err)
+	}
+
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := waitTerminated(t, sess); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Session terminated with %v, want PROTOCOL_VIOLATION", err)
+	}
+	if code := peerCloseCode(t, peer); code != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Connection closed with %#x, want PROTOCOL_VIOLATION", uint64(code))
+	}
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"errors"
+	"go-moq/pkg/model"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Errors of the transport are turned into the typed errors of the model package before they reach the application:
+// the peer closing the connection becomes a model.MOQT_SESSION_TERMINATION_ERROR and a reset data stream a model.MOQT_STREAM_RESET_ERROR.
+// In the other direction, CloseWithError sends the code of a model.MOQT_SESSION_TERMINATION_ERROR and resetCode converts
+// model.MOQT_STREAM_RESET_ERROR_CODE for CancelWrite and CancelRead.
+
+// Converts a MOQT stream reset code for CancelWrite and CancelRead, i.e. RESET_STREAM and STOP_SENDING.
+func resetCode(code model.MOQT_STREAM_RESET_ERROR_CODE) quic.StreamErrorCode {
+	return quic.StreamErrorCode(code)
+}
+
+// Returns the code a stream that failed with err is reset with, the peer's code is echoed if it stopped the stream.
+func resetCodeFor(err error) quic.StreamErrorCode {
+	var resetErr model.MOQT_STREAM_RESET_ERROR
+	if errors.As(streamResetError(err), &resetErr) {
+		return resetCode(resetErr.ErrorCode)
+	}
+	return resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR)
+}
+
+// Turns the reset of a stream into a model.MOQT_STREAM_RESET_ERROR, any other error is returned as is.
+func streamResetError(err error) error {
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) {
+		return model.MOQT_STREAM_RESET_ERROR{
+			ErrorCode: model.MOQT_STREAM_RESET_ERROR_CODE(streamErr.ErrorCode),
+			Remote:    streamErr.Remote,
+		}
+	}
+	return err
+}
+
+// Turns the peer closing the connection into a model.MOQT_SESSION_TERMINATION_ERROR with the peer's code and reason,
+// any other error is returned as is.
+func sessionTerminationError(err error) error {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE(appErr.ErrorCode),
+			ReasonPhrase: model.MoqtReasonPhrase(appErr.ErrorMessage), // Not NewReasonPhrase, it's up to the peer to keep it valid
+		}
+	}
+	return err
+}
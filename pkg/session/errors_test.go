@@ -0,0 +1,45 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+			return
+		}
+		w.CloseWithStatus(control.PublishDoneExpired, "Subscription expired")
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	var doneErr model.MOQT_PUBLISH_DONE_ERROR
+	if _, err := sub.ReadObject(ctx); !errors.As(err, &doneErr) || doneErr.StatusCode != model.MOQT_PUBLISH_DONE_STATUS_CODE_EXPIRED {
+		t.Errorf("ReadObject() of an expired subscription error = %v, want MOQT_PUBLISH_DONE_ERROR (EXPIRED)", err)
+	}
+
+	// The peer's code and reason are reported as they were sent
+	server.CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{
+		ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_TOO_MANY_REQUESTS,
+		ReasonPhrase: model.NewReasonPhrase("Slow down"),
+	})
+	<-client.Done()
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if !errors.As(client.Err(), &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_TOO_MANY_REQUESTS || termErr.ReasonPhrase != "Slow down" {
+		t.Errorf("Err() of the peer's session = %v, want TOO_MANY_REQUESTS (Slow down)", client.Err())
+	}
+}
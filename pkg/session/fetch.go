@@ -0,0 +1,602 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+	"sync"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// ErrFetchCancelled is returned when reading from or writing to a fetch that was cancelled by either endpoint.
+var ErrFetchCancelled = errors.New("fetch was cancelled")
+
+// --- Subscriber side --- //
+
+// FetchTarget selects the objects a FETCH retrieves, see StandaloneFetch, RelativeJoiningFetch and AbsoluteJoiningFetch.
+type FetchTarget func(*control.FetchMessage) error
+
+// Fetches the objects of the track from start up to end (inclusive), an End Object ID of math.MaxUint64 requests the whole end group.
+// Session.Fetch fails if a location can't be encoded, see control.FetchEndLocation.
+func StandaloneFetch(ftn model.MoqtFullTrackName, start model.MoqtLocation, end model.MoqtLocation) FetchTarget {
+	return func(fm *control.FetchMessage) error {
+		if start.GroupId > quicvarint.Max || start.ObjectId > quicvarint.Max {
+			return fmt.Errorf("StandaloneFetch(): Start Location %v exceeds the maximum varint value", start)
+		}
+		endLocation, err := control.FetchEndLocation(end)
+		if err != nil {
+			return fmt.Errorf("StandaloneFetch(): %w", err)
+		}
+		fm.FetchType = control.FetchTypeStandalone
+		fm.FullTrackName = ftn
+		fm.StartLocation = start
+		fm.EndLocation = endLocation
+		return nil
+	}
+}
+
+// Fetches the groupOffset groups preceding the first object delivered by the subscription, to fill the gap before it.
+func RelativeJoiningFetch(sub *Subscription, groupOffset uint64) FetchTarget {
+	return func(fm *control.FetchMessage) error {
+		fm.FetchType = control.FetchTypeRelativeJoining
+		fm.FullTrackName = sub.FullTrackName // Not on the wire, the publisher knows the track from the subscription
+		fm.JoiningRequestID = sub.RequestID
+		fm.JoiningStart = groupOffset
+		return nil
+	}
+}
+
+// Fetches the objects from startGroup up to the first object delivered by the subscription.
+func AbsoluteJoiningFetch(sub *Subscription, startGroup uint64) FetchTarget {
+	return func(fm *control.FetchMessage) error {
+		fm.FetchType = control.FetchTypeAbsoluteJoining
+		fm.FullTrackName = sub.FullTrackName // Not on the wire, the publisher knows the track from the subscription
+		fm.JoiningRequestID = sub.RequestID
+		fm.JoiningStart = startGroup
+		return nil
+	}
+}
+
+// FetchOption customizes the FETCH message sent by Session.Fetch.
+type FetchOption func(*control.FetchMessage)
+
+func WithFetchSubscriberPriority(priority uint8) FetchOption {
+	return func(fm *control.FetchMessage) {
+		fm.Parameters = append(fm.Parameters, uintParam(control.ParamSubscriberPriority, uint64(priority)))
+	}
+}
+
+// 0x1 ascending, 0x2 descending, the publisher decides if omitted.
+func WithFetchGroupOrder(order uint64) FetchOption {
+	return func(fm *control.FetchMessage) {
+		fm.Parameters = append(fm.Parameters, uintParam(control.ParamGroupOrder, order))
+	}
+}
+
+// Attaches an AUTHORIZATION_TOKEN, see WithAuthToken.
+func WithFetchAuthToken(t control.AuthToken) FetchOption {
+	return func(fm *control.FetchMessage) {
+		fm.Parameters = append(fm.Parameters, t.ToParam())
+	}
+}
+
+// Appends arbitrary parameters, e.g. AUTHORIZATION_TOKEN.
+func WithFetchParameters(params ...model.MoqtKeyValuePair) FetchOption {
+	return func(fm *control.FetchMessage) {
+		fm.Parameters = append(fm.Parameters, params...)
+	}
+}
+
+// Fetch sends FETCH for the target and waits for the publisher's answer.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR, on FETCH_OK the objects are delivered through the returned Fetch.
+// It blocks until the answer arrives, ctx is done or the session terminates, giving up cancels the fetch. Run MUST be running.
+func (s *Session) Fetch(ctx context.Context, target FetchTarget, opts ...FetchOption) (*Fetch, error) {
+	fm := &control.FetchMessage{}
+	if err := target(fm); err != nil {
+		return nil, fmt.Errorf("Session.Fetch(): %w", err)
+	}
+	for _, opt := range opts {
+		opt(fm)
+	}
+
+	if err := s.State.checkLocalAuthTokens(fm.Parameters); err != nil {
+		return nil, fmt.Errorf("Session.Fetch(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.Fetch(): %w", err)
+	}
+	fm.RequestID = requestID
+
+	// The fetch stream might overtake FETCH_OK, so the fetch is known before the request is sent
+	f := newFetch(s, requestID, fm.FullTrackName)
+	s.addFetch(f)
+
+	answer := make(chan error, 1)
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.FetchOkMessage:
+			f.EndOfTrack = m.EndOfTrack
+			f.EndLocation = m.EndLocation
+			f.Parameters = m.Parameters
+			answer <- nil
+		case *control.RequestErrorMessage:
+			s.removeFetch(requestID)
+			answer <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to FETCH", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(fm.Parameters, func() error {
+		return s.Cmf.WriteControlMessage(fm)
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		s.removeFetch(requestID)
+		return nil, fmt.Errorf("Session.Fetch(): Failed to send FETCH message: %w", err)
+	}
+
+	select {
+	case err := <-answer:
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case <-ctx.Done():
+		f.Cancel()
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, s.Err()
+	}
+}
+
+func (s *Session) addFetch(f *Fetch) {
+	s.fetchesMutex.Lock()
+	defer s.fetchesMutex.Unlock()
+	s.fetches[f.RequestID] = f
+}
+
+func (s *Session) removeFetch(requestID uint64) {
+	s.fetchesMutex.Lock()
+	defer s.fetchesMutex.Unlock()
+	delete(s.fetches, requestID)
+}
+
+func (s *Session) lookupFetch(requestID uint64) (*Fetch, bool) {
+	s.fetchesMutex.Lock()
+	defer s.fetchesMutex.Unlock()
+	f, ok := s.fetches[requestID]
+	return f, ok
+}
+
+// Routes a FETCH_HEADER stream to the fetch it answers, streams of unknown (e.g. cancelled) fetches are dropped.
+func (s *Session) acceptFetchStream(bs *message.BufferedReceiveStream, typeId uint64) error {
+	fr, err := message.NewFetchReaderWithType(bs, typeId)
+	if err != nil {
+		return err
+	}
+
+	f, ok := s.lookupFetch(fr.RequestID())
+	if !ok {
+		fr.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+		return nil
+	}
+	return f.deliver(fr)
+}
+
+// Fetch is an accepted fetch, its objects are read in the order the publisher sends them.
+type Fetch struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	EndOfTrack    bool                     // From FETCH_OK, whether the fetch covers the end of the track
+	EndLocation   model.MoqtLocation       // From FETCH_OK, the largest location that will be delivered
+	Parameters    []model.MoqtKeyValuePair // Parameters of FETCH_OK
+
+	sess *Session
+
+	mu        sync.Mutex
+	reader    *message.FetchReader // Set once the fetch stream arrives, immutable afterwards
+	ready     chan struct{}        // Closed when reader is set
+	cancelled chan struct{}        // Closed when the fetch is cancelled
+	ended     bool                 // Whether the fetch was cancelled or finished by the publisher
+}
+
+func newFetch(sess *Session, requestID uint64, ftn model.MoqtFullTrackName) *Fetch {
+	return &Fetch{
+		RequestID:     requestID,
+		FullTrackName: ftn,
+		sess:          sess,
+		ready:         make(chan struct{}),
+		cancelled:     make(chan struct{}),
+	}
+}
+
+// Hands over the fetch stream, a fetch is answered by exactly one stream.
+func (f *Fetch) deliver(fr *message.FetchReader) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.reader != nil {
+		return protocolViolation(fmt.Sprintf("Received a second fetch stream for Request ID: %d", f.RequestID))
+	}
+	if f.ended {
+		fr.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+		return nil
+	}
+	f.reader = fr
+	close(f.ready)
+	return nil
+}
+
+// ReadObject returns the next object of the fetch, io.EOF is returned after the last one.
+// ctx only bounds waiting for the fetch stream to arrive, reading from the stream can be interrupted with Cancel.
+func (f *Fetch) ReadObject(ctx context.Context) (*model.MoqtObject, error) {
+	select {
+	case <-f.ready:
+	case <-f.cancelled:
+		return nil, ErrFetchCancelled
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.sess.closed:
+		return nil, f.sess.Err()
+	}
+
+	obj, err := f.reader.ReadObject()
+	if errors.Is(err, io.EOF) {
+		f.mu.Lock()
+		f.ended = true
+		f.mu.Unlock()
+		f.sess.removeFetch(f.RequestID)
+		return nil, io.EOF
+	}
+	if err != nil {
+		select {
+		case <-f.cancelled:
+			return nil, ErrFetchCancelled // The read was interrupted by Cancel
+		default:
+		}
+		f.sess.closeOnMalformedStream(err)
+		return nil, streamResetError(err)
+	}
+
+	obj.FullTrackName = f.FullTrackName
+	return obj, nil
+}
+
+// Cancel tells the publisher to stop the fetch with FETCH_CANCEL, objects that weren't read yet are discarded.
+// Cancelling a fetch that already ended has no effect.
+func (f *Fetch) Cancel() error {
+	f.mu.Lock()
+	if f.ended {
+		f.mu.Unlock()
+		return nil
+	}
+	f.ended = true
+	close(f.cancelled)
+	if f.reader != nil {
+		f.reader.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+	}
+	f.mu.Unlock()
+
+	f.sess.removeFetch(f.RequestID)
+	if err := f.sess.Cmf.WriteControlMessage(&control.FetchCancelMessage{RequestID: f.RequestID}); err != nil {
+		return fmt.Errorf("Fetch.Cancel(): Failed to send FETCH_CANCEL message: %w", err)
+	}
+	return nil
+}
+
+// --- Publisher side --- //
+
+// FetchRequestHandler is called for every FETCH of the peer.
+// The same rules of SubscribeRequestHandler apply, the request MUST be answered with FetchRequest.Accept or FetchRequest.Reject.
+type FetchRequestHandler func(req *FetchRequest)
+
+// HandleFetch registers the handler for all fetches of the peer, without one fetches are rejected with NOT_SUPPORTED.
+func (p *Publisher) HandleFetch(h FetchRequestHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetchHandler = h
+}
+
+// FetchRequest is an incoming FETCH waiting for an answer.
+type FetchRequest struct {
+	RequestID uint64
+	FetchType control.FetchType
+
+	// For joining fetches, the track of the joined subscription
+	FullTrackName model.MoqtFullTrackName
+
+	// Only set for standalone fetches
+	StartLocation model.MoqtLocation
+	EndLocation   model.MoqtLocation // The last location asked for (inclusive), an Object ID of math.MaxUint64 means the whole End Group
+
+	// Only set for joining fetches, see control.FetchMessage
+	JoiningStart        uint64
+	JoiningSubscription *TrackWriter
+
+	SubscriberPriority uint8  // 128 if the subscriber didn't specify it
+	GroupOrder         uint64 // 0x0 if the subscriber left it to the publisher, 0x1 ascending, 0x2 descending
+	Parameters         []model.MoqtKeyValuePair
+
+	pub *Publisher
+
+	answerOnce sync.Once
+	cancelled  bool         // Whether the subscriber sent FETCH_CANCEL, protected by pub.mu
+	writer     *FetchWriter // Set on Accept, protected by pub.mu
+}
+
+func (p *Publisher) onFetch(sess *Session, msg control.ControlMessage) error {
+	fm := msg.(*control.FetchMessage)
+
+	req := &FetchRequest{
+		RequestID:     fm.RequestID,
+		FetchType:     fm.FetchType,
+		FullTrackName: fm.FullTrackName,
+		StartLocation: fm.StartLocation,
+		JoiningStart:  fm.JoiningStart,
+		Parameters:    fm.Parameters,
+		pub:           p,
+	}
+
+	if !fm.IsJoining() {
+		req.EndLocation = control.FetchLastLocation(fm.EndLocation)
+	}
+
+	var err error
+	if req.SubscriberPriority, err = subscriberPriorityFromParams(fm.Parameters); err != nil {
+		return err
+	}
+	if req.GroupOrder, err = groupOrderFromParams(fm.Parameters); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	h := p.fetchHandler
+	if fm.IsJoining() {
+		req.JoiningSubscription = p.subscriptions[fm.JoiningRequestID]
+	}
+	p.mu.Unlock()
+
+	if h == nil {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    fm.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED,
+			ReasonPhrase: model.NewReasonPhrase("FETCH is not supported"),
+		}
+	}
+
+	if fm.IsJoining() {
+		if req.JoiningSubscription == nil {
+			return model.MOQT_REQUEST_ERROR{
+				RequestID:    fm.RequestID,
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Joining Request ID %d doesn't refer to a subscription", fm.JoiningRequestID)),
+			}
+		}
+		req.FullTrackName = req.JoiningSubscription.FullTrackName
+	} else if req.EndLocation.LessThan(req.StartLocation) {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    fm.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE,
+			ReasonPhrase: model.NewReasonPhrase("End Location is smaller than Start Location"),
+		}
+	}
+
+	p.mu.Lock()
+	p.fetches[req.RequestID] = req
+	p.mu.Unlock()
+
+	h(req)
+	return nil
+}
+
+func (p *Publisher) onFetchCancel(sess *Session, msg control.ControlMessage) error {
+	fcm := msg.(*control.FetchCancelMessage)
+
+	p.mu.Lock()
+	req, ok := p.fetches[fcm.RequestID]
+	var w *FetchWriter
+	if ok {
+		req.cancelled = true
+		w = req.writer
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		return nil // The fetch already ended, FETCH_CANCEL crossed our FIN
+	}
+	if w != nil {
+		w.cancel()
+	}
+	return nil
+}
+
+// Removes the fetch and completes its request, only the first call has an effect.
+func (p *Publisher) endFetch(requestID uint64) error {
+	p.mu.Lock()
+	_, ok := p.fetches[requestID]
+	delete(p.fetches, requestID)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return p.sess.CompleteIncomingRequest(requestID)
+}
+
+// Accept answers the request with FETCH_OK and returns the writer the objects are delivered through.
+// endLocation is the largest location that will be delivered, endOfTrack tells whether it is the end of the track.
+func (req *FetchRequest) Accept(endOfTrack bool, endLocation model.MoqtLocation, params ...model.MoqtKeyValuePair) (*FetchWriter, error) {
+	var w *FetchWriter
+	err := fmt.Errorf("FetchRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		p := req.pub
+
+		p.mu.Lock()
+		cancelled := req.cancelled
+		if !cancelled {
+			w = &FetchWriter{RequestID: req.RequestID, pub: p}
+			req.writer = w
+		}
+		p.mu.Unlock()
+
+		if cancelled {
+			w, err = nil, ErrFetchCancelled
+			p.endFetch(req.RequestID)
+			return
+		}
+
+		err = p.sess.Cmf.WriteControlMessage(&control.FetchOkMessage{
+			RequestID:   req.RequestID,
+			EndOfTrack:  endOfTrack,
+			EndLocation: endLocation,
+			Parameters:  params,
+		})
+		if err != nil {
+			w, err = nil, fmt.Errorf("FetchRequest.Accept(): Failed to send FETCH_OK message: %w", err)
+		}
+	})
+	return w, err
+}
+
+// Reject answers the request with REQUEST_ERROR.
+func (req *FetchRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("FetchRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		p := req.pub
+		p.mu.Lock()
+		delete(p.fetches, req.RequestID)
+		p.mu.Unlock()
+
+		err = p.sess.RejectRequest(model.MOQT_REQUEST_ERROR{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+	})
+	return err
+}
+
+// FetchWriter delivers the objects of an accepted fetch on a single fetch stream, which is opened with the first object.
+// Objects MUST be written in the order the subscriber asked for. It is safe for concurrent use, writes are serialized.
+type FetchWriter struct {
+	RequestID uint64
+
+	pub *Publisher
+
+	mu        sync.Mutex
+	fw        *message.FetchWriter // nil until the stream is opened
+	closed    bool
+	cancelled bool
+}
+
+// Must be called with w.mu held
+func (w *FetchWriter) open() error {
+	if w.fw != nil {
+		return nil
+	}
+
+	sess := w.pub.sess
+	stream, err := sess.Conn.OpenUniStreamSync(sess.Conn.Context())
+	if err != nil {
+		return fmt.Errorf("FetchWriter: Failed to open fetch stream: %w", err)
+	}
+	fw, err := message.NewFetchWriter(stream, w.RequestID)
+	if err != nil {
+		stream.CancelWrite(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR))
+		return fmt.Errorf("FetchWriter: %w", err)
+	}
+	w.fw = fw
+	return nil
+}
+
+// WriteObject writes the next object of the fetch, ErrFetchCancelled is returned once the subscriber cancelled the fetch.
+func (w *FetchWriter) WriteObject(obj *model.MoqtObject) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancelled {
+		return ErrFetchCancelled
+	}
+	if w.closed {
+		return fmt.Errorf("FetchWriter.WriteObject(): fetch %d is closed", w.RequestID)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	if err := w.fw.WriteObject(obj); err != nil {
+		return fmt.Errorf("FetchWriter.WriteObject(): %w", streamResetError(err))
+	}
+	return nil
+}
+
+// Close finishes the fetch stream, telling the subscriber that every object was delivered, and completes the request.
+func (w *FetchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed || w.cancelled {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+
+	// A fetch without objects still needs its stream, the subscriber waits for the FIN
+	err := w.open()
+	if err == nil {
+		err = w.fw.Close()
+	}
+	w.mu.Unlock()
+
+	if endErr := w.pub.endFetch(w.RequestID); err == nil {
+		err = endErr
+	}
+	return err
+}
+
+// Abort resets the fetch stream with INTERNAL_ERROR, telling the subscriber that the fetch failed before every object was delivered,
+// and completes the request. It has no effect on a fetch that was closed or cancelled.
+// A reset discards what the subscriber didn't read yet, if that includes the FETCH_HEADER the subscriber can't tell which fetch failed.
+func (w *FetchWriter) Abort() error {
+	w.mu.Lock()
+	if w.closed || w.cancelled {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+
+	err := w.open()
+	if err == nil {
+		w.fw.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR))
+	}
+	w.mu.Unlock()
+
+	if endErr := w.pub.endFetch(w.RequestID); err == nil {
+		err = endErr
+	}
+	return err
+}
+
+// Handles FETCH_CANCEL of the subscriber
+func (w *FetchWriter) cancel() {
+	w.mu.Lock()
+	if w.closed || w.cancelled {
+		w.mu.Unlock()
+		return
+	}
+	w.cancelled = true
+	if w.fw != nil {
+		w.fw.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+	}
+	w.mu.Unlock()
+
+	w.pub.endFetch(w.RequestID)
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestFetchEndToEnd(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "vod")
+
+	objects := []*model.MoqtObject{
+		{Location: model.MoqtLocation{GroupId: 2, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("a")},
+		{Location: model.MoqtLocation{GroupId: 2, ObjectId: 1}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("b")},
+		{Location: model.MoqtLocation{GroupId: 3, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("c")},
+	}
+	end := model.MoqtLocation{GroupId: 3, ObjectId: 0}
+
+	pub := NewPublisher(server)
+	pub.HandleFetch(func(req *FetchRequest) {
+		if req.EndLocation != end {
+			t.Errorf("FetchRequest got EndLocation = %+v, want %+v", req.EndLocation, end)
+		}
+		go func() {
+			w, err := req.Accept(true, end)
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+				return
+			}
+			for _, obj := range objects {
+				if err := w.WriteObject(obj); err != nil {
+					t.Errorf("WriteObject() unexpected error: %v", err)
+				}
+			}
+			w.Close()
+		}()
+	})
+
+	f, err := client.Fetch(ctx, StandaloneFetch(track, model.MoqtLocation{GroupId: 2}, end))
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error: %v", err)
+	}
+	if !f.EndOfTrack || f.EndLocation != end {
+		t.Errorf("FETCH_OK got EndOfTrack = %v, EndLocation = %+v", f.EndOfTrack, f.EndLocation)
+	}
+
+	// Objects of a fetch arrive in order on a single stream
+	for _, expected := range objects {
+		obj, err := f.ReadObject(ctx)
+		if err != nil {
+			t.Fatalf("ReadObject() unexpected error: %v", err)
+		}
+		if obj.Location != expected.Location || string(obj.Payload) != string(expected.Payload) {
+			t.Errorf("ReadObject() got %+v %q, want %+v %q", obj.Location, obj.Payload, expected.Location, expected.Payload)
+		}
+	}
+	if _, err := f.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadObject() at the end error = %v, want io.EOF", err)
+	}
+}
+
+func TestFetchInvalidRange(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	NewPublisher(server).HandleFetch(func(req *FetchRequest) {
+		t.Errorf("Handler invoked for an invalid range")
+	})
+
+	tests := []struct {
+		name  string
+		start model.MoqtLocation
+		end   model.MoqtLocation
+	}{
+		{"earlier group", model.MoqtLocation{GroupId: 5}, model.MoqtLocation{GroupId: 1, ObjectId: math.MaxUint64}},
+		{"earlier object", model.MoqtLocation{GroupId: 5, ObjectId: 3}, model.MoqtLocation{GroupId: 5, ObjectId: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Fetch(ctx, StandaloneFetch(testutil.FullTrackName("video", "vod"), tt.start, tt.end))
+			var reqErr model.MOQT_REQUEST_ERROR
+			if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE {
+				t.Errorf("Fetch() error = %v, want INVALID_RANGE", err)
+			}
+		})
+	}
+}
+
+func TestFetchLocationTooLarge(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	NewPublisher(server).HandleFetch(func(req *FetchRequest) {
+		t.Errorf("Handler invoked for a location that can't be encoded")
+	})
+
+	// The End Location is one object past the last one, it doesn't fit in a varint anymore
+	end := model.MoqtLocation{GroupId: 1, ObjectId: quicvarint.Max}
+	if _, err := client.Fetch(ctx, StandaloneFetch(testutil.FullTrackName("video", "vod"), model.MoqtLocation{}, end)); err == nil {
+		t.Fatalf("Fetch() expected an error for the last Object ID %d, but got none", end.ObjectId)
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Err() = %v, want the session alive", err)
+	}
+}
+
+func TestFetchAbort(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "vod")
+	obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: 1}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("a")}
+
+	// A reset discards what the subscriber didn't read, the abort waits until the stream is known to belong to the fetch
+	read := make(chan struct{})
+	NewPublisher(server).HandleFetch(func(req *FetchRequest) {
+		go func() {
+			w, err := req.Accept(false, req.EndLocation)
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+				return
+			}
+			w.WriteObject(obj)
+			<-read
+			w.Abort()
+		}()
+	})
+
+	f, err := client.Fetch(ctx, StandaloneFetch(track, model.MoqtLocation{GroupId: 1}, model.MoqtLocation{GroupId: 2}))
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error: %v", err)
+	}
+	if _, err := f.ReadObject(ctx); err != nil {
+		t.Fatalf("ReadObject() unexpected error: %v", err)
+	}
+	close(read)
+
+	var resetErr model.MOQT_STREAM_RESET_ERROR
+	if _, err := f.ReadObject(ctx); !errors.As(err, &resetErr) || resetErr.ErrorCode != model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR {
+		t.Errorf("ReadObject() of an aborted fetch error = %v, want a reset with INTERNAL_ERROR", err)
+	}
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+)
+
+// GOAWAY initiates the graceful shutdown of a session (Section 9.4)
+// Requests that are in flight are not affected, but no new requests are sent once either endpoint sent GOAWAY.
+// The client is expected to close the session once it's done with it, optionally moving to the New Session URI given by the server.
+
+// ErrGoingAway is returned when a new request is attempted on a session that is going away.
+var ErrGoingAway = errors.New("session is going away")
+
+// GoAway sends GOAWAY to the peer, only the server may give a New Session URI.
+// After that, new requests of the peer are rejected with REQUEST_ERROR, GOAWAY can only be sent once.
+func (s *Session) GoAway(newSessionURI string) error {
+	if s.State.LocalRole == RoleClient && newSessionURI != "" {
+		return fmt.Errorf("Session.GoAway(): A client must not send a New Session URI")
+	}
+
+	s.goAwayMutex.Lock()
+	if s.goAwaySent {
+		s.goAwayMutex.Unlock()
+		return fmt.Errorf("Session.GoAway(): GOAWAY was already sent")
+	}
+	s.goAwaySent = true
+	s.goAwayMutex.Unlock()
+
+	if err := s.Cmf.WriteControlMessage(&control.GoAwayMessage{NewSessionURI: newSessionURI}); err != nil {
+		return fmt.Errorf("Session.GoAway(): Failed to send GOAWAY message: %w", err)
+	}
+	return nil
+}
+
+// Drain sends GOAWAY and waits until the peer closes the session.
+// If ctx is done first, the session is closed with GOAWAY_TIMEOUT.
+func (s *Session) Drain(ctx context.Context, newSessionURI string) error {
+	if err := s.GoAway(newSessionURI); err != nil {
+		return err
+	}
+
+	select {
+	case <-s.closed:
+		return nil
+	case <-ctx.Done():
+		s.CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT,
+			ReasonPhrase: model.NewReasonPhrase("The session was not closed in time after GOAWAY"),
+		})
+		return ctx.Err()
+	}
+}
+
+// GoingAway returns a channel that is closed when the peer sends GOAWAY.
+func (s *Session) GoingAway() <-chan struct{} {
+	return s.goAwayReceived
+}
+
+// NewSessionURI returns the New Session URI of the peer's GOAWAY, empty if there was none or GOAWAY wasn't received yet.
+func (s *Session) NewSessionURI() string {
+	select {
+	case <-s.goAwayReceived:
+		return s.newSessionURI
+	default:
+		return ""
+	}
+}
+
+// Returns ErrGoingAway if either endpoint sent GOAWAY.
+func (s *Session) goingAwayErr() error {
+	select {
+	case <-s.goAwayReceived:
+		return ErrGoingAway
+	default:
+	}
+	if s.sentGoAway() {
+		return ErrGoingAway
+	}
+	return nil
+}
+
+// Handles GOAWAY from the peer.
+func (s *Session) onGoAway(msg *control.GoAwayMessage) error {
+	// The client MUST NOT include a New Session URI.
+	if s.State.LocalRole == RoleServer && msg.NewSessionURI != "" {
+		return protocolViolation("GOAWAY of a client must not include a New Session URI")
+	}
+
+	select {
+	case <-s.goAwayReceived:
+		// An endpoint MUST terminate the session with a PROTOCOL_VIOLATION if it receives multiple GOAWAY messages.
+		return protocolViolation("Received multiple GOAWAY messages")
+	default:
+	}
+
+	s.newSessionURI = msg.NewSessionURI // Written before the channel is closed, so readers see it
+	close(s.goAwayReceived)
+	return nil
+}
+
+// Reports whether we sent GOAWAY.
+func (s *Session) sentGoAway() bool {
+	s.goAwayMutex.Lock()
+	defer s.goAwayMutex.Unlock()
+	return s.goAwaySent
+}
+
+// Rejects a new request of the peer if we sent GOAWAY, reports whether it was rejected.
+func (s *Session) rejectIfGoingAway(requestID uint64) (bool, error) {
+	if !s.sentGoAway() {
+		return false, nil
+	}
+	return true, s.RejectRequest(model.MOQT_REQUEST_ERROR{
+		RequestID:    requestID,
+		ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED,
+		ReasonPhrase: model.NewReasonPhrase("Session is going away"),
+	})
+}
@@ -0,0 +1,118 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+	"time"
+)
+
+func TestGoAway(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	writers := make(chan *TrackWriter, 1)
+	NewPublisher(server).HandleTrack(track, func(req *SubscribeRequest) {
+		go func() {
+			w, err := req.Accept()
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+			}
+			writers <- w
+		}()
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	if err := client.GoAway("moqt://relay2.example.com"); err == nil {
+		t.Errorf("GoAway() of a client with a New Session URI expected an error, but got none")
+	}
+	if err := server.GoAway("moqt://relay2.example.com"); err != nil {
+		t.Fatalf("GoAway() unexpected error: %v", err)
+	}
+	if err := server.GoAway(""); err == nil {
+		t.Errorf("Second GoAway() expected an error, but got none")
+	}
+
+	select {
+	case <-client.GoingAway():
+	case <-ctx.Done():
+		t.Fatalf("GoingAway() wasn't closed after GOAWAY")
+	}
+	if uri := client.NewSessionURI(); uri != "moqt://relay2.example.com" {
+		t.Errorf("NewSessionURI() got = %q, want \"moqt://relay2.example.com\"", uri)
+	}
+
+	// No new requests, but the subscription that is in flight goes on
+	if _, err := client.Subscribe(ctx, track); !errors.Is(err, ErrGoingAway) {
+		t.Errorf("Subscribe() after GOAWAY error = %v, want %v", err, ErrGoingAway)
+	}
+	obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: 4}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("late")}
+	if err := w.WriteObject(obj); err != nil {
+		t.Fatalf("WriteObject() after GOAWAY unexpected error: %v", err)
+	}
+	if got, err := sub.ReadObject(ctx); err != nil || string(got.Payload) != "late" {
+		t.Errorf("ReadObject() after GOAWAY got = %+v, %v", got, err)
+	}
+}
+
+func TestGoAwayProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*control.GoAwayMessage
+		toServer bool
+	}{
+		{"Multiple GOAWAY messages", []*control.GoAwayMessage{{}, {}}, false},
+		{"New Session URI from a client", []*control.GoAwayMessage{{NewSessionURI: "moqt://elsewhere"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testutil.Context(t)
+			client, server := newSessionPair(t)
+			sender, receiver := server, client
+			if tt.toServer {
+				sender, receiver = client, server
+			}
+
+			// Written directly, Session.GoAway refuses to send these
+			for _, msg := range tt.messages {
+				sender.Cmf.WriteControlMessage(msg)
+			}
+
+			select {
+			case <-receiver.Done():
+			case <-ctx.Done():
+				t.Fatalf("Session wasn't terminated")
+			}
+			var termErr model.MOQT_SESSION_TERMINATION_ERROR
+			if !errors.As(receiver.Err(), &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+				t.Errorf("Session terminated with %v, want PROTOCOL_VIOLATION", receiver.Err())
+			}
+		})
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	_, server := newSessionPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The client never closes the session
+	if err := server.Drain(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if !errors.As(server.Err(), &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT {
+		t.Errorf("Session terminated with %v, want GOAWAY_TIMEOUT", server.Err())
+	}
+}
@@ -0,0 +1,388 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"sync"
+)
+
+// PUBLISH_NAMESPACE advertises that an endpoint can serve the tracks of a namespace (Section 9.20)
+// The receiver answers with REQUEST_OK or REQUEST_ERROR. Later on, the publisher withdraws the namespace with PUBLISH_NAMESPACE_DONE,
+// or the receiver withdraws its acceptance with PUBLISH_NAMESPACE_CANCEL. Both messages identify the announcement by its namespace.
+
+// ErrNamespaceWithdrawn is returned when answering a PUBLISH_NAMESPACE the peer already withdrew with PUBLISH_NAMESPACE_DONE.
+var ErrNamespaceWithdrawn = errors.New("namespace was withdrawn by the publisher")
+
+// PublishedNamespace is a namespace WE published and the peer accepted.
+type PublishedNamespace struct {
+	RequestID  uint64
+	Namespace  model.MoqtTrackNamespace
+	Parameters []model.MoqtKeyValuePair // Parameters of REQUEST_OK
+
+	sess *Session
+
+	endOnce sync.Once
+	ended   chan struct{}            // Closed by Close or PUBLISH_NAMESPACE_CANCEL
+	err     model.MOQT_REQUEST_ERROR // The reason of PUBLISH_NAMESPACE_CANCEL, valid after ended is closed
+	closed  bool                     // Whether the namespace ended with Close
+}
+
+// PublishNamespace sends PUBLISH_NAMESPACE for the namespace and waits for the peer's answer.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR. A namespace can only be published once at a time on a session.
+// It blocks until the answer arrives, ctx is done or the session terminates, Run MUST be running.
+func (s *Session) PublishNamespace(ctx context.Context, ns model.MoqtTrackNamespace, params ...model.MoqtKeyValuePair) (*PublishedNamespace, error) {
+	key := ns.Key()
+
+	// The namespace is reserved until the answer arrives, so concurrent calls can't publish it twice
+	s.namespacesMutex.Lock()
+	_, published := s.publishedNamespaces[key]
+	_, pending := s.pendingNamespaces[key]
+	if !published && !pending {
+		s.pendingNamespaces[key] = struct{}{}
+	}
+	s.namespacesMutex.Unlock()
+	if published || pending {
+		return nil, fmt.Errorf("Session.PublishNamespace(): Namespace %s is already published", ns.ToString())
+	}
+
+	if err := s.State.checkLocalAuthTokens(params); err != nil {
+		s.releasePendingNamespace(key)
+		return nil, fmt.Errorf("Session.PublishNamespace(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		s.releasePendingNamespace(key)
+		return nil, fmt.Errorf("Session.PublishNamespace(): %w", err)
+	}
+
+	pn := &PublishedNamespace{
+		RequestID: requestID,
+		Namespace: ns,
+		sess:      s,
+		ended:     make(chan struct{}),
+	}
+
+	var (
+		mu        sync.Mutex
+		abandoned bool // Whether we gave up waiting for the answer
+	)
+	answer := make(chan error, 1)
+
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.RequestOkMessage:
+			mu.Lock()
+			defer mu.Unlock()
+			if abandoned {
+				// The peer accepted a namespace nobody serves anymore
+				err := s.Cmf.WriteControlMessage(&control.PublishNamespaceDoneMessage{Namespace: ns})
+				s.releasePendingNamespace(key)
+				return err
+			}
+
+			pn.Parameters = m.Parameters
+			s.namespacesMutex.Lock()
+			delete(s.pendingNamespaces, key)
+			s.publishedNamespaces[key] = pn
+			s.namespacesMutex.Unlock()
+			answer <- nil
+		case *control.RequestErrorMessage:
+			s.releasePendingNamespace(key)
+			answer <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to PUBLISH_NAMESPACE", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(params, func() error {
+		return s.Cmf.WriteControlMessage(&control.PublishNamespaceMessage{RequestID: requestID, Namespace: ns, Parameters: params})
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		s.releasePendingNamespace(key)
+		return nil, fmt.Errorf("Session.PublishNamespace(): Failed to send PUBLISH_NAMESPACE message: %w", err)
+	}
+
+	select {
+	case err := <-answer:
+		if err != nil {
+			return nil, err
+		}
+		return pn, nil
+	case <-ctx.Done():
+		mu.Lock()
+		abandoned = true
+		mu.Unlock()
+
+		// The answer might have been handled right before we gave up
+		select {
+		case err := <-answer:
+			if err == nil {
+				pn.Close()
+			}
+		default:
+		}
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, s.Err()
+	}
+}
+
+// Close withdraws the namespace with PUBLISH_NAMESPACE_DONE, it has no effect if the peer already cancelled it.
+func (pn *PublishedNamespace) Close() error {
+	first := false
+	pn.endOnce.Do(func() {
+		first = true
+		pn.closed = true
+		pn.sess.removePublishedNamespace(pn)
+		close(pn.ended)
+	})
+	if !first {
+		return nil
+	}
+
+	if err := pn.sess.Cmf.WriteControlMessage(&control.PublishNamespaceDoneMessage{Namespace: pn.Namespace}); err != nil {
+		return fmt.Errorf("PublishedNamespace.Close(): Failed to send PUBLISH_NAMESPACE_DONE message: %w", err)
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the namespace ends, by Close or by the peer's PUBLISH_NAMESPACE_CANCEL.
+func (pn *PublishedNamespace) Done() <-chan struct{} {
+	return pn.ended
+}
+
+// Err returns the error code and reason of the peer's PUBLISH_NAMESPACE_CANCEL as a model.MOQT_REQUEST_ERROR,
+// nil while the namespace is published or if it ended with Close.
+func (pn *PublishedNamespace) Err() error {
+	select {
+	case <-pn.ended:
+		if pn.closed {
+			return nil
+		}
+		return pn.err
+	default:
+		return nil
+	}
+}
+
+// Gives up the reservation of a namespace whose PUBLISH_NAMESPACE wasn't accepted.
+func (s *Session) releasePendingNamespace(key string) {
+	s.namespacesMutex.Lock()
+	defer s.namespacesMutex.Unlock()
+	delete(s.pendingNamespaces, key)
+}
+
+func (s *Session) removePublishedNamespace(pn *PublishedNamespace) {
+	s.namespacesMutex.Lock()
+	defer s.namespacesMutex.Unlock()
+
+	// A later publication of the same namespace must not be removed
+	if s.publishedNamespaces[pn.Namespace.Key()] == pn {
+		delete(s.publishedNamespaces, pn.Namespace.Key())
+	}
+}
+
+// Handles PUBLISH_NAMESPACE_CANCEL from the peer, ending the namespace we published.
+func (s *Session) onPublishNamespaceCancel(msg *control.PublishNamespaceCancelMessage) error {
+	s.namespacesMutex.Lock()
+	pn, ok := s.publishedNamespaces[msg.Namespace.Key()]
+	s.namespacesMutex.Unlock()
+
+	if !ok {
+		return nil // We withdrew it in the meantime
+	}
+
+	pn.endOnce.Do(func() {
+		pn.err = model.MOQT_REQUEST_ERROR{RequestID: pn.RequestID, ErrorCode: msg.ErrorCode, ReasonPhrase: msg.ReasonPhrase}
+		s.removePublishedNamespace(pn)
+		close(pn.ended)
+	})
+	return nil
+}
+
+// PublishNamespaceHandler is called for every PUBLISH_NAMESPACE of the peer.
+// The handler MUST answer the request exactly once, with PublishNamespaceRequest.Accept or PublishNamespaceRequest.Reject.
+// It runs on the event loop of the session, so it MUST NOT block, the answer can also be given later from another goroutine.
+type PublishNamespaceHandler func(req *PublishNamespaceRequest)
+
+// HandlePublishNamespace registers the handler for namespaces the peer publishes, replacing the previous one if any.
+// Without a handler, PUBLISH_NAMESPACE is rejected with NOT_SUPPORTED.
+func (s *Session) HandlePublishNamespace(h PublishNamespaceHandler) {
+	s.HandleMessage(control.PUBLISH_NAMESPACE, func(sess *Session, msg control.ControlMessage) error {
+		return sess.onPublishNamespace(msg.(*control.PublishNamespaceMessage), h)
+	})
+}
+
+func (s *Session) onPublishNamespace(pnm *control.PublishNamespaceMessage, h PublishNamespaceHandler) error {
+	an := &AnnouncedNamespace{
+		RequestID:  pnm.RequestID,
+		Namespace:  pnm.Namespace,
+		Parameters: pnm.Parameters,
+		sess:       s,
+		ended:      make(chan struct{}),
+	}
+
+	key := pnm.Namespace.Key()
+	s.namespacesMutex.Lock()
+	_, duplicate := s.announcedNamespaces[key]
+	if !duplicate {
+		s.announcedNamespaces[key] = an
+	}
+	s.namespacesMutex.Unlock()
+
+	if duplicate {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    pnm.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_INTERNAL_ERROR,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Namespace %s is already published", pnm.Namespace.ToString())),
+		}
+	}
+
+	h(&PublishNamespaceRequest{
+		RequestID:  pnm.RequestID,
+		Namespace:  pnm.Namespace,
+		Parameters: pnm.Parameters,
+		an:         an,
+	})
+	return nil
+}
+
+// PublishNamespaceRequest is an incoming PUBLISH_NAMESPACE waiting for an answer.
+type PublishNamespaceRequest struct {
+	RequestID  uint64
+	Namespace  model.MoqtTrackNamespace
+	Parameters []model.MoqtKeyValuePair
+
+	an *AnnouncedNamespace
+
+	answerOnce sync.Once
+}
+
+// Accept answers the request with REQUEST_OK carrying the given parameters, the namespace is tracked until the peer withdraws it.
+// ErrNamespaceWithdrawn is returned if the peer sent PUBLISH_NAMESPACE_DONE before the answer.
+func (req *PublishNamespaceRequest) Accept(params ...model.MoqtKeyValuePair) (*AnnouncedNamespace, error) {
+	var an *AnnouncedNamespace
+	err := fmt.Errorf("PublishNamespaceRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		sess := req.an.sess
+
+		select {
+		case <-req.an.ended:
+			err = ErrNamespaceWithdrawn
+			return
+		default:
+		}
+
+		err = sess.Cmf.WriteControlMessage(&control.RequestOkMessage{RequestID: req.RequestID, Parameters: params})
+		if err != nil {
+			err = fmt.Errorf("PublishNamespaceRequest.Accept(): Failed to send REQUEST_OK message: %w", err)
+			return
+		}
+		an = req.an
+	})
+	return an, err
+}
+
+// Reject answers the request with REQUEST_ERROR.
+func (req *PublishNamespaceRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("PublishNamespaceRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		sess := req.an.sess
+		req.an.end()
+
+		err = sess.RejectRequest(model.MOQT_REQUEST_ERROR{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+	})
+	return err
+}
+
+// AnnouncedNamespace is a namespace the peer published and we accepted.
+type AnnouncedNamespace struct {
+	RequestID  uint64
+	Namespace  model.MoqtTrackNamespace
+	Parameters []model.MoqtKeyValuePair // Parameters of PUBLISH_NAMESPACE
+
+	sess *Session
+
+	endOnce sync.Once
+	ended   chan struct{} // Closed by PUBLISH_NAMESPACE_DONE or Cancel
+}
+
+// Done returns a channel that is closed when the namespace ends, by the peer's PUBLISH_NAMESPACE_DONE or by Cancel.
+// Routing state built on top of the namespace should also be dropped when the session terminates, see Session.Done.
+func (an *AnnouncedNamespace) Done() <-chan struct{} {
+	return an.ended
+}
+
+// Cancel withdraws our acceptance with PUBLISH_NAMESPACE_CANCEL, it has no effect if the namespace already ended.
+func (an *AnnouncedNamespace) Cancel(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	if !an.end() {
+		return nil
+	}
+
+	err := an.sess.Cmf.WriteControlMessage(&control.PublishNamespaceCancelMessage{
+		Namespace:    an.Namespace,
+		ErrorCode:    code,
+		ReasonPhrase: model.NewReasonPhrase(reason),
+	})
+	if err != nil {
+		return fmt.Errorf("AnnouncedNamespace.Cancel(): Failed to send PUBLISH_NAMESPACE_CANCEL message: %w", err)
+	}
+	return an.sess.CompleteIncomingRequest(an.RequestID)
+}
+
+// Stops tracking the namespace, reports whether this call ended it.
+func (an *AnnouncedNamespace) end() bool {
+	first := false
+	an.endOnce.Do(func() {
+		first = true
+
+		s := an.sess
+		s.namespacesMutex.Lock()
+		if s.announcedNamespaces[an.Namespace.Key()] == an {
+			delete(s.announcedNamespaces, an.Namespace.Key())
+		}
+		s.namespacesMutex.Unlock()
+
+		close(an.ended)
+	})
+	return first
+}
+
+// AnnouncedNamespaces returns the namespaces the peer published and we accepted, or didn't answer yet.
+func (s *Session) AnnouncedNamespaces() []*AnnouncedNamespace {
+	s.namespacesMutex.Lock()
+	defer s.namespacesMutex.Unlock()
+
+	namespaces := make([]*AnnouncedNamespace, 0, len(s.announcedNamespaces))
+	for _, an := range s.announcedNamespaces {
+		namespaces = append(namespaces, an)
+	}
+	return namespaces
+}
+
+// Handles PUBLISH_NAMESPACE_DONE from the peer, ending the namespace it published.
+func (s *Session) onPublishNamespaceDone(msg *control.PublishNamespaceDoneMessage) error {
+	s.namespacesMutex.Lock()
+	an, ok := s.announcedNamespaces[msg.Namespace.Key()]
+	s.namespacesMutex.Unlock()
+
+	if !ok {
+		return nil // We cancelled or rejected it in the meantime
+	}
+	if an.end() {
+		return s.CompleteIncomingRequest(an.RequestID)
+	}
+	return nil
+}
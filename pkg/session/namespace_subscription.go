@@ -0,0 +1,480 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"go-moq/pkg/transport"
+	"io"
+	"sync"
+)
+
+// SUBSCRIBE_NAMESPACE asks the peer for the namespaces matching a prefix (Section 9.25)
+// Unlike other requests it opens its own bidirectional stream, the publisher answers on it with REQUEST_OK or REQUEST_ERROR
+// and then keeps sending NAMESPACE and NAMESPACE_DONE as matching namespaces come and go. Either endpoint closes the stream to end it.
+
+// ErrNamespaceSubscriptionEnded is returned when sending on a SUBSCRIBE_NAMESPACE stream that was already closed.
+var ErrNamespaceSubscriptionEnded = errors.New("namespace subscription ended")
+
+// SubscribeNamespace opens a stream for SUBSCRIBE_NAMESPACE and waits for the peer's answer on it.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR, on REQUEST_OK the matching namespaces are delivered through the returned NamespaceSubscription.
+// It blocks until the answer arrives, ctx is done or the session terminates, Run MUST be running.
+func (s *Session) SubscribeNamespace(ctx context.Context, prefix model.MoqtTrackNamespace, params ...model.MoqtKeyValuePair) (*NamespaceSubscription, error) {
+	if err := s.State.checkLocalAuthTokens(params); err != nil {
+		return nil, fmt.Errorf("Session.SubscribeNamespace(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.SubscribeNamespace(): %w", err)
+	}
+
+	stream, err := s.Conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.SubscribeNamespace(): Failed to open the stream: %w", err)
+	}
+	cmf := control.NewControlMessageFactory(stream)
+
+	// Reading the answer doesn't observe ctx on its own, resetting the stream unblocks it
+	stop := context.AfterFunc(ctx, func() {
+		cancelStream(stream)
+	})
+
+	err = s.State.sendWithLocalAuthTokens(params, func() error {
+		return cmf.WriteControlMessage(&control.SubscribeNamespaceMessage{RequestID: requestID, NamespacePrefix: prefix, Parameters: params})
+	})
+	if err != nil {
+		stop()
+		cancelStream(stream)
+		return nil, fmt.Errorf("Session.SubscribeNamespace(): Failed to send SUBSCRIBE_NAMESPACE message: %w", err)
+	}
+
+	msg, err := cmf.ReadControlMessage()
+	if !stop() {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		cancelStream(stream)
+		select {
+		case <-s.closed:
+			return nil, s.Err()
+		default:
+		}
+		return nil, fmt.Errorf("Session.SubscribeNamespace(): Failed to read the answer to SUBSCRIBE_NAMESPACE: %w", err)
+	}
+
+	switch m := msg.(type) {
+	case *control.RequestOkMessage:
+		if m.RequestID != requestID {
+			return nil, s.closeStreamWithViolation(stream, fmt.Sprintf("REQUEST_OK for Request ID %d on the stream of SUBSCRIBE_NAMESPACE %d", m.RequestID, requestID))
+		}
+		sub := &NamespaceSubscription{
+			RequestID:       requestID,
+			NamespacePrefix: prefix,
+			Parameters:      m.Parameters,
+			sess:            s,
+			stream:          stream,
+			cmf:             cmf,
+			notify:          make(chan struct{}, 1),
+			ended:           make(chan struct{}),
+		}
+		go sub.receive()
+		return sub, nil
+	case *control.RequestErrorMessage:
+		stream.Close()
+		return nil, m.ToError()
+	default:
+		return nil, s.closeStreamWithViolation(stream, fmt.Sprintf("Unexpected response (Type: %#X) to SUBSCRIBE_NAMESPACE", uint64(msg.Type())))
+	}
+}
+
+// NamespaceEvent is a namespace that became available (NAMESPACE) or is no longer available (NAMESPACE_DONE).
+type NamespaceEvent struct {
+	Namespace model.MoqtTrackNamespace // The prefix of the subscription followed by the suffix the publisher sent
+	Done      bool                     // false for NAMESPACE, true for NAMESPACE_DONE
+}
+
+// NamespaceSubscription is an accepted SUBSCRIBE_NAMESPACE WE sent.
+type NamespaceSubscription struct {
+	RequestID       uint64
+	NamespacePrefix model.MoqtTrackNamespace
+	Parameters      []model.MoqtKeyValuePair // Parameters of REQUEST_OK
+
+	sess   *Session
+	stream transport.Stream
+	cmf    *control.ControlMessageFactory
+
+	mu     sync.Mutex
+	queue  []NamespaceEvent // Events that arrived but weren't read yet, in arrival order
+	notify chan struct{}    // Signaled when the queue becomes non-empty
+
+	endOnce sync.Once
+	ended   chan struct{} // Closed when the stream ends
+	err     error         // The reason the stream ended, io.EOF if the publisher closed it, valid after ended is closed
+}
+
+// Reads NAMESPACE and NAMESPACE_DONE from the stream until it ends.
+func (ns *NamespaceSubscription) receive() {
+	for {
+		msg, err := ns.cmf.ReadControlMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.EOF // The publisher closed the stream
+			}
+			ns.end(err)
+			return
+		}
+
+		event := NamespaceEvent{}
+		switch m := msg.(type) {
+		case *control.NamespaceMessage:
+			event.Namespace = joinNamespace(ns.NamespacePrefix, m.NamespaceSuffix)
+		case *control.NamespaceDoneMessage:
+			event.Namespace = joinNamespace(ns.NamespacePrefix, m.NamespaceSuffix)
+			event.Done = true
+		default:
+			ns.end(ns.sess.closeStreamWithViolation(ns.stream, fmt.Sprintf("Unexpected message (Type: %#X) on the stream of SUBSCRIBE_NAMESPACE", uint64(msg.Type()))))
+			return
+		}
+
+		ns.mu.Lock()
+		ns.queue = append(ns.queue, event)
+		ns.mu.Unlock()
+
+		select {
+		case ns.notify <- struct{}{}:
+		default: // A signal is already pending
+		}
+	}
+}
+
+func (ns *NamespaceSubscription) end(err error) {
+	ns.endOnce.Do(func() {
+		ns.err = err
+		close(ns.ended)
+	})
+}
+
+// ReadEvent returns the next NAMESPACE or NAMESPACE_DONE of the publisher, in the order they arrived.
+// It blocks until an event arrives, ctx is done or the session terminates.
+// Once the publisher closed the stream and every queued event was read, io.EOF is returned.
+func (ns *NamespaceSubscription) ReadEvent(ctx context.Context) (NamespaceEvent, error) {
+	for {
+		ns.mu.Lock()
+		if len(ns.queue) > 0 {
+			event := ns.queue[0]
+			ns.queue = ns.queue[1:]
+			ns.mu.Unlock()
+			return event, nil
+		}
+		ns.mu.Unlock()
+
+		select {
+		case <-ns.notify:
+		case <-ns.ended:
+			ns.mu.Lock()
+			empty := len(ns.queue) == 0
+			ns.mu.Unlock()
+			if empty {
+				return NamespaceEvent{}, ns.err
+			}
+		case <-ctx.Done():
+			return NamespaceEvent{}, ctx.Err()
+		case <-ns.sess.closed:
+			return NamespaceEvent{}, ns.sess.Err()
+		}
+	}
+}
+
+// Done returns a channel that is closed when the stream ends, by Close or by the publisher.
+func (ns *NamespaceSubscription) Done() <-chan struct{} {
+	return ns.ended
+}
+
+// Close ends the subscription by closing the stream, events that weren't read yet are dropped.
+func (ns *NamespaceSubscription) Close() error {
+	ns.end(ErrNamespaceSubscriptionEnded)
+	ns.stream.CancelRead(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+	if err := ns.stream.Close(); err != nil {
+		return fmt.Errorf("NamespaceSubscription.Close(): Failed to close the stream: %w", err)
+	}
+	return nil
+}
+
+// SubscribeNamespaceHandler is called for every SUBSCRIBE_NAMESPACE of the peer.
+// The handler MUST answer the request exactly once, with SubscribeNamespaceRequest.Accept or SubscribeNamespaceRequest.Reject.
+// It runs on the goroutine reading the stream of the request, the answer can also be given later from another goroutine.
+type SubscribeNamespaceHandler func(req *SubscribeNamespaceRequest)
+
+// HandleSubscribeNamespace registers the handler for namespace subscriptions of the peer, replacing the previous one if any.
+// Without a handler, SUBSCRIBE_NAMESPACE is rejected with NOT_SUPPORTED.
+func (s *Session) HandleSubscribeNamespace(h SubscribeNamespaceHandler) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.subscribeNamespaceHandler = h
+}
+
+// Accepts the bidirectional streams of the peer until the connection is closed, started by Run.
+// The control stream is accepted before, during the handshake, so only SUBSCRIBE_NAMESPACE streams are expected here.
+func (s *Session) receiveBidiStreams() {
+	for {
+		stream, err := s.Conn.AcceptStream(s.Conn.Context())
+		if err != nil {
+			return // The connection is closed, Run reports the reason
+		}
+		go s.handleBidiStream(stream)
+	}
+}
+
+func (s *Session) handleBidiStream(stream transport.Stream) {
+	cmf := control.NewControlMessageFactory(stream)
+	msg, err := cmf.ReadControlMessage()
+	if err != nil {
+		cancelStream(stream) // Reset before it carried a request
+		return
+	}
+
+	// Bidirectional streams MUST NOT begin with any other message type unless negotiated. [Cite: Section 3.3]
+	snm, ok := msg.(*control.SubscribeNamespaceMessage)
+	if !ok {
+		s.closeStreamWithViolation(stream, fmt.Sprintf("Bidirectional stream began with Control Message Type %#X", uint64(msg.Type())))
+		return
+	}
+	if err := s.acceptIncomingRequestID(snm.RequestID); err != nil {
+		cancelStream(stream)
+		s.CloseWithError(err)
+		return
+	}
+	if err := s.State.resolvePeerAuthTokens(&snm.Parameters); err != nil {
+		cancelStream(stream)
+		s.CloseWithError(err)
+		return
+	}
+
+	req := &SubscribeNamespaceRequest{
+		RequestID:       snm.RequestID,
+		NamespacePrefix: snm.NamespacePrefix,
+		Parameters:      snm.Parameters,
+		sess:            s,
+		stream:          stream,
+		cmf:             cmf,
+	}
+
+	if s.sentGoAway() {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED, "Session is going away")
+		return
+	}
+
+	if err := s.authorizeRequest(snm); err != nil {
+		var reqErr model.MOQT_REQUEST_ERROR
+		if !errors.As(err, &reqErr) {
+			cancelStream(stream)
+			s.CloseWithError(err)
+			return
+		}
+		req.Reject(reqErr.ErrorCode, string(reqErr.ReasonPhrase))
+		return
+	}
+
+	s.handlersMutex.Lock()
+	h := s.subscribeNamespaceHandler
+	s.handlersMutex.Unlock()
+
+	if h == nil {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED, fmt.Sprintf("Control Message Type %#X is not supported", uint64(control.SUBSCRIBE_NAMESPACE)))
+		return
+	}
+	h(req)
+}
+
+// SubscribeNamespaceRequest is an incoming SUBSCRIBE_NAMESPACE waiting for an answer.
+type SubscribeNamespaceRequest struct {
+	RequestID       uint64
+	NamespacePrefix model.MoqtTrackNamespace
+	Parameters      []model.MoqtKeyValuePair
+
+	sess   *Session
+	stream transport.Stream
+	cmf    *control.ControlMessageFactory
+
+	answerOnce sync.Once
+}
+
+// Accept answers the request with REQUEST_OK carrying the given parameters,
+// the matching namespaces are then sent through the returned NamespaceSubscriber.
+func (req *SubscribeNamespaceRequest) Accept(params ...model.MoqtKeyValuePair) (*NamespaceSubscriber, error) {
+	var sub *NamespaceSubscriber
+	err := fmt.Errorf("SubscribeNamespaceRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		err = req.cmf.WriteControlMessage(&control.RequestOkMessage{RequestID: req.RequestID, Parameters: params})
+		if err != nil {
+			cancelStream(req.stream)
+			req.sess.CompleteIncomingRequest(req.RequestID)
+			err = fmt.Errorf("SubscribeNamespaceRequest.Accept(): Failed to send REQUEST_OK message: %w", err)
+			return
+		}
+
+		sub = &NamespaceSubscriber{
+			RequestID:       req.RequestID,
+			NamespacePrefix: req.NamespacePrefix,
+			Parameters:      req.Parameters,
+			sess:            req.sess,
+			stream:          req.stream,
+			cmf:             req.cmf,
+			active:          make(map[string]struct{}),
+			ended:           make(chan struct{}),
+		}
+		go sub.watch()
+	})
+	return sub, err
+}
+
+// Reject answers the request with REQUEST_ERROR on its stream and closes the stream.
+func (req *SubscribeNamespaceRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("SubscribeNamespaceRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		err = req.cmf.WriteControlMessage(&control.RequestErrorMessage{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+		if err != nil {
+			cancelStream(req.stream)
+			err = fmt.Errorf("SubscribeNamespaceRequest.Reject(): Failed to send REQUEST_ERROR message: %w", err)
+		} else {
+			req.stream.CancelRead(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+			req.stream.Close()
+		}
+
+		if completeErr := req.sess.CompleteIncomingRequest(req.RequestID); err == nil {
+			err = completeErr
+		}
+	})
+	return err
+}
+
+// NamespaceSubscriber is an accepted SUBSCRIBE_NAMESPACE of the peer, namespaces matching its prefix are sent through it.
+type NamespaceSubscriber struct {
+	RequestID       uint64
+	NamespacePrefix model.MoqtTrackNamespace
+	Parameters      []model.MoqtKeyValuePair // Parameters of SUBSCRIBE_NAMESPACE
+
+	sess   *Session
+	stream transport.Stream
+	cmf    *control.ControlMessageFactory
+
+	mu     sync.Mutex
+	active map[string]struct{} // Namespaces sent with NAMESPACE and not withdrawn yet, keyed by MoqtTrackNamespace.Key()
+
+	endOnce sync.Once
+	ended   chan struct{} // Closed when the stream ends, by Close or by the subscriber
+}
+
+// SendNamespace sends NAMESPACE for a namespace that became available, it MUST begin with the prefix of the subscription.
+func (n *NamespaceSubscriber) SendNamespace(ns model.MoqtTrackNamespace) error {
+	if !ns.HasPrefix(n.NamespacePrefix) {
+		return fmt.Errorf("NamespaceSubscriber.SendNamespace(): Namespace %s doesn't match the prefix %s", ns.ToString(), n.NamespacePrefix.ToString())
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.active[ns.Key()]; ok {
+		return fmt.Errorf("NamespaceSubscriber.SendNamespace(): Namespace %s was already sent", ns.ToString())
+	}
+	if err := n.send(&control.NamespaceMessage{NamespaceSuffix: ns[len(n.NamespacePrefix):]}); err != nil {
+		return fmt.Errorf("NamespaceSubscriber.SendNamespace(): %w", err)
+	}
+	n.active[ns.Key()] = struct{}{}
+	return nil
+}
+
+// SendNamespaceDone sends NAMESPACE_DONE for a namespace previously sent with SendNamespace.
+func (n *NamespaceSubscriber) SendNamespaceDone(ns model.MoqtTrackNamespace) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.active[ns.Key()]; !ok {
+		return fmt.Errorf("NamespaceSubscriber.SendNamespaceDone(): Namespace %s wasn't sent", ns.ToString())
+	}
+	if err := n.send(&control.NamespaceDoneMessage{NamespaceSuffix: ns[len(n.NamespacePrefix):]}); err != nil {
+		return fmt.Errorf("NamespaceSubscriber.SendNamespaceDone(): %w", err)
+	}
+	delete(n.active, ns.Key())
+	return nil
+}
+
+// Writes a message on the stream, n.mu MUST be held.
+func (n *NamespaceSubscriber) send(msg control.ControlMessage) error {
+	select {
+	case <-n.ended:
+		return ErrNamespaceSubscriptionEnded
+	default:
+	}
+	if err := n.cmf.WriteControlMessage(msg); err != nil {
+		return fmt.Errorf("Failed to send %T: %w", msg, err)
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the subscription ends, by Close or by the subscriber closing the stream.
+func (n *NamespaceSubscriber) Done() <-chan struct{} {
+	return n.ended
+}
+
+// Close ends the subscription by closing the stream.
+func (n *NamespaceSubscriber) Close() error {
+	n.stream.CancelRead(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+	return n.end()
+}
+
+// Waits for the subscriber to close the stream, nothing else may follow SUBSCRIBE_NAMESPACE.
+func (n *NamespaceSubscriber) watch() {
+	msg, err := n.cmf.ReadControlMessage()
+	if err == nil {
+		n.sess.closeStreamWithViolation(n.stream, fmt.Sprintf("Unexpected message (Type: %#X) after SUBSCRIBE_NAMESPACE", uint64(msg.Type())))
+	}
+	n.end()
+}
+
+// Closes the stream and completes the request, only the first call has an effect.
+func (n *NamespaceSubscriber) end() error {
+	var err error
+	n.endOnce.Do(func() {
+		n.mu.Lock()
+		close(n.ended)
+		closeErr := n.stream.Close()
+		n.mu.Unlock()
+
+		err = n.sess.CompleteIncomingRequest(n.RequestID)
+		if closeErr != nil {
+			err = fmt.Errorf("NamespaceSubscriber.Close(): Failed to close the stream: %w", closeErr)
+		}
+	})
+	return err
+}
+
+// Resets both directions of a stream that is abandoned.
+func cancelStream(stream transport.Stream) {
+	stream.CancelRead(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+	stream.CancelWrite(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+}
+
+// Resets the stream and terminates the session with a PROTOCOL_VIOLATION, returns the violation.
+func (s *Session) closeStreamWithViolation(stream transport.Stream, reason string) error {
+	cancelStream(stream)
+	err := protocolViolation(reason)
+	s.CloseWithError(err)
+	return err
+}
+
+// Prepends the prefix of a subscription to a suffix of NAMESPACE or NAMESPACE_DONE.
+func joinNamespace(prefix, suffix model.MoqtTrackNamespace) model.MoqtTrackNamespace {
+	ns := make(model.MoqtTrackNamespace, 0, len(prefix)+len(suffix))
+	ns = append(ns, prefix...)
+	return append(ns, suffix...)
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"io"
+	"testing"
+)
+
+func TestSubscribeNamespace(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	prefix := testutil.FullTrackName("", "live").Namespace
+	room1 := testutil.FullTrackName("", "live", "room1").Namespace
+	room2 := testutil.FullTrackName("", "live", "room2").Namespace
+
+	accepted := make(chan *NamespaceSubscriber, 1)
+	server.HandleSubscribeNamespace(func(req *SubscribeNamespaceRequest) {
+		if !req.NamespacePrefix.Equal(prefix) {
+			t.Errorf("SubscribeNamespaceRequest got prefix %s, want %s", req.NamespacePrefix.ToString(), prefix.ToString())
+		}
+		sub, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		accepted <- sub
+	})
+
+	ns, err := client.SubscribeNamespace(ctx, prefix)
+	if err != nil {
+		t.Fatalf("SubscribeNamespace() unexpected error: %v", err)
+	}
+	sub := <-accepted
+
+	if err := sub.SendNamespace(testutil.FullTrackName("", "vod", "room1").Namespace); err == nil {
+		t.Errorf("SendNamespace() of a namespace outside the prefix expected an error, but got none")
+	}
+	if err := sub.SendNamespaceDone(room2); err == nil {
+		t.Errorf("SendNamespaceDone() of a namespace that wasn't sent expected an error, but got none")
+	}
+	for _, n := range []model.MoqtTrackNamespace{room1, room2} {
+		if err := sub.SendNamespace(n); err != nil {
+			t.Fatalf("SendNamespace(%s) unexpected error: %v", n.ToString(), err)
+		}
+	}
+	if err := sub.SendNamespaceDone(room1); err != nil {
+		t.Fatalf("SendNamespaceDone() unexpected error: %v", err)
+	}
+
+	// Requests on the control stream keep working next to the stream of SUBSCRIBE_NAMESPACE
+	if _, err := client.Subscribe(ctx, testutil.FullTrackName("video", "live", "room2")); err == nil {
+		t.Errorf("Subscribe() expected an error without a publisher, but got none")
+	}
+
+	want := []NamespaceEvent{{Namespace: room1}, {Namespace: room2}, {Namespace: room1, Done: true}}
+	for i, w := range want {
+		got, err := ns.ReadEvent(ctx)
+		if err != nil {
+			t.Fatalf("ReadEvent() #%d unexpected error: %v", i, err)
+		}
+		if !got.Namespace.Equal(w.Namespace) || got.Done != w.Done {
+			t.Errorf("ReadEvent() #%d got = {%s %v}, want {%s %v}", i, got.Namespace.ToString(), got.Done, w.Namespace.ToString(), w.Done)
+		}
+	}
+
+	sub.Close()
+	if _, err := ns.ReadEvent(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadEvent() after the publisher closed the stream got error = %v, want io.EOF", err)
+	}
+	if err := sub.SendNamespace(room1); !errors.Is(err, ErrNamespaceSubscriptionEnded) {
+		t.Errorf("SendNamespace() after Close got error = %v, want ErrNamespaceSubscriptionEnded", err)
+	}
+
+	// Closed by the subscriber
+	ns, err = client.SubscribeNamespace(ctx, prefix)
+	if err != nil {
+		t.Fatalf("Second SubscribeNamespace() unexpected error: %v", err)
+	}
+	sub = <-accepted
+	ns.Close()
+
+	select {
+	case <-sub.Done():
+	case <-ctx.Done():
+		t.Fatalf("NamespaceSubscriber didn't end after the subscriber closed the stream")
+	}
+}
+
+func TestSubscribeNamespaceNotSupported(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, _ := newSessionPair(t)
+
+	_, err := client.SubscribeNamespace(ctx, model.MoqtTrackNamespace{})
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Errorf("SubscribeNamespace() error = %v, want NOT_SUPPORTED", err)
+	}
+}
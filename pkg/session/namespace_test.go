@@ -0,0 +1,116 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"testing"
+)
+
+func TestPublishNamespace(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	ns := testutil.FullTrackName("", "live", "room1").Namespace
+
+	accepted := make(chan *AnnouncedNamespace, 2)
+	server.HandlePublishNamespace(func(req *PublishNamespaceRequest) {
+		go func() {
+			if !req.Namespace.Equal(ns) {
+				t.Errorf("PublishNamespaceRequest got namespace %s, want %s", req.Namespace.ToString(), ns.ToString())
+			}
+			an, err := req.Accept()
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+			}
+			accepted <- an
+		}()
+	})
+
+	// Withdrawn by the publisher
+	pn, err := client.PublishNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("PublishNamespace() unexpected error: %v", err)
+	}
+	if _, err := client.PublishNamespace(ctx, ns); err == nil {
+		t.Errorf("Second PublishNamespace() of the same namespace expected an error, but got none")
+	}
+	an := <-accepted
+	if got := server.AnnouncedNamespaces(); len(got) != 1 || got[0] != an {
+		t.Errorf("AnnouncedNamespaces() got = %v, want the accepted namespace", got)
+	}
+
+	pn.Close()
+	select {
+	case <-an.Done():
+	case <-ctx.Done():
+		t.Fatalf("Namespace didn't end after PUBLISH_NAMESPACE_DONE")
+	}
+	if got := server.AnnouncedNamespaces(); len(got) != 0 {
+		t.Errorf("AnnouncedNamespaces() after PUBLISH_NAMESPACE_DONE got %d namespaces, want 0", len(got))
+	}
+	if pn.Err() != nil {
+		t.Errorf("Err() after Close got = %v, want nil", pn.Err())
+	}
+
+	// Cancelled by the receiver
+	pn, err = client.PublishNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("PublishNamespace() after Close unexpected error: %v", err)
+	}
+	an = <-accepted
+	an.Cancel(model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED, "Token expired")
+
+	select {
+	case <-pn.Done():
+	case <-ctx.Done():
+		t.Fatalf("Namespace didn't end after PUBLISH_NAMESPACE_CANCEL")
+	}
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(pn.Err(), &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED || reqErr.ReasonPhrase != "Token expired" {
+		t.Errorf("Err() after PUBLISH_NAMESPACE_CANCEL got = %v, want UNAUTHORIZED", pn.Err())
+	}
+}
+
+func TestPublishNamespaceRejected(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+
+	ns := testutil.FullTrackName("", "live").Namespace
+
+	requests := make(chan *PublishNamespaceRequest, 2)
+	server.HandlePublishNamespace(func(req *PublishNamespaceRequest) {
+		requests <- req
+	})
+	publish := func() <-chan error {
+		result := make(chan error, 1)
+		go func() {
+			_, err := client.PublishNamespace(ctx, ns)
+			result <- err
+		}()
+		return result
+	}
+
+	for i := 0; i < 2; i++ {
+		result := publish()
+		req := <-requests
+
+		// While waiting for the answer the namespace can't be published again
+		if _, err := client.PublishNamespace(ctx, ns); err == nil {
+			t.Errorf("PublishNamespace() while the first waits for its answer expected an error, but got none")
+		}
+
+		// The rejection releases the namespace for the next iteration
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED, "Not your namespace")
+		err := <-result
+		var reqErr model.MOQT_REQUEST_ERROR
+		if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED || reqErr.ReasonPhrase != "Not your namespace" {
+			t.Fatalf("PublishNamespace() #%d error = %v, want UNAUTHORIZED", i, err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Errorf("The concurrent PublishNamespace() sent PUBLISH_NAMESPACE")
+	}
+	if got := server.AnnouncedNamespaces(); len(got) != 0 {
+		t.Errorf("AnnouncedNamespaces() after rejecting got %d namespaces, want 0", len(got))
+	}
+}
@@ -0,0 +1,235 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"sync"
+)
+
+// PUBLISH lets a publisher push a track to the peer without waiting for SUBSCRIBE (Section 9.13)
+// The publisher assigns the Track Alias in PUBLISH, the peer answers with PUBLISH_OK carrying its subscription preferences
+// (Forward, Subscriber Priority, Group Order, Subscription Filter) or REQUEST_ERROR. Either side of the session may publish.
+
+// PublishOption customizes the PUBLISH message sent by Session.Publish.
+type PublishOption func(*control.PublishMessage)
+
+// 0x1 ascending, 0x2 descending, the order the publisher delivers groups in.
+func WithPublishGroupOrder(order uint64) PublishOption {
+	return func(pm *control.PublishMessage) {
+		pm.Parameters = append(pm.Parameters, uintParam(control.ParamGroupOrder, order))
+	}
+}
+
+// Attaches an AUTHORIZATION_TOKEN, see WithAuthToken.
+func WithPublishAuthToken(t control.AuthToken) PublishOption {
+	return func(pm *control.PublishMessage) {
+		pm.Parameters = append(pm.Parameters, t.ToParam())
+	}
+}
+
+// Appends arbitrary parameters, e.g. AUTHORIZATION_TOKEN, LARGEST_OBJECT or EXPIRES.
+func WithPublishParameters(params ...model.MoqtKeyValuePair) PublishOption {
+	return func(pm *control.PublishMessage) {
+		pm.Parameters = append(pm.Parameters, params...)
+	}
+}
+
+// Publish sends PUBLISH for the track and waits for the peer's answer.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR, on PUBLISH_OK the objects of the track are written through the returned TrackWriter,
+// which honors the Forward flag and Subscription Filter of the peer. Closing the writer sends PUBLISH_DONE.
+// It blocks until the answer arrives, ctx is done or the session terminates, Run MUST be running.
+func (s *Session) Publish(ctx context.Context, ftn model.MoqtFullTrackName, opts ...PublishOption) (*TrackWriter, error) {
+	pm := &control.PublishMessage{FullTrackName: ftn}
+	for _, opt := range opts {
+		opt(pm)
+	}
+
+	if err := s.State.checkLocalAuthTokens(pm.Parameters); err != nil {
+		return nil, fmt.Errorf("Session.Publish(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.Publish(): %w", err)
+	}
+	pm.RequestID = requestID
+	pm.TrackAlias = s.AllocateTrackAlias()
+	largest, err := largestObjectFromParams(pm.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("Session.Publish(): %w", err)
+	}
+
+	var (
+		mu        sync.Mutex
+		abandoned bool // Whether we gave up waiting for the answer
+	)
+	answer := make(chan *TrackWriter, 1)
+	failed := make(chan error, 1)
+
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.PublishOkMessage:
+			// PUBLISH_OK carries the same preferences as a SUBSCRIBE would
+			req, err := newSubscribeRequest(nil, &control.SubscribeMessage{RequestID: requestID, FullTrackName: ftn, Parameters: m.Parameters})
+			if err != nil {
+				return err
+			}
+			w := newTrackWriter(s, nil, req, pm.TrackAlias, largest)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if abandoned {
+				// The peer already subscribed, it must learn that nothing will follow
+				return w.CloseWithStatus(control.PublishDoneSubscriptionEnded, "Publisher gave up on the track")
+			}
+			s.addTrackWriter(w)
+			answer <- w
+		case *control.RequestErrorMessage:
+			failed <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to PUBLISH", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(pm.Parameters, func() error {
+		return s.Cmf.WriteControlMessage(pm)
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		return nil, fmt.Errorf("Session.Publish(): Failed to send PUBLISH message: %w", err)
+	}
+
+	select {
+	case w := <-answer:
+		return w, nil
+	case err := <-failed:
+		return nil, err
+	case <-ctx.Done():
+		mu.Lock()
+		abandoned = true
+		mu.Unlock()
+
+		// The answer might have been handled right before we gave up
+		select {
+		case w := <-answer:
+			w.CloseWithStatus(control.PublishDoneSubscriptionEnded, "Publisher gave up on the track")
+		default:
+		}
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, s.Err()
+	}
+}
+
+// PublishRequestHandler is called for every PUBLISH of the peer.
+// The handler MUST answer the request exactly once, with PublishRequest.Accept or PublishRequest.Reject.
+// It runs on the event loop of the session, so it MUST NOT block, the answer can also be given later from another goroutine.
+type PublishRequestHandler func(req *PublishRequest)
+
+// HandlePublish registers the handler for tracks the peer pushes with PUBLISH, replacing the previous one if any.
+// Without a handler, PUBLISH is rejected with NOT_SUPPORTED.
+func (s *Session) HandlePublish(h PublishRequestHandler) {
+	s.HandleMessage(control.PUBLISH, func(sess *Session, msg control.ControlMessage) error {
+		return sess.onPublish(msg.(*control.PublishMessage), h)
+	})
+}
+
+func (s *Session) onPublish(pm *control.PublishMessage, h PublishRequestHandler) error {
+	groupOrder, err := groupOrderFromParams(pm.Parameters)
+	if err != nil {
+		return err
+	}
+	largest, err := largestObjectFromParams(pm.Parameters)
+	if err != nil {
+		return err
+	}
+
+	// Objects may arrive before the application answers, they are queued in the subscription
+	sub := newSubscription(s, pm.RequestID, pm.FullTrackName)
+	sub.Parameters = pm.Parameters
+	sub.mu.Lock()
+	err = sub.register(pm.TrackAlias)
+	sub.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.addSubscription(sub)
+
+	h(&PublishRequest{
+		RequestID:     pm.RequestID,
+		FullTrackName: pm.FullTrackName,
+		TrackAlias:    pm.TrackAlias,
+		GroupOrder:    groupOrder,
+		Parameters:    pm.Parameters,
+		largest:       largest,
+		sub:           sub,
+	})
+	return nil
+}
+
+// PublishRequest is an incoming PUBLISH waiting for an answer.
+type PublishRequest struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	TrackAlias    uint64
+	GroupOrder    uint64 // 0x0 if the publisher didn't specify it, 0x1 ascending, 0x2 descending
+	Parameters    []model.MoqtKeyValuePair
+
+	largest *model.MoqtLocation // The LARGEST_OBJECT of the PUBLISH, nil if the track has no objects yet
+	sub     *Subscription
+
+	answerOnce sync.Once
+}
+
+// Accept answers the request with PUBLISH_OK, the options set the subscriber's preferences just like for Session.Subscribe.
+// The objects of the track are delivered through the returned Subscription.
+func (req *PublishRequest) Accept(opts ...SubscribeOption) (*Subscription, error) {
+	sm := &control.SubscribeMessage{}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	filter, err := sm.Filter()
+	if err != nil {
+		return nil, fmt.Errorf("PublishRequest.Accept(): %w", err)
+	}
+
+	var sub *Subscription
+	err = fmt.Errorf("PublishRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		err = req.sub.sess.Cmf.WriteControlMessage(&control.PublishOkMessage{
+			RequestID:  req.RequestID,
+			Parameters: sm.Parameters,
+		})
+		if err != nil {
+			err = fmt.Errorf("PublishRequest.Accept(): Failed to send PUBLISH_OK message: %w", err)
+			return
+		}
+
+		req.sub.mu.Lock()
+		req.sub.filter = filter
+		req.sub.start = filter.Start(req.largest)
+		req.sub.mu.Unlock()
+		sub = req.sub
+	})
+	return sub, err
+}
+
+// Reject answers the request with REQUEST_ERROR, objects that already arrived are dropped.
+func (req *PublishRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("PublishRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		req.sub.reject() // Unregisters the Track Alias
+
+		err = req.sub.sess.RejectRequest(model.MOQT_REQUEST_ERROR{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+	})
+	return err
+}
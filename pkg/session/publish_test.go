@@ -0,0 +1,107 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+	"testing"
+)
+
+func TestPublishEndToEnd(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("camera1", "ingest")
+
+	requests := make(chan *PublishRequest, 1)
+	server.HandlePublish(func(req *PublishRequest) { requests <- req })
+
+	go func() {
+		req := <-requests
+		if !req.FullTrackName.Equal(track) {
+			t.Errorf("PublishRequest got track %v, want %v", req.FullTrackName, track)
+		}
+		req.Accept(WithSubscriberPriority(7))
+	}()
+
+	w, err := client.Publish(ctx, track, WithPublishGroupOrder(0x1))
+	if err != nil {
+		t.Fatalf("Publish() unexpected error: %v", err)
+	}
+
+	server.subscriptionsMutex.Lock()
+	sub := server.subscriptions[w.RequestID]
+	server.subscriptionsMutex.Unlock()
+	if sub == nil {
+		t.Fatalf("No subscription for the accepted PUBLISH")
+	}
+
+	obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: 0, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("frame")}
+	if err := w.WriteObject(obj); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if got, err := sub.ReadObject(ctx); err != nil || string(got.Payload) != "frame" || !got.FullTrackName.Equal(track) {
+		t.Fatalf("ReadObject() got = %+v, %v", got, err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadObject() after PUBLISH_DONE error = %v, want io.EOF", err)
+	}
+	done := sub.PublishDone()
+	if done == nil || done.StatusCode != control.PublishDoneTrackEnded || done.StreamCount != 1 {
+		t.Errorf("PublishDone() got = %+v, want TRACK_ENDED with 1 stream", done)
+	}
+}
+
+func TestPublishForwardOff(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+
+	accepted := make(chan *Subscription, 1)
+	server.HandlePublish(func(req *PublishRequest) {
+		go func() {
+			sub, err := req.Accept(WithForward(false))
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+			}
+			accepted <- sub
+		}()
+	})
+
+	w, err := client.Publish(ctx, testutil.FullTrackName("camera1", "ingest"))
+	if err != nil {
+		t.Fatalf("Publish() unexpected error: %v", err)
+	}
+	w.WriteObject(&model.MoqtObject{ObjectForwardingPreference: model.Subgroup, Payload: []byte("dropped")})
+
+	w.mu.Lock()
+	streams := w.streamCount
+	w.mu.Unlock()
+	if streams != 0 {
+		t.Errorf("Objects were sent although the subscriber turned Forward off")
+	}
+
+	// The subscription of a PUBLISH is updated just like one of a SUBSCRIBE
+	sub := <-accepted
+	if err := sub.Update(ctx, WithForward(true)); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if !w.Forward() {
+		t.Errorf("Forward() after Update() got = false, want true")
+	}
+}
+
+func TestPublishNotSupported(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, _ := newSessionPair(t)
+
+	_, err := client.Publish(ctx, testutil.FullTrackName("camera1", "ingest"))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Errorf("Publish() error = %v, want NOT_SUPPORTED", err)
+	}
+}
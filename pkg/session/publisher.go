@@ -0,0 +1,583 @@
+package session
+
+import (
+	"fmt"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"sync"
+)
+
+// SubscribeRequestHandler is called for every SUBSCRIBE of the peer to a track the handler was registered for.
+// The handler MUST answer the request exactly once, with SubscribeRequest.Accept or SubscribeRequest.Reject.
+// It runs on the event loop of the session, so it MUST NOT block, the answer can also be given later from another goroutine.
+type SubscribeRequestHandler func(req *SubscribeRequest)
+
+// Publisher serves the tracks the application publishes on a session, it answers incoming SUBSCRIBE requests
+// by routing them to the handler registered for the track, or for the longest matching namespace prefix.
+type Publisher struct {
+	sess *Session
+
+	mu            sync.Mutex
+	tracks        map[string]SubscribeRequestHandler // Handlers of single tracks, keyed by MoqtFullTrackName.Key()
+	namespaces    map[string]namespaceHandler        // Handlers of whole namespaces, keyed by MoqtTrackNamespace.Key()
+	subscriptions map[uint64]*TrackWriter            // Accepted subscriptions that are still open, keyed by Request ID
+	fetchHandler  FetchRequestHandler                // Handler of all fetches, nil if fetches aren't supported
+	fetches       map[uint64]*FetchRequest           // Fetches that didn't end yet, keyed by Request ID
+
+	trackStatusHandler TrackStatusRequestHandler // Handler of all TRACK_STATUS requests, nil if they aren't supported
+}
+
+type namespaceHandler struct {
+	prefix model.MoqtTrackNamespace
+	h      SubscribeRequestHandler
+}
+
+// NewPublisher creates a publisher and registers it as the SUBSCRIBE, FETCH and TRACK_STATUS handler of the session.
+func NewPublisher(sess *Session) *Publisher {
+	p := &Publisher{
+		sess:          sess,
+		tracks:        make(map[string]SubscribeRequestHandler),
+		namespaces:    make(map[string]namespaceHandler),
+		subscriptions: make(map[uint64]*TrackWriter),
+		fetches:       make(map[uint64]*FetchRequest),
+	}
+	sess.HandleMessage(control.SUBSCRIBE, p.onSubscribe)
+	sess.HandleMessage(control.FETCH, p.onFetch)
+	sess.HandleMessage(control.FETCH_CANCEL, p.onFetchCancel)
+	sess.HandleMessage(control.TRACK_STATUS, p.onTrackStatus)
+	return p
+}
+
+// HandleTrack registers the handler for subscriptions to a single track, replacing the previous one if any.
+// Track handlers take precedence over namespace handlers.
+func (p *Publisher) HandleTrack(ftn model.MoqtFullTrackName, h SubscribeRequestHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracks[ftn.Key()] = h
+}
+
+// HandleNamespace registers the handler for subscriptions to any track whose namespace starts with prefix.
+// When several prefixes match, the longest one wins.
+func (p *Publisher) HandleNamespace(prefix model.MoqtTrackNamespace, h SubscribeRequestHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.namespaces[prefix.Key()] = namespaceHandler{prefix: prefix, h: h}
+}
+
+// Returns the handler responsible for the track, ok is false if nobody publishes it.
+func (p *Publisher) lookup(ftn model.MoqtFullTrackName) (SubscribeRequestHandler, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if h, ok := p.tracks[ftn.Key()]; ok {
+		return h, true
+	}
+
+	var best *namespaceHandler
+	for _, nh := range p.namespaces {
+		if !ftn.Namespace.HasPrefix(nh.prefix) {
+			continue
+		}
+		if best == nil || len(nh.prefix) > len(best.prefix) {
+			best = &nh
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.h, true
+}
+
+func (p *Publisher) onSubscribe(sess *Session, msg control.ControlMessage) error {
+	sm := msg.(*control.SubscribeMessage)
+
+	req, err := newSubscribeRequest(p, sm)
+	if err != nil {
+		return err
+	}
+
+	h, ok := p.lookup(sm.FullTrackName)
+	if !ok {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    sm.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Track %s is not published", sm.FullTrackName.ToString())),
+		}
+	}
+
+	h(req)
+	return nil
+}
+
+// SubscribeRequest is an incoming SUBSCRIBE waiting for an answer.
+type SubscribeRequest struct {
+	RequestID          uint64
+	FullTrackName      model.MoqtFullTrackName
+	Filter             control.SubscriptionFilter
+	SubscriberPriority uint8  // 128 if the subscriber didn't specify it
+	GroupOrder         uint64 // 0x0 if the subscriber left it to the publisher, 0x1 ascending, 0x2 descending
+	Forward            bool   // Whether objects should be sent at all, true if the subscriber didn't specify it
+	Parameters         []model.MoqtKeyValuePair
+
+	pub *Publisher
+
+	answerOnce sync.Once
+}
+
+// Defaults of the version-specific parameters, used when the subscriber omits them (Section 9.2.1)
+const (
+	defaultSubscriberPriority = 128
+	groupOrderDescending      = 0x2
+)
+
+func newSubscribeRequest(p *Publisher, sm *control.SubscribeMessage) (*SubscribeRequest, error) {
+	filter, err := sm.Filter()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &SubscribeRequest{
+		RequestID:     sm.RequestID,
+		FullTrackName: sm.FullTrackName,
+		Filter:        filter,
+		Forward:       true,
+		Parameters:    sm.Parameters,
+		pub:           p,
+	}
+
+	if req.SubscriberPriority, err = subscriberPriorityFromParams(sm.Parameters); err != nil {
+		return nil, err
+	}
+	if req.GroupOrder, err = groupOrderFromParams(sm.Parameters); err != nil {
+		return nil, err
+	}
+	if param, ok := control.FindParam(sm.Parameters, control.ParamForward); ok {
+		if param.ValueUInt64 > 1 {
+			return nil, protocolViolation(fmt.Sprintf("Invalid FORWARD parameter: %d", param.ValueUInt64))
+		}
+		req.Forward = param.ValueUInt64 == 1
+	}
+	return req, nil
+}
+
+// Extracts the SUBSCRIBER_PRIORITY parameter, defaultSubscriberPriority is returned if it is absent.
+func subscriberPriorityFromParams(params []model.MoqtKeyValuePair) (uint8, error) {
+	param, ok := control.FindParam(params, control.ParamSubscriberPriority)
+	if !ok {
+		return defaultSubscriberPriority, nil
+	}
+	if param.ValueUInt64 > 255 {
+		return 0, protocolViolation("SUBSCRIBER_PRIORITY parameter is larger than 255")
+	}
+	return uint8(param.ValueUInt64), nil
+}
+
+// Extracts the GROUP_ORDER parameter, 0x0 (publisher's choice) is returned if it is absent.
+func groupOrderFromParams(params []model.MoqtKeyValuePair) (uint64, error) {
+	param, ok := control.FindParam(params, control.ParamGroupOrder)
+	if !ok {
+		return 0, nil
+	}
+	if param.ValueUInt64 > groupOrderDescending {
+		return 0, protocolViolation(fmt.Sprintf("Invalid GROUP_ORDER parameter: %d", param.ValueUInt64))
+	}
+	return param.ValueUInt64, nil
+}
+
+// Extracts the LARGEST_OBJECT parameter, nil is returned if it is absent.
+func largestObjectFromParams(params []model.MoqtKeyValuePair) (*model.MoqtLocation, error) {
+	loc, ok, err := control.LargestObjectFromParams(params)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &loc, nil
+}
+
+func protocolViolation(reason string) model.MOQT_SESSION_TERMINATION_ERROR {
+	return model.MOQT_SESSION_TERMINATION_ERROR{
+		ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+		ReasonPhrase: model.NewReasonPhrase(reason),
+	}
+}
+
+// Accept answers the request with SUBSCRIBE_OK carrying the given parameters (e.g. LARGEST_OBJECT, EXPIRES)
+// and returns the writer the objects of the track are delivered through.
+func (req *SubscribeRequest) Accept(params ...model.MoqtKeyValuePair) (*TrackWriter, error) {
+	largest, err := largestObjectFromParams(params)
+	if err != nil {
+		return nil, fmt.Errorf("SubscribeRequest.Accept(): %w", err)
+	}
+
+	var w *TrackWriter
+	err = fmt.Errorf("SubscribeRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		p := req.pub
+		w = newTrackWriter(p.sess, p, req, p.sess.AllocateTrackAlias(), largest)
+
+		// The writer is known before the subscriber can react to SUBSCRIBE_OK
+		p.mu.Lock()
+		p.subscriptions[req.RequestID] = w
+		p.mu.Unlock()
+		p.sess.addTrackWriter(w)
+
+		err = p.sess.Cmf.WriteControlMessage(&control.SubscribeOkMessage{
+			RequestID:  req.RequestID,
+			TrackAlias: w.TrackAlias,
+			Parameters: params,
+		})
+		if err != nil {
+			p.mu.Lock()
+			delete(p.subscriptions, req.RequestID)
+			p.mu.Unlock()
+			p.sess.removeTrackWriter(req.RequestID)
+			w, err = nil, fmt.Errorf("SubscribeRequest.Accept(): Failed to send SUBSCRIBE_OK message: %w", err)
+		}
+	})
+	return w, err
+}
+
+// Reject answers the request with REQUEST_ERROR.
+func (req *SubscribeRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("SubscribeRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		err = req.pub.sess.RejectRequest(model.MOQT_REQUEST_ERROR{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+	})
+	return err
+}
+
+// Identifies an open subgroup stream of a track
+type subgroupKey struct {
+	groupId    uint64
+	subgroupId uint64
+}
+
+// TrackWriter delivers the objects of a track to the subscriber, for an accepted SUBSCRIBE or a PUBLISH the peer accepted.
+// Objects with the Subgroup forwarding preference are written to a unidirectional stream per subgroup,
+// objects with the Datagram forwarding preference are sent as OBJECT_DATAGRAMs.
+// It is safe for concurrent use, writes are serialized.
+type TrackWriter struct {
+	RequestID     uint64 // The Request ID of the SUBSCRIBE, or of our PUBLISH
+	TrackAlias    uint64
+	FullTrackName model.MoqtFullTrackName
+
+	sess *Session
+	pub  *Publisher // nil for tracks pushed with Session.Publish
+
+	// writeMu serializes the writes and is held across the stream I/O, mu guards the state below and is never held across I/O,
+	// so UNSUBSCRIBE and REQUEST_UPDATE, handled on the event loop, aren't stalled by a slow subscriber.
+	writeMu            sync.Mutex
+	mu                 sync.Mutex
+	filter             control.SubscriptionFilter
+	start              *model.MoqtLocation // Where the subscription began, nil until the LARGEST_OBJECT we answered with or the first object written tells
+	forward            bool
+	subscriberPriority uint8
+	subgroups          map[subgroupKey]*message.SubgroupWriter // Subgroup streams that are still open
+	streamCount        uint64                                  // Data streams opened so far, reported in PUBLISH_DONE
+	closed             bool
+	done               chan struct{} // Closed when the subscription ends
+}
+
+// largest is the LARGEST_OBJECT the subscription was accepted with, nil if there was none.
+func newTrackWriter(sess *Session, p *Publisher, req *SubscribeRequest, alias uint64, largest *model.MoqtLocation) *TrackWriter {
+	w := &TrackWriter{
+		RequestID:          req.RequestID,
+		TrackAlias:         alias,
+		FullTrackName:      req.FullTrackName,
+		sess:               sess,
+		pub:                p,
+		filter:             req.Filter,
+		forward:            req.Forward,
+		subscriberPriority: req.SubscriberPriority,
+		subgroups:          make(map[subgroupKey]*message.SubgroupWriter),
+		done:               make(chan struct{}),
+	}
+	if largest != nil || req.Filter.Absolute() {
+		start := req.Filter.Start(largest)
+		w.start = &start
+	}
+	return w
+}
+
+// Filter returns the subscription filter the subscriber asked for, narrowed by its REQUEST_UPDATEs.
+func (w *TrackWriter) Filter() control.SubscriptionFilter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.filter
+}
+
+// Forward reports whether the subscriber currently wants objects, it can be toggled with REQUEST_UPDATE.
+func (w *TrackWriter) Forward() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.forward
+}
+
+// SubscriberPriority returns the priority the subscriber currently gives the track, 128 if it didn't specify one.
+func (w *TrackWriter) SubscriberPriority() uint8 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.subscriberPriority
+}
+
+// Reports whether the object at loc is requested by the subscriber.
+// Only the absolute filters can be checked here, where a Largest Object or Next Group Start subscription begins
+// is only known by the application, which is expected to start writing from there.
+// Must be called with w.mu held
+func (w *TrackWriter) wanted(loc model.MoqtLocation) bool {
+	if !w.forward {
+		return false
+	}
+	switch w.filter.Type {
+	case control.FilterAbsoluteStart:
+		return !loc.LessThan(w.filter.StartLocation)
+	case control.FilterAbsoluteRange:
+		return !loc.LessThan(w.filter.StartLocation) && loc.GroupId <= w.filter.EndGroup
+	}
+	return true
+}
+
+// WriteObject delivers the object according to its forwarding preference.
+// Objects outside of the subscription filter, or all objects while Forward is off, are silently dropped.
+// An object with the EndOfGroup or EndOfTrack status finishes its subgroup stream.
+func (w *TrackWriter) WriteObject(obj *model.MoqtObject) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return w.closedError()
+	}
+	if !w.wanted(obj.Location) {
+		w.mu.Unlock()
+		return nil
+	}
+	if w.start == nil {
+		loc := obj.Location
+		w.start = &loc
+	}
+	w.mu.Unlock()
+
+	switch obj.ObjectForwardingPreference {
+	case model.Datagram:
+		return w.writeDatagram(obj)
+	case model.Subgroup:
+		return w.writeToSubgroup(obj)
+	default:
+		return fmt.Errorf("TrackWriter.WriteObject(): unknown forwarding preference: %d", obj.ObjectForwardingPreference)
+	}
+}
+
+func (w *TrackWriter) writeDatagram(obj *model.MoqtObject) error {
+	opts := []message.ObjectDatagramOption{
+		message.WithObjectId(obj.Location.ObjectId),
+		message.WithPublisherPriority(obj.PublisherPriority),
+	}
+	if len(obj.ExtensionHeaders) > 0 {
+		opts = append(opts, message.WithExtensions(obj.ExtensionHeaders))
+	}
+	if obj.ObjectStatus != model.Normal {
+		opts = append(opts, message.WithStatus(obj.ObjectStatus))
+	} else {
+		opts = append(opts, message.WithPayload(obj.Payload))
+	}
+
+	dg, err := message.NewObjectDatagram(w.TrackAlias, obj.Location.GroupId, opts...)
+	if err != nil {
+		return fmt.Errorf("TrackWriter.WriteObject(): %w", err)
+	}
+	return w.sess.SendObjectDatagram(dg)
+}
+
+func (w *TrackWriter) closedError() error {
+	return fmt.Errorf("TrackWriter.WriteObject(): subscription %d is closed", w.RequestID)
+}
+
+// Must be called with w.writeMu held. The subscription can end while the stream is written to, the streams are reset by end then.
+func (w *TrackWriter) writeToSubgroup(obj *model.MoqtObject) error {
+	key := subgroupKey{groupId: obj.Location.GroupId, subgroupId: obj.SubgroupID}
+
+	w.mu.Lock()
+	sw, ok := w.subgroups[key]
+	w.mu.Unlock()
+
+	if !ok {
+		var err error
+		sw, err = w.openSubgroup(obj)
+		if err != nil {
+			return err
+		}
+
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			sw.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+			return w.closedError()
+		}
+		w.subgroups[key] = sw
+		w.streamCount++
+		w.mu.Unlock()
+	}
+
+	if err := sw.WriteObject(obj); err != nil {
+		w.forgetSubgroup(key, sw)
+		sw.Cancel(resetCodeFor(err))
+		return fmt.Errorf("TrackWriter.WriteObject(): %w", streamResetError(err))
+	}
+
+	// Nothing can follow these objects in the subgroup
+	if obj.ObjectStatus == model.EndOfGroup || obj.ObjectStatus == model.EndOfTrack {
+		if !w.forgetSubgroup(key, sw) {
+			return w.closedError() // end reset the stream meanwhile
+		}
+		return sw.Close()
+	}
+	return nil
+}
+
+// Removes the subgroup stream from the open ones, false if end already took it.
+func (w *TrackWriter) forgetSubgroup(key subgroupKey, sw *message.SubgroupWriter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.subgroups[key] != sw {
+		return false
+	}
+	delete(w.subgroups, key)
+	return true
+}
+
+func (w *TrackWriter) openSubgroup(obj *model.MoqtObject) (*message.SubgroupWriter, error) {
+	sess := w.sess
+
+	// Extensions are always enabled, since it can't be known whether later objects of the subgroup will carry any
+	header, err := message.NewSubgroupHeader(w.TrackAlias, obj.Location.GroupId,
+		message.WithSubgroupId(obj.SubgroupID),
+		message.WithSubgroupPublisherPriority(obj.PublisherPriority),
+		message.WithSubgroupExtensions(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("TrackWriter.WriteObject(): %w", err)
+	}
+
+	stream, err := sess.Conn.OpenUniStreamSync(sess.Conn.Context())
+	if err != nil {
+		return nil, fmt.Errorf("TrackWriter.WriteObject(): Failed to open subgroup stream: %w", err)
+	}
+
+	sw, err := message.NewSubgroupWriter(stream, header)
+	if err != nil {
+		stream.CancelWrite(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_INTERNAL_ERROR))
+		return nil, fmt.Errorf("TrackWriter.WriteObject(): %w", err)
+	}
+	return sw, nil
+}
+
+// CloseGroup gracefully finishes every open subgroup stream of the group, later objects of the group open new streams.
+func (w *TrackWriter) CloseGroup(groupId uint64) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	var group []*message.SubgroupWriter
+	for key, sw := range w.subgroups {
+		if key.groupId != groupId {
+			continue
+		}
+		delete(w.subgroups, key)
+		group = append(group, sw)
+	}
+	w.mu.Unlock()
+
+	var firstErr error
+	for _, sw := range group {
+		if err := sw.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close finishes every open subgroup stream and ends the subscription with PUBLISH_DONE (TRACK_ENDED).
+// For a SUBSCRIBE of the peer, this completes the request.
+func (w *TrackWriter) Close() error {
+	return w.CloseWithStatus(control.PublishDoneTrackEnded, "Track ended")
+}
+
+// CloseWithStatus is like Close, but reports the given status code and reason in PUBLISH_DONE.
+func (w *TrackWriter) CloseWithStatus(code control.PublishDoneStatusCode, reason string) error {
+	return w.end(code, reason, false)
+}
+
+// Done is closed once the subscription ended, by Close or by the subscriber's UNSUBSCRIBE.
+func (w *TrackWriter) Done() <-chan struct{} {
+	return w.done
+}
+
+// Ends the subscription with PUBLISH_DONE. The open subgroup streams are finished gracefully,
+// or reset with CANCELLED if the subscriber isn't interested in the rest of them anymore.
+// Finishing them waits for the write in progress, so no object is cut short, resetting them doesn't wait,
+// it fails the write in progress instead, which keeps the event loop going when UNSUBSCRIBE arrives during a stalled write.
+func (w *TrackWriter) end(code control.PublishDoneStatusCode, reason string, reset bool) error {
+	if !reset {
+		w.writeMu.Lock()
+		defer w.writeMu.Unlock()
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+
+	open := make([]*message.SubgroupWriter, 0, len(w.subgroups))
+	for key, sw := range w.subgroups {
+		delete(w.subgroups, key)
+		open = append(open, sw)
+	}
+	streamCount := w.streamCount
+	w.mu.Unlock()
+	w.sess.removeTrackWriter(w.RequestID)
+
+	var firstErr error
+	for _, sw := range open {
+		if reset {
+			sw.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+			continue
+		}
+		if err := sw.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Stream Count lets the subscriber wait for the streams still in flight before releasing the Track Alias
+	err := w.sess.Cmf.WriteControlMessage(&control.PublishDoneMessage{
+		RequestID:    w.RequestID,
+		StatusCode:   code,
+		StreamCount:  streamCount,
+		ReasonPhrase: model.NewReasonPhrase(reason),
+	})
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("TrackWriter.Close(): Failed to send PUBLISH_DONE message: %w", err)
+	}
+
+	if p := w.pub; p != nil {
+		p.mu.Lock()
+		delete(p.subscriptions, w.RequestID)
+		p.mu.Unlock()
+
+		if err := w.sess.CompleteIncomingRequest(w.RequestID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,198 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"go-moq/pkg/transport"
+	moqtmemory "go-moq/pkg/transport/memory"
+	"io"
+	"testing"
+)
+
+func TestPublisherLookup(t *testing.T) {
+	p := &Publisher{
+		tracks:     make(map[string]SubscribeRequestHandler),
+		namespaces: make(map[string]namespaceHandler),
+	}
+
+	var got string
+	p.HandleTrack(testutil.FullTrackName("video", "live", "room1"), func(*SubscribeRequest) { got = "track" })
+	p.HandleNamespace(testutil.FullTrackName("", "live").Namespace, func(*SubscribeRequest) { got = "live" })
+	p.HandleNamespace(testutil.FullTrackName("", "live", "room2").Namespace, func(*SubscribeRequest) { got = "live/room2" })
+
+	tests := []struct {
+		name     string
+		track    model.MoqtFullTrackName
+		expected string // "" means no handler
+	}{
+		{"Exact track wins over namespaces", testutil.FullTrackName("video", "live", "room1"), "track"},
+		{"Falls back to the namespace", testutil.FullTrackName("audio", "live", "room1"), "live"},
+		{"Longest prefix wins", testutil.FullTrackName("video", "live", "room2", "cam"), "live/room2"},
+		{"No match", testutil.FullTrackName("video", "vod"), ""},
+		{"Field prefixes don't match", testutil.FullTrackName("video", "livestream"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			h, ok := p.lookup(tt.track)
+			if ok != (tt.expected != "") {
+				t.Fatalf("lookup() ok = %v, want %v", ok, tt.expected != "")
+			}
+			if ok {
+				h(nil)
+			}
+			if got != tt.expected {
+				t.Errorf("lookup() picked handler %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewSubscribeRequest(t *testing.T) {
+	uintParam := func(typ uint64, v uint64) model.MoqtKeyValuePair {
+		return model.MoqtKeyValuePair{Type: typ, KVPairType: model.MoqtKeyValuePairValueType_UInt64, ValueUInt64: v}
+	}
+	rangeFilter := control.SubscriptionFilter{Type: control.FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 2, ObjectId: 3}, EndGroup: 4}
+
+	tests := []struct {
+		name        string
+		params      []model.MoqtKeyValuePair
+		expectErr   bool
+		expPriority uint8
+		expForward  bool
+		expFilter   control.SubscriptionFilter
+	}{
+		{"Defaults", nil, false, defaultSubscriberPriority, true, control.DefaultSubscriptionFilter},
+		{"Explicit values", []model.MoqtKeyValuePair{
+			uintParam(control.ParamSubscriberPriority, 7),
+			uintParam(control.ParamForward, 0),
+			rangeFilter.ToParam(),
+		}, false, 7, false, rangeFilter},
+		{"Priority out of range", []model.MoqtKeyValuePair{uintParam(control.ParamSubscriberPriority, 256)}, true, 0, false, control.SubscriptionFilter{}},
+		{"Invalid forward", []model.MoqtKeyValuePair{uintParam(control.ParamForward, 2)}, true, 0, false, control.SubscriptionFilter{}},
+		{"Invalid group order", []model.MoqtKeyValuePair{uintParam(control.ParamGroupOrder, 3)}, true, 0, false, control.SubscriptionFilter{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newSubscribeRequest(nil, &control.SubscribeMessage{RequestID: 2, FullTrackName: testutil.FullTrackName("video", "live"), Parameters: tt.params})
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("newSubscribeRequest() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+			if req.SubscriberPriority != tt.expPriority || req.Forward != tt.expForward || req.Filter != tt.expFilter {
+				t.Errorf("newSubscribeRequest() got priority=%d forward=%v filter=%+v, want priority=%d forward=%v filter=%+v",
+					req.SubscriberPriority, req.Forward, req.Filter, tt.expPriority, tt.expForward, tt.expFilter)
+			}
+		})
+	}
+}
+
+func TestTrackWriterWanted(t *testing.T) {
+	w := &TrackWriter{
+		forward: true,
+		filter:  control.SubscriptionFilter{Type: control.FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 2, ObjectId: 3}, EndGroup: 4},
+	}
+
+	tests := []struct {
+		loc      model.MoqtLocation
+		expected bool
+	}{
+		{model.MoqtLocation{GroupId: 1, ObjectId: 10}, false},
+		{model.MoqtLocation{GroupId: 2, ObjectId: 2}, false},
+		{model.MoqtLocation{GroupId: 2, ObjectId: 3}, true},
+		{model.MoqtLocation{GroupId: 4, ObjectId: 100}, true},
+		{model.MoqtLocation{GroupId: 5, ObjectId: 0}, false},
+	}
+	for _, tt := range tests {
+		if got := w.wanted(tt.loc); got != tt.expected {
+			t.Errorf("wanted(%+v) = %v, want %v", tt.loc, got, tt.expected)
+		}
+	}
+
+	w.forward = false
+	if w.wanted(model.MoqtLocation{GroupId: 3}) {
+		t.Errorf("wanted() must drop everything while Forward is off")
+	}
+}
+
+// A connection whose subgroup streams open only once release is closed, like a subscriber that stopped granting streams.
+type stalledConn struct {
+	*moqtmemory.Connection
+	opening chan struct{} // Signalled when a stream starts opening
+	release chan struct{}
+}
+
+func (c *stalledConn) OpenUniStreamSync(ctx context.Context) (transport.SendStream, error) {
+	c.opening <- struct{}{}
+	<-c.release
+	return c.Connection.OpenUniStreamSync(ctx)
+}
+
+// A write stalled on the subscriber doesn't hold up the event loop, UNSUBSCRIBE and REQUEST_UPDATE are still handled.
+func TestTrackWriterStalledWrite(t *testing.T) {
+	ctx := testutil.Context(t)
+	track := testutil.FullTrackName("video", "live")
+	p := testutil.NewPair(t)
+	conn := &stalledConn{Connection: p.ServerConn, opening: make(chan struct{}, 1), release: make(chan struct{})}
+
+	clientState := NewSessionState(RoleClient, 100, 0)
+	clientState.MaxOutgoingRequestID = 100
+	serverState := NewSessionState(RoleServer, 100, 0)
+	client := NewSession(p.ClientConn, p.ClientStream, clientState)
+	server := NewSession(conn, p.ServerStream, serverState)
+	go client.Run(ctx)
+	go server.Run(ctx)
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	written := make(chan error, 1)
+	go func() {
+		written <- w.WriteObject(&model.MoqtObject{ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")})
+	}()
+	<-conn.opening
+
+	if err := sub.Update(ctx, WithSubscriberPriority(10)); err != nil {
+		t.Fatalf("Update() during a stalled write unexpected error: %v", err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe() unexpected error: %v", err)
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadObject() after UNSUBSCRIBE error = %v, want io.EOF", err)
+	}
+	if done := sub.PublishDone(); done.StatusCode != control.PublishDoneSubscriptionEnded || done.StreamCount != 0 {
+		t.Errorf("PublishDone() got = (%#x, %d streams), want (SUBSCRIPTION_ENDED, 0 streams)", uint64(done.StatusCode), done.StreamCount)
+	}
+
+	// The stream opened after the end is reset, the write fails
+	close(conn.release)
+	select {
+	case err := <-written:
+		if err == nil {
+			t.Errorf("WriteObject() ended by UNSUBSCRIBE expected an error, but got none")
+		}
+	case <-ctx.Done():
+		t.Fatalf("WriteObject() didn't return after the stream opened")
+	}
+}
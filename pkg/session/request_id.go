@@ -0,0 +1,157 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+)
+
+// Request IDs are allocated by both endpoints from disjoint spaces, Client uses even IDs and Server uses odd IDs.
+// Each endpoint limits how many requests the peer may open with MAX_REQUEST_ID (Section 9.5)
+
+// RequestsBlockedError is returned when a request cannot be sent because the peer's Maximum Request ID is reached.
+type RequestsBlockedError struct {
+	MaxRequestID uint64 // The limit imposed by the peer
+}
+
+func (e RequestsBlockedError) Error() string {
+	return fmt.Sprintf("Requests blocked by the peer's Maximum Request ID: %d", e.MaxRequestID)
+}
+
+// TryNextRequestID allocates the Request ID for a new request we send, without waiting.
+// When the peer's limit is reached, REQUESTS_BLOCKED is sent and a RequestsBlockedError is returned.
+func (s *Session) TryNextRequestID() (uint64, error) {
+	id, _, err := s.allocateRequestID()
+	return id, err
+}
+
+// NextRequestID allocates the Request ID for a new request we send, ErrGoingAway is returned once either endpoint sent GOAWAY.
+// When the peer's limit is reached, REQUESTS_BLOCKED is sent and it waits until the peer raises the limit, ctx is done or the session terminates.
+func (s *Session) NextRequestID(ctx context.Context) (uint64, error) {
+	for {
+		id, updated, err := s.allocateRequestID()
+		if err == nil {
+			return id, nil
+		}
+		if updated == nil { // Not a RequestsBlockedError
+			return 0, err
+		}
+
+		select {
+		case <-updated:
+		case <-s.goAwayReceived:
+			return 0, ErrGoingAway
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-s.closed:
+			return 0, s.Err()
+		}
+	}
+}
+
+// Returns the allocated ID, or the channel that is closed once the peer raises its limit together with a RequestsBlockedError.
+func (s *Session) allocateRequestID() (uint64, <-chan struct{}, error) {
+	if err := s.goingAwayErr(); err != nil {
+		return 0, nil, err
+	}
+
+	s.State.RequestIDMutex.Lock()
+	if s.State.NextOutgoingRequestID < s.State.MaxOutgoingRequestID {
+		id := s.State.NextOutgoingRequestID
+		s.State.NextOutgoingRequestID += 2
+		s.State.RequestIDMutex.Unlock()
+		return id, nil, nil
+	}
+
+	limit := s.State.MaxOutgoingRequestID
+	updated := s.requestIDUpdated
+	sendBlocked := !s.requestsBlockedSent // Tell the peer only once per limit
+	s.requestsBlockedSent = true
+	s.State.RequestIDMutex.Unlock()
+
+	if sendBlocked {
+		err := s.Cmf.WriteControlMessage(&control.RequestsBlockedMessage{MaximumRequestID: limit})
+		if err != nil {
+			return 0, nil, fmt.Errorf("Session.allocateRequestID(): Failed to send REQUESTS_BLOCKED message: %w", err)
+		}
+	}
+	return 0, updated, RequestsBlockedError{MaxRequestID: limit}
+}
+
+// Handles MAX_REQUEST_ID from the peer, waking up requests that wait for a Request ID.
+func (s *Session) onMaxRequestID(msg *control.MaxRequestIdMessage) error {
+	s.State.RequestIDMutex.Lock()
+	defer s.State.RequestIDMutex.Unlock()
+
+	if msg.MaxRequestID <= s.State.MaxOutgoingRequestID {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("MAX_REQUEST_ID must increase, current: %d, received: %d", s.State.MaxOutgoingRequestID, msg.MaxRequestID)),
+		}
+	}
+
+	s.State.MaxOutgoingRequestID = msg.MaxRequestID
+	s.requestsBlockedSent = false
+	close(s.requestIDUpdated)
+	s.requestIDUpdated = make(chan struct{})
+	return nil
+}
+
+// Validates the Request ID of a new request from the peer and marks the request as open.
+// Requests on SUBSCRIBE_NAMESPACE streams may overtake the ones on the control stream, so an ID above the next expected one
+// is accepted once, the gap below it is filled by the requests still in flight.
+func (s *Session) acceptIncomingRequestID(requestID uint64) error {
+	s.State.RequestIDMutex.Lock()
+	defer s.State.RequestIDMutex.Unlock()
+
+	_, reused := s.skippedIncomingRequests[requestID]
+	if requestID < s.State.NextIncomingRequestID || requestID%2 != s.State.NextIncomingRequestID%2 || reused {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_REQUEST_ID,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Expected Request ID: %d, got: %d", s.State.NextIncomingRequestID, requestID)),
+		}
+	}
+	if requestID >= s.State.MaxIncomingRequestID {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_TOO_MANY_REQUESTS,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Request ID %d exceeds the Maximum Request ID: %d", requestID, s.State.MaxIncomingRequestID)),
+		}
+	}
+
+	s.openIncomingRequests[requestID] = struct{}{}
+	if requestID != s.State.NextIncomingRequestID {
+		s.skippedIncomingRequests[requestID] = struct{}{}
+		return nil
+	}
+
+	s.State.NextIncomingRequestID += 2
+	for { // Skip the IDs that overtook this one
+		if _, ok := s.skippedIncomingRequests[s.State.NextIncomingRequestID]; !ok {
+			break
+		}
+		delete(s.skippedIncomingRequests, s.State.NextIncomingRequestID)
+		s.State.NextIncomingRequestID += 2
+	}
+	return nil
+}
+
+// CompleteIncomingRequest marks a request of the peer as finished and grants the peer a new request by sending MAX_REQUEST_ID.
+// Completing an unknown or already completed request has no effect.
+func (s *Session) CompleteIncomingRequest(requestID uint64) error {
+	s.State.RequestIDMutex.Lock()
+	if _, ok := s.openIncomingRequests[requestID]; !ok {
+		s.State.RequestIDMutex.Unlock()
+		return nil
+	}
+	delete(s.openIncomingRequests, requestID)
+	s.State.MaxIncomingRequestID += 2 // Next ID in the peer's space
+	maxRequestId := s.State.MaxIncomingRequestID
+	s.State.RequestIDMutex.Unlock()
+
+	err := s.Cmf.WriteControlMessage(&control.MaxRequestIdMessage{MaxRequestID: maxRequestId})
+	if err != nil {
+		return fmt.Errorf("Session.CompleteIncomingRequest(): Failed to send MAX_REQUEST_ID message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+)
+
+func TestNextRequestIDBlocks(t *testing.T) {
+	ctx := testutil.Context(t)
+	state := NewSessionState(RoleClient, 100, 0)
+	state.MaxOutgoingRequestID = 2
+	client, peer := newRawPeer(t, state)
+
+	if id, err := client.NextRequestID(ctx); err != nil || id != 0 {
+		t.Fatalf("NextRequestID() got = %d, %v, want 0", id, err)
+	}
+
+	type result struct {
+		id  uint64
+		err error
+	}
+	allocated := make(chan result, 1)
+	go func() {
+		id, err := client.NextRequestID(ctx)
+		allocated <- result{id, err}
+	}()
+
+	msg, ok := readMessage(t, peer).(*control.RequestsBlockedMessage)
+	if !ok || msg.MaximumRequestID != 2 {
+		t.Fatalf("Got %#v, want REQUESTS_BLOCKED with Maximum Request ID 2", msg)
+	}
+	select {
+	case r := <-allocated:
+		t.Fatalf("NextRequestID() returned %d, %v before the limit was raised", r.id, r.err)
+	default:
+	}
+
+	// Blocked again on the same limit, REQUESTS_BLOCKED isn't repeated
+	var blocked RequestsBlockedError
+	if _, err := client.TryNextRequestID(); !errors.As(err, &blocked) || blocked.MaxRequestID != 2 {
+		t.Fatalf("TryNextRequestID() error = %v, want RequestsBlockedError for 2", err)
+	}
+
+	if err := peer.WriteControlMessage(&control.MaxRequestIdMessage{MaxRequestID: 4}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	select {
+	case r := <-allocated:
+		if r.err != nil || r.id != 2 {
+			t.Fatalf("NextRequestID() after MAX_REQUEST_ID got = %d, %v, want 2", r.id, r.err)
+		}
+	case <-ctx.Done():
+		t.Fatalf("NextRequestID() wasn't woken up by MAX_REQUEST_ID")
+	}
+
+	// The new limit is reported once reached, the next message isn't a repeated REQUESTS_BLOCKED for 2
+	if _, err := client.TryNextRequestID(); !errors.As(err, &blocked) || blocked.MaxRequestID != 4 {
+		t.Fatalf("TryNextRequestID() error = %v, want RequestsBlockedError for 4", err)
+	}
+	msg, ok = readMessage(t, peer).(*control.RequestsBlockedMessage)
+	if !ok || msg.MaximumRequestID != 4 {
+		t.Fatalf("Got %#v, want REQUESTS_BLOCKED with Maximum Request ID 4", msg)
+	}
+}
+
+func TestMaxRequestIDMustIncrease(t *testing.T) {
+	state := NewSessionState(RoleClient, 100, 0)
+	state.MaxOutgoingRequestID = 10
+	client, peer := newRawPeer(t, state)
+
+	if err := peer.WriteControlMessage(&control.MaxRequestIdMessage{MaxRequestID: 10}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := waitTerminated(t, client); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Session terminated with %v, want PROTOCOL_VIOLATION", err)
+	}
+}
+
+func TestCompleteIncomingRequest(t *testing.T) {
+	server, peer := newRawPeer(t, NewSessionState(RoleServer, 10, 0))
+
+	for _, id := range []uint64{0, 2} {
+		if err := server.acceptIncomingRequestID(id); err != nil {
+			t.Fatalf("acceptIncomingRequestID(%d) unexpected error: %v", id, err)
+		}
+	}
+
+	if err := server.CompleteIncomingRequest(0); err != nil {
+		t.Fatalf("CompleteIncomingRequest(0) unexpected error: %v", err)
+	}
+	if msg, ok := readMessage(t, peer).(*control.MaxRequestIdMessage); !ok || msg.MaxRequestID != 12 {
+		t.Fatalf("Got %#v, want MAX_REQUEST_ID 12", msg)
+	}
+
+	// A second completion grants nothing, the next MAX_REQUEST_ID is the one of request 2
+	if err := server.CompleteIncomingRequest(0); err != nil {
+		t.Fatalf("CompleteIncomingRequest(0) again unexpected error: %v", err)
+	}
+	if err := server.CompleteIncomingRequest(2); err != nil {
+		t.Fatalf("CompleteIncomingRequest(2) unexpected error: %v", err)
+	}
+	if msg, ok := readMessage(t, peer).(*control.MaxRequestIdMessage); !ok || msg.MaxRequestID != 14 {
+		t.Fatalf("Got %#v, want MAX_REQUEST_ID 14", msg)
+	}
+	if server.State.MaxIncomingRequestID != 14 {
+		t.Errorf("MaxIncomingRequestID = %d, want 14", server.State.MaxIncomingRequestID)
+	}
+}
+
+func TestTooManyRequests(t *testing.T) {
+	server, peer := newRawPeer(t, NewSessionState(RoleServer, 2, 0))
+
+	// Request IDs may skip ahead, but not up to the Maximum Request ID
+	msg := &control.TrackStatusMessage{RequestID: 2, FullTrackName: testutil.FullTrackName("video", "live")}
+	if err := peer.WriteControlMessage(msg); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := waitTerminated(t, server); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_TOO_MANY_REQUESTS {
+		t.Errorf("Session terminated with %v, want TOO_MANY_REQUESTS", err)
+	}
+}
+
+func TestIncomingRequestIDOutOfOrder(t *testing.T) {
+	_, server := newSessionPair(t)
+
+	// Client Request IDs are even, 2 overtakes 0 as it was sent on another stream
+	for _, id := range []uint64{2, 0, 4} {
+		if err := server.acceptIncomingRequestID(id); err != nil {
+			t.Fatalf("acceptIncomingRequestID(%d) unexpected error: %v", id, err)
+		}
+	}
+	if server.State.NextIncomingRequestID != 6 {
+		t.Errorf("NextIncomingRequestID got = %d, want 6", server.State.NextIncomingRequestID)
+	}
+
+	if err := server.acceptIncomingRequestID(8); err != nil {
+		t.Fatalf("acceptIncomingRequestID(8) unexpected error: %v", err)
+	}
+
+	// Already used, below the next expected ID or in the server's space
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	for _, id := range []uint64{8, 4, 7} {
+		err := server.acceptIncomingRequestID(id)
+		if !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_REQUEST_ID {
+			t.Errorf("acceptIncomingRequestID(%d) got error = %v, want INVALID_REQUEST_ID", id, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+)
+
+// REQUEST_UPDATE modifies a subscription that is in progress (Section 9.10)
+// It refers to the SUBSCRIBE or PUBLISH that started the subscription and carries only the parameters that change:
+// SUBSCRIBER_PRIORITY, FORWARD and SUBSCRIPTION_FILTER. The filter may only narrow the subscription, see control.SubscriptionFilter.Narrows.
+// The update is a request of its own, answered with REQUEST_OK or REQUEST_ERROR.
+
+// ErrSubscriptionEnded is returned when updating a subscription that already ended.
+var ErrSubscriptionEnded = errors.New("subscription ended")
+
+// --- Subscriber side --- //
+
+// Update sends REQUEST_UPDATE for the subscription and waits for the publisher's answer.
+// Only WithSubscriptionFilter, WithSubscriberPriority and WithForward have an effect, the filter MUST narrow the current one.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR. It blocks until the answer arrives, ctx is done or the session terminates.
+func (sub *Subscription) Update(ctx context.Context, opts ...SubscribeOption) error {
+	sm := &control.SubscribeMessage{}
+	for _, opt := range opts {
+		opt(sm)
+	}
+
+	sub.mu.Lock()
+	current, start := sub.filter, sub.start
+	ended := sub.done != nil
+	sub.mu.Unlock()
+
+	if ended {
+		return ErrSubscriptionEnded
+	}
+
+	_, hasFilter := control.FindParam(sm.Parameters, control.ParamSubscriptionFilter)
+	filter, err := sm.Filter()
+	if err != nil {
+		return fmt.Errorf("Subscription.Update(): %w", err)
+	}
+	if hasFilter && !filter.Narrows(current, start) {
+		return fmt.Errorf("Subscription.Update(): The subscription filter can only be narrowed")
+	}
+
+	s := sub.sess
+	if err := s.State.checkLocalAuthTokens(sm.Parameters); err != nil {
+		return fmt.Errorf("Subscription.Update(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return fmt.Errorf("Subscription.Update(): %w", err)
+	}
+
+	// Buffered, the handler never blocks even if we gave up waiting
+	answer := make(chan error, 1)
+
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.RequestOkMessage:
+			if hasFilter {
+				sub.mu.Lock()
+				sub.filter = filter
+				sub.start = filter.StartLocation
+				sub.mu.Unlock()
+			}
+			answer <- nil
+		case *control.RequestErrorMessage:
+			answer <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to REQUEST_UPDATE", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(sm.Parameters, func() error {
+		return s.Cmf.WriteControlMessage(&control.RequestUpdateMessage{
+			RequestID:         requestID,
+			ExistingRequestID: sub.RequestID,
+			Parameters:        sm.Parameters,
+		})
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		return fmt.Errorf("Subscription.Update(): Failed to send REQUEST_UPDATE message: %w", err)
+	}
+
+	select {
+	case err := <-answer:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closed:
+		return s.Err()
+	}
+}
+
+// --- Publisher side --- //
+
+func (s *Session) addTrackWriter(w *TrackWriter) {
+	s.trackWritersMutex.Lock()
+	defer s.trackWritersMutex.Unlock()
+	s.trackWriters[w.RequestID] = w
+}
+
+func (s *Session) removeTrackWriter(requestID uint64) {
+	s.trackWritersMutex.Lock()
+	defer s.trackWritersMutex.Unlock()
+	delete(s.trackWriters, requestID)
+}
+
+// Handles REQUEST_UPDATE from the peer, modifying a track we deliver. The update is answered right away, it completes on the answer.
+func (s *Session) onRequestUpdate(msg *control.RequestUpdateMessage) error {
+	s.trackWritersMutex.Lock()
+	w, ok := s.trackWriters[msg.ExistingRequestID]
+	s.trackWritersMutex.Unlock()
+
+	if !ok {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    msg.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Request ID %d doesn't refer to a subscription", msg.ExistingRequestID)),
+		}
+	}
+
+	if err := w.update(msg); err != nil {
+		return err
+	}
+
+	if err := s.Cmf.WriteControlMessage(&control.RequestOkMessage{RequestID: msg.RequestID}); err != nil {
+		return fmt.Errorf("Session.onRequestUpdate(): Failed to send REQUEST_OK message: %w", err)
+	}
+	return s.CompleteIncomingRequest(msg.RequestID)
+}
+
+// Applies the parameters of REQUEST_UPDATE, nothing is changed if any of them is invalid.
+func (w *TrackWriter) update(msg *control.RequestUpdateMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	filter := w.filter
+	if _, ok := control.FindParam(msg.Parameters, control.ParamSubscriptionFilter); ok {
+		var err error
+		if filter, err = control.SubscriptionFilterFromParams(msg.Parameters); err != nil {
+			return err
+		}
+		start := model.MoqtLocation{} // Nothing was written yet, the subscription begins with the first object
+		if w.start != nil {
+			start = *w.start
+		}
+		if !filter.Narrows(w.filter, start) {
+			return model.MOQT_REQUEST_ERROR{
+				RequestID:    msg.RequestID,
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE,
+				ReasonPhrase: model.NewReasonPhrase("REQUEST_UPDATE can only narrow the subscription"),
+			}
+		}
+	}
+
+	priority := w.subscriberPriority
+	if _, ok := control.FindParam(msg.Parameters, control.ParamSubscriberPriority); ok {
+		var err error
+		if priority, err = subscriberPriorityFromParams(msg.Parameters); err != nil {
+			return err
+		}
+	}
+
+	forward := w.forward
+	if param, ok := control.FindParam(msg.Parameters, control.ParamForward); ok {
+		if param.ValueUInt64 > 1 {
+			return protocolViolation(fmt.Sprintf("Invalid FORWARD parameter: %d", param.ValueUInt64))
+		}
+		forward = param.ValueUInt64 == 1
+	}
+
+	if filter != w.filter {
+		w.filter = filter
+		w.start = &filter.StartLocation
+	}
+	w.subscriberPriority = priority
+	w.forward = forward
+	return nil
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+)
+
+func TestRequestUpdate(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+	startAt := func(group uint64) control.SubscriptionFilter {
+		return control.SubscriptionFilter{Type: control.FilterAbsoluteStart, StartLocation: model.MoqtLocation{GroupId: group}}
+	}
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	sub, err := client.Subscribe(ctx, track, WithSubscriptionFilter(startAt(2)))
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	narrower := control.SubscriptionFilter{Type: control.FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 3}, EndGroup: 5}
+	if err := sub.Update(ctx, WithSubscriptionFilter(narrower), WithForward(false), WithSubscriberPriority(10)); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if w.Filter() != narrower || w.Forward() || w.SubscriberPriority() != 10 {
+		t.Errorf("TrackWriter after Update() got = (%+v, %v, %d), want (%+v, false, 10)", w.Filter(), w.Forward(), w.SubscriberPriority(), narrower)
+	}
+
+	// Parameters that are absent are left as they are
+	if err := sub.Update(ctx, WithForward(true)); err != nil {
+		t.Fatalf("Update() of Forward unexpected error: %v", err)
+	}
+	if w.Filter() != narrower || !w.Forward() || w.SubscriberPriority() != 10 {
+		t.Errorf("TrackWriter after the second Update() got = (%+v, %v, %d), want (%+v, true, 10)", w.Filter(), w.Forward(), w.SubscriberPriority(), narrower)
+	}
+
+	if err := sub.Update(ctx, WithSubscriptionFilter(startAt(1))); err == nil {
+		t.Errorf("Update() widening the filter expected an error, but got none")
+	}
+
+	// The publisher validates on its own, pretend we subscribed to a wider range
+	sub.mu.Lock()
+	sub.filter = startAt(0)
+	sub.mu.Unlock()
+	wider := control.SubscriptionFilter{Type: control.FilterAbsoluteRange, StartLocation: model.MoqtLocation{GroupId: 3}, EndGroup: 9}
+	err = sub.Update(ctx, WithSubscriptionFilter(wider))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE {
+		t.Errorf("Update() raising the End Group error = %v, want INVALID_RANGE", err)
+	}
+	if w.Filter() != narrower {
+		t.Errorf("TrackWriter filter after a rejected update got = %+v, want %+v", w.Filter(), narrower)
+	}
+
+	unknown := newSubscription(client, 98, track)
+	err = unknown.Update(ctx, WithForward(false))
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Errorf("Update() of an unknown subscription error = %v, want DOES_NOT_EXIST", err)
+	}
+}
+
+func TestRequestUpdateLargestObject(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+	startAt := func(group, object uint64) control.SubscriptionFilter {
+		return control.SubscriptionFilter{Type: control.FilterAbsoluteStart, StartLocation: model.MoqtLocation{GroupId: group, ObjectId: object}}
+	}
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept(control.LargestObjectParam(model.MoqtLocation{GroupId: 10, ObjectId: 4}))
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	// A Largest Object subscription begins right after the LARGEST_OBJECT of SUBSCRIBE_OK
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	if err := sub.Update(ctx, WithSubscriptionFilter(startAt(10, 4))); err == nil {
+		t.Errorf("Update() starting before the subscription expected an error, but got none")
+	}
+
+	// The publisher validates on its own, pretend the subscription began earlier
+	sub.mu.Lock()
+	sub.start = model.MoqtLocation{}
+	sub.mu.Unlock()
+	err = sub.Update(ctx, WithSubscriptionFilter(startAt(3, 0)))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_INVALID_RANGE {
+		t.Errorf("Update() starting before the subscription error = %v, want INVALID_RANGE", err)
+	}
+	if w.Filter() != control.DefaultSubscriptionFilter {
+		t.Errorf("TrackWriter filter after a rejected update got = %+v, want %+v", w.Filter(), control.DefaultSubscriptionFilter)
+	}
+
+	if err := sub.Update(ctx, WithSubscriptionFilter(startAt(10, 5))); err != nil {
+		t.Fatalf("Update() starting with the subscription unexpected error: %v", err)
+	}
+	if w.Filter() != startAt(10, 5) {
+		t.Errorf("TrackWriter filter after Update() got = %+v, want %+v", w.Filter(), startAt(10, 5))
+	}
+}
@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+)
+
+// MessageHandler is invoked by Run for every incoming control message of the type it was registered for.
+// Handlers run on the event loop goroutine, so they MUST NOT block, long running work should be moved to a separate goroutine.
+// Returning a model.MOQT_REQUEST_ERROR answers the request with REQUEST_ERROR, any other error terminates the session.
+type MessageHandler func(sess *Session, msg control.ControlMessage) error
+
+// ResponseHandler is invoked by Run once, with the response (e.g. SUBSCRIBE_OK or REQUEST_ERROR) to a request we sent.
+// The same rules of MessageHandler apply.
+type ResponseHandler func(msg control.ControlMessage) error
+
+// HandleMessage registers the handler for incoming control messages of the given type, replacing the previous one if any.
+func (s *Session) HandleMessage(typ control.ControlMessageType, h MessageHandler) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.messageHandlers[typ] = h
+}
+
+// HandleResponse registers a one-shot handler for the response to the request with the given ID.
+// It MUST be registered before the request is written to the control stream, otherwise the response might arrive first.
+func (s *Session) HandleResponse(requestID uint64, h ResponseHandler) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.responseHandlers[requestID] = h
+}
+
+// Run is the event loop of the session, it owns the read side of the control stream.
+// Every incoming control message is decoded and dispatched to the registered handlers.
+// It blocks until the session terminates and returns the reason, cancelling ctx closes the session with NO_ERROR.
+func (s *Session) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		s.CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_NO_ERROR,
+			ReasonPhrase: model.NewReasonPhrase("Session closed by the application"),
+		})
+	})
+	defer stop()
+
+	go s.receiveDatagrams()
+	go s.receiveUniStreams()
+	go s.receiveBidiStreams()
+
+	for {
+		msg, err := s.Cmf.ReadControlMessage()
+		if err != nil {
+			// If the session is already closed, the read error is just a consequence of it.
+			select {
+			case <-s.closed:
+				return s.Err()
+			default:
+			}
+
+			if errors.Is(err, io.EOF) {
+				// The control stream is the lifetime of the session, the peer must not finish it on its own.
+				err = model.MOQT_SESSION_TERMINATION_ERROR{
+					ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+					ReasonPhrase: model.NewReasonPhrase("Control stream was closed by the peer"),
+				}
+			}
+			s.CloseWithError(sessionTerminationError(err))
+			return s.Err()
+		}
+
+		if err := s.dispatch(msg); err != nil {
+			s.CloseWithError(err)
+			return s.Err()
+		}
+	}
+}
+
+// Routes a single control message to its handler.
+func (s *Session) dispatch(msg control.ControlMessage) error {
+	typ := msg.Type()
+
+	// The setup messages are only valid as the very first message on the control stream.
+	if typ == control.CLIENT_SETUP || typ == control.SERVER_SETUP {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Unexpected setup message (Type: %#X) after the handshake", uint64(typ))),
+		}
+	}
+
+	if typ.IsResponse() {
+		requestID := msg.(control.RequestMessage).GetRequestID() // Every response carries a Request ID
+
+		s.handlersMutex.Lock()
+		h, ok := s.responseHandlers[requestID]
+		delete(s.responseHandlers, requestID)
+		s.handlersMutex.Unlock()
+
+		if !ok {
+			return model.MOQT_SESSION_TERMINATION_ERROR{
+				ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Received response (Type: %#X) for unknown Request ID: %d", uint64(typ), requestID)),
+			}
+		}
+		return h(msg)
+	}
+
+	// Messages that manage the session itself are never exposed to the handlers
+	switch m := msg.(type) {
+	case *control.MaxRequestIdMessage:
+		return s.onMaxRequestID(m)
+	case *control.GoAwayMessage:
+		return s.onGoAway(m)
+	case *control.PublishDoneMessage:
+		return s.onPublishDone(m)
+	case *control.UnsubscribeMessage:
+		return s.onUnsubscribe(m)
+	case *control.PublishNamespaceDoneMessage:
+		return s.onPublishNamespaceDone(m)
+	case *control.PublishNamespaceCancelMessage:
+		return s.onPublishNamespaceCancel(m)
+	case *control.SubscribeNamespaceMessage, *control.NamespaceMessage, *control.NamespaceDoneMessage:
+		return protocolViolation(fmt.Sprintf("Control Message Type %#X is only valid on the stream of SUBSCRIBE_NAMESPACE", uint64(typ)))
+	}
+
+	if typ.IsRequest() {
+		requestID := msg.(control.RequestMessage).GetRequestID()
+		if err := s.acceptIncomingRequestID(requestID); err != nil {
+			return err
+		}
+		// Registered tokens must be tracked even if the request is rejected, later requests may use their alias
+		if params := authTokenParams(msg); params != nil {
+			if err := s.State.resolvePeerAuthTokens(params); err != nil {
+				return err
+			}
+		}
+		if rejected, err := s.rejectIfGoingAway(requestID); rejected || err != nil {
+			return err
+		}
+		if err := s.authorizeRequest(msg); err != nil {
+			return s.rejectOnRequestError(err)
+		}
+	}
+
+	// Updates of the tracks we deliver are applied by the session itself
+	if m, ok := msg.(*control.RequestUpdateMessage); ok {
+		return s.rejectOnRequestError(s.onRequestUpdate(m))
+	}
+
+	s.handlersMutex.Lock()
+	h, ok := s.messageHandlers[typ]
+	s.handlersMutex.Unlock()
+
+	if !ok {
+		// Nobody is interested, requests still deserve an answer so the peer doesn't wait forever.
+		if typ.IsRequest() {
+			return s.RejectRequest(model.MOQT_REQUEST_ERROR{
+				RequestID:    msg.(control.RequestMessage).GetRequestID(),
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Control Message Type %#X is not supported", uint64(typ))),
+			})
+		}
+		return nil
+	}
+
+	return s.rejectOnRequestError(h(s, msg))
+}
+
+// Answers a request with REQUEST_ERROR if its handler returned a model.MOQT_REQUEST_ERROR, any other error is returned as is.
+func (s *Session) rejectOnRequestError(err error) error {
+	var reqErr model.MOQT_REQUEST_ERROR
+	if errors.As(err, &reqErr) {
+		return s.RejectRequest(reqErr)
+	}
+	return err
+}
+
+// RejectRequest answers a request of the peer with REQUEST_ERROR, which also completes the request.
+func (s *Session) RejectRequest(reqErr model.MOQT_REQUEST_ERROR) error {
+	err := s.Cmf.WriteControlMessage(&control.RequestErrorMessage{
+		RequestID:    reqErr.RequestID,
+		ErrorCode:    reqErr.ErrorCode,
+		ReasonPhrase: reqErr.ReasonPhrase,
+	})
+	if err != nil {
+		return fmt.Errorf("Session.RejectRequest(): Failed to send REQUEST_ERROR message: %w", err)
+	}
+	return s.CompleteIncomingRequest(reqErr.RequestID)
+}
+
+// CloseWithError terminates the session and the underlying connection.
+// MOQT_SESSION_TERMINATION_ERRORs are sent to the peer with their own code, any other error is reported as INTERNAL_ERROR.
+// Only the first call has an effect.
+func (s *Session) CloseWithError(err error) error {
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if !errors.As(err, &termErr) {
+		termErr = model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_INTERNAL_ERROR,
+			ReasonPhrase: model.NewReasonPhrase("Internal error"),
+		}
+	}
+
+	var closeErr error
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.closed)
+		closeErr = s.Conn.CloseWithError(uint64(termErr.ErrorCode), string(termErr.ReasonPhrase))
+	})
+	return closeErr
+}
+
+// Done returns a channel that is closed when the session terminates.
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Err returns the reason the session terminated, nil if it is still alive.
+func (s *Session) Err() error {
+	select {
+	case <-s.closed:
+		return s.closeErr
+	default:
+		return nil
+	}
+}
+
+// Removes the response handler of a request that will never be answered, e.g. because it couldn't be sent.
+func (s *Session) removeResponseHandler(requestID uint64) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	delete(s.responseHandlers, requestID)
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Returns the code the session closed the connection with, as observed by the peer.
+func peerCloseCode(t *testing.T, peer *rawPeer) model.MOQT_SESSION_TERMINATION_ERROR_CODE {
+	t.Helper()
+	select {
+	case <-peer.conn.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("The connection wasn't closed")
+	}
+	var appErr *quic.ApplicationError
+	if !errors.As(context.Cause(peer.conn.Context()), &appErr) || !appErr.Remote {
+		t.Fatalf("The connection was closed with %v, want an application error of the session", context.Cause(peer.conn.Context()))
+	}
+	return model.MOQT_SESSION_TERMINATION_ERROR_CODE(appErr.ErrorCode)
+}
+
+func TestRunUnknownMessageType(t *testing.T) {
+	sess, peer := newRawPeer(t, NewSessionState(RoleServer, 100, 0))
+
+	// Type 0x3FFF as a two byte varint, with an empty payload
+	if _, err := peer.stream.Write([]byte{0x7F, 0xFF, 0x00}); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := waitTerminated(t, sess); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Session terminated with %v, want PROTOCOL_VIOLATION", err)
+	}
+	if code := peerCloseCode(t, peer); code != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Connection closed with %#x, want PROTOCOL_VIOLATION", uint64(code))
+	}
+}
+
+func TestRunWithoutHandler(t *testing.T) {
+	sess, peer := newRawPeer(t, NewSessionState(RoleServer, 100, 0))
+
+	// Requests are answered, so the peer doesn't wait forever
+	if err := peer.WriteControlMessage(&control.SubscribeMessage{RequestID: 0, FullTrackName: testutil.FullTrackName("video", "live")}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	if msg, ok := readMessage(t, peer).(*control.RequestErrorMessage); !ok || msg.RequestID != 0 || msg.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED {
+		t.Fatalf("Got %#v, want REQUEST_ERROR NOT_SUPPORTED for Request ID 0", msg)
+	}
+	if msg, ok := readMessage(t, peer).(*control.MaxRequestIdMessage); !ok || msg.MaxRequestID != 102 {
+		t.Fatalf("Got %#v, want MAX_REQUEST_ID 102 for the rejected request", msg)
+	}
+
+	// Other messages are dropped, the session goes on
+	if err := peer.WriteControlMessage(&control.RequestsBlockedMessage{MaximumRequestID: 100}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	if err := peer.WriteControlMessage(&control.SubscribeMessage{RequestID: 2, FullTrackName: testutil.FullTrackName("video", "live")}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	if msg, ok := readMessage(t, peer).(*control.RequestErrorMessage); !ok || msg.RequestID != 2 {
+		t.Fatalf("Got %#v, want REQUEST_ERROR for Request ID 2", msg)
+	}
+	if err := sess.Err(); err != nil {
+		t.Errorf("Err() = %v, want the session alive", err)
+	}
+}
+
+func TestRunHandlerErrors(t *testing.T) {
+	sess, peer := newRawPeer(t, NewSessionState(RoleServer, 100, 0))
+
+	// A MOQT_REQUEST_ERROR rejects the request
+	sess.HandleMessage(control.SUBSCRIBE, func(sess *Session, msg control.ControlMessage) error {
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    msg.(*control.SubscribeMessage).RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED,
+			ReasonPhrase: model.NewReasonPhrase("Not for you"),
+		}
+	})
+	if err := peer.WriteControlMessage(&control.SubscribeMessage{RequestID: 0, FullTrackName: testutil.FullTrackName("video", "live")}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	msg, ok := readMessage(t, peer).(*control.RequestErrorMessage)
+	if !ok || msg.RequestID != 0 || msg.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_UNAUTHORIZED || string(msg.ReasonPhrase) != "Not for you" {
+		t.Fatalf("Got %#v, want the REQUEST_ERROR of the handler", msg)
+	}
+	if msg, ok := readMessage(t, peer).(*control.MaxRequestIdMessage); !ok || msg.MaxRequestID != 102 {
+		t.Fatalf("Got %#v, want MAX_REQUEST_ID 102 for the rejected request", msg)
+	}
+
+	// Any other error terminates the session with INTERNAL_ERROR
+	failure := errors.New("handler failed")
+	sess.HandleMessage(control.SUBSCRIBE, func(sess *Session, msg control.ControlMessage) error {
+		return failure
+	})
+	if err := peer.WriteControlMessage(&control.SubscribeMessage{RequestID: 2, FullTrackName: testutil.FullTrackName("video", "live")}); err != nil {
+		t.Fatalf("WriteControlMessage() unexpected error: %v", err)
+	}
+	if err := waitTerminated(t, sess); !errors.Is(err, failure) {
+		t.Errorf("Session terminated with %v, want the error of the handler", err)
+	}
+	if code := peerCloseCode(t, peer); code != model.MOQT_SESSION_TERMINATION_ERROR_CODE_INTERNAL_ERROR {
+		t.Errorf("Connection closed with %#x, want INTERNAL_ERROR", uint64(code))
+	}
+}
+
+func TestRunControlStreamClosed(t *testing.T) {
+	sess, peer := newRawPeer(t, NewSessionState(RoleServer, 100, 0))
+
+	if err := peer.stream.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+
+	var termErr model.MOQT_SESSION_TERMINATION_ERROR
+	if err := waitTerminated(t, sess); !errors.As(err, &termErr) || termErr.ErrorCode != model.MOQT_SESSION_TERMINATION_ERROR_CODE_PROTOCOL_VIOLATION {
+		t.Errorf("Session terminated with %v, want PROTOCOL_VIOLATION", err)
+	}
+	if err := <-peer.runErr; err != sess.Err() {
+		t.Errorf("Run() returned %v, want %v", err, sess.Err())
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode model.MOQT_SESSION_TERMINATION_ERROR_CODE
+	}{
+		{
+			name:     "termination error",
+			err:      model.MOQT_SESSION_TERMINATION_ERROR{ErrorCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT, ReasonPhrase: model.NewReasonPhrase("Too slow")},
+			wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT,
+		},
+		{
+			name:     "other error",
+			err:      errors.New("something broke"),
+			wantCode: model.MOQT_SESSION_TERMINATION_ERROR_CODE_INTERNAL_ERROR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, peer := newRawPeer(t, NewSessionState(RoleServer, 100, 0))
+
+			if err := sess.CloseWithError(tt.err); err != nil {
+				t.Fatalf("CloseWithError() unexpected error: %v", err)
+			}
+			// Only the first call has an effect
+			sess.CloseWithError(errors.New("too late"))
+
+			if err := waitTerminated(t, sess); err != tt.err {
+				t.Errorf("Err() = %v, want %v", err, tt.err)
+			}
+			if err := <-peer.runErr; err != tt.err {
+				t.Errorf("Run() returned %v, want %v", err, tt.err)
+			}
+			if code := peerCloseCode(t, peer); code != tt.wantCode {
+				t.Errorf("Connection closed with %#x, want %#x", uint64(code), uint64(tt.wantCode))
+			}
+		})
+	}
+}
@@ -55,6 +55,10 @@ type SessionState struct {
 	// We send updates to this value via MAX_REQUEST_ID control messages.
 	MaxIncomingRequestID uint64
 
+	// NextIncomingRequestID is the lowest ID the PEER didn't use yet.
+	// Client starts at 0, Server at 1 (increments by 2), a lower or reused ID is an INVALID_REQUEST_ID.
+	NextIncomingRequestID uint64
+
 	// --- Authorization State ---
 
 	// PeerMaxTokenCacheSize is the limit of token data the PEER is willing to store.
@@ -65,6 +69,15 @@ type SessionState struct {
 	// We use this to validate incoming REGISTER token requests from the peer.
 	LocalTokenCacheSize uint64
 
+	// PeerAuthTokens holds the tokens the PEER registered with us, bounded by LocalTokenCacheSize.
+	PeerAuthTokens *AuthTokenCache
+
+	// LocalAuthTokens mirrors the tokens WE registered with the peer, bounded by PeerMaxTokenCacheSize.
+	LocalAuthTokens *AuthTokenCache
+
+	// SetupAuthTokens are the AUTHORIZATION_TOKENs of the peer's CLIENT_SETUP (Server-side only), resolved to USE_VALUE.
+	SetupAuthTokens []control.AuthToken
+
 	// --- Extension State ---
 
 	// Extensions stores which optional features were successfully negotiated.
@@ -76,15 +89,19 @@ type SessionState struct {
 func NewSessionState(localRole Role, maxIncomingRequestId uint64, localTokenCacheSize uint64) *SessionState{
 	state := &SessionState{
 		LocalRole:             localRole,
-		NextOutgoingRequestID: uint64(localRole), // Client starts at 0, Server at 1
+		NextOutgoingRequestID: uint64(localRole),     // Client starts at 0, Server at 1
+		NextIncomingRequestID: uint64(1 - localRole), // The peer has the opposite role
 		MaxIncomingRequestID:  maxIncomingRequestId,
 		LocalTokenCacheSize:   localTokenCacheSize,
+		PeerAuthTokens:        NewAuthTokenCache(),
+		LocalAuthTokens:       NewAuthTokenCache(),
 	}
 	return state
 }
 
 // Populates session state's peer values (not local) with given setup parameters from the peer
-func (state *SessionState) FromParams(params []model.MoqtKeyValuePair){
+// Tokens are resolved against PeerAuthTokens, so MAX_AUTH_TOKEN_CACHE_SIZE must be set before, an invalid token terminates the session.
+func (state *SessionState) FromParams(params []model.MoqtKeyValuePair) error {
 	for _, param := range params{
 		switch param.Type{
 		case control.SetupParamMoqtImplementation:
@@ -97,12 +114,21 @@ func (state *SessionState) FromParams(params []model.MoqtKeyValuePair){
 			state.MaxOutgoingRequestID = param.ValueUInt64
 		case control.SetupParamMaxAuthTokenCacheSize:
 			state.PeerMaxTokenCacheSize = param.ValueUInt64
+		case control.SetupParamAuthToken:
+			resolved := []model.MoqtKeyValuePair{param}
+			if err := state.resolvePeerAuthTokens(&resolved); err != nil {
+				return err
+			}
+			tokens, err := control.AuthTokensFromParams(resolved)
+			if err != nil {
+				return err
+			}
+			state.SetupAuthTokens = append(state.SetupAuthTokens, tokens...)
 		default:
 			continue // Unknown parameter type, just ignore
-
-		// TODO: Implement the handling AuthToken setup parameter later on.
 		}
 	}
+	return nil
 }
 
 type Session struct {
@@ -113,6 +139,86 @@ type Session struct {
 
 	State *SessionState
 
-	trackAliases map[uint64]model.MoqtFullTrackName
+	MaxQueuedObjects int // Objects a subscription may have waiting to be read before it is unsubscribed, 0 uses the default of 1024. Set it before subscribing
+
+	// Tracks the peer publishes to us, keyed by Track Alias, as they are identified on data streams and datagrams
+	trackAliasesMutex sync.Mutex
+	trackAliases      map[uint64]model.MoqtFullTrackName
+	objectHandlers    map[uint64]ObjectHandler
+	streamTrackers    map[uint64]streamTracker // Only for aliases registered with one, e.g. by a Subscription
+	nextTrackAlias    uint64 // The next Track Alias we assign to a track WE publish, protected by trackAliasesMutex
+
+	trackAliasRegistered chan struct{} // Closed (and replaced) whenever a Track Alias is registered, protected by trackAliasesMutex
+
+	// Subscriptions to tracks of the peer that didn't end yet, started by our SUBSCRIBE or the peer's PUBLISH, keyed by Request ID.
+	// PUBLISH_DONE is routed here, the Request IDs of both endpoints never collide.
+	subscriptionsMutex sync.Mutex
+	subscriptions      map[uint64]*Subscription
+
+	// Namespaces announced with PUBLISH_NAMESPACE, keyed by MoqtTrackNamespace.Key(), protected by namespacesMutex
+	namespacesMutex     sync.Mutex
+	publishedNamespaces map[string]*PublishedNamespace // Namespaces WE published and the peer accepted
+	pendingNamespaces   map[string]struct{}            // Namespaces WE published that wait for the peer's answer
+	announcedNamespaces map[string]*AnnouncedNamespace // Namespaces the peer published, accepted or waiting for an answer
+
+	// Tracks WE deliver that didn't end yet, for SUBSCRIBEs we accepted and PUBLISHes the peer accepted, keyed by Request ID.
+	// REQUEST_UPDATE of the peer is routed here.
+	trackWritersMutex sync.Mutex
+	trackWriters      map[uint64]*TrackWriter
+
+	// Fetches WE sent that didn't end yet, keyed by Request ID, their FETCH_HEADER streams are routed here
+	fetchesMutex sync.Mutex
+	fetches      map[uint64]*Fetch
+
+	// handlersMutex protects the handlers below, they are read by Run and written by the application or the high-level APIs.
+	handlersMutex             sync.Mutex
+	messageHandlers           map[control.ControlMessageType]MessageHandler // Handlers for messages that open a request or notify us, keyed by message type
+	responseHandlers          map[uint64]ResponseHandler                    // One-shot handlers for responses to requests WE sent, keyed by Request ID
+	subscribeNamespaceHandler SubscribeNamespaceHandler                     // SUBSCRIBE_NAMESPACE arrives on its own stream, not through Run
+	authorizer                Authorizer                                    // Consulted for every request of the peer, nil authorizes everything
+
+	// Request ID flow control, protected by State.RequestIDMutex
+	openIncomingRequests    map[uint64]struct{} // Requests of the peer that didn't complete yet
+	skippedIncomingRequests map[uint64]struct{} // IDs above NextIncomingRequestID the peer already used
+	requestIDUpdated        chan struct{}       // Closed (and replaced) whenever the peer raises MaxOutgoingRequestID
+	requestsBlockedSent     bool                // Whether REQUESTS_BLOCKED was already sent for the current MaxOutgoingRequestID
+
+	// GOAWAY state, protected by goAwayMutex
+	goAwayMutex    sync.Mutex
+	goAwaySent     bool          // We sent GOAWAY, new requests of the peer are rejected
+	goAwayReceived chan struct{} // Closed when the peer sends GOAWAY
+	newSessionURI  string        // The New Session URI of the peer's GOAWAY, valid after goAwayReceived is closed
+
+	closeOnce sync.Once
+	closed    chan struct{} // Closed when the session terminates
+	closeErr  error         // The reason the session terminated, valid after closed is closed
+}
+
+// Creates a session on top of an established connection and its control stream.
+// The handshake is not performed here, see Client.InitiateSession and Server.InitateSession
+func NewSession(conn transport.MOQTConnection, controlStream transport.Stream, state *SessionState) *Session {
+	return &Session{
+		Conn:                    conn,
+		ControlStream:           controlStream,
+		Cmf:                     control.NewControlMessageFactory(controlStream),
+		State:                   state,
+		trackAliases:            make(map[uint64]model.MoqtFullTrackName),
+		objectHandlers:          make(map[uint64]ObjectHandler),
+		streamTrackers:          make(map[uint64]streamTracker),
+		trackAliasRegistered:    make(chan struct{}),
+		fetches:                 make(map[uint64]*Fetch),
+		subscriptions:           make(map[uint64]*Subscription),
+		trackWriters:            make(map[uint64]*TrackWriter),
+		publishedNamespaces:     make(map[string]*PublishedNamespace),
+		pendingNamespaces:       make(map[string]struct{}),
+		announcedNamespaces:     make(map[string]*AnnouncedNamespace),
+		messageHandlers:         make(map[control.ControlMessageType]MessageHandler),
+		responseHandlers:        make(map[uint64]ResponseHandler),
+		openIncomingRequests:    make(map[uint64]struct{}),
+		skippedIncomingRequests: make(map[uint64]struct{}),
+		requestIDUpdated:        make(chan struct{}),
+		goAwayReceived:          make(chan struct{}),
+		closed:                  make(chan struct{}),
+	}
 }
 
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/session/control"
+	"go-moq/pkg/transport"
+	moqtmemory "go-moq/pkg/transport/memory"
+	"testing"
+	"time"
+)
+
+// Returns a running client and server session connected over an in-memory connection, the handshake is skipped.
+func newSessionPair(t *testing.T) (client *Session, server *Session) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	p := testutil.NewPair(t)
+
+	clientState := NewSessionState(RoleClient, 100, 0)
+	clientState.MaxOutgoingRequestID = 100
+	serverState := NewSessionState(RoleServer, 100, 0)
+	serverState.MaxOutgoingRequestID = 100
+
+	client = NewSession(p.ClientConn, p.ClientStream, clientState)
+	server = NewSession(p.ServerConn, p.ServerStream, serverState)
+	go client.Run(ctx)
+	go server.Run(ctx)
+	return client, server
+}
+
+// The peer of a session under test, driven by hand on the control stream.
+type rawPeer struct {
+	*control.ControlMessageFactory
+	stream transport.Stream
+	conn   *moqtmemory.Connection
+	runErr chan error // What Run of the session returned
+}
+
+// Returns a running session whose peer is driven by hand, the handshake is skipped.
+func newRawPeer(t *testing.T, state *SessionState) (*Session, *rawPeer) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	p := testutil.NewPair(t)
+
+	sess := NewSession(p.ClientConn, p.ClientStream, state)
+	peer := &rawPeer{
+		ControlMessageFactory: control.NewControlMessageFactory(p.ServerStream),
+		stream:                p.ServerStream,
+		conn:                  p.ServerConn,
+		runErr:                make(chan error, 1),
+	}
+	go func() { peer.runErr <- sess.Run(ctx) }()
+	return sess, peer
+}
+
+// Reads the next control message the session sent to a raw peer.
+func readMessage(t *testing.T, peer *rawPeer) control.ControlMessage {
+	t.Helper()
+	type result struct {
+		msg control.ControlMessage
+		err error
+	}
+	read := make(chan result, 1)
+	go func() {
+		msg, err := peer.ReadControlMessage()
+		read <- result{msg, err}
+	}()
+
+	select {
+	case r := <-read:
+		if r.err != nil {
+			t.Fatalf("ReadControlMessage() unexpected error: %v", r.err)
+		}
+		return r.msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("ReadControlMessage() got no message")
+		return nil
+	}
+}
+
+// Waits until the session terminates and returns why.
+func waitTerminated(t *testing.T, sess *Session) error {
+	t.Helper()
+	select {
+	case <-sess.Done():
+		return sess.Err()
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Session wasn't terminated")
+		return nil
+	}
+}
@@ -0,0 +1,465 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+	"sync"
+	"time"
+)
+
+// How long the Track Alias of an ended subscription is kept for the data streams that PUBLISH_DONE reports, but that didn't arrive yet.
+const publishDoneStreamTimeout = 2 * time.Second
+
+// Objects a subscription may have waiting to be read before it is unsubscribed, used if Session.MaxQueuedObjects is 0
+const defaultMaxQueuedObjects = 1024
+
+// ErrTooFarBehind is returned by ReadObject once the subscription was unsubscribed because the reader didn't keep up.
+var ErrTooFarBehind = errors.New("subscription fell too far behind")
+
+// SubgroupResetError is returned by ReadObject after the objects of a subgroup stream that was reset, e.g. by the publisher
+// giving up on a group. The objects of the subgroup that didn't arrive are lost, the subscription goes on.
+type SubgroupResetError struct {
+	GroupID uint64
+	Err     model.MOQT_STREAM_RESET_ERROR
+}
+
+func (e *SubgroupResetError) Error() string {
+	return fmt.Sprintf("Subgroup stream of group %d was reset: %v", e.GroupID, e.Err)
+}
+
+func (e *SubgroupResetError) Unwrap() error {
+	return e.Err
+}
+
+// An entry of the queue of a subscription, an object or the reset of a subgroup stream that delivered the objects before it
+type queued struct {
+	obj   *model.MoqtObject
+	reset *SubgroupResetError
+}
+
+// SubscribeOption customizes the SUBSCRIBE message sent by Session.Subscribe.
+type SubscribeOption func(*control.SubscribeMessage)
+
+// Sets the SUBSCRIPTION_FILTER parameter, DefaultSubscriptionFilter (Largest Object) is used if omitted.
+func WithSubscriptionFilter(f control.SubscriptionFilter) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		sm.Parameters = append(sm.Parameters, f.ToParam())
+	}
+}
+
+func WithSubscriberPriority(priority uint8) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		sm.Parameters = append(sm.Parameters, uintParam(control.ParamSubscriberPriority, uint64(priority)))
+	}
+}
+
+// 0x1 ascending, 0x2 descending, the publisher decides if omitted.
+func WithGroupOrder(order uint64) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		sm.Parameters = append(sm.Parameters, uintParam(control.ParamGroupOrder, order))
+	}
+}
+
+// With forward set to false, the publisher accepts the subscription but doesn't send any objects.
+func WithForward(forward bool) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		var v uint64
+		if forward {
+			v = 1
+		}
+		sm.Parameters = append(sm.Parameters, uintParam(control.ParamForward, v))
+	}
+}
+
+// Attaches an AUTHORIZATION_TOKEN, REGISTER and DELETE are tracked against the peer's MAX_AUTH_TOKEN_CACHE_SIZE when sending.
+// Can be repeated to attach several tokens.
+func WithAuthToken(t control.AuthToken) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		sm.Parameters = append(sm.Parameters, t.ToParam())
+	}
+}
+
+// Appends arbitrary parameters, e.g. AUTHORIZATION_TOKEN or DELIVERY_TIMEOUT.
+func WithSubscribeParameters(params ...model.MoqtKeyValuePair) SubscribeOption {
+	return func(sm *control.SubscribeMessage) {
+		sm.Parameters = append(sm.Parameters, params...)
+	}
+}
+
+func uintParam(typ uint64, v uint64) model.MoqtKeyValuePair {
+	return model.MoqtKeyValuePair{Type: typ, KVPairType: model.MoqtKeyValuePairValueType_UInt64, ValueUInt64: v}
+}
+
+// Subscribe sends SUBSCRIBE for the track and waits for the publisher's answer.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR, on SUBSCRIBE_OK the objects of the track are delivered through the returned Subscription.
+// It blocks until the answer arrives, ctx is done or the session terminates, Run MUST be running.
+func (s *Session) Subscribe(ctx context.Context, ftn model.MoqtFullTrackName, opts ...SubscribeOption) (*Subscription, error) {
+	sm := &control.SubscribeMessage{FullTrackName: ftn}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	filter, err := sm.Filter()
+	if err != nil {
+		return nil, fmt.Errorf("Session.Subscribe(): %w", err)
+	}
+
+	if err := s.State.checkLocalAuthTokens(sm.Parameters); err != nil {
+		return nil, fmt.Errorf("Session.Subscribe(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.Subscribe(): %w", err)
+	}
+	sm.RequestID = requestID
+
+	sub := newSubscription(s, requestID, ftn)
+	sub.filter = filter
+	answer := make(chan error, 1)
+
+	// The alias is registered on the event loop, before any later message or data stream can be routed
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.SubscribeOkMessage:
+			if err := sub.onSubscribeOk(m); err != nil {
+				return err
+			}
+			answer <- nil
+		case *control.RequestErrorMessage:
+			answer <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to SUBSCRIBE", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(sm.Parameters, func() error {
+		return s.Cmf.WriteControlMessage(sm)
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		return nil, fmt.Errorf("Session.Subscribe(): Failed to send SUBSCRIBE message: %w", err)
+	}
+
+	select {
+	case err := <-answer:
+		if err != nil {
+			return nil, err
+		}
+		return sub, nil
+	case <-ctx.Done():
+		if err := sub.abandon(); err != nil {
+			return nil, fmt.Errorf("Session.Subscribe(): %w", err)
+		}
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, s.Err()
+	}
+}
+
+// Subscription is an accepted subscription to a track of the peer, started by our SUBSCRIBE or by the peer's PUBLISH.
+type Subscription struct {
+	RequestID     uint64 // The Request ID of our SUBSCRIBE, or of the peer's PUBLISH
+	TrackAlias    uint64 // Assigned by the publisher in SUBSCRIBE_OK or PUBLISH
+	FullTrackName model.MoqtFullTrackName
+	Parameters    []model.MoqtKeyValuePair // Parameters of SUBSCRIBE_OK or PUBLISH, e.g. LARGEST_OBJECT or EXPIRES
+
+	sess *Session
+
+	mu            sync.Mutex
+	filter        control.SubscriptionFilter  // The filter we asked for, narrowed by Update
+	start         model.MoqtLocation          // Where the subscription began, the filter resolved against the publisher's LARGEST_OBJECT
+	queue         []queued                    // Objects and resets that arrived but weren't read yet, in arrival order
+	notify        chan struct{}               // Signaled when the queue becomes non-empty
+	registered    bool                        // Whether the Track Alias is registered on the session
+	abandoned     bool                        // Whether Subscribe gave up waiting for the answer
+	unsubscribed  bool                        // Whether we sent UNSUBSCRIBE, later objects are dropped
+	tooFarBehind  bool                        // Whether the queue overflowed, ReadObject returns ErrTooFarBehind once it is drained
+	streamsOpened uint64                      // Subgroup streams of the track received so far
+	streamsActive int                         // Subgroup streams of the track that are still being read
+	done          *control.PublishDoneMessage // The PUBLISH_DONE that ended the subscription, nil while it goes on
+	releaseTimer  *time.Timer                 // Gives up on the streams PUBLISH_DONE reports, but that never arrive
+	ended         chan struct{}               // Closed once PUBLISH_DONE is received and every stream it reports is accounted for
+}
+
+func newSubscription(sess *Session, requestID uint64, ftn model.MoqtFullTrackName) *Subscription {
+	return &Subscription{
+		RequestID:     requestID,
+		FullTrackName: ftn,
+		sess:          sess,
+		filter:        control.DefaultSubscriptionFilter,
+		notify:        make(chan struct{}, 1),
+		ended:         make(chan struct{}),
+	}
+}
+
+func (sub *Subscription) onSubscribeOk(m *control.SubscribeOkMessage) error {
+	sub.mu.Lock()
+	if sub.abandoned {
+		// Nobody is waiting, the publisher is told to stop. Objects that are on their way are dropped as their alias is unknown
+		sub.unsubscribed = true
+		sub.mu.Unlock()
+		return sub.sendUnsubscribe()
+	}
+	defer sub.mu.Unlock()
+
+	largest, err := largestObjectFromParams(m.Parameters)
+	if err != nil {
+		return err
+	}
+	sub.start = sub.filter.Start(largest)
+
+	if err := sub.register(m.TrackAlias); err != nil {
+		return err
+	}
+	sub.Parameters = m.Parameters
+	sub.sess.addSubscription(sub)
+	return nil
+}
+
+// Routes the objects and the subgroup streams of the alias to the subscription, must be called with sub.mu held.
+func (sub *Subscription) register(alias uint64) error {
+	if err := sub.sess.registerTrackAlias(alias, sub.FullTrackName, sub.push, sub); err != nil {
+		return err
+	}
+	sub.TrackAlias = alias
+	sub.registered = true
+	return nil
+}
+
+// Called when Subscribe gives up, the answer might have been handled in the meantime.
+// If SUBSCRIBE_OK arrived already the publisher is told to stop, otherwise onSubscribeOk does it once it arrives.
+func (sub *Subscription) abandon() error {
+	sub.mu.Lock()
+	sub.abandoned = true
+	accepted := sub.unregister()
+	if accepted {
+		sub.unsubscribed = true
+	}
+	sub.mu.Unlock()
+
+	if accepted {
+		return sub.sendUnsubscribe()
+	}
+	return nil
+}
+
+// Called when we reject the peer's PUBLISH, objects that already arrived are dropped.
+func (sub *Subscription) reject() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.abandoned = true
+	sub.unregister()
+}
+
+// Unregisters the Track Alias and the subscription, reporting whether they were registered. Must be called with sub.mu held.
+func (sub *Subscription) unregister() bool {
+	if !sub.registered {
+		return false
+	}
+	sub.sess.UnregisterTrackAlias(sub.TrackAlias)
+	sub.sess.removeSubscription(sub.RequestID)
+	sub.registered = false
+	return true
+}
+
+// Called when the publisher ends the subscription with PUBLISH_DONE.
+// The Track Alias is only released once all the subgroup streams the publisher reports were received and read,
+// or after publishDoneStreamTimeout if some of them never show up.
+func (sub *Subscription) end(m *control.PublishDoneMessage) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.done != nil {
+		return
+	}
+	sub.done = m
+	if sub.streamsAccountedFor() {
+		sub.release()
+		return
+	}
+	sub.releaseTimer = time.AfterFunc(publishDoneStreamTimeout, func() {
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		sub.release()
+	})
+}
+
+// Must be called with sub.mu held, after PUBLISH_DONE was received.
+func (sub *Subscription) streamsAccountedFor() bool {
+	return sub.streamsOpened >= sub.done.StreamCount && sub.streamsActive == 0
+}
+
+// Unregisters the Track Alias and ends ReadObject, must be called with sub.mu held. Objects of streams arriving later are dropped.
+func (sub *Subscription) release() {
+	select {
+	case <-sub.ended:
+		return
+	default:
+	}
+
+	if sub.registered {
+		sub.sess.UnregisterTrackAlias(sub.TrackAlias)
+		sub.registered = false
+	}
+	if sub.releaseTimer != nil {
+		sub.releaseTimer.Stop()
+	}
+	close(sub.ended)
+}
+
+func (sub *Subscription) streamOpened() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.streamsOpened++
+	sub.streamsActive++
+}
+
+func (sub *Subscription) streamClosed() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.streamsActive--
+	if sub.done != nil && sub.streamsAccountedFor() {
+		sub.release()
+	}
+}
+
+// PublishDone returns the PUBLISH_DONE the publisher ended the subscription with, nil while the subscription goes on.
+func (sub *Subscription) PublishDone() *control.PublishDoneMessage {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.done
+}
+
+func (sub *Subscription) streamReset(err *SubgroupResetError) {
+	sub.enqueue(queued{reset: err})
+}
+
+// The ObjectHandler of the subscription, it never blocks.
+func (sub *Subscription) push(obj *model.MoqtObject) {
+	sub.enqueue(queued{obj: obj})
+}
+
+// Queues an object or a reset for ReadObject. A reader that falls more than Session.MaxQueuedObjects behind ends
+// the subscription, the publisher is told to stop with UNSUBSCRIBE.
+func (sub *Subscription) enqueue(q queued) {
+	sub.mu.Lock()
+	if sub.unsubscribed || sub.tooFarBehind {
+		sub.mu.Unlock()
+		return
+	}
+	if len(sub.queue) >= sub.sess.maxQueuedObjects() {
+		sub.tooFarBehind = true
+		unsubscribe := sub.done == nil
+		sub.unsubscribed = true
+		sub.mu.Unlock()
+
+		if unsubscribe {
+			go sub.sendUnsubscribe() // A failed write means the control stream is gone, Run reports that
+		}
+		return
+	}
+	sub.queue = append(sub.queue, q)
+	sub.mu.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default: // A signal is already pending
+	}
+}
+
+// ReadObject returns the next object of the track, from subgroup streams and datagrams alike, in the order they arrived.
+// It blocks until an object arrives, ctx is done or the session terminates.
+// Objects that arrived before the session terminated are still returned.
+// Once the publisher ended the subscription, the streams it reports were read and every queued object was read, io.EOF is returned, see PublishDone.
+// If the publisher ended it with an error status (i.e. not TRACK_ENDED or SUBSCRIPTION_ENDED), a model.MOQT_PUBLISH_DONE_ERROR is returned instead.
+// If objects were dropped because the reader fell too far behind, ErrTooFarBehind is returned after the queued objects.
+// A subgroup stream that was reset is reported by a *SubgroupResetError after its objects, reading goes on with the next call.
+func (sub *Subscription) ReadObject(ctx context.Context) (*model.MoqtObject, error) {
+	for {
+		sub.mu.Lock()
+		if len(sub.queue) > 0 {
+			q := sub.queue[0]
+			sub.queue[0] = queued{}
+			sub.queue = sub.queue[1:]
+			sub.mu.Unlock()
+			if q.reset != nil {
+				return nil, q.reset
+			}
+			return q.obj, nil
+		}
+		if sub.tooFarBehind {
+			sub.mu.Unlock()
+			return nil, ErrTooFarBehind
+		}
+		sub.mu.Unlock()
+
+		select {
+		case <-sub.notify:
+		case <-sub.ended:
+			sub.mu.Lock()
+			empty := len(sub.queue) == 0
+			done := sub.done
+			sub.mu.Unlock()
+			if !empty {
+				continue
+			}
+			if !done.StatusCode.IsNormal() {
+				return nil, done.ToError()
+			}
+			return nil, io.EOF
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-sub.sess.closed:
+			// An object might have been queued right before the session terminated
+			sub.mu.Lock()
+			empty := len(sub.queue) == 0
+			sub.mu.Unlock()
+			if empty {
+				return nil, sub.sess.Err()
+			}
+		}
+	}
+}
+
+func (s *Session) maxQueuedObjects() int {
+	if s.MaxQueuedObjects > 0 {
+		return s.MaxQueuedObjects
+	}
+	return defaultMaxQueuedObjects
+}
+
+func (s *Session) addSubscription(sub *Subscription) {
+	s.subscriptionsMutex.Lock()
+	defer s.subscriptionsMutex.Unlock()
+	s.subscriptions[sub.RequestID] = sub
+}
+
+func (s *Session) removeSubscription(requestID uint64) {
+	s.subscriptionsMutex.Lock()
+	defer s.subscriptionsMutex.Unlock()
+	delete(s.subscriptions, requestID)
+}
+
+// Handles PUBLISH_DONE from the peer, ending the subscription it refers to.
+func (s *Session) onPublishDone(msg *control.PublishDoneMessage) error {
+	s.subscriptionsMutex.Lock()
+	sub, ok := s.subscriptions[msg.RequestID]
+	delete(s.subscriptions, msg.RequestID)
+	s.subscriptionsMutex.Unlock()
+
+	if !ok {
+		return nil // A subscription we gave up on, or one that already ended
+	}
+	sub.end(msg)
+
+	// A PUBLISH of the peer is a request of the peer, it completes with PUBLISH_DONE, our own Request IDs are ignored
+	return s.CompleteIncomingRequest(msg.RequestID)
+}
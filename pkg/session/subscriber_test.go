@@ -0,0 +1,338 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/message"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionReadObject(t *testing.T) {
+	sess := NewSession(nil, nil, NewSessionState(RoleClient, 100, 0))
+	sub := newSubscription(sess, 0, testutil.FullTrackName("video", "live"))
+
+	// Objects of subgroup streams and datagrams are interleaved in arrival order
+	objects := []*model.MoqtObject{
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup},
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 1}, ObjectForwardingPreference: model.Datagram},
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 2}, ObjectForwardingPreference: model.Subgroup},
+	}
+	for _, obj := range objects {
+		sub.push(obj)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i, expected := range objects {
+		got, err := sub.ReadObject(ctx)
+		if err != nil {
+			t.Fatalf("ReadObject() #%d unexpected error: %v", i, err)
+		}
+		if got != expected {
+			t.Errorf("ReadObject() #%d got = %+v, want %+v", i, got, expected)
+		}
+	}
+
+	// A blocked reader is woken up by a later object
+	go sub.push(objects[0])
+	if got, err := sub.ReadObject(ctx); err != nil || got != objects[0] {
+		t.Errorf("ReadObject() after waiting got = %+v, %v", got, err)
+	}
+
+	// Queued objects are still delivered after the session terminated
+	sub.push(objects[1])
+	termErr := errors.New("terminated")
+	sess.closeErr = termErr
+	close(sess.closed)
+
+	if got, err := sub.ReadObject(ctx); err != nil || got != objects[1] {
+		t.Errorf("ReadObject() after termination got = %+v, %v", got, err)
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, termErr) {
+		t.Errorf("ReadObject() on an empty queue after termination error = %v, want %v", err, termErr)
+	}
+}
+
+func TestSubscriptionWaitsForStreams(t *testing.T) {
+	sess := NewSession(nil, nil, NewSessionState(RoleClient, 100, 0))
+	sub := newSubscription(sess, 0, testutil.FullTrackName("video", "live"))
+	sub.mu.Lock()
+	if err := sub.register(7); err != nil {
+		t.Fatalf("register() unexpected error: %v", err)
+	}
+	sub.mu.Unlock()
+
+	// PUBLISH_DONE overtakes the second of two streams, while the first one is still being read
+	sub.streamOpened()
+	sub.end(&control.PublishDoneMessage{StatusCode: control.PublishDoneTrackEnded, StreamCount: 2})
+	sub.streamClosed()
+	sub.streamOpened()
+	sub.push(&model.MoqtObject{Location: model.MoqtLocation{GroupId: 1}})
+
+	select {
+	case <-sub.ended:
+		t.Fatalf("Subscription ended before all of its streams were accounted for")
+	default:
+	}
+	if _, _, ok := sess.lookupTrackAlias(7); !ok {
+		t.Fatalf("Track Alias released before all of its streams were accounted for")
+	}
+
+	sub.streamClosed()
+	if _, _, ok := sess.lookupTrackAlias(7); ok {
+		t.Errorf("Track Alias still registered after all of its streams were accounted for")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := sub.ReadObject(ctx); err != nil {
+		t.Errorf("ReadObject() of the last object unexpected error: %v", err)
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadObject() after the end error = %v, want io.EOF", err)
+	}
+}
+
+func TestSubscribeEndToEnd(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	objects := []*model.MoqtObject{
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")},
+		{Location: model.MoqtLocation{GroupId: 0, ObjectId: 1}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("delta")},
+		{Location: model.MoqtLocation{GroupId: 1, ObjectId: 0}, ObjectForwardingPreference: model.Datagram, Payload: []byte("datagram")},
+	}
+
+	// Datagrams of a Track Alias the subscriber doesn't know yet are dropped, the datagram is sent once SUBSCRIBE_OK surely arrived
+	subgroupsRead := make(chan struct{})
+
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		go func() {
+			w, err := req.Accept()
+			if err != nil {
+				t.Errorf("Accept() unexpected error: %v", err)
+				return
+			}
+			for i, obj := range objects {
+				if obj.ObjectForwardingPreference == model.Datagram {
+					<-subgroupsRead
+				}
+				if err := w.WriteObject(obj); err != nil {
+					t.Errorf("WriteObject() #%d unexpected error: %v", i, err)
+				}
+			}
+			w.CloseGroup(0)
+		}()
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+
+	for i, expected := range objects {
+		if expected.ObjectForwardingPreference == model.Datagram {
+			close(subgroupsRead)
+		}
+		obj, err := sub.ReadObject(ctx)
+		if err != nil {
+			t.Fatalf("ReadObject() #%d unexpected error: %v", i, err)
+		}
+		if !obj.FullTrackName.Equal(track) {
+			t.Errorf("ReadObject() #%d got track %v, want %v", i, obj.FullTrackName, track)
+		}
+		if obj.Location != expected.Location || obj.ObjectForwardingPreference != expected.ObjectForwardingPreference || string(obj.Payload) != string(expected.Payload) {
+			t.Errorf("ReadObject() #%d got %+v %q, want %+v %q", i, obj.Location, obj.Payload, expected.Location, expected.Payload)
+		}
+	}
+}
+
+func TestSubscribeDoesNotExist(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	NewPublisher(server)
+
+	_, err := client.Subscribe(ctx, testutil.FullTrackName("video", "unknown"))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Fatalf("Subscribe() error = %v, want DOES_NOT_EXIST", err)
+	}
+
+	// A failed request doesn't affect the session
+	select {
+	case <-client.Done():
+		t.Errorf("Session terminated after a rejected request: %v", client.Err())
+	default:
+	}
+}
+
+func TestSubscribeCancelled(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	requests := make(chan *SubscribeRequest, 2)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		requests <- req
+	})
+
+	// SUBSCRIBE_OK arrives after the subscriber gave up
+	subCtx, cancel := context.WithCancel(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Subscribe(subCtx, track)
+		errs <- err
+	}()
+	req := <-requests
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Subscribe() error = %v, want context.Canceled", err)
+	}
+	w, err := req.Accept()
+	if err != nil {
+		t.Fatalf("Accept() unexpected error: %v", err)
+	}
+	select {
+	case <-w.Done():
+	case <-ctx.Done():
+		t.Fatalf("TrackWriter wasn't ended by UNSUBSCRIBE after SUBSCRIBE_OK arrived late")
+	}
+
+	// SUBSCRIBE_OK was handled before the subscriber gave up
+	writers := make(chan *TrackWriter, 1)
+	go func() {
+		w, err := (<-requests).Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	}()
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	writer := <-writers
+	if err := sub.abandon(); err != nil {
+		t.Fatalf("abandon() unexpected error: %v", err)
+	}
+	select {
+	case <-writer.Done():
+	case <-ctx.Done():
+		t.Fatalf("TrackWriter wasn't ended by UNSUBSCRIBE after the subscriber gave up")
+	}
+	if _, _, ok := client.lookupTrackAlias(sub.TrackAlias); ok {
+		t.Errorf("Track Alias %d is still registered after the subscriber gave up", sub.TrackAlias)
+	}
+}
+
+func TestSubscriptionTooFarBehind(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	client.MaxQueuedObjects = 2
+	track := testutil.FullTrackName("video", "live")
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	// Nothing is read, the third object overflows the queue
+	for object := uint64(0); object < 3; object++ {
+		obj := &model.MoqtObject{Location: model.MoqtLocation{ObjectId: object}, ObjectForwardingPreference: model.Subgroup}
+		if err := w.WriteObject(obj); err != nil {
+			t.Fatalf("WriteObject() #%d unexpected error: %v", object, err)
+		}
+	}
+	select {
+	case <-w.Done():
+	case <-ctx.Done():
+		t.Fatalf("TrackWriter wasn't ended by the UNSUBSCRIBE of the overflowing subscriber")
+	}
+
+	// The queued objects are still read, the loss is reported after them
+	for object := uint64(0); object < 2; object++ {
+		if got, err := sub.ReadObject(ctx); err != nil || got.Location.ObjectId != object {
+			t.Fatalf("ReadObject() #%d got = %+v, %v, want object %d", object, got, err, object)
+		}
+	}
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, ErrTooFarBehind) {
+		t.Errorf("ReadObject() after the overflow error = %v, want ErrTooFarBehind", err)
+	}
+}
+
+func TestSubscriptionSubgroupReset(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	// The publisher gives up on group 0 after its first object
+	stream, err := server.Conn.OpenUniStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenUniStreamSync() unexpected error: %v", err)
+	}
+	header, err := message.NewSubgroupHeader(w.TrackAlias, 0)
+	if err != nil {
+		t.Fatalf("NewSubgroupHeader() unexpected error: %v", err)
+	}
+	sw, err := message.NewSubgroupWriter(stream, header)
+	if err != nil {
+		t.Fatalf("NewSubgroupWriter() unexpected error: %v", err)
+	}
+	if err := sw.WriteObject(&model.MoqtObject{Location: model.MoqtLocation{GroupId: 0, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup}); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if got, err := sub.ReadObject(ctx); err != nil || got.Location != (model.MoqtLocation{}) {
+		t.Fatalf("ReadObject() got = %+v, %v, want object 0/0", got, err)
+	}
+	sw.Cancel(resetCode(model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED))
+
+	var resetErr *SubgroupResetError
+	if _, err := sub.ReadObject(ctx); !errors.As(err, &resetErr) || resetErr.GroupID != 0 || resetErr.Err.ErrorCode != model.MOQT_STREAM_RESET_ERROR_CODE_CANCELLED {
+		t.Fatalf("ReadObject() after the reset error = %v, want a SubgroupResetError of group 0 with CANCELLED", err)
+	}
+
+	// The subscription goes on
+	if err := w.WriteObject(&model.MoqtObject{Location: model.MoqtLocation{GroupId: 1, ObjectId: 0}, ObjectForwardingPreference: model.Subgroup}); err != nil {
+		t.Fatalf("WriteObject() unexpected error: %v", err)
+	}
+	if got, err := sub.ReadObject(ctx); err != nil || got.Location != (model.MoqtLocation{GroupId: 1}) {
+		t.Errorf("ReadObject() after the reset got = %+v, %v, want object 1/0", got, err)
+	}
+}
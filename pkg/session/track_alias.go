@@ -0,0 +1,108 @@
+package session
+
+import (
+	"fmt"
+	"go-moq/pkg/model"
+	"time"
+)
+
+// ObjectHandler receives the objects of a track the peer publishes to us, as they arrive on data streams or datagrams.
+// It is called from the goroutine reading the stream or the datagrams, so it MUST NOT block.
+type ObjectHandler func(obj *model.MoqtObject)
+
+// Notified about the subgroup streams of a Track Alias, so the end of a subscription can wait for the streams still in flight.
+// All are called from the goroutine reading the stream, without any lock of the session held. A reset stream is reported
+// by streamReset before it is closed.
+type streamTracker interface {
+	streamOpened()
+	streamReset(err *SubgroupResetError)
+	streamClosed()
+}
+
+// RegisterTrackAlias routes objects arriving with the given Track Alias to h, with their FullTrackName set to ftn.
+// Registering an alias that is already in use is a DUPLICATE_TRACK_ALIAS error.
+func (s *Session) RegisterTrackAlias(alias uint64, ftn model.MoqtFullTrackName, h ObjectHandler) error {
+	return s.registerTrackAlias(alias, ftn, h, nil)
+}
+
+// Like RegisterTrackAlias, the tracker is optional.
+func (s *Session) registerTrackAlias(alias uint64, ftn model.MoqtFullTrackName, h ObjectHandler, tracker streamTracker) error {
+	s.trackAliasesMutex.Lock()
+	defer s.trackAliasesMutex.Unlock()
+
+	if _, ok := s.trackAliases[alias]; ok {
+		return model.MOQT_SESSION_TERMINATION_ERROR{
+			ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_DUPLICATE_TRACK_ALIAS,
+			ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Track Alias %d is already in use", alias)),
+		}
+	}
+
+	s.trackAliases[alias] = ftn
+	s.objectHandlers[alias] = h
+	if tracker != nil {
+		s.streamTrackers[alias] = tracker
+	}
+
+	// Wake up the data streams that arrived before the alias was known
+	close(s.trackAliasRegistered)
+	s.trackAliasRegistered = make(chan struct{})
+	return nil
+}
+
+// UnregisterTrackAlias stops routing objects of the given Track Alias, objects arriving later are dropped.
+func (s *Session) UnregisterTrackAlias(alias uint64) {
+	s.trackAliasesMutex.Lock()
+	defer s.trackAliasesMutex.Unlock()
+
+	delete(s.trackAliases, alias)
+	delete(s.objectHandlers, alias)
+	delete(s.streamTrackers, alias)
+}
+
+// Returns the track and the handler registered for the alias, ok is false if the alias is unknown.
+func (s *Session) lookupTrackAlias(alias uint64) (model.MoqtFullTrackName, ObjectHandler, bool) {
+	s.trackAliasesMutex.Lock()
+	defer s.trackAliasesMutex.Unlock()
+
+	ftn, ok := s.trackAliases[alias]
+	return ftn, s.objectHandlers[alias], ok
+}
+
+// Like lookupTrackAlias, but waits up to timeout for the alias to be registered, the tracker is nil if none was registered.
+// Data streams can overtake the control message that tells us their alias (e.g. SUBSCRIBE_OK), so they are given a grace period.
+func (s *Session) waitTrackAlias(alias uint64, timeout time.Duration) (model.MoqtFullTrackName, ObjectHandler, streamTracker, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.trackAliasesMutex.Lock()
+		ftn, ok := s.trackAliases[alias]
+		h := s.objectHandlers[alias]
+		tracker := s.streamTrackers[alias]
+		registered := s.trackAliasRegistered
+		s.trackAliasesMutex.Unlock()
+
+		if ok {
+			return ftn, h, tracker, true
+		}
+
+		select {
+		case <-registered:
+		case <-timer.C:
+			return model.MoqtFullTrackName{}, nil, nil, false
+		case <-s.closed:
+			return model.MoqtFullTrackName{}, nil, nil, false
+		}
+	}
+}
+
+// AllocateTrackAlias returns a Track Alias that was never used before for a track WE publish on this session.
+// Aliases are scoped to the publisher, so they never collide with the ones the peer assigns.
+func (s *Session) AllocateTrackAlias() uint64 {
+	s.trackAliasesMutex.Lock()
+	defer s.trackAliasesMutex.Unlock()
+
+	alias := s.nextTrackAlias
+	s.nextTrackAlias++
+	return alias
+}
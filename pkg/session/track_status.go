@@ -0,0 +1,182 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"sync"
+)
+
+// TRACK_STATUS asks the publisher for the status of a track without subscribing to it (Section 9.19)
+// The publisher answers with REQUEST_OK carrying the parameters a SUBSCRIBE_OK would carry (LARGEST_OBJECT, EXPIRES, GROUP_ORDER),
+// or with REQUEST_ERROR, e.g. DOES_NOT_EXIST for an unknown track. No objects are delivered either way.
+
+// --- Subscriber side --- //
+
+// TrackStatus is the status of a track reported by the publisher.
+type TrackStatus struct {
+	FullTrackName   model.MoqtFullTrackName
+	ContentExists   bool               // Whether any object of the track was published, LargestLocation is only valid if true
+	LargestLocation model.MoqtLocation // The LARGEST_OBJECT parameter
+	Expires         uint64             // Milliseconds the status stays valid, 0 if the publisher didn't specify it
+	GroupOrder      uint64             // 0x0 if the publisher didn't specify it, 0x1 ascending, 0x2 descending
+	Parameters      []model.MoqtKeyValuePair
+}
+
+// TrackStatus sends TRACK_STATUS for the track and waits for the publisher's answer.
+// A REQUEST_ERROR is returned as model.MOQT_REQUEST_ERROR, DOES_NOT_EXIST if the publisher doesn't know the track.
+// It blocks until the answer arrives, ctx is done or the session terminates, Run MUST be running.
+func (s *Session) TrackStatus(ctx context.Context, ftn model.MoqtFullTrackName, params ...model.MoqtKeyValuePair) (*TrackStatus, error) {
+	if err := s.State.checkLocalAuthTokens(params); err != nil {
+		return nil, fmt.Errorf("Session.TrackStatus(): %w", err)
+	}
+
+	requestID, err := s.NextRequestID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Session.TrackStatus(): %w", err)
+	}
+
+	// Buffered, the handler never blocks even if we gave up waiting
+	answer := make(chan *TrackStatus, 1)
+	failed := make(chan error, 1)
+
+	s.HandleResponse(requestID, func(msg control.ControlMessage) error {
+		switch m := msg.(type) {
+		case *control.RequestOkMessage:
+			status, err := newTrackStatus(ftn, m.Parameters)
+			if err != nil {
+				return err
+			}
+			answer <- status
+		case *control.RequestErrorMessage:
+			failed <- m.ToError()
+		default:
+			return protocolViolation(fmt.Sprintf("Unexpected response (Type: %#X) to TRACK_STATUS", uint64(msg.Type())))
+		}
+		return nil
+	})
+
+	err = s.State.sendWithLocalAuthTokens(params, func() error {
+		return s.Cmf.WriteControlMessage(&control.TrackStatusMessage{RequestID: requestID, FullTrackName: ftn, Parameters: params})
+	})
+	if err != nil {
+		s.removeResponseHandler(requestID)
+		return nil, fmt.Errorf("Session.TrackStatus(): Failed to send TRACK_STATUS message: %w", err)
+	}
+
+	select {
+	case status := <-answer:
+		return status, nil
+	case err := <-failed:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, s.Err()
+	}
+}
+
+func newTrackStatus(ftn model.MoqtFullTrackName, params []model.MoqtKeyValuePair) (*TrackStatus, error) {
+	status := &TrackStatus{FullTrackName: ftn, Parameters: params}
+
+	var err error
+	if status.LargestLocation, status.ContentExists, err = control.LargestObjectFromParams(params); err != nil {
+		return nil, err
+	}
+	if status.GroupOrder, err = groupOrderFromParams(params); err != nil {
+		return nil, err
+	}
+	if param, ok := control.FindParam(params, control.ParamExpires); ok {
+		status.Expires = param.ValueUInt64
+	}
+	return status, nil
+}
+
+// --- Publisher side --- //
+
+// TrackStatusRequestHandler is called for every TRACK_STATUS of the peer.
+// The same rules of SubscribeRequestHandler apply, the request MUST be answered with TrackStatusRequest.Accept or TrackStatusRequest.Reject.
+type TrackStatusRequestHandler func(req *TrackStatusRequest)
+
+// HandleTrackStatus registers the handler for all TRACK_STATUS requests of the peer.
+// Without one, TRACK_STATUS is rejected with DOES_NOT_EXIST for tracks nobody publishes and with NOT_SUPPORTED otherwise.
+func (p *Publisher) HandleTrackStatus(h TrackStatusRequestHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trackStatusHandler = h
+}
+
+// TrackStatusRequest is an incoming TRACK_STATUS waiting for an answer.
+type TrackStatusRequest struct {
+	RequestID     uint64
+	FullTrackName model.MoqtFullTrackName
+	Parameters    []model.MoqtKeyValuePair
+
+	pub *Publisher
+
+	answerOnce sync.Once
+}
+
+func (p *Publisher) onTrackStatus(sess *Session, msg control.ControlMessage) error {
+	tsm := msg.(*control.TrackStatusMessage)
+
+	p.mu.Lock()
+	h := p.trackStatusHandler
+	p.mu.Unlock()
+
+	if h == nil {
+		if _, ok := p.lookup(tsm.FullTrackName); !ok {
+			return model.MOQT_REQUEST_ERROR{
+				RequestID:    tsm.RequestID,
+				ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST,
+				ReasonPhrase: model.NewReasonPhrase(fmt.Sprintf("Track %s is not published", tsm.FullTrackName.ToString())),
+			}
+		}
+		return model.MOQT_REQUEST_ERROR{
+			RequestID:    tsm.RequestID,
+			ErrorCode:    model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED,
+			ReasonPhrase: model.NewReasonPhrase("TRACK_STATUS is not supported"),
+		}
+	}
+
+	h(&TrackStatusRequest{
+		RequestID:     tsm.RequestID,
+		FullTrackName: tsm.FullTrackName,
+		Parameters:    tsm.Parameters,
+		pub:           p,
+	})
+	return nil
+}
+
+// Accept answers the request with REQUEST_OK carrying the status of the track as parameters,
+// see control.LargestObjectParam and control.ParamExpires. Omitting LARGEST_OBJECT reports that no object was published yet.
+func (req *TrackStatusRequest) Accept(params ...model.MoqtKeyValuePair) error {
+	err := fmt.Errorf("TrackStatusRequest.Accept(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		sess := req.pub.sess
+		err = sess.Cmf.WriteControlMessage(&control.RequestOkMessage{RequestID: req.RequestID, Parameters: params})
+		if err != nil {
+			err = fmt.Errorf("TrackStatusRequest.Accept(): Failed to send REQUEST_OK message: %w", err)
+			return
+		}
+		// The request is done once answered, nothing follows REQUEST_OK
+		err = sess.CompleteIncomingRequest(req.RequestID)
+	})
+	return err
+}
+
+// Reject answers the request with REQUEST_ERROR.
+func (req *TrackStatusRequest) Reject(code model.MOQT_REQUEST_ERROR_CODE, reason string) error {
+	err := fmt.Errorf("TrackStatusRequest.Reject(): Request %d was already answered", req.RequestID)
+
+	req.answerOnce.Do(func() {
+		err = req.pub.sess.RejectRequest(model.MOQT_REQUEST_ERROR{
+			RequestID:    req.RequestID,
+			ErrorCode:    code,
+			ReasonPhrase: model.NewReasonPhrase(reason),
+		})
+	})
+	return err
+}
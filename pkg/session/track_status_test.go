@@ -0,0 +1,80 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"testing"
+)
+
+func TestTrackStatus(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	live := testutil.FullTrackName("video", "live")
+	idle := testutil.FullTrackName("audio", "live")
+
+	pub := NewPublisher(server)
+	pub.HandleTrackStatus(func(req *TrackStatusRequest) {
+		switch {
+		case req.FullTrackName.Equal(live):
+			req.Accept(
+				control.LargestObjectParam(model.MoqtLocation{GroupId: 12, ObjectId: 4}),
+				uintParam(control.ParamExpires, 30000),
+				uintParam(control.ParamGroupOrder, 0x1),
+			)
+		case req.FullTrackName.Equal(idle):
+			req.Accept()
+		default:
+			req.Reject(model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST, "No such track")
+		}
+	})
+
+	status, err := client.TrackStatus(ctx, live)
+	if err != nil {
+		t.Fatalf("TrackStatus() unexpected error: %v", err)
+	}
+	if !status.ContentExists || !status.LargestLocation.Equal(model.MoqtLocation{GroupId: 12, ObjectId: 4}) || status.Expires != 30000 || status.GroupOrder != 0x1 {
+		t.Errorf("TrackStatus() got = %+v, want Largest Location {12 4}, Expires 30000 and ascending Group Order", status)
+	}
+
+	status, err = client.TrackStatus(ctx, idle)
+	if err != nil {
+		t.Fatalf("TrackStatus() of a track without objects unexpected error: %v", err)
+	}
+	if status.ContentExists {
+		t.Errorf("TrackStatus() of a track without objects got ContentExists = true, want false")
+	}
+
+	_, err = client.TrackStatus(ctx, testutil.FullTrackName("chat", "live"))
+	var reqErr model.MOQT_REQUEST_ERROR
+	if !errors.As(err, &reqErr) || reqErr.ErrorCode != model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST {
+		t.Errorf("TrackStatus() of an unknown track error = %v, want DOES_NOT_EXIST", err)
+	}
+}
+
+func TestTrackStatusWithoutHandler(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		req.Reject(model.MOQT_REQUEST_ERROR_CODE_INTERNAL_ERROR, "Unused")
+	})
+
+	tests := []struct {
+		ftn  model.MoqtFullTrackName
+		want model.MOQT_REQUEST_ERROR_CODE
+	}{
+		{track, model.MOQT_REQUEST_ERROR_CODE_NOT_SUPPORTED},
+		{testutil.FullTrackName("audio", "live"), model.MOQT_REQUEST_ERROR_CODE_DOES_NOT_EXIST},
+	}
+	for _, tt := range tests {
+		_, err := client.TrackStatus(ctx, tt.ftn)
+		var reqErr model.MOQT_REQUEST_ERROR
+		if !errors.As(err, &reqErr) || reqErr.ErrorCode != tt.want {
+			t.Errorf("TrackStatus(%s) error = %v, want code %#X", tt.ftn.ToString(), err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"fmt"
+	"go-moq/pkg/session/control"
+)
+
+// UNSUBSCRIBE ends a subscription from the subscriber side (Section 9.11)
+// The publisher resets the subgroup streams it still has open with CANCELLED and answers with PUBLISH_DONE (SUBSCRIPTION_ENDED),
+// whose Stream Count tells the subscriber how many streams to wait for before the Track Alias can be released.
+
+// --- Subscriber side --- //
+
+// Unsubscribe sends UNSUBSCRIBE, telling the publisher to stop delivering the track. Objects arriving afterwards are dropped,
+// the ones already queued can still be read. ReadObject returns io.EOF once the publisher answered with PUBLISH_DONE, see PublishDone.
+// Unsubscribing a subscription that already ended, or twice, does nothing.
+func (sub *Subscription) Unsubscribe() error {
+	sub.mu.Lock()
+	if sub.done != nil || sub.unsubscribed {
+		sub.mu.Unlock()
+		return nil
+	}
+	sub.unsubscribed = true
+	sub.mu.Unlock()
+
+	return sub.sendUnsubscribe()
+}
+
+func (sub *Subscription) sendUnsubscribe() error {
+	if err := sub.sess.Cmf.WriteControlMessage(&control.UnsubscribeMessage{RequestID: sub.RequestID}); err != nil {
+		return fmt.Errorf("Subscription.Unsubscribe(): Failed to send UNSUBSCRIBE message: %w", err)
+	}
+	return nil
+}
+
+// --- Publisher side --- //
+
+// Handles UNSUBSCRIBE from the peer, ending the track we deliver for the subscription.
+func (s *Session) onUnsubscribe(msg *control.UnsubscribeMessage) error {
+	s.trackWritersMutex.Lock()
+	w, ok := s.trackWriters[msg.RequestID]
+	s.trackWritersMutex.Unlock()
+
+	if !ok {
+		return nil // Already ended, our PUBLISH_DONE crossed the UNSUBSCRIBE
+	}
+	return w.end(control.PublishDoneSubscriptionEnded, "Unsubscribed", true)
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"errors"
+	"go-moq/internal/testutil"
+	"go-moq/pkg/model"
+	"go-moq/pkg/session/control"
+	"io"
+	"testing"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	ctx := testutil.Context(t)
+	client, server := newSessionPair(t)
+	track := testutil.FullTrackName("video", "live")
+
+	writers := make(chan *TrackWriter, 1)
+	pub := NewPublisher(server)
+	pub.HandleTrack(track, func(req *SubscribeRequest) {
+		w, err := req.Accept()
+		if err != nil {
+			t.Errorf("Accept() unexpected error: %v", err)
+		}
+		writers <- w
+	})
+
+	sub, err := client.Subscribe(ctx, track)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error: %v", err)
+	}
+	w := <-writers
+
+	// Two subgroup streams that are still open when the subscriber leaves
+	for group := uint64(0); group < 2; group++ {
+		obj := &model.MoqtObject{Location: model.MoqtLocation{GroupId: group}, ObjectForwardingPreference: model.Subgroup, Payload: []byte("key")}
+		if err := w.WriteObject(obj); err != nil {
+			t.Fatalf("WriteObject() unexpected error: %v", err)
+		}
+		if _, err := sub.ReadObject(ctx); err != nil {
+			t.Fatalf("ReadObject() #%d unexpected error: %v", group, err)
+		}
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe() unexpected error: %v", err)
+	}
+	select {
+	case <-w.Done():
+	case <-ctx.Done():
+		t.Fatalf("TrackWriter wasn't ended by UNSUBSCRIBE")
+	}
+	if err := w.WriteObject(&model.MoqtObject{ObjectForwardingPreference: model.Subgroup}); err == nil {
+		t.Errorf("WriteObject() after UNSUBSCRIBE expected an error, but got none")
+	}
+
+	if _, err := sub.ReadObject(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadObject() after UNSUBSCRIBE error = %v, want io.EOF", err)
+	}
+	done := sub.PublishDone()
+	if done.StatusCode != control.PublishDoneSubscriptionEnded || done.StreamCount != 2 {
+		t.Errorf("PublishDone() got = (%#x, %d streams), want (SUBSCRIPTION_ENDED, 2 streams)", uint64(done.StatusCode), done.StreamCount)
+	}
+	if _, _, ok := client.lookupTrackAlias(sub.TrackAlias); ok {
+		t.Errorf("Track Alias %d is still registered after the subscription ended", sub.TrackAlias)
+	}
+
+	// Reset streams only end the subscription, not the session
+	select {
+	case <-client.Done():
+		t.Errorf("Session terminated after UNSUBSCRIBE: %v", client.Err())
+	default:
+	}
+}
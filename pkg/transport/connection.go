@@ -38,4 +38,6 @@ type MOQTConnection interface {
 	CloseWithError(uint64 , string) error // Terminates the session with the given error information
 	Context() context.Context // Returns a context that lives throughout the connection (until it's closed)
 	RemoteHost() string // Returns the remote host address
+	SendDatagram([]byte) error // Sends an unreliable datagram, fails if the payload doesn't fit into a single datagram frame
+	ReceiveDatagram(context.Context) ([]byte, error) // Blocks until a datagram arrives, the context is done or the connection is closed
 }
\ No newline at end of file
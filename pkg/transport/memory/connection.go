@@ -0,0 +1,299 @@
+package moqtmemory // Package name follows moqtquic and moqtwebtransport.
+
+import (
+	"context"
+	"fmt"
+	"go-moq/pkg/transport"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// An in-process transport.MOQTConnection, for tests that need a client and a server without certificates or sockets.
+// Stream IDs, stream cancellation and connection close behave like QUIC, there is no flow control and no packet loss,
+// except for datagrams, which are dropped when the receiver doesn't keep up.
+
+// MaxDatagramSize is the largest datagram payload SendDatagram accepts, roughly what fits into a QUIC packet.
+const MaxDatagramSize = 1200
+
+// How many streams and datagrams may wait to be accepted or received, beyond that OpenStream fails and datagrams are dropped.
+const (
+	maxPendingStreams   = 256
+	maxPendingDatagrams = 256
+)
+
+// State shared by both ends of the connection
+type pair struct {
+	mu     sync.Mutex
+	closed bool
+	pipes  []pipeEnd // Every pipe ever opened, failed on close
+}
+
+type pipeEnd struct {
+	p      *pipe
+	writer *Connection
+}
+
+type Connection struct {
+	// WebTransport makes IsWebTransport report true, to exercise the WebTransport specific paths of the handshake.
+	WebTransport bool
+
+	pair        *pair
+	peer        *Connection
+	perspective quic.StreamID // 0 for the client end, 1 for the server end
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	streams    chan *Stream        // Bidirectional streams opened by the peer, waiting to be accepted
+	uniStreams chan *ReceiveStream // Unidirectional streams opened by the peer, waiting to be accepted
+	datagrams  chan []byte         // Datagrams sent by the peer, waiting to be received
+
+	// QUIC numbering: the two low bits tell the initiator (client 0, server 1) and the directionality (bidi 0, uni 2)
+	idMutex    sync.Mutex
+	nextBidiID quic.StreamID
+	nextUniID  quic.StreamID
+}
+
+// NewPair returns both ends of a new connection, the first one takes the client role in stream numbering.
+func NewPair() (client *Connection, server *Connection) {
+	pr := &pair{}
+	client = newConnection(pr, 0)
+	server = newConnection(pr, 1)
+	client.peer = server
+	server.peer = client
+	return client, server
+}
+
+func newConnection(pr *pair, perspective quic.StreamID) *Connection {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Connection{
+		pair:        pr,
+		perspective: perspective,
+		ctx:         ctx,
+		cancel:      cancel,
+		streams:     make(chan *Stream, maxPendingStreams),
+		uniStreams:  make(chan *ReceiveStream, maxPendingStreams),
+		datagrams:   make(chan []byte, maxPendingDatagrams),
+		nextBidiID:  perspective,
+		nextUniID:   perspective | 2,
+	}
+}
+
+// Returns the error the connection was closed with, nil if it is still open.
+func (c *Connection) closeErr() error {
+	if c.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(c.ctx)
+}
+
+// Registers a pipe, so it fails when the connection is closed.
+func (c *Connection) newPipe(id quic.StreamID, writer *Connection) (*pipe, error) {
+	c.pair.mu.Lock()
+	defer c.pair.mu.Unlock()
+
+	if c.pair.closed {
+		return nil, c.closeErr()
+	}
+	p := newPipe(id)
+	c.pair.pipes = append(c.pair.pipes, pipeEnd{p: p, writer: writer})
+	return p, nil
+}
+
+func (c *Connection) nextStreamID(uni bool) quic.StreamID {
+	c.idMutex.Lock()
+	defer c.idMutex.Unlock()
+
+	if uni {
+		id := c.nextUniID
+		c.nextUniID += 4
+		return id
+	}
+	id := c.nextBidiID
+	c.nextBidiID += 4
+	return id
+}
+
+// Returns our end and the peer's end of a new bidirectional stream.
+func (c *Connection) newStream() (*Stream, *Stream, error) {
+	id := c.nextStreamID(false)
+	out, err := c.newPipe(id, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err := c.newPipe(id, c.peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Stream{send: out, recv: in}, &Stream{send: in, recv: out}, nil
+}
+
+// Returns our end and the peer's end of a new unidirectional stream.
+func (c *Connection) newUniStream() (*SendStream, *ReceiveStream, error) {
+	p, err := c.newPipe(c.nextStreamID(true), c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &SendStream{p: p}, &ReceiveStream{p: p}, nil
+}
+
+// moqtmemory.Connection implements transport.MOQTConnection
+
+func (c *Connection) OpenStream() (transport.Stream, error) {
+	local, remote, err := c.newStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtmemory.OpenStream():\n\t Failed to open stream:\n\t: %w", err)
+	}
+
+	select {
+	case c.peer.streams <- remote:
+		return local, nil
+	default:
+		return nil, fmt.Errorf("moqtmemory.OpenStream():\n\t Failed to open stream:\n\t: too many streams waiting to be accepted")
+	}
+}
+
+func (c *Connection) OpenStreamSync(ctx context.Context) (transport.Stream, error) {
+	local, remote, err := c.newStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtmemory.OpenStreamSync():\n\t Failed to open stream:\n\t: %w", err)
+	}
+
+	select {
+	case c.peer.streams <- remote:
+		return local, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.OpenStreamSync():\n\t Failed to open stream:\n\t: %w", ctx.Err())
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.OpenStreamSync():\n\t Failed to open stream:\n\t: %w", c.closeErr())
+	}
+}
+
+func (c *Connection) OpenUniStream() (transport.SendStream, error) {
+	local, remote, err := c.newUniStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtmemory.OpenUniStream():\n\t Failed to open unistream:\n\t: %w", err)
+	}
+
+	select {
+	case c.peer.uniStreams <- remote:
+		return local, nil
+	default:
+		return nil, fmt.Errorf("moqtmemory.OpenUniStream():\n\t Failed to open unistream:\n\t: too many streams waiting to be accepted")
+	}
+}
+
+func (c *Connection) OpenUniStreamSync(ctx context.Context) (transport.SendStream, error) {
+	local, remote, err := c.newUniStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtmemory.OpenUniStreamSync():\n\t Failed to open unistream:\n\t: %w", err)
+	}
+
+	select {
+	case c.peer.uniStreams <- remote:
+		return local, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.OpenUniStreamSync():\n\t Failed to open unistream:\n\t: %w", ctx.Err())
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.OpenUniStreamSync():\n\t Failed to open unistream:\n\t: %w", c.closeErr())
+	}
+}
+
+func (c *Connection) AcceptStream(ctx context.Context) (transport.Stream, error) {
+	select {
+	case s := <-c.streams:
+		return s, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.AcceptStream():\n\t Failed to accept stream:\n\t: %w", ctx.Err())
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.AcceptStream():\n\t Failed to accept stream:\n\t: %w", c.closeErr())
+	}
+}
+
+func (c *Connection) AcceptUniStream(ctx context.Context) (transport.ReceiveStream, error) {
+	select {
+	case s := <-c.uniStreams:
+		return s, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.AcceptUniStream():\n\t Failed to accept unistream:\n\t: %w", ctx.Err())
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("moqtmemory.AcceptUniStream():\n\t Failed to accept unistream:\n\t: %w", c.closeErr())
+	}
+}
+
+func (c *Connection) IsWebTransport() bool {
+	return c.WebTransport
+}
+
+// CloseWithError closes both ends, the peer observes a *quic.ApplicationError with Remote set.
+// Every stream of the connection fails, only the first call has an effect.
+func (c *Connection) CloseWithError(code uint64, reason string) error {
+	c.pair.mu.Lock()
+	defer c.pair.mu.Unlock()
+
+	if c.pair.closed {
+		return nil
+	}
+	c.pair.closed = true
+
+	localErr := &quic.ApplicationError{Remote: false, ErrorCode: quic.ApplicationErrorCode(code), ErrorMessage: reason}
+	remoteErr := &quic.ApplicationError{Remote: true, ErrorCode: quic.ApplicationErrorCode(code), ErrorMessage: reason}
+	c.cancel(localErr)
+	c.peer.cancel(remoteErr)
+
+	for _, pe := range c.pair.pipes {
+		if pe.writer == c {
+			pe.p.closeWithError(localErr, remoteErr)
+		} else {
+			pe.p.closeWithError(remoteErr, localErr)
+		}
+	}
+	c.pair.pipes = nil
+	return nil
+}
+
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Connection) RemoteHost() string {
+	if c.peer.perspective == 0 {
+		return "memory-client"
+	}
+	return "memory-server"
+}
+
+func (c *Connection) SendDatagram(b []byte) error {
+	if err := c.closeErr(); err != nil {
+		return err
+	}
+	if len(b) > MaxDatagramSize {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: MaxDatagramSize}
+	}
+
+	cp := make([]byte, len(b)) // The caller may reuse b
+	copy(cp, b)
+
+	select {
+	case c.peer.datagrams <- cp:
+	default: // Datagrams are unreliable, the receiver is too slow
+	}
+	return nil
+}
+
+func (c *Connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-c.datagrams:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, c.closeErr()
+	}
+}
+
+// CloseError returns the error the connection was closed with, a *quic.ApplicationError, nil while it is open.
+func (c *Connection) CloseError() error {
+	return c.closeErr()
+}
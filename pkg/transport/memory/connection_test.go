@@ -0,0 +1,155 @@
+package moqtmemory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestBidirectionalStream(t *testing.T) {
+	ctx := testContext(t)
+	client, server := NewPair()
+
+	cs, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync() unexpected error: %v", err)
+	}
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() unexpected error: %v", err)
+	}
+
+	cs.Write([]byte("ping"))
+	cs.Close()
+	got, err := io.ReadAll(ss)
+	if err != nil || string(got) != "ping" {
+		t.Errorf("server read got = %q, %v, want \"ping\"", got, err)
+	}
+
+	// The other direction is independent of the client's FIN
+	ss.Write([]byte("pong"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(cs, buf); err != nil || string(buf) != "pong" {
+		t.Errorf("client read got = %q, %v, want \"pong\"", buf, err)
+	}
+}
+
+func TestStreamIDs(t *testing.T) {
+	client, server := NewPair()
+
+	ids := []struct {
+		name     string
+		open     func() (quic.StreamID, error)
+		expected quic.StreamID
+	}{
+		{"Client bidi", func() (quic.StreamID, error) { s, err := client.OpenStream(); return s.(*Stream).send.id, err }, 0},
+		{"Client bidi 2", func() (quic.StreamID, error) { s, err := client.OpenStream(); return s.(*Stream).send.id, err }, 4},
+		{"Server bidi", func() (quic.StreamID, error) { s, err := server.OpenStream(); return s.(*Stream).send.id, err }, 1},
+		{"Client uni", func() (quic.StreamID, error) { s, err := client.OpenUniStream(); return s.(*SendStream).p.id, err }, 2},
+		{"Server uni", func() (quic.StreamID, error) { s, err := server.OpenUniStream(); return s.(*SendStream).p.id, err }, 3},
+	}
+	for _, tt := range ids {
+		id, err := tt.open()
+		if err != nil || id != tt.expected {
+			t.Errorf("%s: got ID %d, %v, want %d", tt.name, id, err, tt.expected)
+		}
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	ctx := testContext(t)
+	client, server := NewPair()
+
+	// RESET_STREAM: the reader sees the code, buffered data is discarded
+	ss, _ := server.OpenUniStreamSync(ctx)
+	cr, _ := client.AcceptUniStream(ctx)
+	ss.Write([]byte("discarded"))
+	ss.CancelWrite(7)
+
+	var streamErr *quic.StreamError
+	if _, err := cr.Read(make([]byte, 16)); !errors.As(err, &streamErr) || streamErr.ErrorCode != 7 || !streamErr.Remote {
+		t.Errorf("Read() after CancelWrite error = %v, want remote StreamError with code 7", err)
+	}
+
+	// STOP_SENDING: the writer sees the code on its next write
+	ss, _ = server.OpenUniStreamSync(ctx)
+	cr, _ = client.AcceptUniStream(ctx)
+	cr.CancelRead(3)
+
+	if _, err := ss.Write([]byte("x")); !errors.As(err, &streamErr) || streamErr.ErrorCode != 3 || !streamErr.Remote {
+		t.Errorf("Write() after CancelRead error = %v, want remote StreamError with code 3", err)
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	ctx := testContext(t)
+	client, server := NewPair()
+
+	cs, _ := client.OpenStreamSync(ctx)
+	ss, _ := server.AcceptStream(ctx)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := ss.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	client.CloseWithError(0x3, "protocol violation")
+
+	var appErr *quic.ApplicationError
+	select {
+	case err := <-readErr:
+		if !errors.As(err, &appErr) || appErr.ErrorCode != 0x3 || !appErr.Remote {
+			t.Errorf("blocked Read() error = %v, want remote ApplicationError with code 0x3", err)
+		}
+	case <-ctx.Done():
+		t.Fatalf("blocked Read() wasn't woken up by CloseWithError")
+	}
+
+	if _, err := cs.Write([]byte("x")); !errors.As(err, &appErr) || appErr.Remote {
+		t.Errorf("Write() after local close error = %v, want local ApplicationError", err)
+	}
+	if err := server.CloseError(); !errors.As(err, &appErr) || appErr.ErrorMessage != "protocol violation" {
+		t.Errorf("CloseError() = %v, want the reason of the peer", err)
+	}
+	if server.Context().Err() == nil {
+		t.Errorf("Context() of the peer is not done after close")
+	}
+	if _, err := server.AcceptUniStream(ctx); !errors.As(err, &appErr) {
+		t.Errorf("AcceptUniStream() after close error = %v, want ApplicationError", err)
+	}
+	if _, err := server.OpenUniStream(); err == nil {
+		t.Errorf("OpenUniStream() after close succeeded")
+	}
+}
+
+func TestDatagrams(t *testing.T) {
+	ctx := testContext(t)
+	client, server := NewPair()
+
+	b := []byte("datagram")
+	if err := client.SendDatagram(b); err != nil {
+		t.Fatalf("SendDatagram() unexpected error: %v", err)
+	}
+	b[0] = 'X' // The sender may reuse its buffer
+
+	got, err := server.ReceiveDatagram(ctx)
+	if err != nil || string(got) != "datagram" {
+		t.Errorf("ReceiveDatagram() got = %q, %v, want \"datagram\"", got, err)
+	}
+
+	var tooLarge *quic.DatagramTooLargeError
+	if err := client.SendDatagram(make([]byte, MaxDatagramSize+1)); !errors.As(err, &tooLarge) {
+		t.Errorf("SendDatagram() of an oversized payload error = %v, want DatagramTooLargeError", err)
+	}
+}
@@ -0,0 +1,191 @@
+package moqtmemory
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Concrete stream implementations for "transport.Stream", "transport.SendStream", "transport.ReceiveStream" on top of in-process pipes.
+// Errors mimic quic-go, so code under test sees the same *quic.StreamError and *quic.ApplicationError values it would see on a real connection.
+
+var errWriteAfterClose = errors.New("write on closed stream")
+
+// pipe carries the bytes of one direction of a stream, it is unbounded, there is no flow control.
+type pipe struct {
+	id quic.StreamID
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      bytes.Buffer
+	fin      bool  // The writer closed the stream, the reader gets io.EOF after draining buf
+	writeErr error // Returned to the writer, set by CancelWrite, CancelRead of the peer or connection close
+	readErr  error // Returned to the reader, set by CancelRead, CancelWrite of the peer or connection close
+}
+
+func newPipe(id quic.StreamID) *pipe {
+	p := &pipe{id: id}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr != nil {
+		return 0, p.writeErr
+	}
+	if p.fin {
+		return 0, errWriteAfterClose
+	}
+	p.buf.Write(b)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *pipe) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr != nil {
+		return p.writeErr
+	}
+	p.fin = true
+	p.cond.Broadcast()
+	return nil
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.buf.Len() == 0 && !p.fin && p.readErr == nil {
+		p.cond.Wait()
+	}
+	if p.readErr != nil {
+		return 0, p.readErr
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(b)
+	}
+	return 0, io.EOF
+}
+
+// RESET_STREAM, data that wasn't read yet is discarded like on a real connection.
+func (p *pipe) cancelWrite(code quic.StreamErrorCode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr != nil {
+		return
+	}
+	p.writeErr = &quic.StreamError{StreamID: p.id, ErrorCode: code, Remote: false}
+	if p.readErr == nil {
+		p.readErr = &quic.StreamError{StreamID: p.id, ErrorCode: code, Remote: true}
+	}
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
+
+// STOP_SENDING, the writer's next write fails with the code.
+func (p *pipe) cancelRead(code quic.StreamErrorCode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.readErr != nil {
+		return
+	}
+	p.readErr = &quic.StreamError{StreamID: p.id, ErrorCode: code, Remote: false}
+	if p.writeErr == nil && !p.fin {
+		p.writeErr = &quic.StreamError{StreamID: p.id, ErrorCode: code, Remote: true}
+	}
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
+
+// Fails both ends of the pipe, used when the connection is closed.
+func (p *pipe) closeWithError(writeErr error, readErr error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr == nil {
+		p.writeErr = writeErr
+	}
+	if p.readErr == nil {
+		p.readErr = readErr
+	}
+	p.cond.Broadcast()
+}
+
+type SendStream struct {
+	p *pipe
+}
+
+// moqtmemory.SendStream implements transport.SendStream
+
+// io.Writer implementation
+func (s *SendStream) Write(b []byte) (n int, err error) {
+	return s.p.write(b)
+}
+
+// io.Closer implementation
+func (s *SendStream) Close() error {
+	return s.p.close()
+}
+
+// CancelWrite implementation
+func (s *SendStream) CancelWrite(code quic.StreamErrorCode) {
+	s.p.cancelWrite(code)
+}
+
+type ReceiveStream struct {
+	p *pipe
+}
+
+// moqtmemory.ReceiveStream implements transport.ReceiveStream
+
+// io.Reader implementation
+func (s *ReceiveStream) Read(b []byte) (n int, err error) {
+	return s.p.read(b)
+}
+
+// CancelRead implementation
+func (s *ReceiveStream) CancelRead(code quic.StreamErrorCode) {
+	s.p.cancelRead(code)
+}
+
+type Stream struct {
+	send *pipe
+	recv *pipe
+}
+
+// moqtmemory.Stream implements transport.Stream
+
+// io.Reader implementation
+func (s *Stream) Read(b []byte) (n int, err error) {
+	return s.recv.read(b)
+}
+
+// CancelRead implementation
+func (s *Stream) CancelRead(code quic.StreamErrorCode) {
+	s.recv.cancelRead(code)
+}
+
+// io.Writer implementation
+func (s *Stream) Write(b []byte) (n int, err error) {
+	return s.send.write(b)
+}
+
+// io.Closer implementation
+func (s *Stream) Close() error {
+	return s.send.close()
+}
+
+// CancelWrite implementation
+func (s *Stream) CancelWrite(code quic.StreamErrorCode) {
+	s.send.cancelWrite(code)
+}
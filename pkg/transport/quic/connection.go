@@ -94,4 +94,12 @@ func (c *Connection) Context() context.Context {
 
 func (c *Connection) RemoteHost() string {
 	return c.Conn.RemoteAddr().String()
+}
+
+func (c *Connection) SendDatagram(b []byte) error {
+	return c.Conn.SendDatagram(b)
+}
+
+func (c *Connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return c.Conn.ReceiveDatagram(ctx)
 }
\ No newline at end of file
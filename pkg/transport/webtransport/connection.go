@@ -0,0 +1,112 @@
+package moqtwebtransport // Package name is not made "webtransport" in order to prevent confusion with "webtransport-go" "webtransport" package.
+
+import (
+	"context"
+	"fmt"
+	"go-moq/pkg/transport"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+type Connection struct {
+	Session *webtransport.Session
+}
+
+// moqtwebtransport.Connection implements transport.Connection
+
+func (c *Connection) OpenStream() (transport.Stream, error) {
+	s, err := c.Session.OpenStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.OpenStream():\n\t Failed to open stream:\n\t: %w", err)
+	}
+
+	return &Stream{ // keep in mind that this is of type moqtwebtransport.Stream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) OpenStreamSync(ctx context.Context) (transport.Stream, error) {
+	s, err := c.Session.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.OpenStreamSync():\n\t Failed to open stream:\n\t: %w", err)
+	}
+
+	return &Stream{ // keep in mind that this is of type moqtwebtransport.Stream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) OpenUniStream() (transport.SendStream, error) {
+	s, err := c.Session.OpenUniStream()
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.OpenUniStream():\n\t Failed to open unistream:\n\t: %w", err)
+	}
+
+	return &SendStream{ // keep in mind that this is of type moqtwebtransport.SendStream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) OpenUniStreamSync(ctx context.Context) (transport.SendStream, error) {
+	s, err := c.Session.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.OpenUniStreamSync():\n\t Failed to open unistream:\n\t: %w", err)
+	}
+
+	return &SendStream{ // keep in mind that this is of type moqtwebtransport.SendStream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) AcceptStream(ctx context.Context) (transport.Stream, error) {
+	s, err := c.Session.AcceptStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.AcceptStream():\n\t Failed to accept stream:\n\t: %w", err)
+	}
+
+	return &Stream{ // keep in mind that this is of type moqtwebtransport.Stream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) AcceptUniStream(ctx context.Context) (transport.ReceiveStream, error) {
+	s, err := c.Session.AcceptUniStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moqtwebtransport.AcceptUniStream():\n\t Failed to accept unistream:\n\t: %w", err)
+	}
+
+	return &ReceiveStream{ // keep in mind that this is of type moqtwebtransport.ReceiveStream
+		stream: s,
+		sess:   c.Session,
+	}, nil
+}
+
+func (c *Connection) IsWebTransport() bool {
+	return true
+}
+
+// WebTransport session error codes are 32 bits, MOQT termination codes all fit into that range.
+func (c *Connection) CloseWithError(code uint64, reason string) error {
+	return c.Session.CloseWithError(webtransport.SessionErrorCode(code), reason)
+}
+
+func (c *Connection) Context() context.Context {
+	return c.Session.Context()
+}
+
+func (c *Connection) RemoteHost() string {
+	return c.Session.RemoteAddr().String()
+}
+
+func (c *Connection) SendDatagram(b []byte) error {
+	return c.Session.SendDatagram(b)
+}
+
+func (c *Connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return c.Session.ReceiveDatagram(ctx)
+}
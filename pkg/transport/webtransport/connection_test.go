@@ -0,0 +1,293 @@
+package moqtwebtransport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// Returns a self-signed certificate for 127.0.0.1 and the pool trusting it.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() unexpected error: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// Returns both ends of a WebTransport session over a loopback UDP socket.
+func newLoopback(t *testing.T) (client *Connection, server *Connection) {
+	t.Helper()
+	ctx := testContext(t)
+	cert, pool := selfSignedCert(t)
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() unexpected error: %v", err)
+	}
+
+	accepted := make(chan *webtransport.Session, 1)
+	mux := http.NewServeMux()
+	wtServer := &webtransport.Server{
+		H3: http3.Server{
+			TLSConfig:  http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+			QUICConfig: &quic.Config{EnableDatagrams: true},
+			Handler:    mux,
+		},
+	}
+	mux.HandleFunc("/moq", func(w http.ResponseWriter, r *http.Request) {
+		sess, err := wtServer.Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade() unexpected error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		accepted <- sess
+	})
+	go wtServer.Serve(udpConn)
+	t.Cleanup(func() {
+		wtServer.Close()
+		udpConn.Close()
+	})
+
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{RootCAs: pool, NextProtos: []string{http3.NextProtoH3}},
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+	}
+	t.Cleanup(func() { dialer.Close() })
+	url := fmt.Sprintf("https://%s/moq", udpConn.LocalAddr())
+	rsp, sess, err := dialer.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Dial(%s) unexpected error: %v", url, err)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Dial(%s) status = %d, want 200", url, rsp.StatusCode)
+	}
+
+	select {
+	case serverSess := <-accepted:
+		return &Connection{Session: sess}, &Connection{Session: serverSess}
+	case <-ctx.Done():
+		t.Fatalf("The server didn't accept the session")
+		return nil, nil
+	}
+}
+
+func TestConnection(t *testing.T) {
+	client, server := newLoopback(t)
+
+	if !client.IsWebTransport() || !server.IsWebTransport() {
+		t.Errorf("IsWebTransport() = false, want true")
+	}
+	_, port, err := net.SplitHostPort(server.RemoteHost())
+	if err != nil || port != fmt.Sprint(client.Session.LocalAddr().(*net.UDPAddr).Port) {
+		t.Errorf("RemoteHost() of the server = %q, want the client's port %d", server.RemoteHost(), client.Session.LocalAddr().(*net.UDPAddr).Port)
+	}
+}
+
+func TestBidirectionalStream(t *testing.T) {
+	ctx := testContext(t)
+	client, server := newLoopback(t)
+
+	cs, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync() unexpected error: %v", err)
+	}
+	// The peer learns about the stream with its first bytes
+	cs.Write([]byte("ping"))
+	cs.Close()
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() unexpected error: %v", err)
+	}
+	got, err := io.ReadAll(ss)
+	if err != nil || string(got) != "ping" {
+		t.Errorf("server read got = %q, %v, want \"ping\"", got, err)
+	}
+
+	ss.Write([]byte("pong"))
+	ss.Close()
+	got, err = io.ReadAll(cs)
+	if err != nil || string(got) != "pong" {
+		t.Errorf("client read got = %q, %v, want \"pong\"", got, err)
+	}
+}
+
+func TestUnidirectionalStream(t *testing.T) {
+	ctx := testContext(t)
+	client, server := newLoopback(t)
+
+	ss, err := server.OpenUniStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenUniStreamSync() unexpected error: %v", err)
+	}
+	ss.Write([]byte("object"))
+	ss.Close()
+
+	cs, err := client.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptUniStream() unexpected error: %v", err)
+	}
+	got, err := io.ReadAll(cs)
+	if err != nil || string(got) != "object" {
+		t.Errorf("client read got = %q, %v, want \"object\"", got, err)
+	}
+}
+
+func TestDatagrams(t *testing.T) {
+	ctx := testContext(t)
+	client, server := newLoopback(t)
+
+	if err := client.SendDatagram([]byte("datagram")); err != nil {
+		t.Fatalf("SendDatagram() unexpected error: %v", err)
+	}
+	got, err := server.ReceiveDatagram(ctx)
+	if err != nil || string(got) != "datagram" {
+		t.Errorf("ReceiveDatagram() got = %q, %v, want \"datagram\"", got, err)
+	}
+}
+
+// Stream resets are reported as *quic.StreamError with the code of the peer, like the QUIC transport does.
+func TestStreamCancellation(t *testing.T) {
+	ctx := testContext(t)
+	client, server := newLoopback(t)
+
+	// RESET_STREAM fails the reads of the peer
+	cs, err := client.OpenUniStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenUniStreamSync() unexpected error: %v", err)
+	}
+	cs.Write([]byte("partial"))
+	cs.CancelWrite(5)
+	ss, err := server.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptUniStream() unexpected error: %v", err)
+	}
+	_, err = io.ReadAll(ss)
+	var streamErr *quic.StreamError
+	if !errors.As(err, &streamErr) || streamErr.ErrorCode != 5 || !streamErr.Remote {
+		t.Errorf("Read() after the reset error = %v, want a remote *quic.StreamError with code 5", err)
+	}
+
+	// STOP_SENDING fails the writes of the peer
+	bidi, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync() unexpected error: %v", err)
+	}
+	bidi.Write([]byte("request"))
+	peerBidi, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() unexpected error: %v", err)
+	}
+	peerBidi.CancelRead(7)
+	for ctx.Err() == nil {
+		if _, err = bidi.Write([]byte("more")); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.As(err, &streamErr) || streamErr.ErrorCode != 7 || !streamErr.Remote {
+		t.Errorf("Write() after STOP_SENDING error = %v, want a remote *quic.StreamError with code 7", err)
+	}
+}
+
+// Closing the session is reported as *quic.ApplicationError with the code and reason of the peer, like the QUIC transport does.
+func TestCloseWithError(t *testing.T) {
+	ctx := testContext(t)
+	client, server := newLoopback(t)
+
+	cs, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync() unexpected error: %v", err)
+	}
+	cs.Write([]byte("ping"))
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() unexpected error: %v", err)
+	}
+
+	// The stream resets may overtake the close of the session, the read is blocked before either arrives
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(cs)
+		read <- err
+	}()
+	if err := server.CloseWithError(0x10, "Going away"); err != nil {
+		t.Fatalf("CloseWithError() unexpected error: %v", err)
+	}
+
+	var appErr *quic.ApplicationError
+	select {
+	case err = <-read:
+	case <-ctx.Done():
+		t.Fatalf("Read() wasn't failed by the close")
+	}
+	if !errors.As(err, &appErr) || appErr.ErrorCode != 0x10 || appErr.ErrorMessage != "Going away" || !appErr.Remote {
+		t.Errorf("Read() after the close error = %v, want a remote *quic.ApplicationError with code 0x10 and the reason", err)
+	}
+
+	// The streams of the closing end fail alike
+	_, err = io.ReadAll(ss)
+	if !errors.As(err, &appErr) || appErr.ErrorCode != 0x10 || appErr.Remote {
+		t.Errorf("Read() on the closing end error = %v, want a local *quic.ApplicationError with code 0x10", err)
+	}
+}
+
+// Only a reset with WT_SESSION_GONE waits for the session to close, other errors are returned right away.
+func TestToQuicErrorDoesNotWait(t *testing.T) {
+	client, _ := newLoopback(t)
+
+	other := errors.New("deadline exceeded")
+	start := time.Now()
+	if err := toQuicError(client.Session, other); err != other {
+		t.Errorf("toQuicError() = %v, want the error as is", err)
+	}
+	if elapsed := time.Since(start); elapsed >= sessionCloseTimeout/2 {
+		t.Errorf("toQuicError() took %v for an error unrelated to the session", elapsed)
+	}
+
+	gone := fmt.Errorf("stream reset, but failed to convert stream error %d: %w", sessionGoneErrorCode, errors.New("error code outside of expected range"))
+	if !isSessionGone(gone) || isSessionGone(other) {
+		t.Errorf("isSessionGone() doesn't tell WT_SESSION_GONE from other errors")
+	}
+}
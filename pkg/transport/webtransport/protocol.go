@@ -0,0 +1,30 @@
+package moqtwebtransport
+
+import "strings"
+
+// MOQT is negotiated as a WebTransport application protocol. [Cite: Section 3.1]
+// The client offers it with "WT-Available-Protocols" and the server confirms it with "WT-Protocol", both are Structured Field strings.
+const (
+	HeaderAvailableProtocols = "WT-Available-Protocols"
+	HeaderProtocol           = "WT-Protocol"
+	Protocol                 = "moqt-15"
+)
+
+// Value of the WT-Available-Protocols / WT-Protocol headers
+func ProtocolHeaderValue() string {
+	return `"` + Protocol + `"`
+}
+
+// OffersProtocol reports whether the given WT-Available-Protocols header values include MOQT.
+// Values are a Structured Field list of strings, e.g. `"moqt-15", "other"`, parameters after ';' are ignored.
+func OffersProtocol(values []string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item, _, _ = strings.Cut(strings.TrimSpace(item), ";")
+			if strings.Trim(item, `"`) == Protocol {
+				return true
+			}
+		}
+	}
+	return false
+}
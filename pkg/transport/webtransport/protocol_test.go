@@ -0,0 +1,25 @@
+package moqtwebtransport
+
+import "testing"
+
+func TestOffersProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected bool
+	}{
+		{"Single protocol", []string{`"moqt-15"`}, true},
+		{"List with parameters", []string{`"other";q=1, "moqt-15";a=b`}, true},
+		{"Spread over multiple header lines", []string{`"other"`, `"moqt-15"`}, true},
+		{"Other draft version", []string{`"moqt-14"`}, false},
+		{"Header missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OffersProtocol(tt.values); got != tt.expected {
+				t.Errorf("OffersProtocol(%q) got = %v, want %v", tt.values, got, tt.expected)
+			}
+		})
+	}
+}
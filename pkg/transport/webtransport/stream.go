@@ -0,0 +1,141 @@
+package moqtwebtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+// "transport.Stream", "transport.SendStream", "transport.ReceiveStream" are provided with webtransport here.
+// WebTransport stream error codes are 32 bits, they are mapped into the HTTP/3 error space by webtransport-go.
+// Errors of Read and Write are reported like the ones of quic-go, so the session handles both transports alike.
+
+// How long a stream reset with WT_SESSION_GONE waits for its session to close, see toQuicError
+const sessionCloseTimeout = time.Second
+
+// WT_SESSION_GONE, the code the streams of a closed session are reset with. webtransport-go exports neither the code
+// nor the *quic.StreamError of such a reset, the code can't be converted into a WebTransport one and only the message tells it.
+const sessionGoneErrorCode quic.StreamErrorCode = 0x170d7b68
+
+type SendStream struct {
+	stream *webtransport.SendStream
+	sess   *webtransport.Session
+}
+
+// moqtwebtransport.SendStream implements transport.SendStream
+
+// io.Writer implementation
+func (s *SendStream) Write(p []byte) (n int, err error) {
+	n, err = s.stream.Write(p)
+	return n, toQuicError(s.sess, err)
+}
+
+// io.Closer implementation
+func (s *SendStream) Close() error {
+	return s.stream.Close()
+}
+
+// CancelWrite implementation
+func (s *SendStream) CancelWrite(code quic.StreamErrorCode) {
+	s.stream.CancelWrite(webtransport.StreamErrorCode(code))
+}
+
+type ReceiveStream struct {
+	stream *webtransport.ReceiveStream
+	sess   *webtransport.Session
+}
+
+// moqtwebtransport.ReceiveStream implements transport.ReceiveStream
+
+// io.Reader implementation
+func (s *ReceiveStream) Read(p []byte) (n int, err error) {
+	n, err = s.stream.Read(p)
+	return n, toQuicError(s.sess, err)
+}
+
+// CancelRead implementation
+func (s *ReceiveStream) CancelRead(code quic.StreamErrorCode) {
+	s.stream.CancelRead(webtransport.StreamErrorCode(code))
+}
+
+type Stream struct {
+	stream *webtransport.Stream
+	sess   *webtransport.Session
+}
+
+// moqtwebtransport.Stream implements transport.Stream
+
+// io.Reader implementation
+func (s *Stream) Read(p []byte) (n int, err error) {
+	n, err = s.stream.Read(p)
+	return n, toQuicError(s.sess, err)
+}
+
+// CancelRead implementation
+func (s *Stream) CancelRead(code quic.StreamErrorCode) {
+	s.stream.CancelRead(webtransport.StreamErrorCode(code))
+}
+
+// io.Writer implementation
+func (s *Stream) Write(p []byte) (n int, err error) {
+	n, err = s.stream.Write(p)
+	return n, toQuicError(s.sess, err)
+}
+
+// io.Closer implementation
+func (s *Stream) Close() error {
+	return s.stream.Close()
+}
+
+// CancelWrite implementation
+func (s *Stream) CancelWrite(code quic.StreamErrorCode) {
+	s.stream.CancelWrite(webtransport.StreamErrorCode(code))
+}
+
+// Converts the stream and session errors of webtransport-go into the equivalent errors of quic-go, anything else is returned as is.
+// When the session closes, its streams are reset with WT_SESSION_GONE. The error the session was closed with is returned instead,
+// once the session learned about it.
+func toQuicError(sess *webtransport.Session, err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	var streamErr *webtransport.StreamError
+	if errors.As(err, &streamErr) {
+		return &quic.StreamError{ErrorCode: quic.StreamErrorCode(streamErr.ErrorCode), Remote: streamErr.Remote}
+	}
+	var sessionErr *webtransport.SessionError
+	if !errors.As(err, &sessionErr) && !(isSessionGone(err) && errors.As(sessionCloseError(sess), &sessionErr)) {
+		return err
+	}
+	return &quic.ApplicationError{
+		ErrorCode:    quic.ApplicationErrorCode(sessionErr.ErrorCode),
+		Remote:       sessionErr.Remote,
+		ErrorMessage: sessionErr.Message,
+	}
+}
+
+// Reports whether the stream was reset with WT_SESSION_GONE, as webtransport-go reports it.
+func isSessionGone(err error) bool {
+	return strings.Contains(err.Error(), fmt.Sprintf("failed to convert stream error %d:", sessionGoneErrorCode))
+}
+
+// Returns the error the session was closed with, nil if it doesn't close within sessionCloseTimeout.
+// The CLOSE_WEBTRANSPORT_SESSION capsule may arrive after the resets of the streams.
+func sessionCloseError(sess *webtransport.Session) error {
+	select {
+	case <-sess.Context().Done():
+	case <-time.After(sessionCloseTimeout):
+		return nil
+	}
+	// A closed session returns the error it was closed with right away, without accepting a stream
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := sess.AcceptUniStream(ctx)
+	return err
+}
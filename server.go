@@ -9,10 +9,15 @@ import (
 	"go-moq/pkg/session/control"
 	"go-moq/pkg/transport"
 	moqtquic "go-moq/pkg/transport/quic"
+	moqtwebtransport "go-moq/pkg/transport/webtransport"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 )
 
 const serverDefaultMaxIncomingRequestId = 1000
@@ -20,7 +25,15 @@ const serverDefaultMaxLocalTokenCacheSize = 0
 
 type Server struct {
 	MaxUniStreamsPerConn        int
+	MaxBidiStreamsPerConn       int // The control stream and one stream for every SUBSCRIBE_NAMESPACE of the client, 0 uses the QUIC default
 	WaitForControlStreamTimeout time.Duration
+	Authorizer                  session.Authorizer // Consulted for the CLIENT_SETUP and every request of each client, nil accepts any client
+
+	// Sessions initiated by InitateSession that didn't terminate yet, so Drain can reach them
+	mu       sync.Mutex
+	sessions map[*session.Session]struct{}
+	draining bool
+	drainURI string
 }
 
 // Starts a while-true loop that accepts connections, sends accepted connection over the channel to get handled by the caller
@@ -44,7 +57,7 @@ func (s *Server) Run(ctx context.Context, uri string, certFile string, keyFile s
 		}
 		quicConf := &quic.Config{
 			EnableDatagrams:       true,
-			MaxIncomingStreams:    1,
+			MaxIncomingStreams:    int64(s.MaxBidiStreamsPerConn),
 			MaxIncomingUniStreams: int64(s.MaxUniStreamsPerConn),
 		}
 
@@ -81,10 +94,73 @@ func (s *Server) Run(ctx context.Context, uri string, certFile string, keyFile s
 			}
 		}
 
-	case "https":
-		// WebTransport implementation would go here
-		// It would need an http.Handler that pushes to connCh
-		return nil
+	case "https": // WebTransport Connection
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+		addr := u.Host
+		if u.Port() == "" {
+			addr = u.Host + ":443"
+		}
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+
+		mux := http.NewServeMux()
+		wtServer := &webtransport.Server{
+			H3: http3.Server{
+				Addr:      addr,
+				TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}), // ALPN is HTTP/3
+				QUICConfig: &quic.Config{
+					EnableDatagrams:       true,
+					MaxIncomingUniStreams: int64(s.MaxUniStreamsPerConn),
+					// MaxIncomingStreams is left at the default, HTTP/3 request streams (the CONNECT) count against it as well.
+				},
+				Handler: mux,
+			},
+		}
+
+		// Every accepted CONNECT request becomes a WebTransport session that is handed to the caller, exactly like QUIC connections.
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			// The client MUST offer moqt-15 in WT-Available-Protocols [Cite: Section 3.1]
+			if !moqtwebtransport.OffersProtocol(r.Header.Values(moqtwebtransport.HeaderAvailableProtocols)) {
+				fmt.Printf("[WARN] Rejecting WebTransport session from %s: %s was not offered\n", r.RemoteAddr, moqtwebtransport.Protocol)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set(moqtwebtransport.HeaderProtocol, moqtwebtransport.ProtocolHeaderValue())
+
+			wtSess, err := wtServer.Upgrade(w, r)
+			if err != nil {
+				fmt.Printf("[WARN] Upgrading to WebTransport failed: %v\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// Send to the caller.
+			// This will BLOCK if the caller is too slow and the channel is full.
+			select {
+			case connCh <- &moqtwebtransport.Connection{Session: wtSess}:
+				// Successfully handed off
+			case <-ctx.Done():
+				wtSess.CloseWithError(0, "Server is shutting down")
+			}
+		})
+
+		go func() {
+			<-ctx.Done()
+			wtServer.Close()
+		}()
+
+		fmt.Printf("[INFO] Listening for WebTransport on %s%s\n", addr, path)
+
+		if err := wtServer.ListenAndServe(); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to serve WebTransport on %s: %w", addr, err)
+		}
+		return ctx.Err()
 
 	default:
 		return nil
@@ -104,20 +180,94 @@ func (s *Server) InitateSession(parentCtx context.Context, conn transport.MOQTCo
 	}
 	fmt.Printf("[INFO]: Server.InitiateSession(): Accepted control stream from client: %s\n", conn.RemoteHost())
 
-	sess := &session.Session{
-		State:         session.NewSessionState(session.RoleServer, serverDefaultMaxIncomingRequestId, serverDefaultMaxLocalTokenCacheSize),
-		Conn:          conn,
-		ControlStream: stream,
-		Cmf:           control.NewControlMessageFactory(stream),
-	}
+	sess := session.NewSession(conn, stream, session.NewSessionState(session.RoleServer, serverDefaultMaxIncomingRequestId, serverDefaultMaxLocalTokenCacheSize))
 
 	err = s.performHandshake(sess, setupParams)
 	if err != nil {
 		return nil, err
 	}
+	if s.Authorizer != nil {
+		sess.SetAuthorizer(s.Authorizer)
+	}
+	s.track(sess)
 	return sess, nil
 }
 
+// Keeps track of the session until it terminates, sessions initiated while draining are told to go away right away.
+func (s *Server) track(sess *session.Session) {
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[*session.Session]struct{})
+	}
+	s.sessions[sess] = struct{}{}
+	draining, drainURI := s.draining, s.drainURI
+	s.mu.Unlock()
+
+	go func() {
+		<-sess.Done()
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+	}()
+
+	if draining {
+		if err := sess.GoAway(drainURI); err != nil {
+			fmt.Printf("[WARN]: Server.InitiateSession(): Failed to send GOAWAY to %s: %v\n", sess.Conn.RemoteHost(), err)
+		}
+	}
+}
+
+// Drain sends GOAWAY with the given New Session URI (may be empty) to every session, sessions initiated later get it right after the handshake.
+// It blocks until all sessions are closed by their clients, when ctx is done first the remaining ones are closed with GOAWAY_TIMEOUT.
+// Accepting connections is not stopped, cancel the context of Run for that.
+func (s *Server) Drain(ctx context.Context, newSessionURI string) error {
+	s.mu.Lock()
+	s.draining = true
+	s.drainURI = newSessionURI
+	s.mu.Unlock()
+
+	for _, sess := range s.liveSessions() {
+		if err := sess.GoAway(newSessionURI); err != nil {
+			fmt.Printf("[WARN]: Server.Drain(): Failed to send GOAWAY to %s: %v\n", sess.Conn.RemoteHost(), err)
+		}
+	}
+
+	for {
+		remaining := s.liveSessions()
+		if len(remaining) == 0 {
+			return nil
+		}
+
+		select {
+		case <-remaining[0].Done():
+		case <-ctx.Done():
+			for _, sess := range remaining {
+				sess.CloseWithError(model.MOQT_SESSION_TERMINATION_ERROR{
+					ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_GOAWAY_TIMEOUT,
+					ReasonPhrase: model.NewReasonPhrase("The session was not closed in time after GOAWAY"),
+				})
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// Returns the tracked sessions that didn't terminate yet.
+func (s *Server) liveSessions() []*session.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]*session.Session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		select {
+		case <-sess.Done():
+		default:
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
 func (s *Server) performHandshake(sess *session.Session, setupParams []model.MoqtKeyValuePair) error { // setup params we
 	// This specification only specifies two uses of bidirectional streams, the control stream, which begins with CLIENT_SETUP, and SUBSCRIBE_NAMESPACE. Bidirectional streams
 	// MUST NOT begin with any other message type unless negotiated. If they do, the peer MUST close the Session with a Protocol Violation.
@@ -164,8 +314,40 @@ func (s *Server) performHandshake(sess *session.Session, setupParams []model.Moq
 		}
 	}
 
+	// With WebTransport the path and authority are those of the CONNECT request, the client MUST NOT send them
+	if sess.Conn.IsWebTransport() {
+		for _, param := range clientSetupMsg.Parameters {
+			var err error
+			if param.Type == control.SetupParamPath {
+				err = model.MOQT_SESSION_TERMINATION_ERROR{
+					ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_PATH,
+					ReasonPhrase: model.NewReasonPhrase("CLIENT_SETUP message MUST NOT include Path parameter over WebTransport."),
+				}
+			} else if param.Type == control.SetupParamAuthority {
+				err = model.MOQT_SESSION_TERMINATION_ERROR{
+					ErrorCode:    model.MOQT_SESSION_TERMINATION_ERROR_CODE_INVALID_AUTHORITY,
+					ReasonPhrase: model.NewReasonPhrase("CLIENT_SETUP message MUST NOT include Authority parameter over WebTransport."),
+				}
+			}
+			if err != nil {
+				sess.CloseWithError(err)
+				return err
+			}
+		}
+	}
+
 	// Populate session state's peer values from obtained parameters in CLIENT_SETUP
-	sess.State.FromParams(clientSetupMsg.Parameters)
+	if err := sess.State.FromParams(clientSetupMsg.Parameters); err != nil {
+		return err
+	}
+
+	// The client learns why it was turned away from the code the connection is closed with
+	if s.Authorizer != nil {
+		if err := sess.AuthorizeSetup(s.Authorizer); err != nil {
+			sess.CloseWithError(err)
+			return err
+		}
+	}
 
 	// Send SERVER_SETUP message
 	ssMsg := control.ServerSetupMessage{